@@ -23,8 +23,8 @@ func CreateAccount(svc *services.BillingAccountService) http.HandlerFunc {
 // @Accept json
 // @Produce json
 // @Success 200 {array} models.Account
-// @Failure 401 {object} string
-// @Failure 500 {object} string
+// @Failure 401 {object} services.Problem
+// @Failure 500 {object} services.Problem
 // @Router /accounts [get]
 func GetAccounts(svc *services.BillingAccountService) http.HandlerFunc {
 
@@ -42,10 +42,10 @@ func GetAccounts(svc *services.BillingAccountService) http.HandlerFunc {
 // @Produce json
 // @Param id path string true "Account ID"
 // @Success 200 {object} models.Account
-// @Failure 400 {object} string
-// @Failure 401 {object} string
-// @Failure 404 {object} string
-// @Failure 500 {object} string
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 404 {object} services.Problem
+// @Failure 500 {object} services.Problem
 // @Router /accounts/{id} [get]
 func GetAccount(svc *services.BillingAccountService) http.HandlerFunc {
 
@@ -56,6 +56,22 @@ func GetAccount(svc *services.BillingAccountService) http.HandlerFunc {
 }
 
 // DeleteAccount handles HTTP requests for deleting an account.
+// @Summary Delete a billing account
+// @Description Delete an account. An account with workspaces is refused with 409 unless cascade is true, in which case the account is marked Closing, its workspaces are deleted and the account is removed once they have all gone. Only the account owner or a hub admin can delete an account.
+// @Tags Billing and Billing Accounts
+// @Param id path string true "Account ID"
+// @Param cascade query bool false "Delete the account's workspaces too"
+// @Param If-Match header string false "ETag of the account being deleted"
+// @Success 202
+// @Success 204
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 404 {object} services.Problem
+// @Failure 409 {object} services.Problem
+// @Failure 412 {object} services.Problem
+// @Failure 500 {object} services.Problem
+// @Router /accounts/{id} [delete]
 func DeleteAccount(svc *services.BillingAccountService) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -65,6 +81,23 @@ func DeleteAccount(svc *services.BillingAccountService) http.HandlerFunc {
 }
 
 // UpdateAccount handles HTTP requests for updating an account.
+// @Summary Update a billing account
+// @Description Change the name, billing address, organisation name or opening reason of an account. Fields omitted from the body keep their current values, and the owner and status cannot be changed. Send the ETag the account was read with in If-Match to fail with 412 if it has changed since. Only the account owner or a hub admin can update an account.
+// @Tags Billing and Billing Accounts
+// @Accept json
+// @Produce json
+// @Param id path string true "Account ID"
+// @Param If-Match header string false "ETag of the account being updated"
+// @Param account body models.Account true "Account fields to change"
+// @Success 200 {object} models.Account
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 404 {object} services.Problem
+// @Failure 412 {object} services.Problem
+// @Failure 422 {object} services.Problem
+// @Failure 500 {object} services.Problem
+// @Router /accounts/{id} [put]
 func UpdateAccount(svc *services.BillingAccountService) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -73,16 +106,30 @@ func UpdateAccount(svc *services.BillingAccountService) http.HandlerFunc {
 	}
 }
 
-// ApproveAccount handles account approval requests
-func AccountStatusHandler(svc *services.BillingAccountService, accountStatusRequest string) http.HandlerFunc {
+// @Summary Approve or deny a pending account
+// @Description Approve or deny an account awaiting approval and email the decision to its owner. A reason is required to deny an account and is included in the email. The decision is recorded with who made it and when. Only hub admins can decide on accounts.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param account-id path string true "Account ID"
+// @Param decision body models.AccountDecisionRequest true "Decision and reason"
+// @Success 200 {object} models.AccountDecision
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 404 {object} services.Problem
+// @Failure 409 {object} services.Problem
+// @Failure 422 {object} services.Problem
+// @Failure 500 {object} services.Problem
+// @Router /admin/accounts/{account-id}/decision [post]
+func DecideAccount(svc *services.BillingAccountService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		// Get a token from keycloak so we can interact with it's API
-		if !ensureKeycloakToken(w, svc.KC) {
+		if !ensureKeycloakToken(w, r, svc.KC) {
 			return
 		}
 
-		svc.AccountApprovalService(w, r, accountStatusRequest)
-
+		svc.AccountDecisionService(w, r)
 	}
 }
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/EO-DataHub/eodhp-workspace-services/api/services"
+)
+
+// @Summary List all accounts
+// @Description List the accounts of every user with the number of workspaces of each. Only hub admins can list all accounts. A Link header gives the URL of the next page, if there is one.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param status query string false "Only list accounts with this status"
+// @Param owner query string false "Only list accounts owned by this user"
+// @Param organization query string false "Only list accounts whose organisation name contains this text"
+// @Param sort query string false "Field to sort by: created_at, name, owner, organization or status" default(created_at)
+// @Param order query string false "Sort order: asc or desc" default(asc)
+// @Param limit query int false "Maximum number of accounts to return (1-100)" default(50)
+// @Param cursor query string false "Cursor from the Link header of the previous page"
+// @Success 200 {array} models.AdminAccount
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 500 {object} services.Problem
+// @Router /admin/accounts [get]
+func AdminListAccounts(svc *services.AdminService) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		svc.ListAccountsService(w, r)
+	}
+}
+
+// @Summary List the accounts awaiting approval
+// @Description List the accounts that have not been approved or denied yet, oldest first by default. Only hub admins can list pending accounts. A Link header gives the URL of the next page, if there is one.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param owner query string false "Only list accounts owned by this user"
+// @Param organization query string false "Only list accounts whose organisation name contains this text"
+// @Param sort query string false "Field to sort by: created_at, name, owner, organization or status" default(created_at)
+// @Param order query string false "Sort order: asc or desc" default(asc)
+// @Param limit query int false "Maximum number of accounts to return (1-100)" default(50)
+// @Param cursor query string false "Cursor from the Link header of the previous page"
+// @Success 200 {array} models.AdminAccount
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 500 {object} services.Problem
+// @Router /admin/accounts/pending [get]
+func AdminListPendingAccounts(svc *services.AdminService) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		svc.ListPendingAccountsService(w, r)
+	}
+}
+
+// @Summary List all workspaces
+// @Description List the workspaces of every account with the number of members of each. Deleted workspaces are only listed when filtering by the Unavailable status. Only hub admins can list all workspaces. A Link header gives the URL of the next page, if there is one.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param status query string false "Only list workspaces with this status"
+// @Param account query string false "Only list workspaces of this account ID"
+// @Param created_before query string false "Only list workspaces created before this RFC 3339 time"
+// @Param created_after query string false "Only list workspaces created after this RFC 3339 time"
+// @Param sort query string false "Field to sort by: created_at, name, status or last_updated" default(created_at)
+// @Param order query string false "Sort order: asc or desc" default(asc)
+// @Param limit query int false "Maximum number of workspaces to return (1-100)" default(50)
+// @Param cursor query string false "Cursor from the Link header of the previous page"
+// @Success 200 {array} models.AdminWorkspace
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 500 {object} services.Problem
+// @Router /admin/workspaces [get]
+func AdminListWorkspaces(svc *services.AdminService) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Get a token from keycloak so we can interact with it's API
+		if !ensureKeycloakToken(w, r, svc.KC) {
+			return
+		}
+
+		svc.ListWorkspacesService(w, r)
+	}
+}
+
+// @Summary Suspend an account
+// @Description Suspend an approved account. Its workspaces and data are kept, but no workspaces can be created for it, no files uploaded to them and no credentials or sessions issued for them until it is reactivated. The change is recorded and the account owner is emailed. Only hub admins can suspend accounts.
+// @Tags Admin
+// @Accept json
+// @Param account-id path string true "Account ID"
+// @Param reason body models.AccountStatusChangeRequest false "Reason for the change, shown to the account owner"
+// @Success 204
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 404 {object} services.Problem
+// @Failure 409 {object} services.Problem
+// @Failure 422 {object} services.Problem
+// @Failure 500 {object} services.Problem
+// @Router /admin/accounts/{account-id}/suspend [post]
+func AdminSuspendAccount(svc *services.AdminService) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if !ensureKeycloakToken(w, r, svc.KC) {
+			return
+		}
+
+		svc.SuspendAccountService(w, r)
+	}
+}
+
+// @Summary Close an account
+// @Description Close an approved or suspended account, keeping its workspaces and data. Like a suspended account, it cannot be used until it is reactivated. The change is recorded and the account owner is emailed. Only hub admins can close accounts.
+// @Tags Admin
+// @Accept json
+// @Param account-id path string true "Account ID"
+// @Param reason body models.AccountStatusChangeRequest false "Reason for the change, shown to the account owner"
+// @Success 204
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 404 {object} services.Problem
+// @Failure 409 {object} services.Problem
+// @Failure 422 {object} services.Problem
+// @Failure 500 {object} services.Problem
+// @Router /admin/accounts/{account-id}/close [post]
+func AdminCloseAccount(svc *services.AdminService) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if !ensureKeycloakToken(w, r, svc.KC) {
+			return
+		}
+
+		svc.CloseAccountService(w, r)
+	}
+}
+
+// @Summary Reactivate an account
+// @Description Approve a suspended or closed account again. The change is recorded and the account owner is emailed. Only hub admins can reactivate accounts.
+// @Tags Admin
+// @Accept json
+// @Param account-id path string true "Account ID"
+// @Param reason body models.AccountStatusChangeRequest false "Reason for the change, shown to the account owner"
+// @Success 204
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 404 {object} services.Problem
+// @Failure 409 {object} services.Problem
+// @Failure 422 {object} services.Problem
+// @Failure 500 {object} services.Problem
+// @Router /admin/accounts/{account-id}/reactivate [post]
+func AdminReactivateAccount(svc *services.AdminService) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if !ensureKeycloakToken(w, r, svc.KC) {
+			return
+		}
+
+		svc.ReactivateAccountService(w, r)
+	}
+}
+
+// @Summary List the status changes of an account
+// @Description List every change to the status of an account, oldest first, with who made it and why. Changes are kept after the account is deleted. Only hub admins can list status changes.
+// @Tags Admin
+// @Produce json
+// @Param account-id path string true "Account ID"
+// @Success 200 {array} models.AccountStatusChange
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 500 {object} services.Problem
+// @Router /admin/accounts/{account-id}/status-changes [get]
+func AdminListAccountStatusChanges(svc *services.AdminService) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		svc.ListAccountStatusChangesService(w, r)
+	}
+}
+
+// @Summary Suspend a workspace
+// @Description Suspend a workspace. Its status is reported as Suspended until it is reactivated. Only hub admins can suspend workspaces.
+// @Tags Admin
+// @Param workspace-id path string true "Workspace ID"
+// @Success 204
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 404 {object} services.Problem
+// @Failure 409 {object} services.Problem
+// @Failure 500 {object} services.Problem
+// @Router /admin/workspaces/{workspace-id}/suspend [post]
+func AdminSuspendWorkspace(svc *services.AdminService) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		svc.SuspendWorkspaceService(w, r)
+	}
+}
+
+// @Summary Reactivate a workspace
+// @Description Lift the suspension of a workspace. Only hub admins can reactivate workspaces.
+// @Tags Admin
+// @Param workspace-id path string true "Workspace ID"
+// @Success 204
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 404 {object} services.Problem
+// @Failure 409 {object} services.Problem
+// @Failure 500 {object} services.Problem
+// @Router /admin/workspaces/{workspace-id}/reactivate [post]
+func AdminReactivateWorkspace(svc *services.AdminService) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		svc.ReactivateWorkspaceService(w, r)
+	}
+}
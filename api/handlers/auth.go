@@ -1,14 +1,19 @@
 package handlers
 
-import "net/http"
+import (
+	"context"
+	"net/http"
+
+	services "github.com/EO-DataHub/eodhp-workspace-services/api/services"
+)
 
 type tokenRefresher interface {
-	GetToken() error
+	GetToken(ctx context.Context) error
 }
 
-func ensureKeycloakToken(w http.ResponseWriter, kc tokenRefresher) bool {
-	if err := kc.GetToken(); err != nil {
-		http.Error(w, "Authentication failed.", http.StatusInternalServerError)
+func ensureKeycloakToken(w http.ResponseWriter, r *http.Request, kc tokenRefresher) bool {
+	if err := kc.GetToken(r.Context()); err != nil {
+		services.WriteError(w, r, http.StatusInternalServerError, services.CodeUpstreamError, "Authentication failed.")
 		return false
 	}
 	return true
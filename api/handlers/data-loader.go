@@ -8,6 +8,7 @@ import (
 
 	services "github.com/EO-DataHub/eodhp-workspace-services/api/services"
 	"github.com/EO-DataHub/eodhp-workspace-services/internal/appconfig"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authz"
 	awsclient "github.com/EO-DataHub/eodhp-workspace-services/internal/aws"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -27,29 +28,21 @@ type DataLoaderFilesDelete struct {
 	Keys []string `json:"keys"`
 }
 
-func resolveDataLoaderS3Credentials(appCfg *appconfig.Config, c STSClient, k services.KeycloakClient, r *http.Request) (awsclient.S3Credentials, int, error) {
+func resolveDataLoaderS3Credentials(appCfg *appconfig.Config, c STSClient, k services.KeycloakClient, r *http.Request) (awsclient.S3Credentials, error) {
 	// Local/dev override: use static S3 keys when provided instead of STS.
 	if appCfg.AWS.S3.AccessKey != "" && appCfg.AWS.S3.SecretKey != "" {
 		return awsclient.S3Credentials{
 			AccessKeyId:     appCfg.AWS.S3.AccessKey,
 			SecretAccessKey: appCfg.AWS.S3.SecretKey,
 			SessionToken:    "",
-		}, http.StatusOK, nil
+		}, nil
 	}
 
-	creds, err := GetS3Credentials(appCfg.AWS.S3.RoleArn, c, k, r)
-	if err != nil {
-		if httpErr, ok := err.(*services.HTTPError); ok {
-			return awsclient.S3Credentials{}, httpErr.Status, err
-		}
-		return awsclient.S3Credentials{}, http.StatusInternalServerError, err
-	}
-
-	return creds, http.StatusOK, nil
+	return GetS3Credentials(appCfg.AWS.S3.RoleArn, c, k, r)
 }
 
 // AddFileDataLoader is a handler that uploads a file to S3
-func AddFileDataLoader(appCfg *appconfig.Config, c STSClient, k services.KeycloakClient) http.HandlerFunc {
+func AddFileDataLoader(appCfg *appconfig.Config, c STSClient, k services.KeycloakClient, a authz.Authorizer) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
@@ -59,11 +52,15 @@ func AddFileDataLoader(appCfg *appconfig.Config, c STSClient, k services.Keycloa
 		// Extract the workspace ID from the request URL path
 		workspaceID := mux.Vars(r)["workspace-id"]
 
+		if !authorizeWorkspace(w, r, a, authz.ActionFilesWrite) {
+			return
+		}
+
 		// Parse the payload
 		var payload DataLoaderFileUpload
 		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 			logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Error decoding payload")
-			http.Error(w, fmt.Sprintf("Error decoding payload: %v", err), http.StatusBadRequest)
+			services.WriteError(w, r, http.StatusBadRequest, services.CodeInvalidRequest, fmt.Sprintf("Error decoding payload: %v", err))
 			return
 		}
 
@@ -72,9 +69,9 @@ func AddFileDataLoader(appCfg *appconfig.Config, c STSClient, k services.Keycloa
 		// Create a prefix for storing eodh-config files
 		objectKey := fmt.Sprintf("%s/%s/%s", workspaceID, "eodh-config", payload.FileName)
 
-		creds, status, err := resolveDataLoaderS3Credentials(appCfg, c, k, r)
+		creds, err := resolveDataLoaderS3Credentials(appCfg, c, k, r)
 		if err != nil {
-			http.Error(w, err.Error(), status)
+			services.WriteHTTPError(w, r, err)
 			return
 		}
 
@@ -89,7 +86,7 @@ func AddFileDataLoader(appCfg *appconfig.Config, c STSClient, k services.Keycloa
 
 		if err != nil {
 			logger.Error().Err(err).Msg("Failed to load AWS config")
-			http.Error(w, "Failed to configure S3 client", http.StatusInternalServerError)
+			services.WriteError(w, r, http.StatusInternalServerError, services.CodeInternal, "Failed to configure S3 client")
 			return
 		}
 
@@ -104,7 +101,7 @@ func AddFileDataLoader(appCfg *appconfig.Config, c STSClient, k services.Keycloa
 		})
 		if err != nil {
 			logger.Error().Err(err).Msg("Failed to upload file to S3")
-			http.Error(w, "Failed to upload file", http.StatusInternalServerError)
+			services.WriteError(w, r, http.StatusInternalServerError, services.CodeInternal, "Failed to upload file")
 			return
 		}
 
@@ -119,7 +116,7 @@ func AddFileDataLoader(appCfg *appconfig.Config, c STSClient, k services.Keycloa
 }
 
 // DeleteFileDataLoader is a handler that deletes files from S3
-func DeleteFileDataLoader(appCfg *appconfig.Config, c STSClient, k services.KeycloakClient) http.HandlerFunc {
+func DeleteFileDataLoader(appCfg *appconfig.Config, c STSClient, k services.KeycloakClient, a authz.Authorizer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		logger := zerolog.Ctx(ctx).With().Str("role arn", appCfg.AWS.S3.RoleArn).Logger()
@@ -127,22 +124,27 @@ func DeleteFileDataLoader(appCfg *appconfig.Config, c STSClient, k services.Keyc
 		workspaceID := mux.Vars(r)["workspace-id"]
 		bucket := appCfg.AWS.S3.Bucket
 
+		if !authorizeWorkspace(w, r, a, authz.ActionFilesWrite) {
+			return
+		}
+
 		var payload DataLoaderFilesDelete
 		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 			logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Error decoding payload")
-			http.Error(w, fmt.Sprintf("Error decoding payload: %v", err), http.StatusBadRequest)
+			services.WriteError(w, r, http.StatusBadRequest, services.CodeInvalidRequest, fmt.Sprintf("Error decoding payload: %v", err))
 			return
 		}
 
 		if len(payload.Keys) == 0 {
-			http.Error(w, "No keys provided for deletion", http.StatusBadRequest)
+			services.WriteProblem(w, r, services.NewProblem(http.StatusBadRequest, services.CodeValidationFailed, "No keys provided for deletion").
+				WithFieldErrors(services.FieldError{Field: "keys", Message: "must not be empty"}))
 			return
 		}
 
 		// Get credentials (static local/dev credentials or STS credentials)
-		creds, status, err := resolveDataLoaderS3Credentials(appCfg, c, k, r)
+		creds, err := resolveDataLoaderS3Credentials(appCfg, c, k, r)
 		if err != nil {
-			http.Error(w, err.Error(), status)
+			services.WriteHTTPError(w, r, err)
 			return
 		}
 
@@ -155,7 +157,7 @@ func DeleteFileDataLoader(appCfg *appconfig.Config, c STSClient, k services.Keyc
 		)
 		if err != nil {
 			logger.Error().Err(err).Msg("Failed to load AWS config")
-			http.Error(w, "Failed to configure S3 client", http.StatusInternalServerError)
+			services.WriteError(w, r, http.StatusInternalServerError, services.CodeInternal, "Failed to configure S3 client")
 			return
 		}
 
@@ -175,7 +177,7 @@ func DeleteFileDataLoader(appCfg *appconfig.Config, c STSClient, k services.Keyc
 		})
 		if err != nil {
 			logger.Error().Err(err).Msg("DeleteObjects call failed")
-			http.Error(w, "Failed to delete objects", http.StatusInternalServerError)
+			services.WriteError(w, r, http.StatusInternalServerError, services.CodeInternal, "Failed to delete objects")
 			return
 		}
 
@@ -187,7 +189,7 @@ func DeleteFileDataLoader(appCfg *appconfig.Config, c STSClient, k services.Keyc
 					Str("message", aws.ToString(delErr.Message)).
 					Msg("S3 DeleteObjects error")
 			}
-			http.Error(w, "Some keys failed to delete", http.StatusConflict)
+			services.WriteError(w, r, http.StatusConflict, services.CodeFilesPartiallyFailed, "Some keys failed to delete")
 			return
 		}
 
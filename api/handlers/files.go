@@ -15,15 +15,16 @@ import (
 // @Param workspace-id path string true "Workspace ID"
 // @Param store query string false "Store type: object or block"
 // @Success 200 {object} services.FileListResponse
-// @Failure 400 {object} string
-// @Failure 401 {object} string
-// @Failure 403 {object} string
-// @Failure 404 {object} string
-// @Failure 500 {object} string
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 404 {object} services.Problem
+// @Failure 429 {object} services.Problem
+// @Failure 500 {object} services.Problem
 // @Router /workspaces/{workspace-id}/files [get]
 func GetWorkspaceFiles(svc *services.FileService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if !ensureKeycloakToken(w, svc.KC) {
+		if !ensureKeycloakToken(w, r, svc.KC) {
 			return
 		}
 
@@ -40,15 +41,16 @@ func GetWorkspaceFiles(svc *services.FileService) http.HandlerFunc {
 // @Param file query string true "File path within the workspace"
 // @Param size query integer true "File size in bytes"
 // @Success 200 {object} services.FileUploadURLResponse
-// @Failure 400 {object} string
-// @Failure 401 {object} string
-// @Failure 403 {object} string
-// @Failure 404 {object} string
-// @Failure 500 {object} string
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 404 {object} services.Problem
+// @Failure 429 {object} services.Problem
+// @Failure 500 {object} services.Problem
 // @Router /workspaces/{workspace-id}/files/object/upload-url [get]
 func GetWorkspaceObjectFileUploadURL(svc *services.FileService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if !ensureKeycloakToken(w, svc.KC) {
+		if !ensureKeycloakToken(w, r, svc.KC) {
 			return
 		}
 
@@ -65,15 +67,16 @@ func GetWorkspaceObjectFileUploadURL(svc *services.FileService) http.HandlerFunc
 // @Param workspace-id path string true "Workspace ID"
 // @Param files formData file true "Files to upload"
 // @Success 201 {object} services.FileUploadResponse
-// @Failure 400 {object} string
-// @Failure 401 {object} string
-// @Failure 403 {object} string
-// @Failure 404 {object} string
-// @Failure 500 {object} string
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 404 {object} services.Problem
+// @Failure 429 {object} services.Problem
+// @Failure 500 {object} services.Problem
 // @Router /workspaces/{workspace-id}/files/object [post]
 func UploadWorkspaceObjectFiles(svc *services.FileService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if !ensureKeycloakToken(w, svc.KC) {
+		if !ensureKeycloakToken(w, r, svc.KC) {
 			return
 		}
 
@@ -90,15 +93,16 @@ func UploadWorkspaceObjectFiles(svc *services.FileService) http.HandlerFunc {
 // @Param workspace-id path string true "Workspace ID"
 // @Param files formData file true "Files to upload"
 // @Success 201 {object} services.FileUploadResponse
-// @Failure 400 {object} string
-// @Failure 401 {object} string
-// @Failure 403 {object} string
-// @Failure 404 {object} string
-// @Failure 500 {object} string
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 404 {object} services.Problem
+// @Failure 429 {object} services.Problem
+// @Failure 500 {object} services.Problem
 // @Router /workspaces/{workspace-id}/files/block [post]
 func UploadWorkspaceBlockFiles(svc *services.FileService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if !ensureKeycloakToken(w, svc.KC) {
+		if !ensureKeycloakToken(w, r, svc.KC) {
 			return
 		}
 
@@ -115,16 +119,17 @@ func UploadWorkspaceBlockFiles(svc *services.FileService) http.HandlerFunc {
 // @Param workspace-id path string true "Workspace ID"
 // @Param file query string true "File name to delete"
 // @Success 200 {object} services.FileDeleteResponse
-// @Failure 400 {object} string
-// @Failure 401 {object} string
-// @Failure 403 {object} string
-// @Failure 404 {object} string
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 404 {object} services.Problem
 // @Failure 409 {object} services.FileDeleteResponse
-// @Failure 500 {object} string
+// @Failure 429 {object} services.Problem
+// @Failure 500 {object} services.Problem
 // @Router /workspaces/{workspace-id}/files/object [delete]
 func DeleteWorkspaceObjectFile(svc *services.FileService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if !ensureKeycloakToken(w, svc.KC) {
+		if !ensureKeycloakToken(w, r, svc.KC) {
 			return
 		}
 
@@ -141,16 +146,17 @@ func DeleteWorkspaceObjectFile(svc *services.FileService) http.HandlerFunc {
 // @Param workspace-id path string true "Workspace ID"
 // @Param file query string true "File name to delete"
 // @Success 200 {object} services.FileDeleteResponse
-// @Failure 400 {object} string
-// @Failure 401 {object} string
-// @Failure 403 {object} string
-// @Failure 404 {object} string
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 404 {object} services.Problem
 // @Failure 409 {object} services.FileDeleteResponse
-// @Failure 500 {object} string
+// @Failure 429 {object} services.Problem
+// @Failure 500 {object} services.Problem
 // @Router /workspaces/{workspace-id}/files/block [delete]
 func DeleteWorkspaceBlockFile(svc *services.FileService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if !ensureKeycloakToken(w, svc.KC) {
+		if !ensureKeycloakToken(w, r, svc.KC) {
 			return
 		}
 
@@ -167,15 +173,16 @@ func DeleteWorkspaceBlockFile(svc *services.FileService) http.HandlerFunc {
 // @Param workspace-id path string true "Workspace ID"
 // @Param file query string true "File name within the workspace"
 // @Success 200 {object} services.FileMetadataResponse
-// @Failure 400 {object} string
-// @Failure 401 {object} string
-// @Failure 403 {object} string
-// @Failure 404 {object} string
-// @Failure 500 {object} string
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 404 {object} services.Problem
+// @Failure 429 {object} services.Problem
+// @Failure 500 {object} services.Problem
 // @Router /workspaces/{workspace-id}/files/object/metadata [get]
 func GetWorkspaceObjectFileMetadata(svc *services.FileService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if !ensureKeycloakToken(w, svc.KC) {
+		if !ensureKeycloakToken(w, r, svc.KC) {
 			return
 		}
 
@@ -192,15 +199,16 @@ func GetWorkspaceObjectFileMetadata(svc *services.FileService) http.HandlerFunc
 // @Param workspace-id path string true "Workspace ID"
 // @Param file query string true "File name within the workspace"
 // @Success 200 {object} services.FileMetadataResponse
-// @Failure 400 {object} string
-// @Failure 401 {object} string
-// @Failure 403 {object} string
-// @Failure 404 {object} string
-// @Failure 500 {object} string
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 404 {object} services.Problem
+// @Failure 429 {object} services.Problem
+// @Failure 500 {object} services.Problem
 // @Router /workspaces/{workspace-id}/files/block/metadata [get]
 func GetWorkspaceBlockFileMetadata(svc *services.FileService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if !ensureKeycloakToken(w, svc.KC) {
+		if !ensureKeycloakToken(w, r, svc.KC) {
 			return
 		}
 
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	services "github.com/EO-DataHub/eodhp-workspace-services/api/services"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authz"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/health"
+)
+
+// HealthChecker reports the status of the service's dependencies.
+type HealthChecker interface {
+	Report(ctx context.Context) health.Report
+}
+
+// HealthStatus is the response of the health endpoints for callers who may not see the details.
+type HealthStatus struct {
+	Status string `json:"status"`
+}
+
+// @Summary Liveness probe
+// @Description Reports that the process is running. No dependencies are checked.
+// @Tags Health
+// @Produce json
+// @Success 200 {object} HealthStatus
+// @Router /healthz [get]
+func Healthz() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		services.WriteResponse(w, http.StatusOK, HealthStatus{Status: health.StatusOK})
+	})
+}
+
+// @Summary Readiness probe
+// @Description Checks Postgres, Keycloak, Pulsar, S3 and the block store. Results are cached briefly. Callers presenting a bearer token allowed health.details, such as hub admins, receive the result of each check.
+// @Tags Health
+// @Produce json
+// @Success 200 {object} health.Report
+// @Failure 503 {object} health.Report
+// @Router /readyz [get]
+func Readyz(checker HealthChecker, verifier authn.TokenVerifier, authorizer authz.Authorizer) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := checker.Report(r.Context())
+
+		status := http.StatusOK
+		if !report.Ready() {
+			status = http.StatusServiceUnavailable
+		}
+
+		if canSeeHealthDetails(r, verifier, authorizer) {
+			services.WriteResponse(w, status, report)
+			return
+		}
+		services.WriteResponse(w, status, HealthStatus{Status: report.Status})
+	})
+}
+
+// canSeeHealthDetails reports whether the request carries a valid bearer token allowed to see the
+// result of each check. The probe endpoints do not require a token, so a missing or invalid one is
+// not an error.
+func canSeeHealthDetails(r *http.Request, verifier authn.TokenVerifier, authorizer authz.Authorizer) bool {
+	if verifier == nil || authorizer == nil {
+		return false
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return false
+	}
+
+	claims, err := verifier.Verify(r.Context(), token)
+	if err != nil {
+		return false
+	}
+
+	decision, err := authorizer.Authorize(r.Context(), authz.SubjectFromClaims(claims), authz.ActionHealthDetails, authz.Resource{})
+	return err == nil && decision.Allowed
+}
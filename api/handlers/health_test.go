@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authz"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticChecker health.Report
+
+func (c staticChecker) Report(ctx context.Context) health.Report {
+	return health.Report(c)
+}
+
+type verifierMock map[string]authn.Claims
+
+func (v verifierMock) Verify(ctx context.Context, token string) (authn.Claims, error) {
+	claims, ok := v[token]
+	if !ok {
+		return authn.Claims{}, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+func TestReadyz(t *testing.T) {
+	checker := staticChecker{
+		Status: health.StatusUnavailable,
+		Checks: map[string]health.CheckResult{
+			"postgres": {Status: health.StatusOK},
+			"keycloak": {Status: health.StatusUnavailable, Error: "connection refused"},
+		},
+	}
+
+	admin := authn.Claims{}
+	admin.RealmAccess.Roles = []string{"hub_admin"}
+	verifier := verifierMock{"admin-token": admin, "user-token": authn.Claims{Username: "user"}}
+
+	tests := []struct {
+		name          string
+		authorization string
+		detailed      bool
+	}{
+		{name: "anonymous"},
+		{name: "user", authorization: "Bearer user-token"},
+		{name: "invalid token", authorization: "Bearer forged"},
+		{name: "hub admin", authorization: "Bearer admin-token", detailed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+
+			Readyz(checker, verifier, authz.NewPolicyAuthorizer(authz.DefaultPolicy(), nil, nil)).ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+			var report health.Report
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+			assert.Equal(t, health.StatusUnavailable, report.Status)
+			if tt.detailed {
+				assert.Equal(t, "connection refused", report.Checks["keycloak"].Error)
+			} else {
+				assert.Empty(t, report.Checks)
+			}
+		})
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	w := httptest.NewRecorder()
+	Healthz().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/EO-DataHub/eodhp-workspace-services/api/services"
+)
+
+// @Summary Invite someone to a workspace
+// @Description Email an invitation to join the workspace. The invitee can accept or decline it once signed in with the invited email address, until it expires. Inviting an email address again replaces its pending invitation. Only workspace admins can invite users, and not to a role above their own.
+// @Tags Workspace Management
+// @Accept json
+// @Produce json
+// @Param workspace-id path string true "Workspace ID"
+// @Param invitation body models.WorkspaceInvitationRequest true "Email address to invite and their role"
+// @Success 201 {object} models.WorkspaceInvitation
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 422 {object} services.Problem
+// @Failure 500 {object} services.Problem
+// @Router /workspaces/{workspace-id}/invitations [post]
+func CreateInvitation(svc *services.WorkspaceService) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Get a token from keycloak so we can interact with it's API
+		if !ensureKeycloakToken(w, r, svc.KC) {
+			return
+		}
+
+		svc.CreateInvitationService(w, r)
+	}
+}
+
+// @Summary Get the pending invitations to a workspace
+// @Description Retrieve the invitations to the workspace that have not been accepted, declined, revoked or expired. Only workspace admins can list invitations.
+// @Tags Workspace Management
+// @Accept json
+// @Produce json
+// @Param workspace-id path string true "Workspace ID"
+// @Success 200 {array} models.WorkspaceInvitation
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 500 {object} services.Problem
+// @Router /workspaces/{workspace-id}/invitations [get]
+func GetInvitations(svc *services.WorkspaceService) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Get a token from keycloak so we can interact with it's API
+		if !ensureKeycloakToken(w, r, svc.KC) {
+			return
+		}
+
+		svc.GetInvitationsService(w, r)
+	}
+}
+
+// @Summary Revoke an invitation to a workspace
+// @Description Revoke a pending invitation so that it can no longer be accepted. Only workspace admins can revoke invitations.
+// @Tags Workspace Management
+// @Accept json
+// @Produce json
+// @Param workspace-id path string true "Workspace ID"
+// @Param invitation-id path string true "Invitation ID"
+// @Success 204 {string} string
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 404 {object} services.Problem
+// @Failure 500 {object} services.Problem
+// @Router /workspaces/{workspace-id}/invitations/{invitation-id} [delete]
+func RevokeInvitation(svc *services.WorkspaceService) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Get a token from keycloak so we can interact with it's API
+		if !ensureKeycloakToken(w, r, svc.KC) {
+			return
+		}
+
+		svc.RevokeInvitationService(w, r)
+	}
+}
+
+// @Summary Page for responding to an invitation to a workspace
+// @Description The page opened by the link in an invitation email, from which the invitee accepts or declines the invitation.
+// @Tags Workspace Management
+// @Produce html
+// @Param token path string true "Invitation token from the invitation email"
+// @Success 200 {string} string
+// @Failure 401 {object} services.Problem
+// @Router /invitations/{token} [get]
+func InvitationPage(svc *services.WorkspaceService) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		svc.InvitationPageService(w, r)
+	}
+}
+
+// @Summary Accept an invitation to a workspace
+// @Description Join the workspace with the role given in the invitation. The signed in user must have the email address the invitation was sent to.
+// @Tags Workspace Management
+// @Accept json
+// @Produce json
+// @Param token path string true "Invitation token from the invitation email"
+// @Success 204 {string} string
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 404 {object} services.Problem
+// @Failure 500 {object} services.Problem
+// @Router /invitations/{token}/accept [post]
+func AcceptInvitation(svc *services.WorkspaceService) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Get a token from keycloak so we can interact with it's API
+		if !ensureKeycloakToken(w, r, svc.KC) {
+			return
+		}
+
+		svc.AcceptInvitationService(w, r)
+	}
+}
+
+// @Summary Decline an invitation to a workspace
+// @Description Decline an invitation sent to the signed in user's email address.
+// @Tags Workspace Management
+// @Accept json
+// @Produce json
+// @Param token path string true "Invitation token from the invitation email"
+// @Success 204 {string} string
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 404 {object} services.Problem
+// @Failure 500 {object} services.Problem
+// @Router /invitations/{token}/decline [post]
+func DeclineInvitation(svc *services.WorkspaceService) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Get a token from keycloak so we can interact with it's API
+		if !ensureKeycloakToken(w, r, svc.KC) {
+			return
+		}
+
+		svc.DeclineInvitationService(w, r)
+	}
+}
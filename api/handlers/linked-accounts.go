@@ -12,7 +12,7 @@ func CreateLinkedAccount(svc *services.LinkedAccountService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		// Get a token from keycloak so we can interact with it's API
-		if !ensureKeycloakToken(w, svc.KC) {
+		if !ensureKeycloakToken(w, r, svc.KC) {
 			return
 		}
 
@@ -30,17 +30,17 @@ func CreateLinkedAccount(svc *services.LinkedAccountService) http.HandlerFunc {
 // @Param workspace-id path string true "Workspace ID"
 // @Param session body services.OpenCosmosSessionPayload true "Open Cosmos OAuth session"
 // @Success 201
-// @Failure 400 {object} string
-// @Failure 401 {object} string
-// @Failure 403 {object} string
-// @Failure 500 {object} string
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 500 {object} services.Problem
 // @Router /workspaces/{workspace-id}/open-cosmos/session [post]
 func CreateOpenCosmosSession(svc *services.LinkedAccountService) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		// Get a token from keycloak so we can interact with its API
-		if !ensureKeycloakToken(w, svc.KC) {
+		if !ensureKeycloakToken(w, r, svc.KC) {
 			return
 		}
 
@@ -54,7 +54,7 @@ func GetLinkedAccounts(svc *services.LinkedAccountService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		// Get a token from keycloak so we can interact with it's API
-		if !ensureKeycloakToken(w, svc.KC) {
+		if !ensureKeycloakToken(w, r, svc.KC) {
 			return
 		}
 
@@ -68,7 +68,7 @@ func DeleteLinkedAccount(svc *services.LinkedAccountService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		// Get a token from keycloak so we can interact with it's API
-		if !ensureKeycloakToken(w, svc.KC) {
+		if !ensureKeycloakToken(w, r, svc.KC) {
 			return
 		}
 
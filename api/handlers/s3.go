@@ -9,6 +9,7 @@ import (
 	"github.com/EO-DataHub/eodhp-workspace-services/api/middleware"
 	"github.com/EO-DataHub/eodhp-workspace-services/api/services"
 	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authz"
 	awsclient "github.com/EO-DataHub/eodhp-workspace-services/internal/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/aws/aws-sdk-go/aws"
@@ -34,7 +35,7 @@ func GetS3Credentials(roleArn string, c STSClient, k services.KeycloakClient, r
 
 	token, ok := r.Context().Value(middleware.TokenKey).(string)
 	if !ok {
-		err := fmt.Errorf("invalid token")
+		err := services.NewProblem(http.StatusUnauthorized, services.CodeInvalidToken, "invalid token")
 		logger.Error().Msg(err.Error())
 		return awsclient.S3Credentials{}, err
 	}
@@ -43,7 +44,7 @@ func GetS3Credentials(roleArn string, c STSClient, k services.KeycloakClient, r
 
 	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
 	if !ok {
-		err := fmt.Errorf("invalid claims")
+		err := services.NewProblem(http.StatusUnauthorized, services.CodeUnauthorized, "invalid claims")
 		logger.Error().Msg(err.Error())
 		return awsclient.S3Credentials{}, err
 	}
@@ -57,7 +58,7 @@ func GetS3Credentials(roleArn string, c STSClient, k services.KeycloakClient, r
 	if tokenExchangeRequired(claims, workspaceID, userID) {
 		logger.Info().Msg("Token exchange required")
 
-		workspaceToken, err := k.ExchangeToken(token, fmt.Sprintf("workspace:%s", workspaceID))
+		workspaceToken, err := k.ExchangeToken(r.Context(), token, fmt.Sprintf("workspace:%s", workspaceID))
 		if err != nil {
 			logger.Error().Err(err).Msg("Failed to get offline token")
 			return awsclient.S3Credentials{}, err
@@ -91,30 +92,30 @@ func GetS3Credentials(roleArn string, c STSClient, k services.KeycloakClient, r
 // @Param workspace-id path string true "Workspace ID" example(my-workspace)
 // @Param user-id path string true "User ID" example(me)
 // @Success 200 {object} awsclient.S3Credentials
-// @Failure 400 {object} string
-// @Failure 401 {object} string
-// @Failure 500 {object} string
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 429 {object} services.Problem
+// @Failure 500 {object} services.Problem
 // @Router /workspaces/{workspace-id}/{user-id}/s3-tokens [post]
-func RequestS3CredentialsHandler(roleArn string, c STSClient, k services.KeycloakClient) http.HandlerFunc {
+func RequestS3CredentialsHandler(roleArn string, c STSClient, k services.KeycloakClient, a authz.Authorizer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		logger := zerolog.Ctx(r.Context())
 
+		// Credentials are not issued for the workspaces of suspended or closed accounts
+		if !authorizeWorkspace(w, r, a, authz.ActionWorkspaceCredentials) {
+			return
+		}
+
 		creds, err := GetS3Credentials(roleArn, c, k, r)
 		if err != nil {
-			var status int
-			if httpErr, ok := err.(*services.HTTPError); ok {
-				status = httpErr.Status
-			} else {
-				status = http.StatusInternalServerError
-			}
-			http.Error(w, err.Error(), status)
+			services.WriteHTTPError(w, r, err)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(creds); err != nil {
 			logger.Error().Err(err).Msg("Failed to encode response")
-			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 			return
 		}
 		logger.Info().Msg("S3 credentials retrieved")
@@ -9,6 +9,7 @@ import (
 	"github.com/EO-DataHub/eodhp-workspace-services/api/middleware"
 	services "github.com/EO-DataHub/eodhp-workspace-services/api/services"
 	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authz"
 	"github.com/gorilla/mux"
 	"github.com/rs/zerolog"
 )
@@ -21,12 +22,13 @@ import (
 // @Param workspace-id path string true "Workspace ID" example(my-workspace)
 // @Param user-id path string true "User ID" example(me)
 // @Success 200 {object} AuthSessionResponse
-// @Failure 400 {object} string
-// @Failure 401 {object} string
-// @Failure 403 {object} string
-// @Failure 500 {object} string
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 429 {object} services.Problem
+// @Failure 500 {object} services.Problem
 // @Router /workspaces/{workspace-id}/{user-id}/sessions [post]
-func CreateWorkspaceSession(kc KeycloakClient) http.HandlerFunc {
+func CreateWorkspaceSession(kc KeycloakClient, a authz.Authorizer) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		workspaceID := vars["workspace-id"]
@@ -38,7 +40,7 @@ func CreateWorkspaceSession(kc KeycloakClient) http.HandlerFunc {
 		token, ok := r.Context().Value(middleware.TokenKey).(string)
 		if !ok {
 			err := "Invalid token"
-			http.Error(w, err, http.StatusUnauthorized)
+			services.WriteError(w, r, http.StatusUnauthorized, services.CodeInvalidToken, err)
 			logger.Error().Msg(err)
 			return
 		}
@@ -49,7 +51,7 @@ func CreateWorkspaceSession(kc KeycloakClient) http.HandlerFunc {
 		if !ok {
 			err := "Invalid claims"
 			logger.Error().Msg(err)
-			http.Error(w, err, http.StatusUnauthorized)
+			services.WriteError(w, r, http.StatusUnauthorized, services.CodeUnauthorized, err)
 			return
 		}
 
@@ -59,19 +61,19 @@ func CreateWorkspaceSession(kc KeycloakClient) http.HandlerFunc {
 		if userID != "me" && userID != claims.Username {
 			err := "Endpoint does not support session credentials for users other than the token owner"
 			logger.Error().Msg(err)
-			http.Error(w, err, http.StatusBadRequest)
+			services.WriteError(w, r, http.StatusBadRequest, services.CodeInvalidRequest, err)
+			return
+		}
+
+		// Sessions are not issued for the workspaces of suspended or closed accounts
+		if !authorizeWorkspace(w, r, a, authz.ActionWorkspaceCredentials) {
+			return
 		}
 
-		resp, err := kc.ExchangeToken(token, fmt.Sprintf("workspace:%s", workspaceID))
+		resp, err := kc.ExchangeToken(r.Context(), token, fmt.Sprintf("workspace:%s", workspaceID))
 		if err != nil {
-			var errStatus int
-			if err, ok := err.(*services.HTTPError); ok {
-				errStatus = err.Status
-			} else {
-				errStatus = http.StatusInternalServerError
-			}
 			logger.Error().Err(err).Msg("Failed to get offline token")
-			http.Error(w, err.Error(), errStatus)
+			services.WriteHTTPError(w, r, err)
 			return
 		}
 
@@ -89,7 +91,6 @@ func CreateWorkspaceSession(kc KeycloakClient) http.HandlerFunc {
 
 		if err := json.NewEncoder(w).Encode(response); err != nil {
 			logger.Error().Err(err).Msg("Failed to encode response")
-			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 	})
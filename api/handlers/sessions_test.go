@@ -10,6 +10,7 @@ import (
 	"github.com/EO-DataHub/eodhp-workspace-services/api/middleware"
 	services "github.com/EO-DataHub/eodhp-workspace-services/api/services"
 	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authz"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 )
@@ -19,7 +20,7 @@ type keycloakMock struct {
 	err      error
 }
 
-func (k keycloakMock) ExchangeToken(token, scope string) (
+func (k keycloakMock) ExchangeToken(ctx context.Context, token, scope string) (
 	*services.TokenResponse, error) {
 
 	if k.err != nil {
@@ -29,6 +30,33 @@ func (k keycloakMock) ExchangeToken(token, scope string) (
 	return k.response, nil
 }
 
+// workspaceLookups gives every user the same role in every workspace, and every workspace an
+// account with the same status.
+type workspaceLookups struct {
+	role          string
+	accountStatus string
+	suspended     *bool
+}
+
+func (l workspaceLookups) WorkspaceRole(context.Context, authz.Subject, string) (string, error) {
+	return l.role, nil
+}
+
+func (l workspaceLookups) WorkspaceAccountStatus(context.Context, string) (string, error) {
+	return l.accountStatus, nil
+}
+
+func (l workspaceLookups) WorkspaceSuspended(context.Context, string) (bool, error) {
+	return l.suspended != nil && *l.suspended, nil
+}
+
+// newTestAuthorizer creates an authorizer for the default policy that gives users role in every
+// workspace, whose accounts have accountStatus.
+func newTestAuthorizer(role, accountStatus string) authz.Authorizer {
+	lookups := workspaceLookups{role: role, accountStatus: accountStatus}
+	return authz.NewPolicyAuthorizer(authz.DefaultPolicy(), lookups, lookups)
+}
+
 func TestCreateWorkspaceSession_Success(t *testing.T) {
 	kc := &keycloakMock{
 		response: &services.TokenResponse{
@@ -47,7 +75,7 @@ func TestCreateWorkspaceSession_Success(t *testing.T) {
 
 	w := httptest.NewRecorder()
 
-	handler := CreateWorkspaceSession(kc)
+	handler := CreateWorkspaceSession(kc, newTestAuthorizer("editor", "Approved"))
 	handler.ServeHTTP(w, req.WithContext(ctx))
 
 	assert.Equal(t, http.StatusOK, w.Code)
@@ -72,7 +100,7 @@ func TestCreateWorkspaceSession_InvalidToken(t *testing.T) {
 
 	w := httptest.NewRecorder()
 
-	handler := CreateWorkspaceSession(kc)
+	handler := CreateWorkspaceSession(kc, newTestAuthorizer("editor", "Approved"))
 	handler.ServeHTTP(w, req.WithContext(ctx))
 
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
@@ -91,7 +119,7 @@ func TestCreateWorkspaceSession_ExchangeTokenError(t *testing.T) {
 
 	rec := httptest.NewRecorder()
 
-	handler := CreateWorkspaceSession(kc)
+	handler := CreateWorkspaceSession(kc, newTestAuthorizer("editor", "Approved"))
 	handler.ServeHTTP(rec, req.WithContext(ctx))
 
 	assert.Equal(t, http.StatusForbidden, rec.Code)
@@ -110,8 +138,82 @@ func TestCreateWorkspaceSession_WrongUserError(t *testing.T) {
 
 	rec := httptest.NewRecorder()
 
-	handler := CreateWorkspaceSession(kc)
+	handler := CreateWorkspaceSession(kc, newTestAuthorizer("editor", "Approved"))
 	handler.ServeHTTP(rec, req.WithContext(ctx))
 
 	assert.Equal(t, http.StatusBadRequest, rec.Code)
 }
+
+func TestCreateWorkspaceSession_AccountSuspended(t *testing.T) {
+	kc := &keycloakMock{
+		response: &services.TokenResponse{Access: "access-token"},
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/workspaces/{workspace-id}/{user-id}/sessions", nil)
+	req = mux.SetURLVars(req, map[string]string{"workspace-id": "test", "user-id": "me"})
+	ctx := context.WithValue(req.Context(), middleware.TokenKey, "valid-token")
+	ctx = context.WithValue(ctx, middleware.ClaimsKey, authn.Claims{Username: "user"})
+
+	w := httptest.NewRecorder()
+
+	handler := CreateWorkspaceSession(kc, newTestAuthorizer("owner", "Suspended"))
+	handler.ServeHTTP(w, req.WithContext(ctx))
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	var problem services.Problem
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+	assert.Equal(t, services.CodeAccountInactive, problem.Code)
+}
+
+func TestCreateWorkspaceSession_ViewerRefused(t *testing.T) {
+	kc := &keycloakMock{
+		response: &services.TokenResponse{Access: "access-token"},
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/workspaces/{workspace-id}/{user-id}/sessions", nil)
+	req = mux.SetURLVars(req, map[string]string{"workspace-id": "test", "user-id": "me"})
+	ctx := context.WithValue(req.Context(), middleware.TokenKey, "valid-token")
+	ctx = context.WithValue(ctx, middleware.ClaimsKey, authn.Claims{Username: "user"})
+
+	w := httptest.NewRecorder()
+
+	handler := CreateWorkspaceSession(kc, newTestAuthorizer("viewer", "Approved"))
+	handler.ServeHTTP(w, req.WithContext(ctx))
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.NotContains(t, w.Body.String(), "access-token")
+}
+
+func TestCreateWorkspaceSession_WorkspaceSuspended(t *testing.T) {
+	kc := &keycloakMock{
+		response: &services.TokenResponse{Access: "access-token"},
+	}
+
+	suspended := true
+	lookups := workspaceLookups{role: "owner", accountStatus: "Approved", suspended: &suspended}
+	handler := CreateWorkspaceSession(kc, authz.NewPolicyAuthorizer(authz.DefaultPolicy(), lookups, lookups))
+
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/workspaces/{workspace-id}/{user-id}/sessions", nil)
+		req = mux.SetURLVars(req, map[string]string{"workspace-id": "test", "user-id": "me"})
+		ctx := context.WithValue(req.Context(), middleware.TokenKey, "valid-token")
+		ctx = context.WithValue(ctx, middleware.ClaimsKey, authn.Claims{Username: "user"})
+		return req.WithContext(ctx)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newRequest())
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	var problem services.Problem
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+	assert.Equal(t, services.CodeWorkspaceSuspended, problem.Code)
+
+	// Sessions are issued again once the workspace is reactivated
+	suspended = false
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, newRequest())
+	assert.Equal(t, http.StatusOK, w.Code)
+}
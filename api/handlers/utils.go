@@ -1,9 +1,35 @@
 package handlers
 
-import services "github.com/EO-DataHub/eodhp-workspace-services/api/services"
+import (
+	"context"
+	"net/http"
+
+	"github.com/EO-DataHub/eodhp-workspace-services/api/middleware"
+	services "github.com/EO-DataHub/eodhp-workspace-services/api/services"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authz"
+	"github.com/gorilla/mux"
+)
 
 const TimeFormat string = "2006-01-02T15:04:05Z"
 
 type KeycloakClient interface {
-	ExchangeToken(token, scope string) (*services.TokenResponse, error)
-}
\ No newline at end of file
+	ExchangeToken(ctx context.Context, token, scope string) (*services.TokenResponse, error)
+}
+
+// authorizeWorkspace checks with a that the user may perform action on the workspace in the URL
+// path. It writes an error response and returns false if they may not.
+func authorizeWorkspace(w http.ResponseWriter, r *http.Request, a authz.Authorizer, action string) bool {
+	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
+	if !ok {
+		services.WriteError(w, r, http.StatusUnauthorized, services.CodeUnauthorized, "missing claims")
+		return false
+	}
+
+	err := services.Authorize(r.Context(), a, claims, action, authz.Resource{Workspace: mux.Vars(r)["workspace-id"]})
+	if err != nil {
+		services.WriteHTTPError(w, r, err)
+		return false
+	}
+	return true
+}
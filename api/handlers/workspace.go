@@ -5,7 +5,6 @@ import (
 
 	ws_manager "github.com/EO-DataHub/eodhp-workspace-manager/models"
 	"github.com/EO-DataHub/eodhp-workspace-services/api/services"
-	"github.com/gorilla/mux"
 	_ "github.com/lib/pq"
 )
 
@@ -18,7 +17,7 @@ func CreateWorkspace(svc *services.WorkspaceService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		// Get a token from keycloak so we can interact with it's API
-		if !ensureKeycloakToken(w, svc.KC) {
+		if !ensureKeycloakToken(w, r, svc.KC) {
 			return
 		}
 
@@ -32,15 +31,15 @@ func CreateWorkspace(svc *services.WorkspaceService) http.HandlerFunc {
 // @Accept json
 // @Produce json
 // @Success 200 {array} ws_manager.WorkspaceSettings
-// @Failure 401 {object} string
-// @Failure 500 {object} string
+// @Failure 401 {object} services.Problem
+// @Failure 500 {object} services.Problem
 // @Router /workspaces [get]
 func GetWorkspaces(svc *services.WorkspaceService) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		// Get a token from keycloak so we can interact with it's API
-		if !ensureKeycloakToken(w, svc.KC) {
+		if !ensureKeycloakToken(w, r, svc.KC) {
 			return
 		}
 
@@ -55,16 +54,16 @@ func GetWorkspaces(svc *services.WorkspaceService) http.HandlerFunc {
 // @Produce json
 // @Param workspace-id path string true "Workspace ID" // Workspace ID from the URL path
 // @Success 200 {object} ws_manager.WorkspaceSettings
-// @Failure 400 {object} string
-// @Failure 401 {object} string
-// @Failure 500 {object} string
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 500 {object} services.Problem
 // @Router /workspaces/{workspace-id} [get]
 func GetWorkspace(svc *services.WorkspaceService) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		// Get a token from keycloak so we can interact with it's API
-		if !ensureKeycloakToken(w, svc.KC) {
+		if !ensureKeycloakToken(w, r, svc.KC) {
 			return
 		}
 
@@ -72,13 +71,24 @@ func GetWorkspace(svc *services.WorkspaceService) http.HandlerFunc {
 	}
 }
 
-// DeleteWorkspace handles HTTP requests for deleting a workspace
+// @Summary Delete a workspace
+// @Description Schedule a workspace for deletion. The workspace is reported as PendingDeletion and can be restored until the deletion grace period has passed. Only the account owner or a hub admin can delete a workspace.
+// @Tags Workspace Management
+// @Accept json
+// @Produce json
+// @Param workspace-id path string true "Workspace ID"
+// @Success 202 {object} models.WorkspaceDeletion
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 404 {object} services.Problem
+// @Failure 500 {object} services.Problem
+// @Router /workspaces/{workspace-id} [delete]
 func DeleteWorkspace(svc *services.WorkspaceService) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		// Get a token from keycloak so we can interact with it's API
-		if !ensureKeycloakToken(w, svc.KC) {
+		if !ensureKeycloakToken(w, r, svc.KC) {
 			return
 		}
 
@@ -86,51 +96,110 @@ func DeleteWorkspace(svc *services.WorkspaceService) http.HandlerFunc {
 	}
 }
 
-// UpdateWorkspace handles HTTP requests for updating a specific workspace by ID.
-// This is a placeholder for the actual implementation.
+// @Summary Restore a workspace
+// @Description Cancel the pending deletion of a workspace that is still within its deletion grace period. Only the account owner or a hub admin can restore a workspace.
+// @Tags Workspace Management
+// @Accept json
+// @Produce json
+// @Param workspace-id path string true "Workspace ID"
+// @Success 200 {object} ws_manager.WorkspaceSettings
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 409 {object} services.Problem
+// @Failure 500 {object} services.Problem
+// @Router /workspaces/{workspace-id}/restore [post]
+func RestoreWorkspace(svc *services.WorkspaceService) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Get a token from keycloak so we can interact with it's API
+		if !ensureKeycloakToken(w, r, svc.KC) {
+			return
+		}
+
+		svc.RestoreWorkspaceService(w, r)
+	}
+}
+
+// @Summary Update a workspace
+// @Description Replace the settings of a workspace. Fields omitted from the body keep their current values. The id, name, account, owner and stores of a workspace cannot be changed, and status and last_updated are managed by the service. Only the account owner or a hub admin can update a workspace.
+// @Tags Workspace Management
+// @Accept json
+// @Produce json
+// @Param workspace-id path string true "Workspace ID"
+// @Param workspace body ws_manager.WorkspaceSettings true "Workspace settings"
+// @Success 200 {object} ws_manager.WorkspaceSettings
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 404 {object} services.Problem
+// @Failure 415 {object} services.Problem
+// @Failure 422 {object} services.Problem
+// @Failure 500 {object} services.Problem
+// @Router /workspaces/{workspace-id} [put]
 func UpdateWorkspace(svc *services.WorkspaceService) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		vars := mux.Vars(r)
-		workspaceID := vars["workspace-id"]
+		// Get a token from keycloak so we can interact with it's API
+		if !ensureKeycloakToken(w, r, svc.KC) {
+			return
+		}
 
-		// placeholder for the implementation
-		http.Error(w, "Failed to update workspace "+workspaceID, http.StatusInternalServerError)
+		svc.UpdateWorkspaceService(w, r)
 	}
 }
 
-// PatchWorkspace handles HTTP requests for partially updating a specific workspace by ID.
-// This is a placeholder for the actual implementation.
+// @Summary Patch a workspace
+// @Description Partially update the settings of a workspace with a JSON Merge Patch (RFC 7396). The same field rules as a full update apply. Only the account owner or a hub admin can patch a workspace.
+// @Tags Workspace Management
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param workspace-id path string true "Workspace ID"
+// @Param patch body object true "JSON Merge Patch document"
+// @Success 200 {object} ws_manager.WorkspaceSettings
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 404 {object} services.Problem
+// @Failure 415 {object} services.Problem
+// @Failure 422 {object} services.Problem
+// @Failure 500 {object} services.Problem
+// @Router /workspaces/{workspace-id} [patch]
 func PatchWorkspace(svc *services.WorkspaceService) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		vars := mux.Vars(r)
-		workspaceID := vars["workspace-id"]
+		// Get a token from keycloak so we can interact with it's API
+		if !ensureKeycloakToken(w, r, svc.KC) {
+			return
+		}
 
-		// placeholder for the implementation
-		http.Error(w, "Failed to patch workspace "+workspaceID, http.StatusInternalServerError)
+		svc.PatchWorkspaceService(w, r)
 	}
 }
 
 // @Summary Get users of a workspace
-// @Description Retrieve a list of users who are members of the specified workspace.
+// @Description Retrieve a list of users who are members of the specified workspace. All users are returned unless a limit is given, in which case a Link header with rel="next" gives the URL of the next page, if there is one.
 // @Tags Workspace Management
 // @Accept json
 // @Produce json
 // @Param workspace-id path string true "Workspace ID"
+// @Param limit query int false "Maximum number of users to return (1-1000)"
+// @Param cursor query string false "Cursor from the Link header of the previous page"
+// @Param search query string false "Only return users whose username, name or email contains this text"
 // @Success 200 {array} models.User
-// @Failure 400 {object} string
-// @Failure 401 {object} string
-// @Failure 500 {object} string
+// @Header 200 {string} Link "URL of the next page"
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 500 {object} services.Problem
 // @Router /workspaces/{workspace-id}/users [get]
 func GetUsers(svc *services.WorkspaceService) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		// Get a token from keycloak so we can interact with it's API
-		if !ensureKeycloakToken(w, svc.KC) {
+		if !ensureKeycloakToken(w, r, svc.KC) {
 			return
 		}
 
@@ -146,17 +215,17 @@ func GetUsers(svc *services.WorkspaceService) http.HandlerFunc {
 // @Param workspace-id path string true "Workspace ID"
 // @Param username path string true "Username"
 // @Success 200 {object} models.User
-// @Failure 400 {object} string
-// @Failure 401 {object} string
-// @Failure 404 {object} string
-// @Failure 500 {object} string
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 404 {object} services.Problem
+// @Failure 500 {object} services.Problem
 // @Router /workspaces/{workspace-id}/users/{username} [get]
 func GetUser(svc *services.WorkspaceService) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		// Get a token from keycloak so we can interact with it's API
-		if !ensureKeycloakToken(w, svc.KC) {
+		if !ensureKeycloakToken(w, r, svc.KC) {
 			return
 		}
 
@@ -165,24 +234,28 @@ func GetUser(svc *services.WorkspaceService) http.HandlerFunc {
 }
 
 // @Summary Add a user to a workspace
-// @Description Add a user to the specified workspace by providing the workspace ID and username.
+// @Description Add a user to the specified workspace by providing the workspace ID and username, or change the role of a member. New members without a role are editors.
 // @Tags Workspace Management
 // @Accept json
 // @Produce json
 // @Param workspace-id path string true "Workspace ID"
 // @Param username path string true "Username"
+// @Param role body models.WorkspaceUserRole false "Role of the user in the workspace"
 // @Success 204 {string} string
-// @Failure 400 {object} string
-// @Failure 401 {object} string
-// @Failure 404 {object} string
-// @Failure 500 {object} string
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 403 {object} services.Problem
+// @Failure 404 {object} services.Problem
+// @Failure 409 {object} services.Problem
+// @Failure 422 {object} services.Problem
+// @Failure 500 {object} services.Problem
 // @Router /workspaces/{workspace-id}/users/{username} [put]
 func AddUser(svc *services.WorkspaceService) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		// Get a token from keycloak so we can interact with it's API
-		if !ensureKeycloakToken(w, svc.KC) {
+		if !ensureKeycloakToken(w, r, svc.KC) {
 			return
 		}
 
@@ -198,17 +271,17 @@ func AddUser(svc *services.WorkspaceService) http.HandlerFunc {
 // @Param workspace-id path string true "Workspace ID"
 // @Param username path string true "Username"
 // @Success 204 {string} string
-// @Failure 400 {object} string
-// @Failure 401 {object} string
-// @Failure 404 {object} string
-// @Failure 500 {object} string
+// @Failure 400 {object} services.Problem
+// @Failure 401 {object} services.Problem
+// @Failure 404 {object} services.Problem
+// @Failure 500 {object} services.Problem
 // @Router /workspaces/{workspace-id}/users/{username} [delete]
 func RemoveUser(svc *services.WorkspaceService) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		// Get a token from keycloak so we can interact with it's API
-		if !ensureKeycloakToken(w, svc.KC) {
+		if !ensureKeycloakToken(w, r, svc.KC) {
 			return
 		}
 
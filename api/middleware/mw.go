@@ -2,106 +2,319 @@ package middleware
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authz"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/metrics"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/ratelimit"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/requestid"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/tracing"
+	"github.com/gorilla/mux"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type contextKey string
 type tokenKey string
 
 const ClaimsKey contextKey = "claims"
+const accessLogKey contextKey = "accessLog"
 const TokenKey tokenKey = "token"
 
-// JWTMiddleware parses the JWT token and adds claims to the request context.
-func JWTMiddleware(next http.Handler) http.Handler {
+// JWTMiddleware verifies the bearer token and adds its claims to the request context.
+func JWTMiddleware(verifier authn.TokenVerifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				logger := zerolog.Ctx(r.Context()).With().
+					Str("handler", "JWTMiddleware").Logger()
+
+				// Get the Authorization header
+				authHeader := r.Header.Get("Authorization")
+				if authHeader == "" {
+					logger.Debug().Msg("authorization header missing")
+					writeProblem(w, r, http.StatusUnauthorized, "unauthorized", "authorization header missing")
+					return
+				}
+
+				// Check the Authorization header format
+				token := strings.TrimPrefix(authHeader, "Bearer ")
+				if token == authHeader {
+					logger.Error().Msg("invalid token format")
+					writeProblem(w, r, http.StatusUnauthorized, "invalid_token", "invalid token format")
+					return
+				}
+
+				// Verify the token signature and registered claims
+				claims, err := verifier.Verify(r.Context(), token)
+				if err != nil {
+					logger.Error().Err(err).Msg("invalid bearer jwt token")
+					writeProblem(w, r, http.StatusUnauthorized, "invalid_token", "invalid bearer jwt token")
+					return
+				}
+
+				// Add the token and claims to the context, and the user to the request's logs
+				ctx := context.WithValue(r.Context(), TokenKey, token)
+				ctx = context.WithValue(ctx, ClaimsKey, claims)
+				ctx = zerolog.Ctx(ctx).With().Str("username", claims.Username).Logger().WithContext(ctx)
+				if entry, ok := ctx.Value(accessLogKey).(*accessLog); ok {
+					entry.username = claims.Username
+				}
+
+				next.ServeHTTP(w, r.WithContext(ctx))
+			},
+		)
+	}
+}
+
+// problem is the body of an error response. It has the same shape as services.Problem, which
+// cannot be used here because the services package depends on this one.
+type problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Code      string `json:"code"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// writeProblem writes an application/problem+json error response.
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("Cache-Control", "max-age=0")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Code:      code,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
+
+// WithLogger assigns the request an ID, adds a logger carrying it to the context and logs the
+// request once it has been handled. An ID sent by the caller in X-Request-ID is kept so that
+// requests can be followed across services; the ID is returned in the response either way.
+func WithLogger(next http.Handler) http.Handler {
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
-			logger := zerolog.Ctx(r.Context()).With().
-				Str("handler", "JWTMiddleware").Logger()
-
-			// Get the Authorization header
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				logger.Debug().Msg("authorization header missing")
-				http.Error(w, "authorization header missing",
-					http.StatusUnauthorized)
-				return
-			}
+			start := time.Now()
 
-			// Check the Authorization header format
-			token := strings.TrimPrefix(authHeader, "Bearer ")
-			if token == authHeader {
-				logger.Error().Msg("invalid token format")
-				http.Error(w, "invalid token format", http.StatusUnauthorized)
-				return
+			id := r.Header.Get(requestid.Header)
+			if !requestid.Valid(id) {
+				id = requestid.New()
 			}
+			w.Header().Set(requestid.Header, id)
 
-			// Parse the token for JWT claims
-			claims, err := authn.ParseClaims(token)
+			logCtx := log.With().
+				Str("request_id", id).
+				Str("host", r.Host).
+				Str("method", r.Method).
+				Str("url", r.URL.String()).
+				Str("remote_addr", r.RemoteAddr).
+				Time("timestamp", start)
 
-			if err != nil {
-				logger.Error().Err(err).Msg("invalid bearer jwt token")
-				http.Error(w, "invalid bearer jwt token", http.StatusUnauthorized)
-				return
+			// Link log lines to the request's trace
+			if spanCtx := trace.SpanContextFromContext(r.Context()); spanCtx.HasTraceID() {
+				logCtx = logCtx.Str("trace_id", spanCtx.TraceID().String())
 			}
+			logger := logCtx.Logger()
 
-			// Add the token and claims to the context
-			ctx := context.WithValue(r.Context(), TokenKey, token)
-			ctx = context.WithValue(ctx, ClaimsKey, claims)
+			// Add the logger, request ID and access log entry to the context
+			entry := &accessLog{}
+			ctx := logger.WithContext(r.Context())
+			ctx = requestid.NewContext(ctx, id)
+			ctx = context.WithValue(ctx, accessLogKey, entry)
+
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r.WithContext(ctx))
 
-			next.ServeHTTP(w, r.WithContext(ctx))
+			logger.Info().
+				Int("status", rec.status).
+				Int("bytes", rec.bytes).
+				Dur("duration", time.Since(start)).
+				Str("username", entry.username).
+				Msg("Request handled")
 		},
 	)
 }
 
-// DenyWorkspaceScopedTokens is a middleware that denies workspace-scoped tokens
-func DenyWorkspaceScopedTokens(next http.Handler) http.Handler {
+// accessLog collects details for the access log that are only known to inner middleware.
+type accessLog struct {
+	username string
+}
+
+// statusRecorder captures the status code and body size written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Flush sends buffered data to the client, so streamed responses are not held back by the recorder.
+func (rec *statusRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// routeTemplate returns the path template of the route that matched r.
+func routeTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return "unmatched"
+}
+
+// Tracing starts a server span for each request, continuing any trace propagated by the caller.
+// The span is named after the route template once the route has been matched.
+func Tracing(next http.Handler) http.Handler {
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
-			logger := zerolog.Ctx(r.Context()).With().
-				Str("handler", "DenyWorkspaceScopedTokens").Logger()
-
-			// Get the claims from the context
-			claims, ok := r.Context().Value(ClaimsKey).(authn.Claims)
-			if !ok {
-				logger.Warn().Msg("missing claims in context")
-				http.Error(w, "missing claims in context", http.StatusUnauthorized)
-				return
-			}
+			ctx := tracing.ExtractHTTP(r.Context(), r.Header)
+			ctx, span := tracing.Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.request.method", r.Method),
+					attribute.String("url.path", r.URL.Path),
+				))
+			defer span.End()
 
-			// Deny workspace-scoped tokens (if Workspace claim is set)
-			if claims.Workspace != "" {
-				logger.Warn().Str("workspace", claims.Workspace).Msg("Unauthorized request: workspace scoped token")
-				http.Error(w, "unauthorized: workspace scoped tokens not allowed", http.StatusUnauthorized)
-				return
-			}
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			r = r.WithContext(ctx)
+			next.ServeHTTP(rec, r)
 
-			// Continue with the next handler if token is valid and not workspace-scoped
-			next.ServeHTTP(w, r)
+			route := routeTemplate(r)
+			span.SetName(r.Method + " " + route)
+			span.SetAttributes(
+				attribute.String("http.route", route),
+				attribute.Int("http.response.status_code", rec.status),
+			)
+			if rec.status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(rec.status))
+			}
 		},
 	)
 }
 
-// WithLogger adds a logger to the context and logs request information.
-func WithLogger(next http.Handler) http.Handler {
+// Metrics records the latency of each request by route template, method and status code.
+// Route templates are used rather than paths so that workspace and file names do not each
+// create a new series.
+func Metrics(next http.Handler) http.Handler {
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
-			logger := log.With().
-				Str("host", r.Host).
-				Str("method", r.Method).
-				Str("url", r.URL.String()).
-				Str("remote_addr", r.RemoteAddr).
-				Time("timestamp", time.Now()).
-				Logger()
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
 
-			// Add the logger to the context
-			ctx := logger.WithContext(r.Context())
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(rec, r)
+
+			metrics.HTTPRequestDuration.WithLabelValues(routeTemplate(r), r.Method, strconv.Itoa(rec.status)).
+				Observe(time.Since(start).Seconds())
 		},
 	)
 }
+
+// RateLimit limits the requests of each user, and of each workspace named in the route, to a
+// route group. Requests only count against a workspace's limit once authorizer confirms the user
+// has a role in it, so that other users cannot use up its limit. Requests over either limit are
+// rejected with 429 and a Retry-After header, without taking from the other limit. It must run
+// after JWTMiddleware. Requests are allowed if the store cannot be reached, so that an outage of
+// the store does not take the API down with it.
+func RateLimit(store ratelimit.Store, group string, user, workspace ratelimit.Limit, authorizer authz.Authorizer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				logger := zerolog.Ctx(r.Context()).With().
+					Str("handler", "RateLimit").Str("group", group).Logger()
+
+				claims, ok := r.Context().Value(ClaimsKey).(authn.Claims)
+				if !ok {
+					next.ServeHTTP(w, r)
+					return
+				}
+
+				var keys []ratelimit.Key
+				scopes := make(map[string]string)
+				add := func(scope, key string, limit ratelimit.Limit) {
+					if !limit.Unlimited() {
+						keys = append(keys, ratelimit.Key{Name: key, Limit: limit})
+						scopes[key] = scope
+					}
+				}
+
+				subject := claims.Subject
+				if subject == "" {
+					subject = claims.Username
+				}
+				if subject != "" {
+					add("user", group+":user:"+subject, user)
+				}
+				if workspaceID := mux.Vars(r)["workspace-id"]; workspaceID != "" && !workspace.Unlimited() {
+					role, err := authorizer.WorkspaceRole(r.Context(), authz.SubjectFromClaims(claims), workspaceID)
+					if err != nil {
+						logger.Warn().Err(err).Str("workspace_id", workspaceID).Msg("unable to look up workspace role, not applying workspace rate limit")
+					} else if role != "" && (claims.Workspace == "" || claims.Workspace == workspaceID) {
+						add("workspace", group+":workspace:"+workspaceID, workspace)
+					}
+				}
+
+				if len(keys) == 0 {
+					next.ServeHTTP(w, r)
+					return
+				}
+
+				result, err := store.Take(r.Context(), keys...)
+				if err != nil {
+					logger.Warn().Err(err).Msg("rate limit store unavailable, allowing request")
+				} else if !result.Allowed {
+					scope := scopes[result.Key]
+					metrics.RateLimited.WithLabelValues(group, scope).Inc()
+
+					retryAfter := int(math.Ceil(result.RetryAfter.Seconds()))
+					if retryAfter < 1 {
+						retryAfter = 1
+					}
+					logger.Info().Str("scope", scope).Int("retry_after", retryAfter).Msg("rate limit exceeded")
+
+					w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+					writeProblem(w, r, http.StatusTooManyRequests, "rate_limited",
+						fmt.Sprintf("%s rate limit exceeded, retry after %d seconds", scope, retryAfter))
+					return
+				}
+
+				next.ServeHTTP(w, r)
+			},
+		)
+	}
+}
@@ -1,15 +1,132 @@
 package middleware
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authz"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/metrics"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/ratelimit"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/requestid"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
+const testIssuer = "https://keycloak.test/realms/eodhp"
+
+// testJWKS serves a JWKS document with a set of RSA keys that can be rotated during a test.
+type testJWKS struct {
+	mu      sync.Mutex
+	keys    map[string]*rsa.PrivateKey
+	fetches int
+	server  *httptest.Server
+}
+
+func newTestJWKS(t *testing.T) *testJWKS {
+	j := &testJWKS{keys: map[string]*rsa.PrivateKey{}}
+	j.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		j.fetches++
+
+		keys := []map[string]string{}
+		for kid, key := range j.keys {
+			keys = append(keys, map[string]string{
+				"kid": kid,
+				"kty": "RSA",
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	t.Cleanup(j.server.Close)
+	return j
+}
+
+func (j *testJWKS) addKey(t *testing.T, kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	j.mu.Lock()
+	j.keys[kid] = key
+	j.mu.Unlock()
+}
+
+func (j *testJWKS) sign(t *testing.T, kid string, claims authn.Claims) string {
+	j.mu.Lock()
+	key := j.keys[kid]
+	j.mu.Unlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func (j *testJWKS) verifier() *authn.JWKSVerifier {
+	return authn.NewJWKSVerifier(authn.VerifierConfig{
+		JWKSURL:        j.server.URL,
+		Issuer:         testIssuer,
+		ClockSkew:      30 * time.Second,
+		RefreshBackoff: time.Nanosecond,
+	})
+}
+
+func testClaims(issuer string, expiresIn time.Duration) authn.Claims {
+	claims := authn.Claims{Username: "test-user"}
+	claims.Subject = "user-id"
+	claims.Issuer = issuer
+	claims.IssuedAt = jwt.NewNumericDate(time.Now())
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(expiresIn))
+	return claims
+}
+
+// serveWithToken runs the JWT middleware on a request carrying token and returns the status code
+// and the claims seen by the next handler.
+func serveWithToken(verifier authn.TokenVerifier, token string) (int, *authn.Claims) {
+	var seen *authn.Claims
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(ClaimsKey).(authn.Claims)
+		seen = &claims
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Add("Authorization", "Bearer "+token)
+
+	w := httptest.NewRecorder()
+	JWTMiddleware(verifier)(next).ServeHTTP(w, req)
+	return w.Code, seen
+}
+
 func TestProxyAuthRequest_InvalidBearerToken_ClaimsNotPopulated(t *testing.T) {
 	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		claims := r.Context().Value(ClaimsKey).(authn.Claims)
@@ -31,43 +148,277 @@ func TestProxyAuthRequest_InvalidBearerToken_ClaimsNotPopulated(t *testing.T) {
 	}
 	req.Header.Add("Authorization", "Bearer invalid-token")
 
-	mw := JWTMiddleware(next)
+	mw := JWTMiddleware(newTestJWKS(t).verifier())(next)
 	w := httptest.NewRecorder()
 	mw.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
 }
 
-func TestDenyWorkspaceScopedTokens_Middleware_WorkspaceScoped(t *testing.T) {
-	// Define the next handler that will check if the claims are properly populated
-	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// This should not be reached if the token is workspace-scoped
-		t.Fatal("Expected request to be blocked by DenyWorkspaceScopedTokens middleware")
+func TestJWTMiddleware_ValidToken(t *testing.T) {
+	jwks := newTestJWKS(t)
+	jwks.addKey(t, "key-1")
+
+	code, claims := serveWithToken(jwks.verifier(), jwks.sign(t, "key-1", testClaims(testIssuer, time.Minute)))
+
+	assert.Equal(t, http.StatusOK, code)
+	require.NotNil(t, claims)
+	assert.Equal(t, "user-id", claims.Subject)
+	assert.Equal(t, "test-user", claims.Username)
+}
+
+func TestJWTMiddleware_RejectsForgedSignature(t *testing.T) {
+	jwks := newTestJWKS(t)
+	jwks.addKey(t, "key-1")
+	forger := newTestJWKS(t)
+	forger.addKey(t, "key-1")
+
+	code, claims := serveWithToken(jwks.verifier(), forger.sign(t, "key-1", testClaims(testIssuer, time.Minute)))
+
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Nil(t, claims)
+}
+
+func TestJWTMiddleware_RejectsExpiredToken(t *testing.T) {
+	jwks := newTestJWKS(t)
+	jwks.addKey(t, "key-1")
+
+	code, _ := serveWithToken(jwks.verifier(), jwks.sign(t, "key-1", testClaims(testIssuer, -time.Minute)))
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// Tokens that expired within the clock skew are still accepted
+	code, _ = serveWithToken(jwks.verifier(), jwks.sign(t, "key-1", testClaims(testIssuer, -10*time.Second)))
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestJWTMiddleware_RejectsWrongIssuer(t *testing.T) {
+	jwks := newTestJWKS(t)
+	jwks.addKey(t, "key-1")
+
+	code, _ := serveWithToken(jwks.verifier(), jwks.sign(t, "key-1", testClaims("https://evil.test/realms/eodhp", time.Minute)))
+
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestJWTMiddleware_KeyRotation(t *testing.T) {
+	jwks := newTestJWKS(t)
+	jwks.addKey(t, "key-1")
+	verifier := jwks.verifier()
+
+	code, _ := serveWithToken(verifier, jwks.sign(t, "key-1", testClaims(testIssuer, time.Minute)))
+	assert.Equal(t, http.StatusOK, code)
+
+	// A token signed with a newly published key triggers a refetch of the key set
+	jwks.addKey(t, "key-2")
+	code, _ = serveWithToken(verifier, jwks.sign(t, "key-2", testClaims(testIssuer, time.Minute)))
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestJWTMiddleware_UnknownKeysDoNotBypassBackoff(t *testing.T) {
+	jwks := newTestJWKS(t)
+	jwks.addKey(t, "key-1")
+	verifier := authn.NewJWKSVerifier(authn.VerifierConfig{
+		JWKSURL:        jwks.server.URL,
+		Issuer:         testIssuer,
+		CacheTTL:       time.Nanosecond,
+		RefreshBackoff: time.Hour,
 	})
 
-	// Create a mock request with a workspace-scoped token
-	workspaceClaims := authn.Claims{
-		Workspace: "user-scoped", 
+	code, _ := serveWithToken(verifier, jwks.sign(t, "key-1", testClaims(testIssuer, time.Minute)))
+	assert.Equal(t, http.StatusOK, code)
+
+	// The cache has always expired, but unknown key IDs still only refetch once per backoff
+	for i := 0; i < 10; i++ {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, testClaims(testIssuer, time.Minute))
+		token.Header["kid"] = fmt.Sprintf("random-%d", i)
+		signed, err := token.SignedString(jwks.keys["key-1"])
+		require.NoError(t, err)
+
+		code, _ = serveWithToken(verifier, signed)
+		assert.Equal(t, http.StatusUnauthorized, code)
 	}
 
-	// Mock the context with the workspace-scoped claims
-	ctx := context.WithValue(context.Background(), ClaimsKey, workspaceClaims)
+	jwks.mu.Lock()
+	defer jwks.mu.Unlock()
+	assert.Equal(t, 1, jwks.fetches)
+}
 
-	// Create a mock JWT token for the workspace-scoped claims
-	token := "Bearer workspace-scoped-token"
+func TestStatusRecorderFlushes(t *testing.T) {
+	handler := Metrics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("partial"))
+		require.NoError(t, http.NewResponseController(w).Flush())
+	}))
 
-	// Set up the request with the workspace-scoped token
-	req, err := http.NewRequest("GET", "/accounts", nil)
-	if err != nil {
-		t.Fatal(err)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream", nil))
+
+	assert.True(t, w.Flushed)
+	assert.Equal(t, "partial", w.Body.String())
+}
+
+func TestMetricsUsesRouteTemplate(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(Metrics)
+	r.HandleFunc("/workspaces/{workspace-id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	observer := metrics.HTTPRequestDuration.WithLabelValues("/workspaces/{workspace-id}", http.MethodGet, "404")
+	before := testutil.CollectAndCount(metrics.HTTPRequestDuration)
+
+	for _, name := range []string{"one", "two"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/workspaces/"+name, nil))
 	}
-	req.Header.Add("Authorization", token)
-	req = req.WithContext(ctx) 
 
-	mw := DenyWorkspaceScopedTokens(next)
+	// Both requests are recorded in a single series
+	assert.Equal(t, before, testutil.CollectAndCount(metrics.HTTPRequestDuration))
+
+	var sample dto.Metric
+	require.NoError(t, observer.(prometheus.Histogram).Write(&sample))
+	assert.Equal(t, uint64(2), sample.GetHistogram().GetSampleCount())
+}
+
+func TestTracingContinuesCallerTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	var traceID string
+	r := mux.NewRouter()
+	r.Use(Tracing)
+	r.HandleFunc("/workspaces/{workspace-id}", func(w http.ResponseWriter, r *http.Request) {
+		traceID = trace.SpanContextFromContext(r.Context()).TraceID().String()
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/workspaces/one", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "GET /workspaces/{workspace-id}", spans[0].Name())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+}
+
+func TestWithLoggerRequestID(t *testing.T) {
+	var seen string
+	handler := WithLogger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestid.FromContext(r.Context())
+	}))
+
+	// A valid ID from the caller is kept
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set(requestid.Header, "caller-id-1")
 	w := httptest.NewRecorder()
-	mw.ServeHTTP(w, req)
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, "caller-id-1", seen)
+	assert.Equal(t, "caller-id-1", w.Header().Get(requestid.Header))
 
-	// Assert that the response status code is 401 Unauthorized for workspace-scoped tokens
-	if w.Code != http.StatusUnauthorized {
-		t.Errorf("Expected status 401 Unauthorized but got %v", w.Code)
+	// Otherwise one is generated
+	req = httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set(requestid.Header, "not valid\n")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.NotEqual(t, "not valid\n", seen)
+	assert.True(t, requestid.Valid(seen))
+	assert.Equal(t, seen, w.Header().Get(requestid.Header))
+}
+
+func TestWithLoggerAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	original := log.Logger
+	log.Logger = zerolog.New(&buf)
+	t.Cleanup(func() { log.Logger = original })
+
+	jwks := newTestJWKS(t)
+	jwks.addKey(t, "key-1")
+
+	handler := WithLogger(JWTMiddleware(jwks.verifier())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("created"))
+	})))
+
+	req := httptest.NewRequest(http.MethodPost, "/test", nil)
+	req.Header.Set("Authorization", "Bearer "+jwks.sign(t, "key-1", testClaims(testIssuer, time.Minute)))
+	req.Header.Set(requestid.Header, "req-123")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "req-123", entry["request_id"])
+	assert.Equal(t, float64(http.StatusCreated), entry["status"])
+	assert.Equal(t, float64(len("created")), entry["bytes"])
+	assert.Equal(t, "test-user", entry["username"])
+	assert.Contains(t, entry, "duration")
+}
+
+// workspaceMembers is an authorizer that knows the role of each "user-id/workspace" pair.
+type workspaceMembers map[string]string
+
+func (m workspaceMembers) Authorize(ctx context.Context, subject authz.Subject, action string, resource authz.Resource) (authz.Decision, error) {
+	return authz.Decision{}, nil
+}
+
+func (m workspaceMembers) WorkspaceRole(ctx context.Context, subject authz.Subject, workspace string) (string, error) {
+	return m[subject.UserID+"/"+workspace], nil
+}
+
+func TestRateLimit(t *testing.T) {
+	store := ratelimit.NewMemoryStore()
+	members := workspaceMembers{
+		"alice-id/ws-1": "editor", "bob-id/ws-1": "editor", "carol-id/ws-1": "editor", "dave-id/ws-1": "editor",
+		"dave-id/ws-2": "editor", "erin-id/ws-4": "editor", "frank-id/ws-4": "viewer",
+	}
+	mw := RateLimit(store, "s3Tokens", ratelimit.PerMinute(1, 2), ratelimit.PerMinute(1, 3), members)
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(username, workspaceID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/workspaces/"+workspaceID+"/s3-tokens", nil)
+		claims := authn.Claims{Username: username}
+		claims.Subject = username + "-id"
+		req = req.WithContext(context.WithValue(req.Context(), ClaimsKey, claims))
+		req = mux.SetURLVars(req, map[string]string{"workspace-id": workspaceID})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
 	}
+
+	// Each user is limited to their burst
+	assert.Equal(t, http.StatusOK, request("alice", "ws-1").Code)
+	assert.Equal(t, http.StatusOK, request("alice", "ws-2").Code)
+
+	w := request("alice", "ws-3")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+
+	var body problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "rate_limited", body.Code)
+
+	// Each workspace is limited across its members
+	assert.Equal(t, http.StatusOK, request("bob", "ws-1").Code)
+	assert.Equal(t, http.StatusOK, request("carol", "ws-1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, request("dave", "ws-1").Code)
+
+	// A refused request does not use up the user's other limit
+	assert.Equal(t, http.StatusOK, request("dave", "ws-2").Code)
+	assert.Equal(t, http.StatusOK, request("dave", "ws-2").Code)
+
+	// Requests from users without access to a workspace do not count against its limit
+	assert.Equal(t, http.StatusOK, request("mallory", "ws-4").Code)
+	assert.Equal(t, http.StatusOK, request("mallory", "ws-4").Code)
+	assert.Equal(t, http.StatusOK, request("erin", "ws-4").Code)
+	assert.Equal(t, http.StatusOK, request("erin", "ws-4").Code)
+	assert.Equal(t, http.StatusOK, request("frank", "ws-4").Code)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.RateLimited.WithLabelValues("s3Tokens", "user")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.RateLimited.WithLabelValues("s3Tokens", "workspace")))
 }
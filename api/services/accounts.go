@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"net/http"
@@ -12,6 +13,7 @@ import (
 	"github.com/EO-DataHub/eodhp-workspace-services/db"
 	"github.com/EO-DataHub/eodhp-workspace-services/internal/appconfig"
 	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authz"
 	ws_services "github.com/EO-DataHub/eodhp-workspace-services/models"
 	"github.com/aws/aws-sdk-go-v2/service/sesv2"
 	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
@@ -25,8 +27,38 @@ var (
 	AccountStatusApproved = "Approved"
 	AccountStatusDenied   = "Denied"
 	AccountStatusPending  = "Pending"
+	// AccountStatusSuspended accounts keep their workspaces and data, but nothing new can be
+	// written to them until a hub admin reactivates the account
+	AccountStatusSuspended = "Suspended"
+	// AccountStatusClosed accounts have been closed by a hub admin. Like suspended accounts they
+	// keep their data and can be reactivated
+	AccountStatusClosed = "Closed"
+	// AccountStatusClosing accounts are deleted once all of their workspaces have been deleted
+	AccountStatusClosing = db.AccountStatusClosing
 )
 
+// Longest values accepted for the account fields users can set.
+const (
+	maxAccountNameLength          = 255
+	maxBillingAddressLength       = 1000
+	maxOrganizationNameLength     = 255
+	maxAccountOpeningReasonLength = 2000
+)
+
+// accountFieldRules lists every field of ws_services.Account an update may contain. The owner and
+// status are changed by hub admins through their own requests.
+var accountFieldRules = map[string]fieldRule{
+	"id":                   fieldImmutable,
+	"accountOwner":         fieldImmutable,
+	"status":               fieldImmutable,
+	"name":                 fieldMutable,
+	"billingAddress":       fieldMutable,
+	"organizationName":     fieldMutable,
+	"accountOpeningReason": fieldMutable,
+	"createdAt":            fieldServerManaged,
+	"workspaces":           fieldServerManaged,
+}
+
 type EmailClient interface {
 	SendEmail(ctx context.Context, input *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error)
 }
@@ -36,6 +68,12 @@ type BillingAccountService struct {
 	DB             db.WorkspaceDBInterface
 	AWSEmailClient EmailClient
 	KC             KeycloakClientInterface
+	// Authorizer decides what users may do. The default policy is used if it is nil.
+	Authorizer authz.Authorizer
+}
+
+func (svc *BillingAccountService) authorizer() authz.Authorizer {
+	return authorizerOrDefault(svc.Authorizer, svc.DB, svc.KC)
 }
 
 // CreateAccountService creates a new account for the authenticated user.
@@ -47,7 +85,11 @@ func (svc *BillingAccountService) CreateAccountService(w http.ResponseWriter, r
 	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
 	if !ok {
 		logger.Warn().Msg("Unauthorized request: missing claims")
-		WriteResponse(w, http.StatusUnauthorized, nil)
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
+		return
+	}
+
+	if !authorize(w, r, svc.authorizer(), claims, authz.ActionAccountCreate, authz.Resource{}) {
 		return
 	}
 
@@ -55,35 +97,40 @@ func (svc *BillingAccountService) CreateAccountService(w http.ResponseWriter, r
 	var messagePayload ws_services.Account
 	if err := json.NewDecoder(r.Body).Decode(&messagePayload); err != nil {
 		logger.Warn().Err(err).Msg("Invalid request payload")
-		WriteResponse(w, http.StatusBadRequest, nil)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "")
 		return
 	}
 
-	// Only hub_admin can create accounts owned by other users otherwise the account owner is the authenticated user
-	if !HasRole(claims.RealmAccess.Roles, "hub_admin") {
-		messagePayload.AccountOwner = claims.Username
+	if fieldErrs := validateAccount(&messagePayload); len(fieldErrs) > 0 {
+		WriteProblem(w, r, NewProblem(http.StatusUnprocessableEntity, CodeValidationFailed, "Invalid account.").
+			WithFieldErrors(fieldErrs...))
+		return
 	}
 
-	// Create the account in the database
-	account, err := svc.DB.CreateAccount(&messagePayload)
+	// Only hub admins can create accounts owned by other users otherwise the account owner is the authenticated user
+	decision, err := svc.authorizer().Authorize(r.Context(), authz.SubjectFromClaims(claims), authz.ActionAccountCreateForOthers, authz.Resource{})
 	if err != nil {
-		logger.Error().Err(err).Msg("Failed to create account in database")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		logger.Error().Err(err).Msg("Failed to authorize account owner")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
+	if !decision.Allowed {
+		messagePayload.AccountOwner = claims.Username
+	}
 
-	token, err := svc.DB.CreateAccountApprovalToken(account.ID)
+	// Create the account in the database
+	account, err := svc.DB.CreateAccount(r.Context(), &messagePayload)
 	if err != nil {
-		logger.Error().Err(err).Msg("Failed to create account approval token")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		logger.Error().Err(err).Msg("Failed to create account in database")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
-	err = svc.SendAccountRequestEmail(account, token)
+	err = svc.SendAccountRequestEmail(account)
 
 	if err != nil {
 		logger.Error().Err(err).Msg("Failed to send account request email")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
@@ -104,16 +151,20 @@ func (svc *BillingAccountService) GetAccountsService(w http.ResponseWriter, r *h
 	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
 	if !ok {
 		logger.Warn().Msg("Unauthorized request: missing claims")
-		WriteResponse(w, http.StatusUnauthorized, nil)
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
+		return
+	}
+
+	if !authorize(w, r, svc.authorizer(), claims, authz.ActionAccountList, authz.Resource{}) {
 		return
 	}
 
 	// Retrieve accounts associated with the user's username
-	accounts, err := svc.DB.GetAccounts(claims.Username)
+	accounts, err := svc.DB.GetAccounts(r.Context(), claims.Username)
 
 	if err != nil {
 		logger.Error().Err(err).Msg("Failed to retrieve accounts from database")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
@@ -135,7 +186,7 @@ func (svc *BillingAccountService) GetAccountService(w http.ResponseWriter, r *ht
 	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
 	if !ok {
 		logger.Warn().Msg("Unauthorized request: missing claims")
-		WriteResponse(w, http.StatusUnauthorized, nil)
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
 		return
 	}
 
@@ -143,33 +194,32 @@ func (svc *BillingAccountService) GetAccountService(w http.ResponseWriter, r *ht
 	accountID, err := uuid.Parse(mux.Vars(r)["account-id"])
 	if err != nil {
 		logger.Error().Err(err).Msg("Account doesn't exist")
-		WriteResponse(w, http.StatusBadRequest, nil)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "")
 		return
 	}
 
 	// Retrieve account associated with the user's username
-	account, err := svc.DB.GetAccount(accountID)
+	account, err := svc.DB.GetAccount(r.Context(), accountID)
 
 	if err != nil {
 		logger.Error().Err(err).Str("account_id", accountID.String()).Msg("Database error retrieving account")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
 	// Handle non-existent account
 	if account == nil {
 		logger.Warn().Str("account_id", accountID.String()).Msg("Account not found")
-		WriteResponse(w, http.StatusNotFound, nil)
+		WriteError(w, r, http.StatusNotFound, CodeAccountNotFound, "Account does not exist.")
 		return
 	}
 
-	// Check if the account owner matches the claims username
-	if account.AccountOwner != claims.Username {
-		logger.Warn().Str("account_id", accountID.String()).Str("requested_by", claims.Username).Msg("Access denied: User not owner of account")
-		WriteResponse(w, http.StatusForbidden, nil)
+	// Only the account owner can read an account
+	if !authorize(w, r, svc.authorizer(), claims, authz.ActionAccountRead, authz.Resource{Owner: account.AccountOwner}) {
 		return
 	}
 
+	w.Header().Set("ETag", accountETag(account))
 	WriteResponse(w, http.StatusOK, *account)
 
 }
@@ -179,54 +229,208 @@ func (svc *BillingAccountService) UpdateAccountService(w http.ResponseWriter, r
 
 	logger := zerolog.Ctx(r.Context())
 
+	// Extract claims from the request context to identify the user
+	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
+	if !ok {
+		logger.Warn().Msg("Unauthorized request: missing claims")
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
+		return
+	}
+
 	// Parse the account ID from the URL path
 	accountID, err := uuid.Parse(mux.Vars(r)["account-id"])
 
 	if err != nil {
 		logger.Warn().Err(err).Msg("Account doesn't exist")
-		WriteResponse(w, http.StatusBadRequest, nil)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "")
 		return
 	}
 
-	// Decode the request payload into an Account struct
+	// Retrieve the account to check who owns it
+	account, err := svc.DB.GetAccount(r.Context(), accountID)
+	if err != nil {
+		logger.Error().Err(err).Str("account_id", accountID.String()).Msg("Database error retrieving account")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	if account == nil {
+		logger.Warn().Str("account_id", accountID.String()).Msg("Account not found")
+		WriteError(w, r, http.StatusNotFound, CodeAccountNotFound, "Account does not exist.")
+		return
+	}
+
+	if !authorize(w, r, svc.authorizer(), claims, authz.ActionAccountUpdate, authz.Resource{Owner: account.AccountOwner}) {
+		return
+	}
+
+	// Clients can send the ETag they read the account with so that they do not overwrite changes
+	// made since
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !etagMatches(ifMatch, accountETag(account)) {
+		logger.Warn().Str("account_id", accountID.String()).Msg("Account has changed since it was read")
+		WriteError(w, r, http.StatusPreconditionFailed, CodePreconditionFailed, "Account has been changed since it was read.")
+		return
+	}
+
+	// Fields omitted from the body keep their current values
+	var target map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&target); err != nil || target == nil {
+		logger.Warn().Err(err).Msg("Invalid update request payload")
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "request body must be a JSON object")
+		return
+	}
+
+	current, err := toJSONObject(account)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to encode account")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+	for field, value := range current {
+		if _, ok := target[field]; !ok {
+			target[field] = value
+		}
+	}
+
+	unknown, immutable := checkFields(accountFieldRules, current, target)
+	if len(unknown) > 0 {
+		logger.Warn().Strs("fields", unknown).Msg("Unknown account fields in request")
+		WriteProblem(w, r, NewProblem(http.StatusBadRequest, CodeValidationFailed,
+			fmt.Sprintf("unknown fields: %s", strings.Join(unknown, ", "))).WithFieldErrors(fieldErrors(unknown, "is not an account field")...))
+		return
+	}
+	if len(immutable) > 0 {
+		logger.Warn().Strs("fields", immutable).Msg("Attempt to change immutable account fields")
+		WriteProblem(w, r, NewProblem(http.StatusUnprocessableEntity, CodeImmutableField,
+			fmt.Sprintf("fields cannot be changed: %s", strings.Join(immutable, ", "))).WithFieldErrors(fieldErrors(immutable, "cannot be changed")...))
+		return
+	}
+
+	// Server managed fields keep their stored values
+	for field, rule := range accountFieldRules {
+		if rule == fieldServerManaged {
+			target[field] = current[field]
+		}
+	}
+
+	body, err := json.Marshal(target)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to encode account")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
 	var updatePayload ws_services.Account
-	if err := json.NewDecoder(r.Body).Decode(&updatePayload); err != nil {
+	if err := json.Unmarshal(body, &updatePayload); err != nil {
 		logger.Warn().Err(err).Msg("Invalid update request payload")
-		WriteResponse(w, http.StatusBadRequest, nil)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("invalid request payload: %v", err))
+		return
+	}
+
+	if fieldErrs := validateAccount(&updatePayload); len(fieldErrs) > 0 {
+		WriteProblem(w, r, NewProblem(http.StatusUnprocessableEntity, CodeValidationFailed, "Invalid account.").
+			WithFieldErrors(fieldErrs...))
 		return
 	}
 
 	// Call UpdateAccount to change the account fields in the database
-	updatedAccount, err := svc.DB.UpdateAccount(accountID, updatePayload)
+	updatedAccount, err := svc.DB.UpdateAccount(r.Context(), accountID, updatePayload, account.Version)
 	if err != nil {
 		logger.Error().Err(err).Str("account_id", accountID.String()).Msg("Database error updating account")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	// Another request changed the account after it was read
+	if updatedAccount == nil {
+		logger.Warn().Str("account_id", accountID.String()).Msg("Account changed during update")
+		WriteError(w, r, http.StatusPreconditionFailed, CodePreconditionFailed, "Account has been changed since it was read.")
 		return
 	}
 
 	logger.Info().Str("account_id", updatedAccount.ID.String()).Msg("Account updated successfully")
+	w.Header().Set("ETag", accountETag(updatedAccount))
 	WriteResponse(w, http.StatusOK, *updatedAccount)
 
 }
 
-// DeleteAccountService deletes an account specified by the account ID from the URL path.
+// DeleteAccountService deletes an account specified by the account ID from the URL path. An
+// account with workspaces is only deleted with cascade=true, which closes it and deletes its
+// workspaces first.
 func (svc *BillingAccountService) DeleteAccountService(w http.ResponseWriter, r *http.Request) {
 
 	logger := zerolog.Ctx(r.Context())
 
+	// Extract claims from the request context to identify the user
+	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
+	if !ok {
+		logger.Warn().Msg("Unauthorized request: missing claims")
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
+		return
+	}
+
 	accountID, err := uuid.Parse(mux.Vars(r)["account-id"])
 	if err != nil {
 		logger.Warn().Err(err).Msg("Account doesn't exist")
-		WriteResponse(w, http.StatusBadRequest, nil)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "")
+		return
+	}
+
+	// Retrieve the account to check who owns it
+	account, err := svc.DB.GetAccount(r.Context(), accountID)
+	if err != nil {
+		logger.Error().Err(err).Str("account_id", accountID.String()).Msg("Database error retrieving account")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	if account == nil {
+		logger.Warn().Str("account_id", accountID.String()).Msg("Account not found")
+		WriteError(w, r, http.StatusNotFound, CodeAccountNotFound, "Account does not exist.")
+		return
+	}
+
+	if !authorize(w, r, svc.authorizer(), claims, authz.ActionAccountDelete, authz.Resource{Owner: account.AccountOwner}) {
+		return
+	}
+
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !etagMatches(ifMatch, accountETag(account)) {
+		logger.Warn().Str("account_id", accountID.String()).Msg("Account has changed since it was read")
+		WriteError(w, r, http.StatusPreconditionFailed, CodePreconditionFailed, "Account has been changed since it was read.")
 		return
 	}
 
-	// TODO: Need to send a publish message to delete all workspaces associated with the account
-	err = svc.DB.DeleteAccount(accountID)
+	// Deleting the row would remove the workspaces without the workspace manager tearing them down,
+	// so an account with workspaces is closed instead and deleted once they have gone
+	if len(account.Workspaces) > 0 {
+		if r.URL.Query().Get("cascade") != "true" {
+			WriteError(w, r, http.StatusConflict, CodeAccountHasWorkspaces,
+				fmt.Sprintf("Account has %d workspaces. Delete them first, or set cascade=true to delete them with the account.", len(account.Workspaces)))
+			return
+		}
+
+		deleting, err := svc.DB.CloseAccount(r.Context(), accountID, claims.Username)
+		if err != nil {
+			logger.Error().Err(err).Str("account_id", accountID.String()).Msg("Database error closing account")
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+			return
+		}
+
+		logger.Info().Str("account_id", accountID.String()).Strs("workspaces", deleting).Msg("Account closing, deleting its workspaces")
+		WriteResponse(w, http.StatusAccepted, nil)
+		return
+	}
 
+	// The account is only deleted if it has not changed since it was read and checked
+	deleted, err := svc.DB.DeleteAccount(r.Context(), accountID, account.Version, claims.Username)
 	if err != nil {
 		logger.Error().Err(err).Str("account_id", accountID.String()).Msg("Database error deleting account")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	if !deleted {
+		logger.Warn().Str("account_id", accountID.String()).Msg("Account changed during deletion")
+		WriteError(w, r, http.StatusPreconditionFailed, CodePreconditionFailed, "Account has been changed since it was read.")
 		return
 	}
 
@@ -234,87 +438,159 @@ func (svc *BillingAccountService) DeleteAccountService(w http.ResponseWriter, r
 	WriteResponse(w, http.StatusNoContent, nil)
 }
 
-// DeleteAccountService deletes an account specified by the account ID from the URL path.
-func (svc *BillingAccountService) AccountApprovalService(w http.ResponseWriter, r *http.Request, accountStatusRequest string) {
+// validateAccount checks the fields of an account that users can set.
+func validateAccount(account *ws_services.Account) []FieldError {
+	var fieldErrs []FieldError
+
+	checkLength := func(field, value string, max int, required bool) {
+		if required && strings.TrimSpace(value) == "" {
+			fieldErrs = append(fieldErrs, FieldError{Field: field, Message: "is required"})
+		} else if len(value) > max {
+			fieldErrs = append(fieldErrs, FieldError{Field: field, Message: fmt.Sprintf("must be at most %d characters", max)})
+		}
+	}
+
+	checkLength("name", account.Name, maxAccountNameLength, true)
+	checkLength("billingAddress", account.BillingAddress, maxBillingAddressLength, true)
+	if account.OrganizationName != nil {
+		checkLength("organizationName", *account.OrganizationName, maxOrganizationNameLength, false)
+	}
+	if account.AccountOpeningReason != nil {
+		checkLength("accountOpeningReason", *account.AccountOpeningReason, maxAccountOpeningReasonLength, false)
+	}
+
+	return fieldErrs
+}
+
+// accountETag returns the entity tag of the current version of an account.
+func accountETag(account *ws_services.Account) string {
+	return fmt.Sprintf(`"%d"`, account.Version)
+}
+
+// etagMatches reports whether an If-Match header lists etag or is a wildcard.
+func etagMatches(ifMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// maxDecisionReasonLength is the longest reason a hub admin can give for a decision.
+const maxDecisionReasonLength = 2000
+
+// AccountDecisionService approves or denies the pending account in the URL path, recording who
+// decided and why, and emails the decision to the account owner.
+func (svc *BillingAccountService) AccountDecisionService(w http.ResponseWriter, r *http.Request) {
 
 	logger := zerolog.Ctx(r.Context())
 
-	vars := mux.Vars(r)
-	token := vars["token"]
+	// Extract claims from the request context to identify the user
+	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
+	if !ok {
+		logger.Warn().Msg("Unauthorized request: missing claims")
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
+		return
+	}
 
-	if token == "" {
-		logger.Warn().Msg("Token is required")
-		http.Error(w, "Token is required", http.StatusBadRequest)
+	if !authorize(w, r, svc.authorizer(), claims, authz.ActionAccountApprove, authz.Resource{}) {
 		return
 	}
 
-	// Validate token
-	accountID, err := svc.DB.ValidateApprovalToken(token)
+	accountID, err := uuid.Parse(mux.Vars(r)["account-id"])
 	if err != nil {
-		logger.Error().Err(err).Msg("Invalid or expired token")
-		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "account ID is not valid")
 		return
 	}
 
-	// Convert accountID to UUID
-	parsedID, err := uuid.Parse(accountID)
-	if err != nil {
-		logger.Error().Err(err).Msg("Invalid account id")
-		http.Error(w, "Invalid account id", http.StatusBadRequest)
+	// Decode and validate the decision
+	var payload ws_services.AccountDecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		logger.Warn().Err(err).Msg("Invalid request payload")
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "")
+		return
+	}
+
+	var status string
+	var fieldErrs []FieldError
+	switch payload.Decision {
+	case "approve":
+		status = AccountStatusApproved
+	case "deny":
+		status = AccountStatusDenied
+		// The owner is told why their account was denied
+		if strings.TrimSpace(payload.Reason) == "" {
+			fieldErrs = append(fieldErrs, FieldError{Field: "reason", Message: "is required to deny an account"})
+		}
+	default:
+		fieldErrs = append(fieldErrs, FieldError{Field: "decision", Message: "must be approve or deny"})
+	}
+	if len(payload.Reason) > maxDecisionReasonLength {
+		fieldErrs = append(fieldErrs, FieldError{Field: "reason", Message: fmt.Sprintf("must be at most %d characters", maxDecisionReasonLength)})
+	}
+
+	if len(fieldErrs) > 0 {
+		WriteProblem(w, r, NewProblem(http.StatusUnprocessableEntity, CodeValidationFailed, "Invalid decision.").
+			WithFieldErrors(fieldErrs...))
 		return
 	}
 
 	// Retrieve the account from the database
-	account, err := svc.DB.GetAccount(parsedID)
+	account, err := svc.DB.GetAccount(r.Context(), accountID)
 	if err != nil {
 		logger.Error().Err(err).Msg("Database error retrieving account")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+	if account == nil {
+		WriteError(w, r, http.StatusNotFound, CodeAccountNotFound, "Account does not exist.")
 		return
 	}
 
 	// Find the email address of the account owner
-	user, err := svc.KC.GetUser(account.AccountOwner)
+	user, err := svc.KC.GetUser(r.Context(), account.AccountOwner)
 	if err != nil {
 		logger.Error().Err(err).Msg("Failed to get user from Keycloak")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
-	// Update the account status in the database
-	if err := svc.DB.UpdateAccountStatus(token, accountID, accountStatusRequest); err != nil {
+	decision, err := svc.DB.DecideAccount(r.Context(), accountID, status, claims.Username, payload.Reason)
+	if err != nil {
 		logger.Error().Err(err).Msg("Failed to update account status")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+	if decision == nil {
+		WriteError(w, r, http.StatusConflict, CodeConflict, fmt.Sprintf("Account is %s, not %s.", account.Status, AccountStatusPending))
 		return
 	}
 
-	// Send confirmation email to the account owner
-	switch accountStatusRequest {
+	logger.Info().Str("account_id", accountID.String()).Str("status", status).Str("decided_by", claims.Username).Msg("Account decided")
+
+	// The decision stands even if the owner could not be told about it
+	switch status {
 	case AccountStatusApproved:
 		err = svc.SendAccountApprovalEmail(account, user.Email)
-		if err != nil {
-			logger.Error().Err(err).Msg("Failed to send account confirmation email")
-			WriteResponse(w, http.StatusInternalServerError, nil)
-			return
-		}
-		logger.Info().Str("account_id", account.ID.String()).Msg("Account confirmation email sent successfully")
 	case AccountStatusDenied:
-		err = svc.SendAccountDenialEmail(account, user.Email)
-		if err != nil {
-			logger.Error().Err(err).Msg("Failed to send account denial email")
-			WriteResponse(w, http.StatusInternalServerError, nil)
-			return
-		}
-		logger.Info().Str("account_id", account.ID.String()).Msg("Account denial email sent successfully")
+		err = svc.SendAccountDenialEmail(account, user.Email, payload.Reason)
+	}
+	if err != nil {
+		logger.Error().Err(err).Str("account_id", accountID.String()).Msg("Failed to send account decision email")
+	} else {
+		logger.Info().Str("account_id", accountID.String()).Msg("Account decision email sent successfully")
 	}
 
-	WriteResponse(w, http.StatusOK, fmt.Sprintf("Account has been %s", accountStatusRequest))
+	WriteResponse(w, http.StatusOK, decision)
 }
 
 // SendAccountRequestEmail sends an email to the helpdesk with the account request details.
-func (svc *BillingAccountService) SendAccountRequestEmail(account *ws_services.Account, token string) error {
+func (svc *BillingAccountService) SendAccountRequestEmail(account *ws_services.Account) error {
 	subject := fmt.Sprintf("EO DataHub Account Request - %s", account.AccountOwner)
-	approvalLink := fmt.Sprintf("https://%s/api/accounts/admin/approve/%s", svc.Config.Host, token)
-	denialLink := fmt.Sprintf("https://%s/api/accounts/admin/deny/%s", svc.Config.Host, token)
+	pendingLink := fmt.Sprintf("https://%s/api/admin/accounts/pending", svc.Config.Host)
+	decisionLink := fmt.Sprintf("https://%s/api/admin/accounts/%s/decision", svc.Config.Host, account.ID)
 
 	body := fmt.Sprintf(`
 	A new billing account has been requested:
@@ -325,16 +601,12 @@ func (svc *BillingAccountService) SendAccountRequestEmail(account *ws_services.A
 	Billing Address: %s
 	Account Opening Reason: %s
 
-	Choose one of the following options:
-
-	To approve the account, click the following link:
+	Hub admins can review the accounts awaiting approval at:
 	%s
 
-	To deny the account, click the following link:
+	To approve or deny this account, POST {"decision": "approve"} or {"decision": "deny", "reason": "..."} to:
 	%s
-
-	Make sure you are authenticated to the EO DataHub and logged in before clicking a link.
-	`, account.AccountOwner, account.Name, *account.OrganizationName, account.BillingAddress, *account.AccountOpeningReason, approvalLink, denialLink)
+	`, account.AccountOwner, account.Name, *account.OrganizationName, account.BillingAddress, *account.AccountOpeningReason, pendingLink, decisionLink)
 
 	return svc.sendEmail(svc.Config.Accounts.ServiceAccountEmail, svc.Config.Accounts.HelpdeskEmail, subject, body)
 }
@@ -375,8 +647,9 @@ func (svc *BillingAccountService) SendAccountApprovalEmail(account *ws_services.
 	return svc.sendEmail(svc.Config.Accounts.ServiceAccountEmail, recipient, subject, body)
 }
 
-// SendAccountDenialEmail sends an email to the account owner with the account denial details.
-func (svc *BillingAccountService) SendAccountDenialEmail(account *ws_services.Account, recipient string) error {
+// SendAccountDenialEmail sends an email to the account owner with the account denial details and
+// the reason it was denied.
+func (svc *BillingAccountService) SendAccountDenialEmail(account *ws_services.Account, recipient, reason string) error {
 	subject := fmt.Sprintf("EO DataHub Billing Account Denial - %s", account.Name)
 
 	body := fmt.Sprintf(`
@@ -385,6 +658,8 @@ func (svc *BillingAccountService) SendAccountDenialEmail(account *ws_services.Ac
 	Thank you for your interest in EO DataHub. After reviewing your account request, 
 	we regret to inform you that your billing account application has not been approved at this time.
 
+	Reason: %s
+
 	Below is a summary of the submitted account details:
 
 	Account Owner: %s
@@ -397,13 +672,18 @@ func (svc *BillingAccountService) SendAccountDenialEmail(account *ws_services.Ac
 
 	Regards,
 	EO DataHub Team
-	`, account.AccountOwner, account.AccountOwner, account.Name, *account.OrganizationName, account.BillingAddress, *account.AccountOpeningReason)
+	`, account.AccountOwner, reason, account.AccountOwner, account.Name, *account.OrganizationName, account.BillingAddress, *account.AccountOpeningReason)
 
 	return svc.sendEmail(svc.Config.Accounts.ServiceAccountEmail, recipient, subject, body)
 }
 
 // sendEmail is a shared helper to construct and send an SES email
 func (svc *BillingAccountService) sendEmail(from, to, subject, body string) error {
+	return sendEmail(svc.AWSEmailClient, from, to, subject, body)
+}
+
+// sendEmail constructs and sends a plain text email through SES
+func sendEmail(client EmailClient, from, to, subject, body string) error {
 	input := &sesv2.SendEmailInput{
 		FromEmailAddress: aws.String(from),
 		Destination: &types.Destination{
@@ -428,7 +708,7 @@ func (svc *BillingAccountService) sendEmail(from, to, subject, body string) erro
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	_, err := svc.AWSEmailClient.SendEmail(ctx, input)
+	_, err := client.SendEmail(ctx, input)
 	if err != nil {
 		return fmt.Errorf("failed to send email: %v", err)
 	}
@@ -8,8 +8,10 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	ws_manager "github.com/EO-DataHub/eodhp-workspace-manager/models"
 	"github.com/EO-DataHub/eodhp-workspace-services/api/middleware"
 	"github.com/EO-DataHub/eodhp-workspace-services/internal/appconfig"
 	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
@@ -22,22 +24,6 @@ import (
 	"github.com/stretchr/testify/mock"
 )
 
-func TestCreateAccountApprovalToken(t *testing.T) {
-
-	mockDB := new(MockWorkspaceDB)
-
-	mockDB.On("CreateAccountApprovalToken", mock.AnythingOfType("uuid.UUID")).Return("some-token", nil)
-
-	token, err := mockDB.CreateAccountApprovalToken(uuid.New())
-
-	mockDB.AssertExpectations(t)
-
-	// Check if the return value is correct
-	if token != "some-token" || err != nil {
-		t.Errorf("Expected token 'some-token' but got '%s' and error '%v'", token, err)
-	}
-}
-
 func TestCreateAccountService(t *testing.T) {
 
 	// Create a mock database, email client, and config
@@ -71,9 +57,6 @@ func TestCreateAccountService(t *testing.T) {
 	// Set up the mock for CreateAccount method
 	mockDB.On("CreateAccount", mock.Anything).Return(testAccount, nil)
 
-	// Set up the mock for CreateAccountApprovalToken method
-	mockDB.On("CreateAccountApprovalToken", mock.AnythingOfType("uuid.UUID")).Return("some-token", nil)
-
 	// Mock the email client to return a successful response
 	mockAWSEmailClient.On("SendEmail", mock.Anything, mock.Anything, mock.Anything).
 		Return(&sesv2.SendEmailOutput{}, nil)
@@ -172,7 +155,8 @@ func TestDeleteAccountService(t *testing.T) {
 		Username: "testuser",
 	}
 
-	mockDB.On("DeleteAccount", accountID).Return(nil).Once()
+	mockDB.On("GetAccount", accountID).Return(&models.Account{ID: accountID, AccountOwner: "testuser", Version: 3}, nil).Once()
+	mockDB.On("DeleteAccount", accountID, 3, "testuser").Return(true, nil).Once()
 
 	req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/accounts/%s", accountID), nil)
 	req = mux.SetURLVars(req, map[string]string{"account-id": accountID.String()})
@@ -191,8 +175,89 @@ func TestDeleteAccountService(t *testing.T) {
 	assert.Equal(t, http.StatusNoContent, res.StatusCode, "Expected HTTP status 204 No Content")
 
 	mockDB.AssertExpectations(t)
-	mockDB.AssertCalled(t, "DeleteAccount", accountID)
+	mockDB.AssertCalled(t, "DeleteAccount", accountID, 3, "testuser")
+
+}
+
+func TestDeleteAccountServiceChangedDuringDeletion(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	accountID := uuid.New()
+
+	// The account's status is changed after it is read, so it is not deleted
+	mockDB.On("GetAccount", accountID).Return(&models.Account{ID: accountID, AccountOwner: "testuser", Version: 3}, nil).Once()
+	mockDB.On("DeleteAccount", accountID, 3, "testuser").Return(false, nil).Once()
+
+	req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/accounts/%s", accountID), nil)
+	req.Header.Set("If-Match", `"3"`)
+	req = mux.SetURLVars(req, map[string]string{"account-id": accountID.String()})
+	req = req.WithContext(context.WithValue(req.Context(), middleware.ClaimsKey, authn.Claims{Username: "testuser"}))
+
+	w := httptest.NewRecorder()
+
+	svc := BillingAccountService{DB: mockDB}
+	svc.DeleteAccountService(w, req)
+
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	mockDB.AssertExpectations(t)
+}
+
+func TestDeleteAccountServiceNotOwner(t *testing.T) {
+
+	mockDB := new(MockWorkspaceDB)
+	accountID := uuid.New()
+
+	mockDB.On("GetAccount", accountID).Return(&models.Account{ID: accountID, AccountOwner: "someone-else"}, nil).Once()
+
+	req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/accounts/%s", accountID), nil)
+	req = mux.SetURLVars(req, map[string]string{"account-id": accountID.String()})
+	req = req.WithContext(context.WithValue(req.Context(), middleware.ClaimsKey, authn.Claims{Username: "testuser"}))
+
+	w := httptest.NewRecorder()
+
+	svc := BillingAccountService{DB: mockDB}
+	svc.DeleteAccountService(w, req)
 
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	mockDB.AssertNotCalled(t, "DeleteAccount", accountID, mock.Anything, mock.Anything)
+}
+
+func TestDeleteAccountServiceWithWorkspaces(t *testing.T) {
+
+	mockDB := new(MockWorkspaceDB)
+	accountID := uuid.New()
+
+	mockDB.On("GetAccount", accountID).Return(&models.Account{
+		ID:           accountID,
+		AccountOwner: "testuser",
+		Workspaces:   []ws_manager.WorkspaceSettings{{Name: "ws-1"}, {Name: "ws-2"}},
+	}, nil)
+
+	newRequest := func(query string) *http.Request {
+		req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/accounts/%s%s", accountID, query), nil)
+		req = mux.SetURLVars(req, map[string]string{"account-id": accountID.String()})
+		return req.WithContext(context.WithValue(req.Context(), middleware.ClaimsKey, authn.Claims{Username: "testuser"}))
+	}
+
+	svc := BillingAccountService{DB: mockDB}
+
+	// Workspaces must be deleted first
+	w := httptest.NewRecorder()
+	svc.DeleteAccountService(w, newRequest(""))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	var problem Problem
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, CodeAccountHasWorkspaces, problem.Code)
+
+	// Or deleted with the account, which is removed once they have gone
+	mockDB.On("CloseAccount", accountID, "testuser").Return([]string{"ws-1", "ws-2"}, nil).Once()
+
+	w = httptest.NewRecorder()
+	svc.DeleteAccountService(w, newRequest("?cascade=true"))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	mockDB.AssertExpectations(t)
+	mockDB.AssertNotCalled(t, "DeleteAccount", accountID, mock.Anything, mock.Anything)
 }
 
 func TestGetAccountService(t *testing.T) {
@@ -232,3 +297,178 @@ func TestGetAccountService(t *testing.T) {
 	mockDB.AssertCalled(t, "GetAccount", accountID)
 
 }
+
+// newDecisionRequest returns a request from a hub admin deciding on an account.
+func newDecisionRequest(accountID uuid.UUID, body string) *http.Request {
+	claims := authn.Claims{Username: "admin"}
+	claims.RealmAccess.Roles = []string{"hub_admin"}
+
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/admin/accounts/%s/decision", accountID), strings.NewReader(body))
+	req = mux.SetURLVars(req, map[string]string{"account-id": accountID.String()})
+	return req.WithContext(context.WithValue(req.Context(), middleware.ClaimsKey, claims))
+}
+
+func TestAccountDecisionService(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	mockKC := new(MockKeycloakClient)
+	mockEmail := new(MockAWSEmailClient)
+	svc := BillingAccountService{
+		Config:         &appconfig.Config{Accounts: appconfig.AccountsConfig{ServiceAccountEmail: "service@example.com"}},
+		DB:             mockDB,
+		KC:             mockKC,
+		AWSEmailClient: mockEmail,
+	}
+
+	accountID := uuid.New()
+	account := &models.Account{
+		ID:                   accountID,
+		Name:                 "Test Account",
+		AccountOwner:         "testuser",
+		OrganizationName:     aws.String("Telespazio UK"),
+		AccountOpeningReason: aws.String("Testing"),
+		Status:               AccountStatusPending,
+	}
+	mockDB.On("GetAccount", accountID).Return(account, nil)
+	mockKC.On("GetUser", "testuser").Return(&models.User{Username: "testuser", Email: "testuser@example.com"}, nil)
+	mockDB.On("DecideAccount", accountID, AccountStatusDenied, "admin", "Not an EO project").
+		Return(&models.AccountDecision{AccountID: accountID, Status: AccountStatusDenied, DecidedBy: "admin", Reason: "Not an EO project"}, nil).Once()
+	mockEmail.On("SendEmail", mock.Anything, mock.Anything, mock.Anything).Return(&sesv2.SendEmailOutput{}, nil)
+
+	w := httptest.NewRecorder()
+	svc.AccountDecisionService(w, newDecisionRequest(accountID, `{"decision": "deny", "reason": "Not an EO project"}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var decision models.AccountDecision
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &decision))
+	assert.Equal(t, "admin", decision.DecidedBy)
+
+	// The owner is told why the account was denied
+	mockEmail.AssertCalled(t, "SendEmail", mock.Anything, mock.MatchedBy(func(input *sesv2.SendEmailInput) bool {
+		return input.Destination.ToAddresses[0] == "testuser@example.com" &&
+			strings.Contains(*input.Content.Simple.Body.Text.Data, "Reason: Not an EO project")
+	}), mock.Anything)
+
+	// An account that has already been decided conflicts
+	mockDB.On("DecideAccount", accountID, AccountStatusApproved, "admin", "").Return((*models.AccountDecision)(nil), nil).Once()
+
+	w = httptest.NewRecorder()
+	svc.AccountDecisionService(w, newDecisionRequest(accountID, `{"decision": "approve"}`))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestAccountDecisionServiceInvalidDecision(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	svc := BillingAccountService{DB: mockDB, KC: new(MockKeycloakClient)}
+	accountID := uuid.New()
+
+	for _, body := range []string{`{"decision": "maybe"}`, `{"decision": "deny"}`, `{"decision": "deny", "reason": " "}`} {
+		w := httptest.NewRecorder()
+		svc.AccountDecisionService(w, newDecisionRequest(accountID, body))
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code, body)
+	}
+
+	// Only hub admins can decide
+	req := newDecisionRequest(accountID, `{"decision": "approve"}`)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.ClaimsKey, authn.Claims{Username: "testuser"}))
+
+	w := httptest.NewRecorder()
+	svc.AccountDecisionService(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	mockDB.AssertNotCalled(t, "DecideAccount")
+}
+
+// newUpdateAccountRequest returns a request from testuser to update an account.
+func newUpdateAccountRequest(accountID uuid.UUID, body, ifMatch string) *http.Request {
+	req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/accounts/%s", accountID), strings.NewReader(body))
+	req = mux.SetURLVars(req, map[string]string{"account-id": accountID.String()})
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	return req.WithContext(context.WithValue(req.Context(), middleware.ClaimsKey, authn.Claims{Username: "testuser"}))
+}
+
+func TestUpdateAccountService(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	svc := BillingAccountService{DB: mockDB}
+
+	accountID := uuid.New()
+	account := &models.Account{
+		ID:             accountID,
+		Name:           "Test Account",
+		AccountOwner:   "testuser",
+		BillingAddress: "123 Test St, London, UK",
+		Status:         AccountStatusApproved,
+		Version:        3,
+	}
+	mockDB.On("GetAccount", accountID).Return(account, nil)
+
+	// Only the name changes, and the owner and status are kept
+	expected := *account
+	expected.Name = "Renamed"
+	expected.Workspaces = nil
+	expected.Version = 0
+	updated := expected
+	updated.Version = 4
+	mockDB.On("UpdateAccount", accountID, expected, 3).Return(&updated, nil).Once()
+
+	w := httptest.NewRecorder()
+	svc.UpdateAccountService(w, newUpdateAccountRequest(accountID, `{"name": "Renamed", "status": "Approved"}`, `"3"`))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+
+	// A stale ETag is refused before anything is changed
+	w = httptest.NewRecorder()
+	svc.UpdateAccountService(w, newUpdateAccountRequest(accountID, `{"name": "Renamed"}`, `"2"`))
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	// As is a change made between reading and updating the account
+	mockDB.On("UpdateAccount", accountID, expected, 3).Return((*models.Account)(nil), nil).Once()
+
+	w = httptest.NewRecorder()
+	svc.UpdateAccountService(w, newUpdateAccountRequest(accountID, `{"name": "Renamed"}`, ""))
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestUpdateAccountServiceInvalidFields(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	svc := BillingAccountService{DB: mockDB}
+
+	accountID := uuid.New()
+	mockDB.On("GetAccount", accountID).Return(&models.Account{
+		ID:             accountID,
+		Name:           "Test Account",
+		AccountOwner:   "testuser",
+		BillingAddress: "123 Test St, London, UK",
+		Status:         AccountStatusPending,
+	}, nil)
+
+	tests := []struct {
+		body   string
+		status int
+		code   string
+	}{
+		{`{"status": "Approved"}`, http.StatusUnprocessableEntity, CodeImmutableField},
+		{`{"accountOwner": "mallory"}`, http.StatusUnprocessableEntity, CodeImmutableField},
+		{`{"billingAddress": "  "}`, http.StatusUnprocessableEntity, CodeValidationFailed},
+		{`{"name": "` + strings.Repeat("a", maxAccountNameLength+1) + `"}`, http.StatusUnprocessableEntity, CodeValidationFailed},
+		{`{"color": "blue"}`, http.StatusBadRequest, CodeValidationFailed},
+		{`[]`, http.StatusBadRequest, CodeInvalidRequest},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		svc.UpdateAccountService(w, newUpdateAccountRequest(accountID, tt.body, ""))
+		assert.Equal(t, tt.status, w.Code, tt.body)
+
+		var problem Problem
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+		assert.Equal(t, tt.code, problem.Code, tt.body)
+	}
+
+	mockDB.AssertNotCalled(t, "UpdateAccount")
+}
@@ -0,0 +1,503 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EO-DataHub/eodhp-workspace-services/api/middleware"
+	"github.com/EO-DataHub/eodhp-workspace-services/db"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/appconfig"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authz"
+	"github.com/EO-DataHub/eodhp-workspace-services/models"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+)
+
+// Page sizes for the admin listings. Listing workspaces looks up the members of each one in
+// Keycloak, so pages are kept small.
+const (
+	defaultAdminPageSize = 50
+	maxAdminPageSize     = 100
+)
+
+// AdminService lets hub admins manage the accounts and workspaces of every user.
+type AdminService struct {
+	Config *appconfig.Config
+	DB     db.WorkspaceDBInterface
+	KC     KeycloakClientInterface
+	// AWSEmailClient sends the emails telling account owners their account's status has changed.
+	AWSEmailClient EmailClient
+	// Authorizer decides what users may do. The default policy is used if it is nil.
+	Authorizer authz.Authorizer
+}
+
+func (svc *AdminService) authorizer() authz.Authorizer {
+	return authorizerOrDefault(svc.Authorizer, svc.DB, svc.KC)
+}
+
+// adminListQuery is the sorting and paging requested for an admin listing.
+type adminListQuery struct {
+	sort       string
+	descending bool
+	offset     int
+	limit      int
+}
+
+// ListAccountsService lists the accounts of every user, filtered by status, owner and
+// organisation. A Link header gives the URL of the next page, if there is one.
+func (svc *AdminService) ListAccountsService(w http.ResponseWriter, r *http.Request) {
+	svc.listAccounts(w, r, r.URL.Query().Get("status"))
+}
+
+// ListPendingAccountsService lists the accounts awaiting approval, filtered by owner and
+// organisation.
+func (svc *AdminService) ListPendingAccountsService(w http.ResponseWriter, r *http.Request) {
+	svc.listAccounts(w, r, AccountStatusPending)
+}
+
+// listAccounts lists the accounts with status, or of any status if it is empty.
+func (svc *AdminService) listAccounts(w http.ResponseWriter, r *http.Request, status string) {
+
+	logger := zerolog.Ctx(r.Context())
+
+	if _, ok := svc.authorizeAdmin(w, r, authz.ActionAdminRead); !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	page, err := parseAdminListQuery(query, db.AccountSortColumns)
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	// One more account than the page holds shows whether there is a next page
+	accounts, err := svc.DB.ListAccounts(r.Context(), models.AccountListOptions{
+		Status:       status,
+		Owner:        query.Get("owner"),
+		Organization: query.Get("organization"),
+		Sort:         page.sort,
+		Descending:   page.descending,
+		Offset:       page.offset,
+		Limit:        page.limit + 1,
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to list accounts")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	if len(accounts) > page.limit {
+		accounts = accounts[:page.limit]
+		setNextPageLink(w, r, query, page)
+	}
+
+	if accounts == nil {
+		accounts = []models.AdminAccount{}
+	}
+
+	WriteResponse(w, http.StatusOK, accounts)
+}
+
+// ListWorkspacesService lists the workspaces of every account with the number of members of
+// each, filtered by status, account and creation time. A Link header gives the URL of the next
+// page, if there is one.
+func (svc *AdminService) ListWorkspacesService(w http.ResponseWriter, r *http.Request) {
+
+	logger := zerolog.Ctx(r.Context())
+
+	if _, ok := svc.authorizeAdmin(w, r, authz.ActionAdminRead); !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	page, err := parseAdminListQuery(query, db.WorkspaceSortColumns)
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	opts := models.WorkspaceListOptions{
+		Status:     query.Get("status"),
+		Sort:       page.sort,
+		Descending: page.descending,
+		Offset:     page.offset,
+		Limit:      page.limit + 1,
+	}
+	if value := query.Get("account"); value != "" {
+		account, err := uuid.Parse(value)
+		if err != nil {
+			WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "account query parameter must be an account ID")
+			return
+		}
+		opts.Account = &account
+	}
+	if opts.CreatedBefore, err = parseTimeQuery(query, "created_before"); err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+	if opts.CreatedAfter, err = parseTimeQuery(query, "created_after"); err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	workspaces, err := svc.DB.ListWorkspaces(r.Context(), opts)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to list workspaces")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	if len(workspaces) > page.limit {
+		workspaces = workspaces[:page.limit]
+		setNextPageLink(w, r, query, page)
+	}
+
+	// Membership is held in Keycloak. A workspace whose members cannot be counted is still
+	// listed, without a count.
+	for i := range workspaces {
+		if workspaces[i].Status == "Unavailable" {
+			continue
+		}
+		count, err := svc.countMembers(r.Context(), workspaces[i].Name)
+		if err != nil {
+			logger.Warn().Err(err).Str("workspace_id", workspaces[i].Name).Msg("Failed to count workspace members")
+			continue
+		}
+		workspaces[i].MemberCount = &count
+	}
+
+	if workspaces == nil {
+		workspaces = []models.AdminWorkspace{}
+	}
+
+	WriteResponse(w, http.StatusOK, workspaces)
+}
+
+// SuspendAccountService suspends an approved account. Its workspaces and data are kept, but no
+// workspaces can be created for it and nothing new can be written to them.
+func (svc *AdminService) SuspendAccountService(w http.ResponseWriter, r *http.Request) {
+	svc.changeAccountStatus(w, r, []string{AccountStatusApproved}, AccountStatusSuspended)
+}
+
+// CloseAccountService closes an approved or suspended account, keeping its workspaces and data.
+func (svc *AdminService) CloseAccountService(w http.ResponseWriter, r *http.Request) {
+	svc.changeAccountStatus(w, r, []string{AccountStatusApproved, AccountStatusSuspended}, AccountStatusClosed)
+}
+
+// ReactivateAccountService approves a suspended or closed account again.
+func (svc *AdminService) ReactivateAccountService(w http.ResponseWriter, r *http.Request) {
+	svc.changeAccountStatus(w, r, []string{AccountStatusSuspended, AccountStatusClosed}, AccountStatusApproved)
+}
+
+// changeAccountStatus moves the account in the URL path to another status, recording the reason
+// given in the request body and emailing the account owner. The account must have one of the
+// statuses it is moved from.
+func (svc *AdminService) changeAccountStatus(w http.ResponseWriter, r *http.Request, from []string, to string) {
+
+	logger := zerolog.Ctx(r.Context())
+
+	claims, ok := svc.authorizeAdmin(w, r, authz.ActionAdminManage)
+	if !ok {
+		return
+	}
+
+	accountID, err := uuid.Parse(mux.Vars(r)["account-id"])
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "account ID is not valid")
+		return
+	}
+
+	// The reason is optional, so the body can be empty
+	var payload models.AccountStatusChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "")
+		return
+	}
+	if len(payload.Reason) > maxDecisionReasonLength {
+		WriteProblem(w, r, NewProblem(http.StatusUnprocessableEntity, CodeValidationFailed, "Invalid status change.").
+			WithFieldErrors(FieldError{Field: "reason", Message: fmt.Sprintf("must be at most %d characters", maxDecisionReasonLength)}))
+		return
+	}
+
+	account, err := svc.DB.GetAccount(r.Context(), accountID)
+	if err != nil {
+		logger.Error().Err(err).Str("account_id", accountID.String()).Msg("Database error retrieving account")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+	if account == nil {
+		WriteError(w, r, http.StatusNotFound, CodeAccountNotFound, "Account does not exist.")
+		return
+	}
+
+	change, err := svc.DB.SetAccountStatus(r.Context(), accountID, from, to, claims.Username, payload.Reason)
+	if err != nil {
+		logger.Error().Err(err).Str("account_id", accountID.String()).Msg("Failed to change account status")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+	if change == nil {
+		WriteError(w, r, http.StatusConflict, CodeConflict, fmt.Sprintf("Account is %s, not %s.", account.Status, strings.Join(from, " or ")))
+		return
+	}
+
+	logger.Info().Str("account_id", accountID.String()).Str("from", change.FromStatus).Str("status", to).Str("changed_by", claims.Username).Msg("Account status changed")
+
+	// The change stands even if the owner could not be told about it
+	if err := svc.sendAccountStatusEmail(r.Context(), account, change); err != nil {
+		logger.Error().Err(err).Str("account_id", accountID.String()).Msg("Failed to send account status email")
+	}
+
+	WriteResponse(w, http.StatusNoContent, nil)
+}
+
+// ListAccountStatusChangesService lists the status changes of the account in the URL path,
+// oldest first. Changes are kept after the account is deleted.
+func (svc *AdminService) ListAccountStatusChangesService(w http.ResponseWriter, r *http.Request) {
+
+	logger := zerolog.Ctx(r.Context())
+
+	if _, ok := svc.authorizeAdmin(w, r, authz.ActionAdminRead); !ok {
+		return
+	}
+
+	accountID, err := uuid.Parse(mux.Vars(r)["account-id"])
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "account ID is not valid")
+		return
+	}
+
+	changes, err := svc.DB.ListAccountStatusChanges(r.Context(), accountID)
+	if err != nil {
+		logger.Error().Err(err).Str("account_id", accountID.String()).Msg("Database error listing account status changes")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	if changes == nil {
+		changes = []models.AccountStatusChange{}
+	}
+
+	WriteResponse(w, http.StatusOK, changes)
+}
+
+// sendAccountStatusEmail tells the owner of an account that its status has changed.
+func (svc *AdminService) sendAccountStatusEmail(ctx context.Context, account *models.Account, change *models.AccountStatusChange) error {
+	user, err := svc.KC.GetUser(ctx, account.AccountOwner)
+	if err != nil {
+		return fmt.Errorf("failed to get account owner: %w", err)
+	}
+
+	var summary string
+	switch change.ToStatus {
+	case AccountStatusSuspended:
+		summary = "Your billing account has been suspended. Your workspaces and data have been kept, but you cannot create workspaces, upload files or request workspace credentials until the account is reactivated."
+	case AccountStatusClosed:
+		summary = "Your billing account has been closed. Your workspaces and data have been kept, but you cannot create workspaces, upload files or request workspace credentials unless the account is reactivated."
+	case AccountStatusApproved:
+		summary = "Your billing account has been reactivated, and you can use its workspaces again."
+	default:
+		summary = fmt.Sprintf("The status of your billing account has changed to %s.", change.ToStatus)
+	}
+
+	reason := change.Reason
+	if reason == "" {
+		reason = "None given"
+	}
+
+	subject := fmt.Sprintf("EO DataHub Billing Account %s - %s", change.ToStatus, account.Name)
+	body := fmt.Sprintf(`
+	Dear %s,
+
+	%s
+
+	Account Name: %s
+	Previous Status: %s
+	New Status: %s
+	Reason: %s
+
+	If you have any questions, please contact our support team at enquiries@eodatahub.org.uk.
+
+	Regards,
+	EO DataHub Team
+	`, account.AccountOwner, summary, account.Name, change.FromStatus, change.ToStatus, reason)
+
+	return sendEmail(svc.AWSEmailClient, svc.Config.Accounts.ServiceAccountEmail, user.Email, subject, body)
+}
+
+// SuspendWorkspaceService suspends a workspace.
+func (svc *AdminService) SuspendWorkspaceService(w http.ResponseWriter, r *http.Request) {
+
+	logger := zerolog.Ctx(r.Context())
+
+	claims, workspaceID, ok := svc.resolveAdminWorkspace(w, r)
+	if !ok {
+		return
+	}
+
+	suspended, err := svc.DB.SuspendWorkspace(r.Context(), workspaceID, claims.Username)
+	if err != nil {
+		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to suspend workspace")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+	if !suspended {
+		WriteError(w, r, http.StatusConflict, CodeConflict, "Workspace is already suspended.")
+		return
+	}
+
+	logger.Info().Str("workspace_id", workspaceID).Str("suspended_by", claims.Username).Msg("Workspace suspended")
+	WriteResponse(w, http.StatusNoContent, nil)
+}
+
+// ReactivateWorkspaceService lifts the suspension of a workspace.
+func (svc *AdminService) ReactivateWorkspaceService(w http.ResponseWriter, r *http.Request) {
+
+	logger := zerolog.Ctx(r.Context())
+
+	claims, workspaceID, ok := svc.resolveAdminWorkspace(w, r)
+	if !ok {
+		return
+	}
+
+	reactivated, err := svc.DB.ReactivateWorkspace(r.Context(), workspaceID)
+	if err != nil {
+		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to reactivate workspace")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+	if !reactivated {
+		WriteError(w, r, http.StatusConflict, CodeConflict, "Workspace is not suspended.")
+		return
+	}
+
+	logger.Info().Str("workspace_id", workspaceID).Str("reactivated_by", claims.Username).Msg("Workspace reactivated")
+	WriteResponse(w, http.StatusNoContent, nil)
+}
+
+// authorizeAdmin checks that the user may perform an admin action. It writes an error response
+// and returns false if they may not.
+func (svc *AdminService) authorizeAdmin(w http.ResponseWriter, r *http.Request, action string) (authn.Claims, bool) {
+	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
+	if !ok {
+		zerolog.Ctx(r.Context()).Warn().Msg("Unauthorized request: missing claims")
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
+		return claims, false
+	}
+
+	return claims, authorize(w, r, svc.authorizer(), claims, action, authz.Resource{})
+}
+
+// resolveAdminWorkspace checks that the user may manage workspaces and that the workspace in the
+// URL path exists.
+func (svc *AdminService) resolveAdminWorkspace(w http.ResponseWriter, r *http.Request) (authn.Claims, string, bool) {
+	claims, ok := svc.authorizeAdmin(w, r, authz.ActionAdminManage)
+	if !ok {
+		return claims, "", false
+	}
+
+	workspaceID := mux.Vars(r)["workspace-id"]
+	if _, err := svc.DB.GetWorkspace(r.Context(), workspaceID); errors.Is(err, sql.ErrNoRows) {
+		zerolog.Ctx(r.Context()).Warn().Str("workspace_id", workspaceID).Msg("Workspace not found")
+		WriteError(w, r, http.StatusNotFound, CodeWorkspaceNotFound, "Workspace does not exist.")
+		return claims, "", false
+	} else if err != nil {
+		zerolog.Ctx(r.Context()).Error().Err(err).Str("workspace_id", workspaceID).Msg("Database error retrieving workspace")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return claims, "", false
+	}
+
+	return claims, workspaceID, true
+}
+
+// countMembers returns the number of members of a workspace's Keycloak group.
+func (svc *AdminService) countMembers(ctx context.Context, workspace string) (int, error) {
+	group, err := svc.KC.GetGroup(ctx, workspace)
+	if err != nil {
+		return 0, err
+	}
+
+	members, err := svc.KC.GetGroupMembers(ctx, group.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(members), nil
+}
+
+// parseAdminListQuery parses the sort, order, limit and cursor query parameters of an admin
+// listing. Results can be sorted by the keys of sortColumns.
+func parseAdminListQuery(query url.Values, sortColumns map[string]string) (adminListQuery, error) {
+	page := adminListQuery{sort: query.Get("sort"), limit: defaultAdminPageSize}
+
+	if page.sort != "" {
+		if _, ok := sortColumns[page.sort]; !ok {
+			keys := make([]string, 0, len(sortColumns))
+			for key := range sortColumns {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			return page, fmt.Errorf("sort query parameter must be one of %s", strings.Join(keys, ", "))
+		}
+	}
+
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		page.descending = true
+	default:
+		return page, errors.New("order query parameter must be asc or desc")
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxAdminPageSize {
+			return page, fmt.Errorf("limit query parameter must be an integer between 1 and %d", maxAdminPageSize)
+		}
+		page.limit = limit
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		offset, err := decodeCursor(cursor)
+		if err != nil {
+			return page, errors.New("cursor query parameter is invalid")
+		}
+		page.offset = offset
+	}
+
+	return page, nil
+}
+
+// setNextPageLink sets a Link header to the page after page.
+func setNextPageLink(w http.ResponseWriter, r *http.Request, query url.Values, page adminListQuery) {
+	query.Set("limit", strconv.Itoa(page.limit))
+	query.Set("cursor", encodeCursor(page.offset+page.limit))
+	w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, query.Encode()))
+}
+
+// parseTimeQuery parses an RFC 3339 time query parameter, returning nil if it is not set.
+func parseTimeQuery(query url.Values, name string) (*time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s query parameter must be an RFC 3339 time", name)
+	}
+	return &t, nil
+}
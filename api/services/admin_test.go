@@ -0,0 +1,314 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	ws_manager "github.com/EO-DataHub/eodhp-workspace-manager/models"
+	"github.com/EO-DataHub/eodhp-workspace-services/api/middleware"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/appconfig"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
+	"github.com/EO-DataHub/eodhp-workspace-services/models"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newAdminRequest returns a request to the admin API from a user with realmRoles.
+func newAdminRequest(method, target string, vars map[string]string, realmRoles ...string) *http.Request {
+	claims := authn.Claims{Username: "admin"}
+	claims.RealmAccess.Roles = realmRoles
+
+	req := httptest.NewRequest(method, target, nil)
+	req = mux.SetURLVars(req, vars)
+	return req.WithContext(context.WithValue(req.Context(), middleware.ClaimsKey, claims))
+}
+
+func TestListAccountsService(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	svc := AdminService{DB: mockDB, KC: new(MockKeycloakClient)}
+
+	// One account more than the limit is fetched to find whether there is a next page
+	mockDB.On("ListAccounts", models.AccountListOptions{
+		Status: "Approved", Organization: "acme", Sort: "name", Descending: true, Limit: 2,
+	}).Return([]models.AdminAccount{{Name: "b"}, {Name: "a"}}, nil).Once()
+
+	w := httptest.NewRecorder()
+	svc.ListAccountsService(w, newAdminRequest(http.MethodGet, "/api/admin/accounts?status=Approved&organization=acme&sort=name&order=desc&limit=1", nil, "hub_admin"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var accounts []models.AdminAccount
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &accounts))
+	assert.Equal(t, []models.AdminAccount{{Name: "b"}}, accounts)
+
+	link := w.Header().Get("Link")
+	require.Regexp(t, `^<(.+)>; rel="next"$`, link)
+	next, err := url.Parse(link[1 : len(link)-len(`>; rel="next"`)])
+	require.NoError(t, err)
+	assert.Equal(t, "/api/admin/accounts", next.Path)
+	assert.Equal(t, "acme", next.Query().Get("organization"))
+
+	// Following the link continues from where the page ended
+	mockDB.On("ListAccounts", models.AccountListOptions{
+		Status: "Approved", Organization: "acme", Sort: "name", Descending: true, Offset: 1, Limit: 2,
+	}).Return([]models.AdminAccount{{Name: "a"}}, nil).Once()
+
+	w = httptest.NewRecorder()
+	svc.ListAccountsService(w, newAdminRequest(http.MethodGet, "/api/admin/accounts?"+next.RawQuery, nil, "hub_admin"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Link"))
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestListAccountsService_InvalidParameters(t *testing.T) {
+	svc := AdminService{DB: new(MockWorkspaceDB), KC: new(MockKeycloakClient)}
+
+	for _, query := range []string{"sort=password", "order=up", "limit=0", "limit=101", "cursor=not-a-cursor"} {
+		w := httptest.NewRecorder()
+		svc.ListAccountsService(w, newAdminRequest(http.MethodGet, "/api/admin/accounts?"+query, nil, "hub_admin"))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestListWorkspacesService(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	mockKC := new(MockKeycloakClient)
+	svc := AdminService{DB: mockDB, KC: mockKC}
+
+	accountID := uuid.New()
+	mockDB.On("ListWorkspaces", models.WorkspaceListOptions{Account: &accountID, Limit: defaultAdminPageSize + 1}).
+		Return([]models.AdminWorkspace{{Name: "ws-1"}, {Name: "ws-2"}, {Name: "ws-3", Status: "Unavailable"}}, nil)
+	mockKC.On("GetGroup", "ws-1").Return(&models.Group{ID: "group-1"}, nil)
+	mockKC.On("GetGroupMembers", "group-1").Return([]models.User{{Username: "alice"}, {Username: "bob"}}, nil)
+	mockKC.On("GetGroup", "ws-2").Return((*models.Group)(nil), errors.New("keycloak unavailable"))
+
+	w := httptest.NewRecorder()
+	svc.ListWorkspacesService(w, newAdminRequest(http.MethodGet, "/api/admin/workspaces?account="+accountID.String(), nil, "hub_admin"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Workspaces whose members cannot be counted are listed without a count
+	var workspaces []models.AdminWorkspace
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &workspaces))
+	require.Len(t, workspaces, 3)
+	require.NotNil(t, workspaces[0].MemberCount)
+	assert.Equal(t, 2, *workspaces[0].MemberCount)
+	assert.Nil(t, workspaces[1].MemberCount)
+	assert.Nil(t, workspaces[2].MemberCount)
+
+	// Creation times must be RFC 3339
+	w = httptest.NewRecorder()
+	svc.ListWorkspacesService(w, newAdminRequest(http.MethodGet, "/api/admin/workspaces?created_after=yesterday", nil, "hub_admin"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAdminServiceRequiresHubAdmin(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	svc := AdminService{DB: mockDB, KC: new(MockKeycloakClient)}
+
+	w := httptest.NewRecorder()
+	svc.ListAccountsService(w, newAdminRequest(http.MethodGet, "/api/admin/accounts", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	svc.SuspendWorkspaceService(w, newAdminRequest(http.MethodPost, "/api/admin/workspaces/ws-1/suspend", map[string]string{"workspace-id": "ws-1"}))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	mockDB.AssertNotCalled(t, "ListAccounts")
+	mockDB.AssertNotCalled(t, "SuspendWorkspace")
+}
+
+func TestSuspendAccountService(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	mockKC := new(MockKeycloakClient)
+	mockEmail := new(MockAWSEmailClient)
+	svc := AdminService{
+		Config:         &appconfig.Config{Accounts: appconfig.AccountsConfig{ServiceAccountEmail: "service@example.com"}},
+		DB:             mockDB,
+		KC:             mockKC,
+		AWSEmailClient: mockEmail,
+	}
+
+	accountID := uuid.New()
+	vars := map[string]string{"account-id": accountID.String()}
+	mockDB.On("GetAccount", accountID).Return(&models.Account{ID: accountID, Name: "Acme", AccountOwner: "alice", Status: AccountStatusApproved}, nil)
+	mockDB.On("SetAccountStatus", accountID, []string{AccountStatusApproved}, AccountStatusSuspended, "admin", "").
+		Return(&models.AccountStatusChange{AccountID: accountID, FromStatus: AccountStatusApproved, ToStatus: AccountStatusSuspended, ChangedBy: "admin"}, nil).Once()
+	mockKC.On("GetUser", "alice").Return(&models.User{Username: "alice", Email: "alice@example.com"}, nil)
+	mockEmail.On("SendEmail", mock.Anything, mock.Anything, mock.Anything).Return(&sesv2.SendEmailOutput{}, nil)
+
+	w := httptest.NewRecorder()
+	svc.SuspendAccountService(w, newAdminRequest(http.MethodPost, "/api/admin/accounts/"+accountID.String()+"/suspend", vars, "hub_admin"))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// The owner is told the account has been suspended
+	mockEmail.AssertCalled(t, "SendEmail", mock.Anything, mock.MatchedBy(func(input *sesv2.SendEmailInput) bool {
+		return input.Destination.ToAddresses[0] == "alice@example.com" &&
+			strings.Contains(*input.Content.Simple.Body.Text.Data, "New Status: Suspended")
+	}), mock.Anything)
+
+	// An account that is not approved cannot be suspended
+	mockDB.On("SetAccountStatus", accountID, []string{AccountStatusApproved}, AccountStatusSuspended, "admin", "").
+		Return((*models.AccountStatusChange)(nil), nil).Once()
+
+	w = httptest.NewRecorder()
+	svc.SuspendAccountService(w, newAdminRequest(http.MethodPost, "/api/admin/accounts/"+accountID.String()+"/suspend", vars, "hub_admin"))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	mockDB.AssertExpectations(t)
+	mockEmail.AssertNumberOfCalls(t, "SendEmail", 1)
+}
+
+func TestCloseAndReactivateAccountService(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	mockKC := new(MockKeycloakClient)
+	mockEmail := new(MockAWSEmailClient)
+	svc := AdminService{
+		Config:         &appconfig.Config{Accounts: appconfig.AccountsConfig{ServiceAccountEmail: "service@example.com"}},
+		DB:             mockDB,
+		KC:             mockKC,
+		AWSEmailClient: mockEmail,
+	}
+
+	accountID := uuid.New()
+	vars := map[string]string{"account-id": accountID.String()}
+	newRequest := func(action, body string) *http.Request {
+		req := newAdminRequest(http.MethodPost, "/api/admin/accounts/"+accountID.String()+"/"+action, vars, "hub_admin")
+		req.Body = io.NopCloser(strings.NewReader(body))
+		return req
+	}
+
+	mockDB.On("GetAccount", accountID).Return(&models.Account{ID: accountID, Name: "Acme", AccountOwner: "alice", Status: AccountStatusSuspended}, nil)
+	mockKC.On("GetUser", "alice").Return(&models.User{Username: "alice", Email: "alice@example.com"}, nil)
+
+	// The reason is recorded with the change and shown to the owner
+	mockDB.On("SetAccountStatus", accountID, []string{AccountStatusApproved, AccountStatusSuspended}, AccountStatusClosed, "admin", "Unpaid invoices").
+		Return(&models.AccountStatusChange{FromStatus: AccountStatusSuspended, ToStatus: AccountStatusClosed, Reason: "Unpaid invoices"}, nil).Once()
+	mockEmail.On("SendEmail", mock.Anything, mock.Anything, mock.Anything).Return(&sesv2.SendEmailOutput{}, nil)
+
+	w := httptest.NewRecorder()
+	svc.CloseAccountService(w, newRequest("close", `{"reason": "Unpaid invoices"}`))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	mockEmail.AssertCalled(t, "SendEmail", mock.Anything, mock.MatchedBy(func(input *sesv2.SendEmailInput) bool {
+		return strings.Contains(*input.Content.Simple.Body.Text.Data, "Reason: Unpaid invoices")
+	}), mock.Anything)
+
+	// A closed account can be reactivated, and the change stands if the owner cannot be emailed
+	mockDB.On("SetAccountStatus", accountID, []string{AccountStatusSuspended, AccountStatusClosed}, AccountStatusApproved, "admin", "").
+		Return(&models.AccountStatusChange{FromStatus: AccountStatusClosed, ToStatus: AccountStatusApproved}, nil).Once()
+	mockEmail.ExpectedCalls = nil
+	mockEmail.On("SendEmail", mock.Anything, mock.Anything, mock.Anything).Return((*sesv2.SendEmailOutput)(nil), errors.New("SES unavailable"))
+
+	w = httptest.NewRecorder()
+	svc.ReactivateAccountService(w, newRequest("reactivate", ""))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// Reasons are limited in length
+	w = httptest.NewRecorder()
+	svc.CloseAccountService(w, newRequest("close", `{"reason": "`+strings.Repeat("x", maxDecisionReasonLength+1)+`"}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestSuspendWorkspaceService(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	svc := AdminService{DB: mockDB, KC: new(MockKeycloakClient)}
+
+	vars := map[string]string{"workspace-id": "ws-1"}
+	mockDB.On("GetWorkspace", "ws-1").Return(&ws_manager.WorkspaceSettings{Name: "ws-1"}, nil)
+	mockDB.On("SuspendWorkspace", "ws-1", "admin").Return(true, nil).Once()
+
+	w := httptest.NewRecorder()
+	svc.SuspendWorkspaceService(w, newAdminRequest(http.MethodPost, "/api/admin/workspaces/ws-1/suspend", vars, "hub_admin"))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// Suspending it again conflicts
+	mockDB.On("SuspendWorkspace", "ws-1", "admin").Return(false, nil).Once()
+
+	w = httptest.NewRecorder()
+	svc.SuspendWorkspaceService(w, newAdminRequest(http.MethodPost, "/api/admin/workspaces/ws-1/suspend", vars, "hub_admin"))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestSuspendedWorkspaceRefusesAccess(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	mockKC := new(MockKeycloakClient)
+	admin := AdminService{DB: mockDB, KC: mockKC}
+	members := WorkspaceService{DB: mockDB, KC: mockKC}
+
+	// alice is an admin of test-workspace
+	mockKC.On("GetUserGroups", "user-a").Return([]string{"test-workspace"}, nil)
+	mockDB.On("IsUserAccountOwner", "alice", "test-workspace").Return(false, nil)
+	mockDB.On("GetWorkspaceRole", "test-workspace", "user-a").Return("admin", nil)
+	mockDB.On("GetWorkspace", "test-workspace").Return(&ws_manager.WorkspaceSettings{Name: "test-workspace"}, nil)
+
+	vars := map[string]string{"workspace-id": "test-workspace"}
+	mockDB.On("SuspendWorkspace", "test-workspace", "admin").Return(true, nil).Once()
+
+	w := httptest.NewRecorder()
+	admin.SuspendWorkspaceService(w, newAdminRequest(http.MethodPost, "/api/admin/workspaces/test-workspace/suspend", vars, "hub_admin"))
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	// Members cannot be managed while the workspace is suspended
+	mockDB.On("IsWorkspaceSuspended", "test-workspace").Return(true, nil).Once()
+
+	w = httptest.NewRecorder()
+	members.AddUserService(w, newMemberRequest(http.MethodPut, ""))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	var problem Problem
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+	assert.Equal(t, CodeWorkspaceSuspended, problem.Code)
+	mockKC.AssertNotCalled(t, "AddMemberToGroup", mock.Anything, mock.Anything)
+
+	// and can be again once it is reactivated
+	mockDB.On("ReactivateWorkspace", "test-workspace").Return(true, nil).Once()
+
+	w = httptest.NewRecorder()
+	admin.ReactivateWorkspaceService(w, newAdminRequest(http.MethodPost, "/api/admin/workspaces/test-workspace/reactivate", vars, "hub_admin"))
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	mockDB.On("IsWorkspaceSuspended", "test-workspace").Return(false, nil).Once()
+	mockKC.On("GetGroup", "test-workspace").Return(&models.Group{ID: "group-123", Name: "test-workspace"}, nil)
+	mockKC.On("GetUser", "bob").Return(&models.User{ID: "user-b", Username: "bob"}, nil)
+	mockDB.On("GetWorkspaceRole", "test-workspace", "user-b").Return("", nil)
+	mockDB.On("DeleteWorkspaceRole", "test-workspace", "user-b").Return(nil).Once()
+	mockKC.On("AddMemberToGroup", "user-b", "group-123").Return(nil).Once()
+
+	w = httptest.NewRecorder()
+	members.AddUserService(w, newMemberRequest(http.MethodPut, ""))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	mockDB.AssertExpectations(t)
+	mockKC.AssertExpectations(t)
+}
+
+func TestListPendingAccountsService(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	svc := AdminService{DB: mockDB, KC: new(MockKeycloakClient)}
+
+	// Only pending accounts are listed, whatever status is asked for
+	mockDB.On("ListAccounts", models.AccountListOptions{Status: AccountStatusPending, Owner: "alice", Limit: defaultAdminPageSize + 1}).
+		Return([]models.AdminAccount{}, nil)
+
+	w := httptest.NewRecorder()
+	svc.ListPendingAccountsService(w, newAdminRequest(http.MethodGet, "/api/admin/accounts/pending?owner=alice&status=Approved", nil, "hub_admin"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, "[]", w.Body.String())
+
+	mockDB.AssertExpectations(t)
+}
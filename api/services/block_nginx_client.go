@@ -12,7 +12,11 @@ import (
 	"strings"
 	"time"
 
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/metrics"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/requestid"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/tracing"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const defaultBlockTimeout = 30 * time.Second
@@ -70,7 +74,7 @@ func (c *blockNginxClient) listFiles(ctx context.Context, workspaceID string) ([
 		return nil, http.StatusInternalServerError, err
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req, "list")
 	if err != nil {
 		return nil, http.StatusInternalServerError, err
 	}
@@ -140,7 +144,7 @@ func (c *blockNginxClient) uploadFile(
 	}
 	req.Header.Set("Content-Type", contentType)
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req, "upload")
 	if err != nil {
 		return FileItem{}, err
 	}
@@ -173,7 +177,7 @@ func (c *blockNginxClient) deleteFile(ctx context.Context, workspaceID string, f
 		return err
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req, "delete")
 	if err != nil {
 		return err
 	}
@@ -205,7 +209,7 @@ func (c *blockNginxClient) fileMetadata(ctx context.Context, workspaceID string,
 		return FileItem{}, err
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req, "metadata")
 	if err != nil {
 		return FileItem{}, err
 	}
@@ -240,6 +244,27 @@ func (c *blockNginxClient) fileMetadata(ctx context.Context, workspaceID string,
 	}, nil
 }
 
+// do sends req and records its latency and a client span under operation. Transport failures and server errors
+// count as errors; other statuses are left for the caller to interpret.
+func (c *blockNginxClient) do(req *http.Request, operation string) (*http.Response, error) {
+	ctx, span := tracing.Start(req.Context(), "block-store "+operation, trace.WithSpanKind(trace.SpanKindClient))
+	req = req.WithContext(ctx)
+	tracing.InjectHTTP(ctx, req.Header)
+	requestid.InjectHTTP(ctx, req.Header)
+
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+
+	observed := err
+	if err == nil && resp.StatusCode >= http.StatusInternalServerError {
+		observed = fmt.Errorf("block store returned status %d", resp.StatusCode)
+	}
+	metrics.ObserveDependency(metrics.DependencyBlockStore, operation, start, observed)
+	tracing.End(span, observed)
+
+	return resp, err
+}
+
 // workspaceURL builds a block store URL for a workspace directory or file path.
 func (c *blockNginxClient) workspaceURL(workspaceID string, fileName string, directory bool) (string, error) {
 	workspaceID = strings.TrimSpace(workspaceID)
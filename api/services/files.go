@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"net/http"
 	"strconv"
@@ -12,6 +13,7 @@ import (
 	"github.com/EO-DataHub/eodhp-workspace-services/db"
 	"github.com/EO-DataHub/eodhp-workspace-services/internal/appconfig"
 	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authz"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/gorilla/mux"
@@ -39,6 +41,12 @@ type FileService struct {
 	DB     db.WorkspaceDBInterface
 	KC     KeycloakClientInterface
 	STS    STSClient
+	// Authorizer decides what users may do. The default policy is used if it is nil.
+	Authorizer authz.Authorizer
+}
+
+func (svc *FileService) authorizer() authz.Authorizer {
+	return authorizerOrDefault(svc.Authorizer, svc.DB, svc.KC)
 }
 
 type FileItem struct {
@@ -81,34 +89,31 @@ type FileUploadURLResponse struct {
 	FileName  string `json:"fileName"`
 }
 
-// resolveAuthorizedWorkspace validates access to the requested workspace and loads its settings.
-func (svc *FileService) resolveAuthorizedWorkspace(w http.ResponseWriter, r *http.Request) (string, *ws_manager.WorkspaceSettings, bool) {
+// resolveAuthorizedWorkspace checks that the user may perform action in the requested workspace
+// and loads its settings.
+func (svc *FileService) resolveAuthorizedWorkspace(w http.ResponseWriter, r *http.Request, action string) (string, *ws_manager.WorkspaceSettings, bool) {
 	logger := zerolog.Ctx(r.Context())
 
 	workspaceID := mux.Vars(r)["workspace-id"]
 	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
 	if !ok {
 		logger.Warn().Msg("Unauthorized request: missing claims")
-		WriteResponse(w, http.StatusUnauthorized, "missing claims")
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
 		return "", nil, false
 	}
 
-	authorized, err := isUserWorkspaceAuthorized(svc.DB, svc.KC, claims, workspaceID, false)
-	if err != nil {
-		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to authorize workspace")
-		WriteResponse(w, http.StatusInternalServerError, "authorization failed")
-		return "", nil, false
-	}
-	if !authorized {
-		logger.Warn().Str("workspace_id", workspaceID).Msg("Access denied")
-		WriteResponse(w, http.StatusForbidden, "access denied")
+	if !authorize(w, r, svc.authorizer(), claims, action, authz.Resource{Workspace: workspaceID}) {
 		return "", nil, false
 	}
 
-	workspace, err := svc.DB.GetWorkspace(workspaceID)
-	if err != nil {
-		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Workspace not found")
-		WriteResponse(w, http.StatusNotFound, "workspace not found")
+	workspace, err := svc.DB.GetWorkspace(r.Context(), workspaceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn().Str("workspace_id", workspaceID).Msg("Workspace not found")
+		WriteError(w, r, http.StatusNotFound, CodeWorkspaceNotFound, "workspace not found")
+		return "", nil, false
+	} else if err != nil {
+		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Database error retrieving workspace")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return "", nil, false
 	}
 
@@ -134,7 +139,7 @@ func resolveStoreSelection(storeType string, allowAll bool) (bool, bool, error)
 
 // ListFilesService lists files from object and/or block stores.
 func (svc *FileService) ListFilesService(w http.ResponseWriter, r *http.Request) {
-	workspaceID, workspace, ok := svc.resolveAuthorizedWorkspace(w, r)
+	workspaceID, workspace, ok := svc.resolveAuthorizedWorkspace(w, r, authz.ActionFilesRead)
 	if !ok {
 		return
 	}
@@ -147,7 +152,7 @@ func (svc *FileService) ListFilesService(w http.ResponseWriter, r *http.Request)
 
 	wantObject, wantBlock, err := resolveStoreSelection(storeType, true)
 	if err != nil {
-		WriteResponse(w, http.StatusBadRequest, err.Error())
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
 		return
 	}
 	if wantObject {
@@ -185,7 +190,7 @@ func (svc *FileService) ListFilesService(w http.ResponseWriter, r *http.Request)
 
 // UploadFilesService uploads files to a single store.
 func (svc *FileService) UploadFilesService(w http.ResponseWriter, r *http.Request, storeType string) {
-	workspaceID, workspace, ok := svc.resolveAuthorizedWorkspace(w, r)
+	workspaceID, workspace, ok := svc.resolveAuthorizedWorkspace(w, r, authz.ActionFilesWrite)
 	if !ok {
 		return
 	}
@@ -195,7 +200,7 @@ func (svc *FileService) UploadFilesService(w http.ResponseWriter, r *http.Reques
 	var items []FileItem
 	wantObject, _, err := resolveStoreSelection(storeType, false)
 	if err != nil {
-		WriteResponse(w, http.StatusBadRequest, err.Error())
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
 		return
 	}
 
@@ -205,18 +210,18 @@ func (svc *FileService) UploadFilesService(w http.ResponseWriter, r *http.Reques
 	if wantObject {
 		s3Client, err = svc.newS3Client(r)
 		if err != nil {
-			WriteResponse(w, http.StatusInternalServerError, err.Error())
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 	}
 
 	if err := r.ParseMultipartForm(svc.maxUploadFormMemoryBytes()); err != nil {
-		WriteResponse(w, http.StatusBadRequest, "invalid multipart form data")
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "invalid multipart form data")
 		return
 	}
 	files := collectMultipartFiles(r.MultipartForm)
 	if len(files) == 0 {
-		WriteResponse(w, http.StatusBadRequest, "no files provided")
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "no files provided")
 		return
 	}
 
@@ -224,12 +229,12 @@ func (svc *FileService) UploadFilesService(w http.ResponseWriter, r *http.Reques
 		objectStores, _ := collectStores(workspace)
 		objectStore, err := selectObjectStore(objectStores)
 		if err != nil {
-			WriteResponse(w, http.StatusBadRequest, err.Error())
+			WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
 			return
 		}
 		uploaded, err := svc.uploadObjectStoreFiles(r, s3Client, objectStore, files)
 		if err != nil {
-			WriteResponse(w, http.StatusInternalServerError, err.Error())
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 		items = uploaded
@@ -237,12 +242,12 @@ func (svc *FileService) UploadFilesService(w http.ResponseWriter, r *http.Reques
 		_, blockStores := collectStores(workspace)
 		blockStore, err := selectBlockStore(blockStores)
 		if err != nil {
-			WriteResponse(w, http.StatusBadRequest, err.Error())
+			WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
 			return
 		}
 		uploaded, err := svc.uploadBlockStoreFiles(ctx, workspaceID, blockStore, files)
 		if err != nil {
-			WriteResponse(w, http.StatusInternalServerError, err.Error())
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 		items = uploaded
@@ -256,7 +261,7 @@ func (svc *FileService) UploadFilesService(w http.ResponseWriter, r *http.Reques
 
 // DeleteFilesService deletes files from a single store.
 func (svc *FileService) DeleteFilesService(w http.ResponseWriter, r *http.Request, storeType string) {
-	workspaceID, workspace, ok := svc.resolveAuthorizedWorkspace(w, r)
+	workspaceID, workspace, ok := svc.resolveAuthorizedWorkspace(w, r, authz.ActionFilesWrite)
 	if !ok {
 		return
 	}
@@ -265,11 +270,11 @@ func (svc *FileService) DeleteFilesService(w http.ResponseWriter, r *http.Reques
 
 	fileName := r.URL.Query().Get("file")
 	if fileName == "" {
-		WriteResponse(w, http.StatusBadRequest, "file is required")
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "file is required")
 		return
 	}
 	if err := validateFileName(fileName); err != nil {
-		WriteResponse(w, http.StatusBadRequest, err.Error())
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
 		return
 	}
 
@@ -278,7 +283,7 @@ func (svc *FileService) DeleteFilesService(w http.ResponseWriter, r *http.Reques
 
 	wantObject, _, err := resolveStoreSelection(storeType, false)
 	if err != nil {
-		WriteResponse(w, http.StatusBadRequest, err.Error())
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
 		return
 	}
 
@@ -286,24 +291,24 @@ func (svc *FileService) DeleteFilesService(w http.ResponseWriter, r *http.Reques
 		objectStores, _ := collectStores(workspace)
 		objectStore, err := selectObjectStore(objectStores)
 		if err != nil {
-			WriteResponse(w, http.StatusBadRequest, err.Error())
+			WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
 			return
 		}
 		deleted, failed, err = svc.deleteObjectStoreFiles(r, objectStore, []string{fileName})
 		if err != nil {
-			WriteResponse(w, http.StatusInternalServerError, err.Error())
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 	} else {
 		_, blockStores := collectStores(workspace)
 		blockStore, err := selectBlockStore(blockStores)
 		if err != nil {
-			WriteResponse(w, http.StatusBadRequest, err.Error())
+			WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
 			return
 		}
 		deleted, failed, err = svc.deleteBlockStoreFiles(ctx, workspaceID, blockStore, []string{fileName})
 		if err != nil {
-			WriteResponse(w, http.StatusInternalServerError, err.Error())
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 	}
@@ -322,7 +327,7 @@ func (svc *FileService) DeleteFilesService(w http.ResponseWriter, r *http.Reques
 
 // GetFileMetadataService gets metadata for a single file.
 func (svc *FileService) GetFileMetadataService(w http.ResponseWriter, r *http.Request, storeType string) {
-	workspaceID, workspace, ok := svc.resolveAuthorizedWorkspace(w, r)
+	workspaceID, workspace, ok := svc.resolveAuthorizedWorkspace(w, r, authz.ActionFilesRead)
 	if !ok {
 		return
 	}
@@ -331,11 +336,11 @@ func (svc *FileService) GetFileMetadataService(w http.ResponseWriter, r *http.Re
 
 	fileName := r.URL.Query().Get("file")
 	if fileName == "" {
-		WriteResponse(w, http.StatusBadRequest, "file is required")
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "file is required")
 		return
 	}
 	if err := validateFileName(fileName); err != nil {
-		WriteResponse(w, http.StatusBadRequest, err.Error())
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
 		return
 	}
 
@@ -343,7 +348,7 @@ func (svc *FileService) GetFileMetadataService(w http.ResponseWriter, r *http.Re
 
 	wantObject, _, err := resolveStoreSelection(storeType, false)
 	if err != nil {
-		WriteResponse(w, http.StatusBadRequest, err.Error())
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
 		return
 	}
 
@@ -351,24 +356,24 @@ func (svc *FileService) GetFileMetadataService(w http.ResponseWriter, r *http.Re
 		objectStores, _ := collectStores(workspace)
 		objectStore, err := selectObjectStore(objectStores)
 		if err != nil {
-			WriteResponse(w, http.StatusBadRequest, err.Error())
+			WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
 			return
 		}
 		item, err = svc.getObjectStoreMetadata(r, objectStore, fileName)
 		if err != nil {
-			WriteResponse(w, http.StatusNotFound, err.Error())
+			WriteError(w, r, http.StatusNotFound, CodeFileNotFound, err.Error())
 			return
 		}
 	} else {
 		_, blockStores := collectStores(workspace)
 		blockStore, err := selectBlockStore(blockStores)
 		if err != nil {
-			WriteResponse(w, http.StatusBadRequest, err.Error())
+			WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
 			return
 		}
 		item, err = svc.getBlockStoreMetadata(ctx, workspaceID, blockStore, fileName)
 		if err != nil {
-			WriteResponse(w, http.StatusNotFound, err.Error())
+			WriteError(w, r, http.StatusNotFound, CodeFileNotFound, err.Error())
 			return
 		}
 	}
@@ -380,37 +385,37 @@ func (svc *FileService) GetFileMetadataService(w http.ResponseWriter, r *http.Re
 }
 
 func (svc *FileService) GetUploadURLService(w http.ResponseWriter, r *http.Request) {
-	workspaceID, workspace, ok := svc.resolveAuthorizedWorkspace(w, r)
+	workspaceID, workspace, ok := svc.resolveAuthorizedWorkspace(w, r, authz.ActionFilesWrite)
 	if !ok {
 		return
 	}
 
 	filename := r.URL.Query().Get("file")
 	if filename == "" {
-		WriteResponse(w, http.StatusBadRequest, "file query parameter is required")
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "file query parameter is required")
 		return
 	}
 
 	size, err := strconv.ParseInt(r.URL.Query().Get("size"), 10, 64)
 	if err != nil || size <= 0 {
-		WriteResponse(w, http.StatusBadRequest, "size query parameter must be a positive integer")
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "size query parameter must be a positive integer")
 		return
 	}
 	if size > maxUploadBytes {
-		WriteResponse(w, http.StatusBadRequest, "file exceeds maximum upload size")
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "file exceeds maximum upload size")
 		return
 	}
 
 	objectStores, _ := collectStores(workspace)
 	objectStore, err := selectObjectStore(objectStores)
 	if err != nil {
-		WriteResponse(w, http.StatusBadRequest, err.Error())
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
 		return
 	}
 
 	uploadURL, err := svc.getObjectStoreUploadURL(r, objectStore, filename, size)
 	if err != nil {
-		WriteResponse(w, http.StatusInternalServerError, err.Error())
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, err.Error())
 		return
 	}
 
@@ -3,8 +3,8 @@ package services
 import (
 	"bytes"
 	"context"
+	"database/sql"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -17,6 +17,7 @@ import (
 	"github.com/EO-DataHub/eodhp-workspace-services/internal/appconfig"
 	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
 	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
@@ -80,13 +81,14 @@ func TestListFilesServiceNonMemberReturnsForbidden(t *testing.T) {
 
 func TestListFilesServiceWorkspaceNotFoundReturnsNotFound(t *testing.T) {
 	mockDB := new(MockWorkspaceDB)
+	mockDB.On("IsWorkspaceSuspended", mock.Anything).Return(false, nil)
 	mockKC := new(MockKeycloakClient)
 
 	claims := hubAdminClaims()
 	workspaceID := "missing-ws"
 
 	mockDB.On("GetWorkspace", workspaceID).
-		Return(&ws_manager.WorkspaceSettings{}, errors.New("not found")).Once()
+		Return(&ws_manager.WorkspaceSettings{}, fmt.Errorf("workspace not found: %w", sql.ErrNoRows)).Once()
 
 	svc := FileService{
 		DB: mockDB,
@@ -103,6 +105,7 @@ func TestListFilesServiceWorkspaceNotFoundReturnsNotFound(t *testing.T) {
 
 func TestListFilesServiceInvalidStoreReturnsBadRequest(t *testing.T) {
 	mockDB := new(MockWorkspaceDB)
+	mockDB.On("IsWorkspaceSuspended", mock.Anything).Return(false, nil)
 	mockKC := new(MockKeycloakClient)
 
 	claims := hubAdminClaims()
@@ -126,6 +129,7 @@ func TestListFilesServiceInvalidStoreReturnsBadRequest(t *testing.T) {
 
 func TestListFilesServiceBlockStoreMissingDirectoryReturnsEmptyItems(t *testing.T) {
 	mockDB := new(MockWorkspaceDB)
+	mockDB.On("IsWorkspaceSuspended", mock.Anything).Return(false, nil)
 	mockKC := new(MockKeycloakClient)
 
 	claims := hubAdminClaims()
@@ -175,6 +179,7 @@ func TestListFilesServiceBlockStoreMissingDirectoryReturnsEmptyItems(t *testing.
 
 func TestListFilesServiceBlockStoreDownstreamErrorReturnsInternalServerError(t *testing.T) {
 	mockDB := new(MockWorkspaceDB)
+	mockDB.On("IsWorkspaceSuspended", mock.Anything).Return(false, nil)
 	mockKC := new(MockKeycloakClient)
 
 	claims := hubAdminClaims()
@@ -219,10 +224,12 @@ func TestListFilesServiceBlockStoreDownstreamErrorReturnsInternalServerError(t *
 
 func TestUploadFilesServiceNoFilesReturnsBadRequest(t *testing.T) {
 	mockDB := new(MockWorkspaceDB)
+	mockDB.On("IsWorkspaceSuspended", mock.Anything).Return(false, nil)
 	claims := hubAdminClaims()
 	workspaceID := "ws-1"
 	workspace := workspaceWithBlockStore(workspaceID)
 	mockDB.On("GetWorkspace", workspaceID).Return(workspace, nil).Once()
+	mockDB.On("GetWorkspaceAccountStatus", workspaceID).Return(workspace).Return(AccountStatusApproved, nil)
 
 	svc := FileService{
 		DB: mockDB,
@@ -238,10 +245,12 @@ func TestUploadFilesServiceNoFilesReturnsBadRequest(t *testing.T) {
 
 func TestUploadFilesServiceInvalidStoreReturnsBadRequest(t *testing.T) {
 	mockDB := new(MockWorkspaceDB)
+	mockDB.On("IsWorkspaceSuspended", mock.Anything).Return(false, nil)
 	claims := hubAdminClaims()
 	workspaceID := "ws-1"
 	workspace := workspaceWithBlockStore(workspaceID)
 	mockDB.On("GetWorkspace", workspaceID).Return(workspace, nil).Once()
+	mockDB.On("GetWorkspaceAccountStatus", workspaceID).Return(workspace).Return(AccountStatusApproved, nil)
 
 	svc := FileService{
 		DB: mockDB,
@@ -257,10 +266,12 @@ func TestUploadFilesServiceInvalidStoreReturnsBadRequest(t *testing.T) {
 
 func TestUploadFilesServiceBlockWithoutStoreReturnsBadRequest(t *testing.T) {
 	mockDB := new(MockWorkspaceDB)
+	mockDB.On("IsWorkspaceSuspended", mock.Anything).Return(false, nil)
 	claims := hubAdminClaims()
 	workspaceID := "ws-1"
 	workspace := &ws_manager.WorkspaceSettings{Name: workspaceID}
 	mockDB.On("GetWorkspace", workspaceID).Return(workspace, nil).Once()
+	mockDB.On("GetWorkspaceAccountStatus", workspaceID).Return(workspace).Return(AccountStatusApproved, nil)
 
 	svc := FileService{
 		DB: mockDB,
@@ -276,10 +287,12 @@ func TestUploadFilesServiceBlockWithoutStoreReturnsBadRequest(t *testing.T) {
 
 func TestUploadFilesServiceBlockSuccess(t *testing.T) {
 	mockDB := new(MockWorkspaceDB)
+	mockDB.On("IsWorkspaceSuspended", mock.Anything).Return(false, nil)
 	claims := hubAdminClaims()
 	workspaceID := "ws-1"
 	workspace := workspaceWithBlockStore(workspaceID)
 	mockDB.On("GetWorkspace", workspaceID).Return(workspace, nil).Once()
+	mockDB.On("GetWorkspaceAccountStatus", workspaceID).Return(workspace).Return(AccountStatusApproved, nil)
 
 	blockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		require.Equal(t, http.MethodPut, r.Method)
@@ -310,12 +323,40 @@ func TestUploadFilesServiceBlockSuccess(t *testing.T) {
 	mockDB.AssertExpectations(t)
 }
 
+func TestUploadFilesServiceViewerReturnsForbidden(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	mockKC := new(MockKeycloakClient)
+
+	claims := authn.Claims{Username: "dev-user"}
+	claims.Subject = "user-123"
+	workspaceID := "ws-1"
+
+	mockKC.On("GetUserGroups", "user-123").Return([]string{workspaceID}, nil).Once()
+	mockDB.On("IsUserAccountOwner", "dev-user", workspaceID).Return(false, nil).Once()
+	mockDB.On("GetWorkspaceRole", workspaceID, "user-123").Return("viewer", nil).Once()
+
+	svc := FileService{
+		DB: mockDB,
+		KC: mockKC,
+	}
+	req := newMultipartWorkspaceRequest(t, http.MethodPost, workspaceID, "upload.tif", []byte("abc"), &claims)
+	w := httptest.NewRecorder()
+
+	svc.UploadFilesService(w, req, storeTypeBlock)
+
+	require.Equal(t, http.StatusForbidden, w.Result().StatusCode)
+	mockDB.AssertNotCalled(t, "GetWorkspace", workspaceID)
+	mockKC.AssertExpectations(t)
+}
+
 func TestDeleteFilesServiceValidatesFileParam(t *testing.T) {
 	mockDB := new(MockWorkspaceDB)
+	mockDB.On("IsWorkspaceSuspended", mock.Anything).Return(false, nil)
 	claims := hubAdminClaims()
 	workspaceID := "ws-1"
 	workspace := workspaceWithBlockStore(workspaceID)
 	mockDB.On("GetWorkspace", workspaceID).Return(workspace, nil).Twice()
+	mockDB.On("GetWorkspaceAccountStatus", workspaceID).Return(workspace).Return(AccountStatusApproved, nil)
 
 	svc := FileService{DB: mockDB}
 
@@ -334,10 +375,12 @@ func TestDeleteFilesServiceValidatesFileParam(t *testing.T) {
 
 func TestDeleteFilesServiceBlockConflictAndSuccess(t *testing.T) {
 	mockDB := new(MockWorkspaceDB)
+	mockDB.On("IsWorkspaceSuspended", mock.Anything).Return(false, nil)
 	claims := hubAdminClaims()
 	workspaceID := "ws-1"
 	workspace := workspaceWithBlockStore(workspaceID)
 	mockDB.On("GetWorkspace", workspaceID).Return(workspace, nil).Twice()
+	mockDB.On("GetWorkspaceAccountStatus", workspaceID).Return(workspace).Return(AccountStatusApproved, nil)
 
 	blockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		require.Equal(t, http.MethodDelete, r.Method)
@@ -382,6 +425,7 @@ func TestDeleteFilesServiceBlockConflictAndSuccess(t *testing.T) {
 
 func TestGetFileMetadataServiceValidatesFileParam(t *testing.T) {
 	mockDB := new(MockWorkspaceDB)
+	mockDB.On("IsWorkspaceSuspended", mock.Anything).Return(false, nil)
 	claims := hubAdminClaims()
 	workspaceID := "ws-1"
 	workspace := workspaceWithBlockStore(workspaceID)
@@ -404,6 +448,7 @@ func TestGetFileMetadataServiceValidatesFileParam(t *testing.T) {
 
 func TestGetFileMetadataServiceBlockNotFoundAndSuccess(t *testing.T) {
 	mockDB := new(MockWorkspaceDB)
+	mockDB.On("IsWorkspaceSuspended", mock.Anything).Return(false, nil)
 	claims := hubAdminClaims()
 	workspaceID := "ws-1"
 	workspace := workspaceWithBlockStore(workspaceID)
@@ -570,9 +615,11 @@ func TestGetUploadURLServiceParameterValidation(t *testing.T) {
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			mockDB := new(MockWorkspaceDB)
+			mockDB.On("IsWorkspaceSuspended", mock.Anything).Return(false, nil)
 			claims := hubAdminClaims()
 			workspaceID := "ws-1"
 			mockDB.On("GetWorkspace", workspaceID).Return(workspaceWithObjectStore(workspaceID), nil).Once()
+			mockDB.On("GetWorkspaceAccountStatus", workspaceID).Return(workspaceWithObjectStore(workspaceID)).Return(AccountStatusApproved, nil)
 
 			svc := FileService{DB: mockDB}
 			req := newWorkspaceRequest(http.MethodGet, workspaceID, tc.query, nil, &claims)
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/EO-DataHub/eodhp-workspace-services/db"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/tracing"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/rs/zerolog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Kinds of resource collected by the garbage collector.
+const (
+	GarbageKindKeycloakGroup = "keycloak-group"
+	GarbageKindAWSSecret     = "aws-secret"
+	GarbageKindK8sSecret     = "k8s-secret"
+)
+
+// workspaceSecretPrefixes are the prefixes of the per-provider secrets stored in workspace namespaces.
+var workspaceSecretPrefixes = []string{"otp-", "oauth-"}
+
+// SecretsManagerAPI is the subset of the AWS Secrets Manager client used by the garbage collector.
+type SecretsManagerAPI interface {
+	secretsmanager.ListSecretsAPIClient
+	DeleteSecret(ctx context.Context, params *secretsmanager.DeleteSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DeleteSecretOutput, error)
+}
+
+// OrphanedResource is a resource that belongs to a workspace which no longer exists.
+type OrphanedResource struct {
+	Kind         string     `json:"kind"`
+	Name         string     `json:"name"`
+	Namespace    string     `json:"namespace,omitempty"`
+	Workspace    string     `json:"workspace"`
+	LastModified *time.Time `json:"last_modified,omitempty"`
+	Deleted      bool       `json:"deleted"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// GarbageReport lists the orphaned resources found by a garbage collection run.
+type GarbageReport struct {
+	GeneratedAt time.Time          `json:"generated_at"`
+	MinAge      string             `json:"min_age"`
+	Delete      bool               `json:"delete"`
+	Resources   []OrphanedResource `json:"resources"`
+}
+
+// GarbageCollectService finds and removes resources left behind by deleted workspaces.
+type GarbageCollectService struct {
+	DB             db.WorkspaceDBInterface
+	KC             KeycloakClientInterface
+	SecretsManager SecretsManagerAPI
+	K8sClient      kubernetes.Interface
+	ClusterPrefix  string
+}
+
+// workspaceLiveness records which workspace names are live and when deleted workspaces were removed.
+type workspaceLiveness struct {
+	live    map[string]bool
+	deleted map[string]time.Time
+}
+
+// orphaned reports whether name is not a live workspace. Unless owned is set the workspace must
+// also be recorded as deleted, so that resources shared with other systems are never collected.
+func (l workspaceLiveness) orphaned(name string, owned bool) bool {
+	if l.live[name] {
+		return false
+	}
+	if owned {
+		return true
+	}
+	_, ok := l.deleted[name]
+	return ok
+}
+
+// Collect finds resources with no live workspace whose last modification is older than minAge.
+// If remove is set the resources are deleted and the outcome is recorded in the report.
+func (svc *GarbageCollectService) Collect(ctx context.Context, minAge time.Duration, remove bool, logger *zerolog.Logger) (*GarbageReport, error) {
+	ctx, span := tracing.Start(ctx, "GarbageCollectService.Collect")
+	defer span.End()
+
+	liveness, err := svc.workspaceLiveness(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &GarbageReport{GeneratedAt: time.Now().UTC(), MinAge: minAge.String(), Delete: remove}
+
+	var found []OrphanedResource
+	for _, find := range []func(context.Context, workspaceLiveness) ([]OrphanedResource, error){
+		svc.orphanedGroups, svc.orphanedAWSSecrets, svc.orphanedK8sSecrets,
+	} {
+		resources, err := find(ctx, liveness)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, resources...)
+	}
+
+	cutoff := report.GeneratedAt.Add(-minAge)
+	for _, resource := range found {
+		// Resources without a timestamp are never considered recent
+		if resource.LastModified != nil && resource.LastModified.After(cutoff) {
+			continue
+		}
+
+		if remove {
+			if err := svc.delete(ctx, resource); err != nil {
+				logger.Error().Err(err).Str("kind", resource.Kind).Str("name", resource.Name).Msg("Failed to delete orphaned resource")
+				resource.Error = err.Error()
+			} else {
+				logger.Info().Str("kind", resource.Kind).Str("name", resource.Name).Msg("Deleted orphaned resource")
+				resource.Deleted = true
+			}
+		}
+		report.Resources = append(report.Resources, resource)
+	}
+
+	return report, nil
+}
+
+func (svc *GarbageCollectService) workspaceLiveness(ctx context.Context) (workspaceLiveness, error) {
+	names, err := svc.DB.GetAllWorkspaces(ctx)
+	if err != nil {
+		return workspaceLiveness{}, err
+	}
+	deleted, err := svc.DB.GetUnavailableWorkspaces(ctx)
+	if err != nil {
+		return workspaceLiveness{}, err
+	}
+
+	liveness := workspaceLiveness{live: make(map[string]bool, len(names)), deleted: make(map[string]time.Time, len(deleted))}
+	for _, name := range names {
+		liveness.live[name] = true
+	}
+	for _, ws := range deleted {
+		liveness.deleted[ws.Name] = ws.LastUpdated
+	}
+	return liveness, nil
+}
+
+// orphanedGroups finds the Keycloak groups of deleted workspaces. Groups carry no timestamp, so
+// the time the workspace was deleted is used as their age.
+func (svc *GarbageCollectService) orphanedGroups(ctx context.Context, liveness workspaceLiveness) ([]OrphanedResource, error) {
+	groups, err := svc.KC.GetGroups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keycloak groups: %w", err)
+	}
+
+	var orphans []OrphanedResource
+	for _, group := range groups {
+		if !liveness.orphaned(group.Name, false) {
+			continue
+		}
+		deletedAt := liveness.deleted[group.Name]
+		orphans = append(orphans, OrphanedResource{Kind: GarbageKindKeycloakGroup, Name: group.Name, Workspace: group.Name, LastModified: &deletedAt})
+	}
+
+	sortOrphans(orphans)
+	return orphans, nil
+}
+
+// orphanedAWSSecrets finds the workspace secrets (ws-<name>) and linked account secrets
+// (ws-<name>-<cluster prefix>) of workspaces that no longer exist.
+func (svc *GarbageCollectService) orphanedAWSSecrets(ctx context.Context, liveness workspaceLiveness) ([]OrphanedResource, error) {
+	paginator := secretsmanager.NewListSecretsPaginator(svc.SecretsManager, &secretsmanager.ListSecretsInput{
+		Filters: []types.Filter{{Key: types.FilterNameStringTypeName, Values: []string{"ws-"}}},
+	})
+
+	var orphans []OrphanedResource
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list secrets: %w", err)
+		}
+
+		for _, secret := range page.SecretList {
+			name := aws.ToString(secret.Name)
+			if !strings.HasPrefix(name, "ws-") {
+				continue
+			}
+
+			// Linked account secrets carrying this cluster's prefix are ours, other names may
+			// belong to another cluster sharing the account
+			workspace := strings.TrimPrefix(name, "ws-")
+			owned := false
+			if svc.ClusterPrefix != "" && strings.HasSuffix(workspace, "-"+svc.ClusterPrefix) {
+				workspace = strings.TrimSuffix(workspace, "-"+svc.ClusterPrefix)
+				owned = true
+			}
+			if !liveness.orphaned(workspace, owned) {
+				continue
+			}
+
+			lastModified := secret.LastChangedDate
+			if lastModified == nil {
+				lastModified = secret.CreatedDate
+			}
+			orphans = append(orphans, OrphanedResource{Kind: GarbageKindAWSSecret, Name: name, Workspace: workspace, LastModified: lastModified})
+		}
+	}
+
+	sortOrphans(orphans)
+	return orphans, nil
+}
+
+// orphanedK8sSecrets finds linked account secrets left in the namespaces of workspaces that no longer exist.
+func (svc *GarbageCollectService) orphanedK8sSecrets(ctx context.Context, liveness workspaceLiveness) ([]OrphanedResource, error) {
+	namespaces, err := svc.K8sClient.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+
+	var orphans []OrphanedResource
+	for _, ns := range namespaces.Items {
+		workspace, ok := strings.CutPrefix(ns.Name, "ws-")
+		if !ok || !liveness.orphaned(workspace, true) {
+			continue
+		}
+
+		secrets, err := svc.K8sClient.CoreV1().Secrets(ns.Name).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list secrets in namespace %s: %w", ns.Name, err)
+		}
+
+		for _, secret := range secrets.Items {
+			if !hasAnyPrefix(secret.Name, workspaceSecretPrefixes) {
+				continue
+			}
+			created := secret.CreationTimestamp.Time
+			orphans = append(orphans, OrphanedResource{Kind: GarbageKindK8sSecret, Name: secret.Name, Namespace: ns.Name,
+				Workspace: workspace, LastModified: &created})
+		}
+	}
+
+	sortOrphans(orphans)
+	return orphans, nil
+}
+
+func (svc *GarbageCollectService) delete(ctx context.Context, resource OrphanedResource) error {
+	switch resource.Kind {
+	case GarbageKindKeycloakGroup:
+		statusCode, err := svc.KC.DeleteGroup(ctx, resource.Name)
+		if statusCode == http.StatusNotFound {
+			return nil
+		}
+		return err
+	case GarbageKindAWSSecret:
+		_, err := svc.SecretsManager.DeleteSecret(ctx, &secretsmanager.DeleteSecretInput{
+			SecretId:                   aws.String(resource.Name),
+			ForceDeleteWithoutRecovery: aws.Bool(true),
+		})
+		return err
+	case GarbageKindK8sSecret:
+		return svc.K8sClient.CoreV1().Secrets(resource.Namespace).Delete(ctx, resource.Name, metav1.DeleteOptions{})
+	}
+	return fmt.Errorf("unsupported resource kind %s", resource.Kind)
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortOrphans(orphans []OrphanedResource) {
+	sort.Slice(orphans, func(i, j int) bool {
+		if orphans[i].Namespace != orphans[j].Namespace {
+			return orphans[i].Namespace < orphans[j].Namespace
+		}
+		return orphans[i].Name < orphans[j].Name
+	})
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ws_manager "github.com/EO-DataHub/eodhp-workspace-manager/models"
+	"github.com/EO-DataHub/eodhp-workspace-services/models"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type fakeSecretsManager struct {
+	secrets []types.SecretListEntry
+	deleted []string
+}
+
+func (f *fakeSecretsManager) ListSecrets(ctx context.Context, params *secretsmanager.ListSecretsInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.ListSecretsOutput, error) {
+	return &secretsmanager.ListSecretsOutput{SecretList: f.secrets}, nil
+}
+
+func (f *fakeSecretsManager) DeleteSecret(ctx context.Context, params *secretsmanager.DeleteSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DeleteSecretOutput, error) {
+	f.deleted = append(f.deleted, aws.ToString(params.SecretId))
+	return &secretsmanager.DeleteSecretOutput{}, nil
+}
+
+func TestGarbageCollect(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	mockKC := new(MockKeycloakClient)
+
+	old := time.Now().Add(-48 * time.Hour)
+	recent := time.Now().Add(-time.Hour)
+
+	secretsManager := &fakeSecretsManager{secrets: []types.SecretListEntry{
+		{Name: aws.String("ws-live-eodhp-test"), LastChangedDate: &old},
+		{Name: aws.String("ws-gone-eodhp-test"), LastChangedDate: &old},
+		{Name: aws.String("ws-gone"), LastChangedDate: &old},
+		{Name: aws.String("ws-fresh-eodhp-test"), LastChangedDate: &recent},
+		{Name: aws.String("ws-other-eodhp-prod"), LastChangedDate: &old},
+	}}
+
+	k8sClient := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ws-live"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ws-gone"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "otp-airbus", Namespace: "ws-live", CreationTimestamp: metav1.NewTime(old)}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "otp-planet", Namespace: "ws-gone", CreationTimestamp: metav1.NewTime(old)}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "oauth-open-cosmos", Namespace: "ws-gone", CreationTimestamp: metav1.NewTime(old)}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "default-token", Namespace: "ws-gone", CreationTimestamp: metav1.NewTime(old)}},
+	)
+
+	svc := &GarbageCollectService{
+		DB:             mockDB,
+		KC:             mockKC,
+		SecretsManager: secretsManager,
+		K8sClient:      k8sClient,
+		ClusterPrefix:  "eodhp-test",
+	}
+
+	mockDB.On("GetAllWorkspaces").Return([]string{"live"}, nil)
+	mockDB.On("GetUnavailableWorkspaces").Return([]ws_manager.WorkspaceSettings{
+		{Name: "gone", LastUpdated: old},
+		{Name: "fresh", LastUpdated: recent},
+	}, nil)
+	mockKC.On("GetGroups").Return([]models.Group{{Name: "live"}, {Name: "gone"}, {Name: "fresh"}, {Name: "hub-admins"}}, nil)
+
+	logger := zerolog.Nop()
+
+	// Without --delete the orphans older than the threshold are only reported
+	report, err := svc.Collect(context.Background(), 24*time.Hour, false, &logger)
+	require.NoError(t, err)
+
+	var names []string
+	for _, resource := range report.Resources {
+		names = append(names, resource.Kind+":"+resource.Name)
+		assert.False(t, resource.Deleted)
+	}
+	assert.Equal(t, []string{
+		"keycloak-group:gone",
+		"aws-secret:ws-gone",
+		"aws-secret:ws-gone-eodhp-test",
+		"k8s-secret:oauth-open-cosmos",
+		"k8s-secret:otp-planet",
+	}, names)
+	assert.Empty(t, secretsManager.deleted)
+
+	// With --delete they are removed
+	mockKC.On("DeleteGroup", "gone").Return(204, nil).Once()
+
+	report, err = svc.Collect(context.Background(), 24*time.Hour, true, &logger)
+	require.NoError(t, err)
+	for _, resource := range report.Resources {
+		assert.True(t, resource.Deleted, resource.Name)
+	}
+	assert.ElementsMatch(t, []string{"ws-gone", "ws-gone-eodhp-test"}, secretsManager.deleted)
+
+	secrets, err := k8sClient.CoreV1().Secrets("ws-gone").List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, secrets.Items, 1)
+	assert.Equal(t, "default-token", secrets.Items[0].Name)
+	mockKC.AssertExpectations(t)
+}
@@ -0,0 +1,437 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/EO-DataHub/eodhp-workspace-services/api/middleware"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authz"
+	"github.com/EO-DataHub/eodhp-workspace-services/models"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+)
+
+// defaultInvitationExpiry is how long an invitation can be accepted for when no expiry is
+// configured.
+const defaultInvitationExpiry = 7 * 24 * time.Hour
+
+// CreateInvitationService invites someone to join a workspace by email. The email contains a
+// token for accepting or declining the invitation, which they can use once they have signed in
+// to the hub with the invited email address.
+func (svc *WorkspaceService) CreateInvitationService(w http.ResponseWriter, r *http.Request) {
+
+	logger := zerolog.Ctx(r.Context())
+
+	// Extract claims from the request context to identify the user
+	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
+	if !ok {
+		logger.Warn().Msg("Unauthorized request: missing claims")
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
+		return
+	}
+
+	workspaceID := mux.Vars(r)["workspace-id"]
+
+	// Decode and validate the invitation
+	var payload models.WorkspaceInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		logger.Warn().Err(err).Msg("Invalid request payload")
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "")
+		return
+	}
+
+	var fieldErrs []FieldError
+	address, err := mail.ParseAddress(payload.Email)
+	if err != nil || address.Name != "" {
+		fieldErrs = append(fieldErrs, FieldError{Field: "email", Message: "must be an email address"})
+	}
+
+	role := defaultWorkspaceRole
+	if payload.Role != "" {
+		if role, ok = ParseWorkspaceRole(payload.Role); !ok {
+			fieldErrs = append(fieldErrs, FieldError{Field: "role", Message: "must be one of viewer, editor, admin or owner"})
+		}
+	}
+
+	if len(fieldErrs) > 0 {
+		WriteProblem(w, r, NewProblem(http.StatusUnprocessableEntity, CodeValidationFailed, "Invalid invitation.").
+			WithFieldErrors(fieldErrs...))
+		return
+	}
+
+	// Only workspace admins can invite users, and not to a role above their own
+	if !authorize(w, r, svc.authorizer(), claims, authz.ActionInvitationsManage, authz.Resource{Workspace: workspaceID}) {
+		return
+	}
+
+	callerRole, err := getWorkspaceRole(r.Context(), svc.authorizer(), claims, workspaceID)
+	if err != nil {
+		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to retrieve workspace role")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	if !callerRole.Includes(role) {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Cannot give a role above your own")
+		return
+	}
+
+	email := strings.ToLower(address.Address)
+	invitation, err := svc.DB.CreateWorkspaceInvitation(r.Context(), workspaceID, email, string(role), claims.Username, svc.invitationExpiry())
+	if err != nil {
+		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to create workspace invitation")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	// An invitation that could not be sent cannot be accepted, so it is removed
+	if err := svc.SendInvitationEmail(invitation); err != nil {
+		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to send workspace invitation email")
+		if _, err := svc.DB.DeleteWorkspaceInvitation(r.Context(), workspaceID, invitation.ID); err != nil {
+			logger.Error().Err(err).Str("invitation_id", invitation.ID.String()).Msg("Failed to remove unsent workspace invitation")
+		}
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	logger.Info().Str("workspace_id", workspaceID).Str("invitation_id", invitation.ID.String()).Str("role", invitation.Role).Msg("Workspace invitation sent")
+
+	var location = fmt.Sprintf("%s/%s", r.URL.Path, invitation.ID)
+	WriteResponse(w, http.StatusCreated, invitation, location)
+}
+
+// GetInvitationsService lists the pending invitations to a workspace.
+func (svc *WorkspaceService) GetInvitationsService(w http.ResponseWriter, r *http.Request) {
+
+	logger := zerolog.Ctx(r.Context())
+
+	// Extract claims from the request context to identify the user
+	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
+	if !ok {
+		logger.Warn().Msg("Unauthorized request: missing claims")
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
+		return
+	}
+
+	workspaceID := mux.Vars(r)["workspace-id"]
+
+	// Only workspace admins can see who has been invited
+	if !authorize(w, r, svc.authorizer(), claims, authz.ActionInvitationsManage, authz.Resource{Workspace: workspaceID}) {
+		return
+	}
+
+	invitations, err := svc.DB.GetWorkspaceInvitations(r.Context(), workspaceID)
+	if err != nil {
+		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to retrieve workspace invitations")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	// Ensure invitations is not nil, return an empty slice if there are none
+	if invitations == nil {
+		invitations = []models.WorkspaceInvitation{}
+	}
+
+	WriteResponse(w, http.StatusOK, invitations)
+}
+
+// RevokeInvitationService revokes a pending invitation to a workspace so that it can no longer
+// be accepted.
+func (svc *WorkspaceService) RevokeInvitationService(w http.ResponseWriter, r *http.Request) {
+
+	logger := zerolog.Ctx(r.Context())
+
+	// Extract claims from the request context to identify the user
+	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
+	if !ok {
+		logger.Warn().Msg("Unauthorized request: missing claims")
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
+		return
+	}
+
+	workspaceID := mux.Vars(r)["workspace-id"]
+
+	invitationID, err := uuid.Parse(mux.Vars(r)["invitation-id"])
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid invitation ID.")
+		return
+	}
+
+	// Only workspace admins can revoke invitations
+	if !authorize(w, r, svc.authorizer(), claims, authz.ActionInvitationsManage, authz.Resource{Workspace: workspaceID}) {
+		return
+	}
+
+	deleted, err := svc.DB.DeleteWorkspaceInvitation(r.Context(), workspaceID, invitationID)
+	if err != nil {
+		logger.Error().Err(err).Str("invitation_id", invitationID.String()).Msg("Failed to revoke workspace invitation")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	if !deleted {
+		WriteError(w, r, http.StatusNotFound, CodeInvitationNotFound, "Invitation does not exist.")
+		return
+	}
+
+	logger.Info().Str("workspace_id", workspaceID).Str("invitation_id", invitationID.String()).Msg("Workspace invitation revoked")
+	WriteResponse(w, http.StatusNoContent, nil)
+}
+
+// invitationPage lets an invitee accept or decline an invitation. The links in invitation emails
+// open it, so following a link never changes anything by itself.
+var invitationPage = template.Must(template.New("invitation").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>EO DataHub Workspace Invitation</title>
+</head>
+<body>
+<h1>EO DataHub Workspace Invitation</h1>
+<p id="message">You have been invited to join an EO DataHub workspace.</p>
+<form method="post" action="{{.Accept}}"><button type="submit">Accept</button></form>
+<form method="post" action="{{.Decline}}"><button type="submit">Decline</button></form>
+<script>
+document.querySelectorAll("form").forEach(function (form) {
+  form.addEventListener("submit", function (event) {
+    event.preventDefault();
+    fetch(form.action, {method: "POST", credentials: "same-origin"}).then(function (response) {
+      if (response.ok) {
+        document.getElementById("message").textContent = form.action.endsWith("/accept") ?
+          "You have joined the workspace." : "You have declined the invitation.";
+        document.querySelectorAll("form").forEach(function (f) { f.remove(); });
+        return;
+      }
+      return response.json().then(function (problem) {
+        document.getElementById("message").textContent = problem.detail || problem.title;
+      });
+    });
+  });
+});
+</script>
+</body>
+</html>
+`))
+
+// InvitationPageService serves the page that the link in an invitation email opens, from which
+// the invitee accepts or declines the invitation with a POST.
+func (svc *WorkspaceService) InvitationPageService(w http.ResponseWriter, r *http.Request) {
+
+	logger := zerolog.Ctx(r.Context())
+
+	base := strings.TrimSuffix(r.URL.Path, "/")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	err := invitationPage.Execute(w, struct{ Accept, Decline string }{base + "/accept", base + "/decline"})
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to render invitation page")
+	}
+}
+
+// AcceptInvitationService adds the signed in user to the workspace they were invited to, with
+// the role given in the invitation. Members who already have that role or a higher one keep
+// their role.
+func (svc *WorkspaceService) AcceptInvitationService(w http.ResponseWriter, r *http.Request) {
+
+	logger := zerolog.Ctx(r.Context())
+
+	claims, invitation, user, ok := svc.resolveInvitation(w, r)
+	if !ok {
+		return
+	}
+
+	role := storedWorkspaceRole(invitation.Role)
+
+	// Nobody can join a workspace that is suspended or being deleted
+	workspace, err := svc.DB.GetWorkspace(r.Context(), invitation.Workspace)
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteError(w, r, http.StatusNotFound, CodeInvitationNotFound, "Invitation does not exist or has expired.")
+		return
+	}
+	if err != nil {
+		logger.Error().Err(err).Str("workspace_id", invitation.Workspace).Msg("Failed to retrieve workspace")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	switch workspace.Status {
+	case "Suspended", WorkspaceStatusPendingDeletion, WorkspaceStatusDeleting, "Unavailable":
+		WriteError(w, r, http.StatusConflict, CodeConflict, "Workspace is suspended or being deleted.")
+		return
+	}
+
+	// Find the user's current role before they are added to the group
+	currentRole, err := getWorkspaceRole(r.Context(), svc.authorizer(), claims, invitation.Workspace)
+	if err != nil {
+		logger.Error().Err(err).Str("workspace_id", invitation.Workspace).Msg("Failed to retrieve workspace role")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	// Find the group ID from keycloak
+	group, err := svc.KC.GetGroup(r.Context(), invitation.Workspace)
+	if err != nil {
+		logger.Error().Err(err).Str("name", invitation.Workspace).Msg("Failed to retrieve Keycloak group")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	// The role stored for the user, to put back if they cannot be added
+	stored, err := svc.DB.GetWorkspaceRole(r.Context(), invitation.Workspace, user.ID)
+	if err != nil {
+		logger.Error().Err(err).Str("user_id", user.ID).Str("workspace_id", invitation.Workspace).Msg("Failed to retrieve workspace role")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	// Record the role, which is granted by whoever sent the invitation, before adding the user,
+	// so that they never have the default role instead. Nothing has changed if this fails, and
+	// the invitation can be accepted again.
+	if !currentRole.Includes(role) {
+		err = svc.DB.SetWorkspaceRole(r.Context(), invitation.Workspace, user.ID, user.Username, string(role), invitation.InvitedBy)
+		if err != nil {
+			logger.Error().Err(err).Str("user_id", user.ID).Str("workspace_id", invitation.Workspace).Msg("Failed to set workspace role")
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+			return
+		}
+	}
+
+	// Add the user to the group in Keycloak
+	err = svc.KC.AddMemberToGroup(r.Context(), user.ID, group.ID)
+	if err != nil {
+		logger.Error().Err(err).Str("user_id", user.ID).Str("group_id", group.ID).Msg("Failed to add user to group")
+
+		if !currentRole.Includes(role) {
+			if err := svc.setMemberRole(r.Context(), invitation.Workspace, user.ID, user.Username, stored, invitation.InvitedBy); err != nil {
+				logger.Error().Err(err).Str("user_id", user.ID).Str("workspace_id", invitation.Workspace).Msg("Failed to restore workspace role")
+			}
+		}
+
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	// The user is now a member, so the invitation has been used even if it cannot be removed
+	if _, err := svc.DB.DeleteWorkspaceInvitation(r.Context(), invitation.Workspace, invitation.ID); err != nil {
+		logger.Error().Err(err).Str("invitation_id", invitation.ID.String()).Msg("Failed to remove accepted workspace invitation")
+	}
+
+	logger.Info().Str("username", user.Username).Str("workspace_id", invitation.Workspace).Msg("Workspace invitation accepted")
+	WriteResponse(w, http.StatusNoContent, nil)
+}
+
+// DeclineInvitationService removes an invitation sent to the signed in user.
+func (svc *WorkspaceService) DeclineInvitationService(w http.ResponseWriter, r *http.Request) {
+
+	logger := zerolog.Ctx(r.Context())
+
+	_, invitation, user, ok := svc.resolveInvitation(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := svc.DB.DeleteWorkspaceInvitation(r.Context(), invitation.Workspace, invitation.ID); err != nil {
+		logger.Error().Err(err).Str("invitation_id", invitation.ID.String()).Msg("Failed to remove declined workspace invitation")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	logger.Info().Str("username", user.Username).Str("workspace_id", invitation.Workspace).Msg("Workspace invitation declined")
+	WriteResponse(w, http.StatusNoContent, nil)
+}
+
+// resolveInvitation finds the invitation whose token is in the URL path and checks that it was
+// sent to the signed in user. It writes an error response and returns false if it was not.
+func (svc *WorkspaceService) resolveInvitation(w http.ResponseWriter, r *http.Request) (authn.Claims, *models.WorkspaceInvitation, *models.User, bool) {
+
+	logger := zerolog.Ctx(r.Context())
+
+	// Extract claims from the request context to identify the user
+	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
+	if !ok {
+		logger.Warn().Msg("Unauthorized request: missing claims")
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
+		return claims, nil, nil, false
+	}
+
+	if !authorize(w, r, svc.authorizer(), claims, authz.ActionInvitationRespond, authz.Resource{}) {
+		return claims, nil, nil, false
+	}
+
+	invitation, err := svc.DB.GetWorkspaceInvitationByToken(r.Context(), mux.Vars(r)["token"])
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to retrieve workspace invitation")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return claims, nil, nil, false
+	}
+
+	if invitation == nil || time.Now().After(invitation.ExpiresAt) {
+		WriteError(w, r, http.StatusNotFound, CodeInvitationNotFound, "Invitation does not exist or has expired.")
+		return claims, nil, nil, false
+	}
+
+	// The token was sent by email, so only the owner of that address can use it
+	user, err := svc.KC.GetUser(r.Context(), claims.Username)
+	if err != nil {
+		logger.Warn().Err(err).Str("username", claims.Username).Msg("User ID not found")
+		WriteError(w, r, http.StatusNotFound, CodeUserNotFound, "User does not exist.")
+		return claims, nil, nil, false
+	}
+
+	if !strings.EqualFold(user.Email, invitation.Email) {
+		logger.Warn().Str("username", claims.Username).Str("invitation_id", invitation.ID.String()).Msg("Invitation was sent to a different email address")
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Invitation was sent to a different email address.")
+		return claims, nil, nil, false
+	}
+
+	// Anyone can give their account an unverified address, so it does not show they received it
+	if !user.EmailVerified {
+		logger.Warn().Str("username", claims.Username).Str("invitation_id", invitation.ID.String()).Msg("Email address of invitee is not verified")
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Verify your email address before responding to the invitation.")
+		return claims, nil, nil, false
+	}
+
+	return claims, invitation, user, true
+}
+
+// SendInvitationEmail sends an invitation to the invited email address.
+func (svc *WorkspaceService) SendInvitationEmail(invitation *models.WorkspaceInvitation) error {
+	subject := fmt.Sprintf("EO DataHub Workspace Invitation - %s", invitation.Workspace)
+	link := fmt.Sprintf("https://%s/api/invitations/%s", svc.Config.Host, invitation.Token)
+
+	body := fmt.Sprintf(`
+	Hello,
+
+	%s has invited you to join the %s workspace on the EO DataHub as a workspace %s.
+
+	If you do not have an EO DataHub account yet, sign up at https://%s/ using this email address first.
+
+	To accept or decline the invitation, open the following link:
+	%s
+
+	Make sure you are logged in to the EO DataHub before opening the link. The invitation expires on %s.
+
+	Regards,
+	EO DataHub Team
+	`, invitation.InvitedBy, invitation.Workspace, invitation.Role, svc.Config.Host, link,
+		invitation.ExpiresAt.Format("2 January 2006 at 15:04 MST"))
+
+	return sendEmail(svc.AWSEmailClient, svc.Config.Accounts.ServiceAccountEmail, invitation.Email, subject, body)
+}
+
+// invitationExpiry returns how long an invitation can be accepted for.
+func (svc *WorkspaceService) invitationExpiry() time.Duration {
+	if svc.Config == nil || svc.Config.Workspaces.InvitationExpiryHours <= 0 {
+		return defaultInvitationExpiry
+	}
+	return time.Duration(svc.Config.Workspaces.InvitationExpiryHours) * time.Hour
+}
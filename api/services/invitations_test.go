@@ -0,0 +1,282 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	ws_manager "github.com/EO-DataHub/eodhp-workspace-manager/models"
+	"github.com/EO-DataHub/eodhp-workspace-services/api/middleware"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/appconfig"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
+	"github.com/EO-DataHub/eodhp-workspace-services/models"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newInvitationRequest(method, target, body string, vars map[string]string, claims authn.Claims) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req = mux.SetURLVars(req, vars)
+	return req.WithContext(context.WithValue(req.Context(), middleware.ClaimsKey, claims))
+}
+
+func TestCreateInvitationService(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	mockKC := new(MockKeycloakClient)
+	mockEmail := new(MockAWSEmailClient)
+
+	svc := WorkspaceService{
+		Config: &appconfig.Config{
+			Host:     "hub.example.com",
+			Accounts: appconfig.AccountsConfig{ServiceAccountEmail: "service@example.com"},
+		},
+		DB:             mockDB,
+		KC:             mockKC,
+		AWSEmailClient: mockEmail,
+	}
+
+	admin := authn.Claims{Username: "alice"}
+	admin.Subject = "user-a"
+	vars := map[string]string{"workspace-id": "test-workspace"}
+
+	mockKC.On("GetUserGroups", "user-a").Return([]string{"test-workspace"}, nil)
+	mockDB.On("IsUserAccountOwner", "alice", "test-workspace").Return(false, nil)
+	mockDB.On("GetWorkspaceRole", "test-workspace", "user-a").Return("admin", nil)
+	mockDB.On("IsWorkspaceSuspended", "test-workspace").Return(false, nil)
+
+	invitation := &models.WorkspaceInvitation{
+		ID:        uuid.New(),
+		Workspace: "test-workspace",
+		Email:     "bob@example.com",
+		Role:      "viewer",
+		InvitedBy: "alice",
+		ExpiresAt: time.Now().Add(defaultInvitationExpiry),
+		Token:     "secret-token",
+	}
+	mockDB.On("CreateWorkspaceInvitation", "test-workspace", "bob@example.com", "viewer", "alice", defaultInvitationExpiry).
+		Return(invitation, nil).Once()
+	mockEmail.On("SendEmail", mock.Anything, mock.Anything, mock.Anything).Return(&sesv2.SendEmailOutput{}, nil).Once()
+
+	w := httptest.NewRecorder()
+	svc.CreateInvitationService(w, newInvitationRequest(http.MethodPost, "/api/workspaces/test-workspace/invitations",
+		`{"email": "Bob@Example.com", "role": "viewer"}`, vars, admin))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "/api/workspaces/test-workspace/invitations/"+invitation.ID.String(), w.Header().Get("Location"))
+	assert.NotContains(t, w.Body.String(), "secret-token")
+
+	// The token is only sent to the invitee
+	mockEmail.AssertCalled(t, "SendEmail", mock.Anything, mock.MatchedBy(func(input *sesv2.SendEmailInput) bool {
+		return input.Destination.ToAddresses[0] == "bob@example.com" &&
+			strings.Contains(*input.Content.Simple.Body.Text.Data, "https://hub.example.com/api/invitations/secret-token\n")
+	}), mock.Anything)
+
+	// Admins cannot invite owners
+	w = httptest.NewRecorder()
+	svc.CreateInvitationService(w, newInvitationRequest(http.MethodPost, "/api/workspaces/test-workspace/invitations",
+		`{"email": "bob@example.com", "role": "owner"}`, vars, admin))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Invalid fields are reported together
+	w = httptest.NewRecorder()
+	svc.CreateInvitationService(w, newInvitationRequest(http.MethodPost, "/api/workspaces/test-workspace/invitations",
+		`{"email": "not an email", "role": "superuser"}`, vars, admin))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	var problem Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Len(t, problem.Errors, 2)
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestCreateInvitationService_EmailFailure(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	mockEmail := new(MockAWSEmailClient)
+
+	svc := WorkspaceService{Config: &appconfig.Config{}, DB: mockDB, AWSEmailClient: mockEmail}
+
+	admin := authn.Claims{Username: "admin"}
+	admin.RealmAccess.Roles = []string{"hub_admin"}
+	mockDB.On("IsWorkspaceSuspended", "test-workspace").Return(false, nil)
+
+	invitation := &models.WorkspaceInvitation{ID: uuid.New(), Workspace: "test-workspace", Email: "bob@example.com", Role: "editor"}
+	mockDB.On("CreateWorkspaceInvitation", "test-workspace", "bob@example.com", "editor", "admin", defaultInvitationExpiry).
+		Return(invitation, nil).Once()
+	mockEmail.On("SendEmail", mock.Anything, mock.Anything, mock.Anything).Return((*sesv2.SendEmailOutput)(nil), errors.New("ses unavailable")).Once()
+
+	// An invitation that could not be sent is removed
+	mockDB.On("DeleteWorkspaceInvitation", "test-workspace", invitation.ID).Return(true, nil).Once()
+
+	w := httptest.NewRecorder()
+	svc.CreateInvitationService(w, newInvitationRequest(http.MethodPost, "/api/workspaces/test-workspace/invitations",
+		`{"email": "bob@example.com"}`, map[string]string{"workspace-id": "test-workspace"}, admin))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestInvitationPageService(t *testing.T) {
+	svc := WorkspaceService{}
+
+	w := httptest.NewRecorder()
+	svc.InvitationPageService(w, httptest.NewRequest(http.MethodGet, "/api/invitations/secret-token", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+
+	// The invitation is only answered by posting from the page
+	assert.Contains(t, w.Body.String(), `<form method="post" action="/api/invitations/secret-token/accept">`)
+	assert.Contains(t, w.Body.String(), `<form method="post" action="/api/invitations/secret-token/decline">`)
+}
+
+func TestAcceptInvitationService(t *testing.T) {
+	invitation := &models.WorkspaceInvitation{
+		ID:        uuid.New(),
+		Workspace: "test-workspace",
+		Email:     "bob@example.com",
+		Role:      "viewer",
+		InvitedBy: "alice",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	bob := authn.Claims{Username: "bob"}
+	bob.Subject = "user-b"
+	vars := map[string]string{"token": "secret-token"}
+
+	newMocks := func(email string, verified bool, workspaceStatus string) (*MockWorkspaceDB, *MockKeycloakClient) {
+		mockDB := new(MockWorkspaceDB)
+		mockKC := new(MockKeycloakClient)
+		mockDB.On("GetWorkspaceInvitationByToken", "secret-token").Return(invitation, nil)
+		mockKC.On("GetUser", "bob").Return(&models.User{ID: "user-b", Username: "bob", Email: email, EmailVerified: verified}, nil)
+		mockDB.On("GetWorkspace", "test-workspace").Return(&ws_manager.WorkspaceSettings{Name: "test-workspace", Status: workspaceStatus}, nil)
+		mockKC.On("GetUserGroups", "user-b").Return([]string{}, nil)
+		mockKC.On("GetGroup", "test-workspace").Return(&models.Group{ID: "group-123", Name: "test-workspace"}, nil)
+		mockDB.On("GetWorkspaceRole", "test-workspace", "user-b").Return("", nil)
+		return mockDB, mockKC
+	}
+
+	// The invitee joins the workspace with the role they were invited to
+	mockDB, mockKC := newMocks("BOB@example.com", true, "Ready")
+	mockKC.On("AddMemberToGroup", "user-b", "group-123").Return(nil).Once()
+	mockDB.On("SetWorkspaceRole", "test-workspace", "user-b", "bob", "viewer", "alice").Return(nil).Once()
+	mockDB.On("DeleteWorkspaceInvitation", "test-workspace", invitation.ID).Return(true, nil).Once()
+
+	svc := WorkspaceService{DB: mockDB, KC: mockKC}
+	w := httptest.NewRecorder()
+	svc.AcceptInvitationService(w, newInvitationRequest(http.MethodPost, "/api/invitations/secret-token/accept", "", vars, bob))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	mockDB.AssertExpectations(t)
+	mockKC.AssertExpectations(t)
+
+	// The role is removed again if the invitee cannot be added, and the invitation is kept
+	mockDB, mockKC = newMocks("bob@example.com", true, "Ready")
+	mockDB.On("SetWorkspaceRole", "test-workspace", "user-b", "bob", "viewer", "alice").Return(nil).Once()
+	mockKC.On("AddMemberToGroup", "user-b", "group-123").Return(errors.New("keycloak down")).Once()
+	mockDB.On("DeleteWorkspaceRole", "test-workspace", "user-b").Return(nil).Once()
+
+	svc = WorkspaceService{DB: mockDB, KC: mockKC}
+	w = httptest.NewRecorder()
+	svc.AcceptInvitationService(w, newInvitationRequest(http.MethodPost, "/api/invitations/secret-token/accept", "", vars, bob))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	mockDB.AssertExpectations(t)
+	mockDB.AssertNotCalled(t, "DeleteWorkspaceInvitation", mock.Anything, mock.Anything)
+
+	// Nothing changes if the role cannot be recorded
+	mockDB, mockKC = newMocks("bob@example.com", true, "Ready")
+	mockDB.On("SetWorkspaceRole", "test-workspace", "user-b", "bob", "viewer", "alice").Return(errors.New("db down")).Once()
+
+	svc = WorkspaceService{DB: mockDB, KC: mockKC}
+	w = httptest.NewRecorder()
+	svc.AcceptInvitationService(w, newInvitationRequest(http.MethodPost, "/api/invitations/secret-token/accept", "", vars, bob))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	mockKC.AssertNotCalled(t, "AddMemberToGroup", mock.Anything, mock.Anything)
+
+	// Only the owner of the invited email address can accept it
+	for _, email := range []string{"mallory@example.com", ""} {
+		mockDB, mockKC = newMocks(email, true, "Ready")
+
+		svc = WorkspaceService{DB: mockDB, KC: mockKC}
+		w = httptest.NewRecorder()
+		svc.AcceptInvitationService(w, newInvitationRequest(http.MethodPost, "/api/invitations/secret-token/accept", "", vars, bob))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		mockKC.AssertNotCalled(t, "AddMemberToGroup", mock.Anything, mock.Anything)
+	}
+
+	// once they have verified it
+	mockDB, mockKC = newMocks("bob@example.com", false, "Ready")
+
+	svc = WorkspaceService{DB: mockDB, KC: mockKC}
+	w = httptest.NewRecorder()
+	svc.AcceptInvitationService(w, newInvitationRequest(http.MethodPost, "/api/invitations/secret-token/accept", "", vars, bob))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	mockKC.AssertNotCalled(t, "AddMemberToGroup", mock.Anything, mock.Anything)
+
+	// Suspended workspaces and those being deleted cannot be joined
+	for _, status := range []string{"Suspended", WorkspaceStatusPendingDeletion, WorkspaceStatusDeleting} {
+		mockDB, mockKC = newMocks("bob@example.com", true, status)
+
+		svc = WorkspaceService{DB: mockDB, KC: mockKC}
+		w = httptest.NewRecorder()
+		svc.AcceptInvitationService(w, newInvitationRequest(http.MethodPost, "/api/invitations/secret-token/accept", "", vars, bob))
+		assert.Equal(t, http.StatusConflict, w.Code, status)
+		mockKC.AssertNotCalled(t, "AddMemberToGroup", mock.Anything, mock.Anything)
+	}
+
+	// Expired invitations cannot be used
+	expired := *invitation
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	mockDB = new(MockWorkspaceDB)
+	mockDB.On("GetWorkspaceInvitationByToken", "secret-token").Return(&expired, nil)
+
+	svc = WorkspaceService{DB: mockDB, KC: new(MockKeycloakClient)}
+	w = httptest.NewRecorder()
+	svc.AcceptInvitationService(w, newInvitationRequest(http.MethodPost, "/api/invitations/secret-token/accept", "", vars, bob))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Keycloak errors are not returned to the invitee
+	mockDB = new(MockWorkspaceDB)
+	mockKC = new(MockKeycloakClient)
+	mockDB.On("GetWorkspaceInvitationByToken", "secret-token").Return(invitation, nil)
+	mockKC.On("GetUser", "bob").Return((*models.User)(nil), errors.New("keycloak lookup failed: https://keycloak.internal"))
+
+	svc = WorkspaceService{DB: mockDB, KC: mockKC}
+	w = httptest.NewRecorder()
+	svc.AcceptInvitationService(w, newInvitationRequest(http.MethodPost, "/api/invitations/secret-token/accept", "", vars, bob))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NotContains(t, w.Body.String(), "keycloak.internal")
+}
+
+func TestRevokeInvitationService(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	svc := WorkspaceService{DB: mockDB, KC: new(MockKeycloakClient)}
+
+	admin := authn.Claims{Username: "admin"}
+	admin.RealmAccess.Roles = []string{"hub_admin"}
+
+	invitationID := uuid.New()
+	vars := map[string]string{"workspace-id": "test-workspace", "invitation-id": invitationID.String()}
+
+	mockDB.On("IsWorkspaceSuspended", "test-workspace").Return(false, nil)
+	mockDB.On("DeleteWorkspaceInvitation", "test-workspace", invitationID).Return(true, nil).Once()
+
+	w := httptest.NewRecorder()
+	svc.RevokeInvitationService(w, newInvitationRequest(http.MethodDelete, "/", "", vars, admin))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// Revoking it again finds nothing
+	mockDB.On("DeleteWorkspaceInvitation", "test-workspace", invitationID).Return(false, nil).Once()
+
+	w = httptest.NewRecorder()
+	svc.RevokeInvitationService(w, newInvitationRequest(http.MethodDelete, "/", "", vars, admin))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	mockDB.AssertExpectations(t)
+}
@@ -2,25 +2,48 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/metrics"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/requestid"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/tracing"
 	"github.com/EO-DataHub/eodhp-workspace-services/models"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// KeycloakClient is a client for interacting with the Keycloak API.
+// KeycloakClient is a client for interacting with the Keycloak API. It is safe for concurrent
+// use, and copies share the admin token of the client they were copied from.
 type KeycloakClient struct {
 	BaseURL      string
 	ClientID     string
 	ClientSecret string
 	Realm        string
-	Token        string
 	HTTPClient   *http.Client
+
+	token *adminToken
+}
+
+// adminToken is the client_credentials token used for admin API calls.
+type adminToken struct {
+	mu        sync.Mutex
+	value     string
+	expiresAt time.Time
 }
 
+// tokenRefreshMargin is how long before it expires the admin token is replaced, so that it
+// does not expire while a request is in flight.
+const tokenRefreshMargin = 30 * time.Second
+
 type TokenResponse struct {
 	Access           string `json:"access_token"`
 	Refresh          string `json:"refresh_token"`
@@ -29,6 +52,14 @@ type TokenResponse struct {
 	Scope            string `json:"scope"`
 }
 
+// keycloakPageSize is the number of entries requested per page when reading Keycloak listings.
+// Keycloak returns 100 entries when no page size is given, and listings are read page by page
+// so that none are silently dropped.
+const keycloakPageSize = 100
+
+// ErrGroupNotFound is returned when a Keycloak group does not exist.
+var ErrGroupNotFound = errors.New("group not found")
+
 type KeycloakError struct {
 	Error            string `json:"error"`
 	ErrorDescription string `json:"error_description"`
@@ -46,17 +77,19 @@ func (e *HTTPError) Error() string {
 }
 
 type KeycloakClientInterface interface {
-	GetToken() error
-	CreateGroup(groupName string) (int, error)
-	DeleteGroup(groupName string) (int, error)
-	GetGroup(groupName string) (*models.Group, error)
-	GetGroupMembers(groupID string) ([]models.User, error)
-	GetGroupMember(groupID, userID string) (*models.User, error)
-	AddMemberToGroup(userID, groupID string) error
-	RemoveMemberFromGroup(userID, groupID string) error
-	GetUser(username string) (*models.User, error)
-	GetUserGroups(userID string) ([]string, error)
-	ExchangeToken(accessToken, scope string) (*TokenResponse, error)
+	GetToken(ctx context.Context) error
+	CreateGroup(ctx context.Context, groupName string) (int, error)
+	DeleteGroup(ctx context.Context, groupName string) (int, error)
+	GetGroup(ctx context.Context, groupName string) (*models.Group, error)
+	GetGroups(ctx context.Context) ([]models.Group, error)
+	GetGroupMembers(ctx context.Context, groupID string) ([]models.User, error)
+	GetGroupMembersPage(ctx context.Context, groupID string, first, limit int, search string) ([]models.User, int, error)
+	GetGroupMember(ctx context.Context, groupID, userID string) (*models.User, error)
+	AddMemberToGroup(ctx context.Context, userID, groupID string) error
+	RemoveMemberFromGroup(ctx context.Context, userID, groupID string) error
+	GetUser(ctx context.Context, username string) (*models.User, error)
+	GetUserGroups(ctx context.Context, userID string) ([]string, error)
+	ExchangeToken(ctx context.Context, accessToken, scope string) (*TokenResponse, error)
 }
 
 var _ KeycloakClientInterface = (*KeycloakClient)(nil)
@@ -69,41 +102,113 @@ func NewKeycloakClient(baseURL, clientID, clientSecret, realm string) *KeycloakC
 		ClientSecret: clientSecret,
 		Realm:        realm,
 		HTTPClient:   &http.Client{},
+		token:        &adminToken{},
 	}
 }
 
-// GetToken retrieves a Keycloak access token using client_credentials.
-func (kc *KeycloakClient) GetToken() error {
+// GetToken makes sure the client holds an admin token, requesting one with client_credentials
+// if it has none or the current token is about to expire.
+func (kc *KeycloakClient) GetToken(ctx context.Context) error {
+	_, err := kc.accessToken(ctx)
+	return err
+}
+
+// accessToken returns the admin token, requesting a new one if it has none or the current
+// token is about to expire. Concurrent callers wait for a single request.
+func (kc *KeycloakClient) accessToken(ctx context.Context) (string, error) {
+	kc.token.mu.Lock()
+	defer kc.token.mu.Unlock()
+
+	if kc.token.value != "" && (kc.token.expiresAt.IsZero() || time.Now().Before(kc.token.expiresAt)) {
+		return kc.token.value, nil
+	}
+	return kc.requestToken(ctx)
+}
+
+// refreshToken replaces an admin token that Keycloak rejected. If another caller has already
+// replaced it, the new token is returned without a further request.
+func (kc *KeycloakClient) refreshToken(ctx context.Context, rejected string) (string, error) {
+	kc.token.mu.Lock()
+	defer kc.token.mu.Unlock()
+
+	if kc.token.value != "" && kc.token.value != rejected {
+		return kc.token.value, nil
+	}
+	return kc.requestToken(ctx)
+}
+
+// requestToken requests an admin token with client_credentials. The token lock must be held.
+func (kc *KeycloakClient) requestToken(ctx context.Context) (string, error) {
 	tokenURL := fmt.Sprintf("%s/realms/%s/protocol/openid-connect/token", kc.BaseURL, kc.Realm)
 
-	data := fmt.Sprintf("grant_type=client_credentials&client_id=%s&client_secret=%s", kc.ClientID, kc.ClientSecret)
+	data := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {kc.ClientID},
+		"client_secret": {kc.ClientSecret},
+	}
 
-	respBody, _, err := kc.makeRequest(http.MethodPost, tokenURL, "application/x-www-form-urlencoded", []byte(data))
+	respBody, _, err := kc.send(ctx, http.MethodPost, tokenURL, "application/x-www-form-urlencoded", []byte(data.Encode()), "")
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	// Parse the token from the response
-	var tokenResponse struct {
-		AccessToken string `json:"access_token"`
-	}
+	var tokenResponse TokenResponse
 	if err := json.Unmarshal(respBody, &tokenResponse); err != nil {
-		return fmt.Errorf("failed to decode token response: %w", err)
+		return "", fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if tokenResponse.Access == "" {
+		return "", errors.New("token response did not include an access token")
+	}
+
+	kc.token.value = tokenResponse.Access
+	kc.token.expiresAt = time.Time{}
+	if tokenResponse.ExpiresIn > 0 {
+		lifetime := time.Duration(tokenResponse.ExpiresIn) * time.Second
+		kc.token.expiresAt = time.Now().Add(lifetime - min(tokenRefreshMargin, lifetime/2))
+	}
+
+	return kc.token.value, nil
+}
+
+// CheckTokenEndpoint requests a client_credentials token to confirm Keycloak is reachable and
+// accepts the client's credentials. The token is discarded.
+func (kc *KeycloakClient) CheckTokenEndpoint(ctx context.Context) error {
+	tokenURL := fmt.Sprintf("%s/realms/%s/protocol/openid-connect/token", kc.BaseURL, kc.Realm)
+
+	data := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {kc.ClientID},
+		"client_secret": {kc.ClientSecret},
 	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := kc.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach token endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
 
-	kc.Token = tokenResponse.AccessToken
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
 	return nil
 }
 
 // CreateGroup creates a new group in Keycloak.
-func (kc *KeycloakClient) CreateGroup(groupName string) (int, error) {
+func (kc *KeycloakClient) CreateGroup(ctx context.Context, groupName string) (int, error) {
 
 	group := map[string]string{"name": groupName}
 	body, _ := json.Marshal(group)
 
 	url := fmt.Sprintf("%s/admin/realms/%s/groups", kc.BaseURL, kc.Realm)
 
-	respBody, statusCode, err := kc.makeRequest(http.MethodPost, url, "application/json", body)
+	respBody, statusCode, err := kc.makeRequest(ctx, http.MethodPost, url, "application/json", body)
 	if err != nil {
 		return statusCode, err
 	}
@@ -116,17 +221,20 @@ func (kc *KeycloakClient) CreateGroup(groupName string) (int, error) {
 }
 
 // DeleteGroup deletes a group in Keycloak
-func (kc *KeycloakClient) DeleteGroup(groupName string) (int, error) {
+func (kc *KeycloakClient) DeleteGroup(ctx context.Context, groupName string) (int, error) {
 
 	// Find the group ID from keycloak
-	group, err := kc.GetGroup(groupName)
+	group, err := kc.GetGroup(ctx, groupName)
 
+	if errors.Is(err, ErrGroupNotFound) {
+		return http.StatusNotFound, err
+	}
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
 
 	url := fmt.Sprintf("%s/admin/realms/%s/groups/%s", kc.BaseURL, kc.Realm, group.ID)
-	respBody, statusCode, err := kc.makeRequest(http.MethodDelete, url, "", nil)
+	respBody, statusCode, err := kc.makeRequest(ctx, http.MethodDelete, url, "", nil)
 
 	if err != nil {
 		return statusCode, err
@@ -140,10 +248,10 @@ func (kc *KeycloakClient) DeleteGroup(groupName string) (int, error) {
 }
 
 // GetGroup retrieves a group by name from Keycloak.
-func (kc *KeycloakClient) GetGroup(groupName string) (*models.Group, error) {
+func (kc *KeycloakClient) GetGroup(ctx context.Context, groupName string) (*models.Group, error) {
 	url := fmt.Sprintf("%s/admin/realms/%s/groups?search=%s", kc.BaseURL, kc.Realm, groupName)
 
-	respBody, statusCode, err := kc.makeRequest(http.MethodGet, url, "application/json", nil)
+	respBody, statusCode, err := kc.makeRequest(ctx, http.MethodGet, url, "application/json", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -165,36 +273,73 @@ func (kc *KeycloakClient) GetGroup(groupName string) (*models.Group, error) {
 		}
 	}
 
-	return nil, fmt.Errorf("group with name %s not found", groupName)
+	return nil, fmt.Errorf("%w: %s", ErrGroupNotFound, groupName)
 }
 
-// GetGroupMembers retrieves a list of members of a group in Keycloak.
-func (kc *KeycloakClient) GetGroupMembers(groupID string) ([]models.User, error) {
-	url := fmt.Sprintf("%s/admin/realms/%s/groups/%s/members", kc.BaseURL, kc.Realm, groupID)
+// GetGroups retrieves all top level groups in the realm from Keycloak.
+func (kc *KeycloakClient) GetGroups(ctx context.Context) ([]models.Group, error) {
+	endpoint := fmt.Sprintf("%s/admin/realms/%s/groups", kc.BaseURL, kc.Realm)
 
-	respBody, statusCode, err := kc.makeRequest(http.MethodGet, url, "application/json", nil)
+	groups, err := getAllPages[models.Group](ctx, kc, endpoint, url.Values{"briefRepresentation": {"true"}})
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to fetch groups: %w", err)
 	}
 
-	// Check if the response status code is not OK
-	if statusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch group members, status: %d", statusCode)
-	}
+	return groups, nil
+}
 
-	// Parse the response body into a slice of User structs
-	var members []models.User
-	if err := json.Unmarshal(respBody, &members); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+// GetGroupMembers retrieves all members of a group in Keycloak.
+func (kc *KeycloakClient) GetGroupMembers(ctx context.Context, groupID string) ([]models.User, error) {
+	endpoint := fmt.Sprintf("%s/admin/realms/%s/groups/%s/members", kc.BaseURL, kc.Realm, groupID)
+
+	members, err := getAllPages[models.User](ctx, kc, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch group members: %w", err)
 	}
 
 	return members, nil
 }
 
+// GetGroupMembersPage retrieves up to limit members of a group in Keycloak, starting at offset
+// first, keeping only those whose username, name or email contains search. Keycloak cannot
+// search the members of a group, so pages are filtered as they are read until limit members
+// match. It returns the offset to continue from, or -1 if there are no more members.
+func (kc *KeycloakClient) GetGroupMembersPage(ctx context.Context, groupID string, first, limit int, search string) ([]models.User, int, error) {
+	endpoint := fmt.Sprintf("%s/admin/realms/%s/groups/%s/members", kc.BaseURL, kc.Realm, groupID)
+
+	members := []models.User{}
+	for {
+		page, err := getPage[models.User](ctx, kc, endpoint, nil, first, keycloakPageSize)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to fetch group members: %w", err)
+		}
+
+		for i, member := range page {
+			if !userMatches(member, search) {
+				continue
+			}
+			members = append(members, member)
+
+			if len(members) == limit {
+				next := first + i + 1
+				if i == len(page)-1 && len(page) < keycloakPageSize {
+					next = -1
+				}
+				return members, next, nil
+			}
+		}
+
+		if len(page) < keycloakPageSize {
+			return members, -1, nil
+		}
+		first += len(page)
+	}
+}
+
 // GetGroupMember retrieves a specific member of a group in Keycloak.
-func (kc *KeycloakClient) GetGroupMember(groupID, userID string) (*models.User, error) {
+func (kc *KeycloakClient) GetGroupMember(ctx context.Context, groupID, userID string) (*models.User, error) {
 
-	members, err := kc.GetGroupMembers(groupID)
+	members, err := kc.GetGroupMembers(ctx, groupID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch group members: %w", err)
 	}
@@ -211,10 +356,10 @@ func (kc *KeycloakClient) GetGroupMember(groupID, userID string) (*models.User,
 }
 
 // AddMemberToGroup adds a user to a group in Keycloak.
-func (kc *KeycloakClient) AddMemberToGroup(userID, groupID string) error {
+func (kc *KeycloakClient) AddMemberToGroup(ctx context.Context, userID, groupID string) error {
 	url := fmt.Sprintf("%s/admin/realms/%s/users/%s/groups/%s", kc.BaseURL, kc.Realm, userID, groupID)
 
-	respBody, statusCode, err := kc.makeRequest(http.MethodPut, url, "application/json", nil)
+	respBody, statusCode, err := kc.makeRequest(ctx, http.MethodPut, url, "application/json", nil)
 	if err != nil {
 		return fmt.Errorf("failed to add member to group: %w", err)
 	}
@@ -227,10 +372,10 @@ func (kc *KeycloakClient) AddMemberToGroup(userID, groupID string) error {
 }
 
 // RemoveMemberFromGroup adds a user to a group in Keycloak.
-func (kc *KeycloakClient) RemoveMemberFromGroup(userID, groupID string) error {
+func (kc *KeycloakClient) RemoveMemberFromGroup(ctx context.Context, userID, groupID string) error {
 	url := fmt.Sprintf("%s/admin/realms/%s/users/%s/groups/%s", kc.BaseURL, kc.Realm, userID, groupID)
 
-	respBody, statusCode, err := kc.makeRequest(http.MethodDelete, url, "application/json", nil)
+	respBody, statusCode, err := kc.makeRequest(ctx, http.MethodDelete, url, "application/json", nil)
 	if err != nil {
 		return fmt.Errorf("failed to remove member from group: %w", err)
 	}
@@ -243,14 +388,14 @@ func (kc *KeycloakClient) RemoveMemberFromGroup(userID, groupID string) error {
 }
 
 // GetUser retrieves a user ID by username from Keycloak.
-func (kc *KeycloakClient) GetUser(username string) (*models.User, error) {
+func (kc *KeycloakClient) GetUser(ctx context.Context, username string) (*models.User, error) {
 	query := url.Values{}
 	query.Set("username", username)
 	query.Set("exact", "true")
 
 	requestURL := fmt.Sprintf("%s/admin/realms/%s/users?%s", kc.BaseURL, kc.Realm, query.Encode())
 
-	respBody, statusCode, err := kc.makeRequest(http.MethodGet, requestURL, "application/json", nil)
+	respBody, statusCode, err := kc.makeRequest(ctx, http.MethodGet, requestURL, "application/json", nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch user by username: %w", err)
 	}
@@ -274,23 +419,14 @@ func (kc *KeycloakClient) GetUser(username string) (*models.User, error) {
 }
 
 // GetUserGroups retrieves a list of group names that a user is a member of.
-func (kc *KeycloakClient) GetUserGroups(userID string) ([]string, error) {
-	url := fmt.Sprintf("%s/admin/realms/%s/users/%s/groups", kc.BaseURL, kc.Realm, userID)
+func (kc *KeycloakClient) GetUserGroups(ctx context.Context, userID string) ([]string, error) {
+	endpoint := fmt.Sprintf("%s/admin/realms/%s/users/%s/groups", kc.BaseURL, kc.Realm, userID)
 
-	respBody, statusCode, err := kc.makeRequest(http.MethodGet, url, "application/json", nil)
+	groups, err := getAllPages[models.Group](ctx, kc, endpoint, url.Values{"briefRepresentation": {"true"}})
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch user groups: %w", err)
 	}
 
-	if statusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch user groups, status: %d", statusCode)
-	}
-
-	var groups []models.Group
-	if err := json.Unmarshal(respBody, &groups); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-
 	// Extract group names into a string slice
 	var groupNames []string
 	for _, group := range groups {
@@ -301,8 +437,16 @@ func (kc *KeycloakClient) GetUserGroups(userID string) ([]string, error) {
 }
 
 // ExchangeToken exchanges an access token for a new token with a different scope.
-func (kc KeycloakClient) ExchangeToken(accessToken, scope string) (*TokenResponse,
-	error) {
+func (kc *KeycloakClient) ExchangeToken(ctx context.Context, accessToken, scope string) (_ *TokenResponse,
+	err error) {
+
+	tokenURL := fmt.Sprintf("%s/realms/%s/protocol/openid-connect/token", kc.BaseURL, kc.Realm)
+	ctx, span := tracing.Start(ctx, "keycloak token exchange", trace.WithSpanKind(trace.SpanKindClient))
+	start := time.Now()
+	defer func() {
+		metrics.ObserveDependency(metrics.DependencyKeycloak, keycloakOperation(http.MethodPost, tokenURL), start, err)
+		tracing.End(span, err)
+	}()
 
 	data := url.Values{}
 	data.Set("client_id", kc.ClientID)
@@ -311,9 +455,15 @@ func (kc KeycloakClient) ExchangeToken(accessToken, scope string) (*TokenRespons
 	data.Set("subject_token", accessToken)
 	data.Set("scope", scope)
 
-	resp, err := kc.HTTPClient.PostForm(
-		fmt.Sprintf("%s/realms/%s/protocol/openid-connect/token",
-			kc.BaseURL, kc.Realm), data)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	tracing.InjectHTTP(ctx, req.Header)
+	requestid.InjectHTTP(ctx, req.Header)
+
+	resp, err := kc.HTTPClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -347,14 +497,47 @@ func (kc KeycloakClient) ExchangeToken(accessToken, scope string) (*TokenRespons
 	return &tokenResponse, nil
 }
 
-// Helper function for making HTTP requests to keycloak API.
-func (kc *KeycloakClient) makeRequest(method, url, contentType string, body []byte) ([]byte, int, error) {
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+// makeRequest makes an admin API request with the admin token. If Keycloak rejects the token,
+// for example because it was revoked, a new token is requested and the request is retried once.
+func (kc *KeycloakClient) makeRequest(ctx context.Context, method, url, contentType string, body []byte) ([]byte, int, error) {
+	token, err := kc.accessToken(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get admin token: %w", err)
+	}
+
+	respBody, statusCode, err := kc.send(ctx, method, url, contentType, body, token)
+	if statusCode != http.StatusUnauthorized {
+		return respBody, statusCode, err
+	}
+
+	token, err = kc.refreshToken(ctx, token)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to refresh admin token: %w", err)
+	}
+
+	return kc.send(ctx, method, url, contentType, body, token)
+}
+
+// send makes a single HTTP request to Keycloak, authenticated with token if it is set.
+func (kc *KeycloakClient) send(ctx context.Context, method, url, contentType string, body []byte, token string) (respBody []byte, statusCode int, err error) {
+	operation := keycloakOperation(method, url)
+	ctx, span := tracing.Start(ctx, "keycloak "+operation, trace.WithSpanKind(trace.SpanKindClient))
+	start := time.Now()
+	defer func() {
+		metrics.ObserveDependency(metrics.DependencyKeycloak, operation, start, err)
+		tracing.End(span, err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(body))
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to create request: %w", err)
 	}
+	tracing.InjectHTTP(ctx, req.Header)
+	requestid.InjectHTTP(ctx, req.Header)
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", kc.Token))
+	if token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	}
 
 	if method != http.MethodDelete {
 		req.Header.Set("Content-Type", contentType)
@@ -366,14 +549,96 @@ func (kc *KeycloakClient) makeRequest(method, url, contentType string, body []by
 	}
 	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
+	respBody, err = io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, resp.StatusCode, fmt.Errorf("failed to read response body: %w", err)
 	}
 
+	// Error responses are returned as errors, so they are also counted as failed calls
 	if resp.StatusCode >= 400 {
 		return respBody, resp.StatusCode, fmt.Errorf("error response: status %d, body: %s", resp.StatusCode, string(respBody))
 	}
 
 	return respBody, resp.StatusCode, nil
 }
+
+// getAllPages reads every entry of a Keycloak listing, requesting a page at a time until a
+// short page is returned.
+func getAllPages[T any](ctx context.Context, kc *KeycloakClient, endpoint string, query url.Values) ([]T, error) {
+	var entries []T
+	for first := 0; ; first += keycloakPageSize {
+		page, err := getPage[T](ctx, kc, endpoint, query, first, keycloakPageSize)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, page...)
+
+		if len(page) < keycloakPageSize {
+			return entries, nil
+		}
+	}
+}
+
+// getPage reads up to max entries of a Keycloak listing, starting at offset first.
+func getPage[T any](ctx context.Context, kc *KeycloakClient, endpoint string, query url.Values, first, max int) ([]T, error) {
+	params := url.Values{}
+	for key, values := range query {
+		params[key] = values
+	}
+	params.Set("first", strconv.Itoa(first))
+	params.Set("max", strconv.Itoa(max))
+
+	respBody, statusCode, err := kc.makeRequest(ctx, http.MethodGet, endpoint+"?"+params.Encode(), "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %d", statusCode)
+	}
+
+	var page []T
+	if err := json.Unmarshal(respBody, &page); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return page, nil
+}
+
+// userMatches reports whether the username, name or email of user contains search, ignoring case.
+func userMatches(user models.User, search string) bool {
+	if search == "" {
+		return true
+	}
+	search = strings.ToLower(search)
+	for _, field := range []string{user.Username, user.FirstName, user.LastName, user.Email} {
+		if strings.Contains(strings.ToLower(field), search) {
+			return true
+		}
+	}
+	return false
+}
+
+// keycloakOperation names a Keycloak request for metrics by its method and path, with the realm
+// and the IDs of groups and users removed so that the number of distinct names stays small.
+func keycloakOperation(method, rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return method
+	}
+
+	segments := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	for i, segment := range segments {
+		if segment == "realms" && i+1 < len(segments) {
+			segments = segments[i+2:]
+			break
+		}
+	}
+	for i := 1; i < len(segments); i++ {
+		if segments[i-1] == "groups" || segments[i-1] == "users" {
+			segments[i] = "{id}"
+		}
+	}
+
+	return method + " /" + strings.Join(segments, "/")
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/metrics"
+)
+
+// GroupCachingKeycloakClient caches the groups of each user so that authorizing a request does
+// not call the Keycloak admin API every time. Adding or removing a member through the client
+// forgets that user's groups, and deleting a group forgets the groups of all of its members.
+// Changes made directly in Keycloak are seen once the entry expires.
+type GroupCachingKeycloakClient struct {
+	KeycloakClientInterface
+
+	ttl     time.Duration
+	maxSize int
+	now     func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// order lists entries from most to least recently used.
+	order *list.List
+	// generation changes whenever entries are invalidated, so that lookups which started
+	// before an invalidation do not store the groups they read.
+	generation uint64
+}
+
+type userGroupsEntry struct {
+	userID    string
+	groups    []string
+	expiresAt time.Time
+}
+
+var _ KeycloakClientInterface = (*GroupCachingKeycloakClient)(nil)
+
+// NewGroupCachingKeycloakClient wraps kc in a cache holding the groups of up to maxSize users
+// for ttl.
+func NewGroupCachingKeycloakClient(kc KeycloakClientInterface, ttl time.Duration, maxSize int) *GroupCachingKeycloakClient {
+	return &GroupCachingKeycloakClient{
+		KeycloakClientInterface: kc,
+		ttl:                     ttl,
+		maxSize:                 maxSize,
+		now:                     time.Now,
+		entries:                 make(map[string]*list.Element),
+		order:                   list.New(),
+	}
+}
+
+// GetUserGroups returns the names of the groups userID is a member of, from the cache if they
+// were read recently.
+func (c *GroupCachingKeycloakClient) GetUserGroups(ctx context.Context, userID string) ([]string, error) {
+	c.mu.Lock()
+	if elem, ok := c.entries[userID]; ok {
+		entry := elem.Value.(*userGroupsEntry)
+		if c.now().Before(entry.expiresAt) {
+			c.order.MoveToFront(elem)
+			groups := slices.Clone(entry.groups)
+			c.mu.Unlock()
+			metrics.CountCacheLookup(metrics.CacheUserGroups, true)
+			return groups, nil
+		}
+		c.remove(elem)
+	}
+	generation := c.generation
+	c.mu.Unlock()
+
+	metrics.CountCacheLookup(metrics.CacheUserGroups, false)
+
+	groups, err := c.KeycloakClientInterface.GetUserGroups(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation == generation {
+		c.add(userID, slices.Clone(groups))
+	}
+
+	return groups, nil
+}
+
+// AddMemberToGroup adds userID to groupID and forgets the user's cached groups.
+func (c *GroupCachingKeycloakClient) AddMemberToGroup(ctx context.Context, userID, groupID string) error {
+	defer c.InvalidateUser(userID)
+	return c.KeycloakClientInterface.AddMemberToGroup(ctx, userID, groupID)
+}
+
+// RemoveMemberFromGroup removes userID from groupID and forgets the user's cached groups.
+func (c *GroupCachingKeycloakClient) RemoveMemberFromGroup(ctx context.Context, userID, groupID string) error {
+	defer c.InvalidateUser(userID)
+	return c.KeycloakClientInterface.RemoveMemberFromGroup(ctx, userID, groupID)
+}
+
+// DeleteGroup deletes groupName and forgets the cached groups of its members.
+func (c *GroupCachingKeycloakClient) DeleteGroup(ctx context.Context, groupName string) (int, error) {
+	defer c.InvalidateGroup(groupName)
+	return c.KeycloakClientInterface.DeleteGroup(ctx, groupName)
+}
+
+// InvalidateUser forgets the cached groups of userID.
+func (c *GroupCachingKeycloakClient) InvalidateUser(userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if elem, ok := c.entries[userID]; ok {
+		c.remove(elem)
+	}
+}
+
+// InvalidateGroup forgets the cached groups of every user who is a member of groupName.
+func (c *GroupCachingKeycloakClient) InvalidateGroup(groupName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for _, elem := range c.entries {
+		if slices.Contains(elem.Value.(*userGroupsEntry).groups, groupName) {
+			c.remove(elem)
+		}
+	}
+}
+
+// add stores the groups of userID, evicting the least recently used entry if the cache is
+// full. The lock must be held.
+func (c *GroupCachingKeycloakClient) add(userID string, groups []string) {
+	if elem, ok := c.entries[userID]; ok {
+		c.remove(elem)
+	}
+
+	for c.maxSize > 0 && c.order.Len() >= c.maxSize {
+		c.remove(c.order.Back())
+	}
+
+	entry := &userGroupsEntry{userID: userID, groups: groups, expiresAt: c.now().Add(c.ttl)}
+	c.entries[userID] = c.order.PushFront(entry)
+}
+
+// remove drops an entry. The lock must be held.
+func (c *GroupCachingKeycloakClient) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*userGroupsEntry).userID)
+}
+
+// groupMembershipInvalidator is implemented by Keycloak clients that cache group membership.
+type groupMembershipInvalidator interface {
+	InvalidateGroup(groupName string)
+}
+
+// invalidateGroupMembership forgets cached membership of groupName, if kc caches it.
+func invalidateGroupMembership(kc KeycloakClientInterface, groupName string) {
+	if cache, ok := kc.(groupMembershipInvalidator); ok {
+		cache.InvalidateGroup(groupName)
+	}
+}
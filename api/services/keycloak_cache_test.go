@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func cacheLookups(result string) float64 {
+	return testutil.ToFloat64(metrics.CacheLookups.WithLabelValues(metrics.CacheUserGroups, result))
+}
+
+func TestGroupCachingKeycloakClientCachesUserGroups(t *testing.T) {
+	kc := new(MockKeycloakClient)
+	kc.On("GetUserGroups", "user-1").Return([]string{"ws-1"}, nil).Twice()
+
+	now := time.Now()
+	cache := NewGroupCachingKeycloakClient(kc, time.Minute, 10)
+	cache.now = func() time.Time { return now }
+	hits, misses := cacheLookups("hit"), cacheLookups("miss")
+
+	for i := 0; i < 3; i++ {
+		groups, err := cache.GetUserGroups(context.Background(), "user-1")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ws-1"}, groups)
+	}
+	assert.Equal(t, float64(2), cacheLookups("hit")-hits)
+	assert.Equal(t, float64(1), cacheLookups("miss")-misses)
+
+	// Entries expire after the TTL
+	now = now.Add(time.Minute)
+	_, err := cache.GetUserGroups(context.Background(), "user-1")
+	require.NoError(t, err)
+
+	kc.AssertNumberOfCalls(t, "GetUserGroups", 2)
+}
+
+func TestGroupCachingKeycloakClientDoesNotCacheErrors(t *testing.T) {
+	kc := new(MockKeycloakClient)
+	kc.On("GetUserGroups", "user-1").Return([]string(nil), errors.New("keycloak unavailable")).Once()
+	kc.On("GetUserGroups", "user-1").Return([]string{"ws-1"}, nil).Once()
+
+	cache := NewGroupCachingKeycloakClient(kc, time.Minute, 10)
+
+	_, err := cache.GetUserGroups(context.Background(), "user-1")
+	assert.Error(t, err)
+
+	groups, err := cache.GetUserGroups(context.Background(), "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ws-1"}, groups)
+}
+
+func TestGroupCachingKeycloakClientEvictsLeastRecentlyUsed(t *testing.T) {
+	kc := new(MockKeycloakClient)
+	kc.On("GetUserGroups", "user-1").Return([]string{"ws-1"}, nil)
+	kc.On("GetUserGroups", "user-2").Return([]string{"ws-2"}, nil)
+	kc.On("GetUserGroups", "user-3").Return([]string{"ws-3"}, nil)
+
+	cache := NewGroupCachingKeycloakClient(kc, time.Minute, 2)
+	ctx := context.Background()
+
+	_, _ = cache.GetUserGroups(ctx, "user-1")
+	_, _ = cache.GetUserGroups(ctx, "user-2")
+	_, _ = cache.GetUserGroups(ctx, "user-1")
+	_, _ = cache.GetUserGroups(ctx, "user-3")
+
+	// user-2 was used least recently, so it was evicted to make room for user-3
+	_, _ = cache.GetUserGroups(ctx, "user-1")
+	_, _ = cache.GetUserGroups(ctx, "user-2")
+
+	kc.AssertNumberOfCalls(t, "GetUserGroups", 4)
+	assert.Equal(t, 2, cache.order.Len())
+}
+
+func TestGroupCachingKeycloakClientInvalidation(t *testing.T) {
+	kc := new(MockKeycloakClient)
+	kc.On("GetUserGroups", "user-1").Return([]string{"ws-1"}, nil)
+	kc.On("GetUserGroups", "user-2").Return([]string{"ws-2"}, nil)
+	kc.On("AddMemberToGroup", "user-1", "group-id").Return(nil)
+	kc.On("DeleteGroup", "ws-2").Return(http.StatusNoContent, nil)
+
+	cache := NewGroupCachingKeycloakClient(kc, time.Minute, 10)
+	ctx := context.Background()
+
+	_, _ = cache.GetUserGroups(ctx, "user-1")
+	_, _ = cache.GetUserGroups(ctx, "user-2")
+
+	// Changing a user's membership forgets only that user's groups
+	require.NoError(t, cache.AddMemberToGroup(ctx, "user-1", "group-id"))
+	_, _ = cache.GetUserGroups(ctx, "user-1")
+	_, _ = cache.GetUserGroups(ctx, "user-2")
+	kc.AssertNumberOfCalls(t, "GetUserGroups", 3)
+
+	// Deleting a group forgets the groups of its members
+	_, err := cache.DeleteGroup(ctx, "ws-2")
+	require.NoError(t, err)
+	_, _ = cache.GetUserGroups(ctx, "user-1")
+	_, _ = cache.GetUserGroups(ctx, "user-2")
+	kc.AssertNumberOfCalls(t, "GetUserGroups", 4)
+
+	// Workspace deletion forgets membership of the workspace's group
+	invalidateGroupMembership(cache, "ws-1")
+	_, _ = cache.GetUserGroups(ctx, "user-1")
+	kc.AssertNumberOfCalls(t, "GetUserGroups", 5)
+}
@@ -1,12 +1,23 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/metrics"
+	"github.com/EO-DataHub/eodhp-workspace-services/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetToken(t *testing.T) {
@@ -19,9 +30,100 @@ func TestGetToken(t *testing.T) {
 	defer server.Close()
 
 	client := NewKeycloakClient(server.URL, "client-id", "client-secret", "test-realm")
-	err := client.GetToken()
+	err := client.GetToken(context.Background())
 	assert.NoError(t, err)
-	assert.Equal(t, "mocked-access-token", client.Token)
+	assert.Equal(t, "mocked-access-token", client.token.value)
+}
+
+// adminTokenServer serves numbered admin tokens and the members of group-id, which it only
+// returns for the latest token.
+func adminTokenServer(t *testing.T, expiresIn int) (*httptest.Server, *atomic.Int32) {
+	var issued atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/realms/test-realm/protocol/openid-connect/token":
+			assert.Empty(t, r.Header.Get("Authorization"))
+			n := issued.Add(1)
+			_, _ = fmt.Fprintf(w, `{"access_token": "token-%d", "expires_in": %d}`, n, expiresIn)
+		case "/admin/realms/test-realm/groups/group-id/members":
+			if r.Header.Get("Authorization") != fmt.Sprintf("Bearer token-%d", issued.Load()) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`[{"id": "user-id", "username": "user"}]`))
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &issued
+}
+
+func TestAdminTokenRequestedOnFirstUse(t *testing.T) {
+	server, issued := adminTokenServer(t, 300)
+	client := NewKeycloakClient(server.URL, "client-id", "client-secret", "test-realm")
+
+	for i := 0; i < 3; i++ {
+		members, err := client.GetGroupMembers(context.Background(), "group-id")
+		require.NoError(t, err)
+		assert.Len(t, members, 1)
+	}
+	assert.Equal(t, int32(1), issued.Load())
+
+	// The token is replaced before it expires
+	assert.WithinDuration(t, time.Now().Add(270*time.Second), client.token.expiresAt, 5*time.Second)
+	client.token.expiresAt = time.Now().Add(-time.Second)
+
+	_, err := client.GetGroupMembers(context.Background(), "group-id")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), issued.Load())
+}
+
+func TestAdminTokenRetriedOnceWhenRejected(t *testing.T) {
+	server, issued := adminTokenServer(t, 300)
+	client := NewKeycloakClient(server.URL, "client-id", "client-secret", "test-realm")
+	client.token.value = "revoked-token"
+
+	members, err := client.GetGroupMembers(context.Background(), "group-id")
+	require.NoError(t, err)
+	assert.Len(t, members, 1)
+	assert.Equal(t, int32(1), issued.Load())
+}
+
+func TestAdminTokenSharedByConcurrentRequests(t *testing.T) {
+	server, issued := adminTokenServer(t, 300)
+	client := NewKeycloakClient(server.URL, "client-id", "client-secret", "test-realm")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.GetGroupMembers(context.Background(), "group-id")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), issued.Load())
+}
+
+func TestCheckTokenEndpoint(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/realms/test-realm/protocol/openid-connect/token", r.URL.Path)
+		assert.Equal(t, "client_credentials", r.FormValue("grant_type"))
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"access_token": "mocked-access-token"}`))
+	}))
+	defer server.Close()
+
+	client := NewKeycloakClient(server.URL, "client-id", "client-secret", "test-realm")
+	assert.NoError(t, client.CheckTokenEndpoint(context.Background()))
+	assert.Empty(t, client.token.value)
+
+	status = http.StatusUnauthorized
+	assert.Error(t, client.CheckTokenEndpoint(context.Background()))
 }
 
 func TestCreateGroup(t *testing.T) {
@@ -36,9 +138,9 @@ func TestCreateGroup(t *testing.T) {
 	defer server.Close()
 
 	client := NewKeycloakClient(server.URL, "client-id", "client-secret", "test-realm")
-	client.Token = "mocked-token"
+	client.token.value = "mocked-token"
 
-	statusCode, err := client.CreateGroup("test-group")
+	statusCode, err := client.CreateGroup(context.Background(), "test-group")
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusCreated, statusCode)
 }
@@ -53,9 +155,9 @@ func TestGetGroup(t *testing.T) {
 	defer server.Close()
 
 	client := NewKeycloakClient(server.URL, "client-id", "client-secret", "test-realm")
-	client.Token = "mocked-token"
+	client.token.value = "mocked-token"
 
-	group, err := client.GetGroup("test-group")
+	group, err := client.GetGroup(context.Background(), "test-group")
 	assert.NoError(t, err)
 	assert.Equal(t, "group-id", group.ID)
 	assert.Equal(t, "test-group", group.Name)
@@ -71,15 +173,65 @@ func TestGetGroupMembers(t *testing.T) {
 	defer server.Close()
 
 	client := NewKeycloakClient(server.URL, "client-id", "client-secret", "test-realm")
-	client.Token = "mocked-token"
+	client.token.value = "mocked-token"
 
-	members, err := client.GetGroupMembers("group-id")
+	members, err := client.GetGroupMembers(context.Background(), "group-id")
 	assert.NoError(t, err)
 	assert.Len(t, members, 2)
 	assert.Equal(t, "user1", members[0].ID)
 	assert.Equal(t, "user2", members[1].ID)
 }
 
+// groupMembersServer serves n members of group-id, named user-0 to user-{n-1}, a page at a time.
+func groupMembersServer(t *testing.T, n int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/admin/realms/test-realm/groups/group-id/members", r.URL.Path)
+		first, _ := strconv.Atoi(r.URL.Query().Get("first"))
+		max, _ := strconv.Atoi(r.URL.Query().Get("max"))
+
+		page := []models.User{}
+		for i := first; i < n && i < first+max; i++ {
+			page = append(page, models.User{ID: strconv.Itoa(i), Username: fmt.Sprintf("user-%d", i)})
+		}
+		_ = json.NewEncoder(w).Encode(page)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGetGroupMembersReadsEveryPage(t *testing.T) {
+	client := NewKeycloakClient(groupMembersServer(t, 250).URL, "client-id", "client-secret", "test-realm")
+	client.token.value = "mocked-token"
+
+	members, err := client.GetGroupMembers(context.Background(), "group-id")
+	require.NoError(t, err)
+	assert.Len(t, members, 250)
+	assert.Equal(t, "249", members[249].ID)
+}
+
+func TestGetGroupMembersPage(t *testing.T) {
+	client := NewKeycloakClient(groupMembersServer(t, 250).URL, "client-id", "client-secret", "test-realm")
+	client.token.value = "mocked-token"
+	ctx := context.Background()
+
+	members, next, err := client.GetGroupMembersPage(ctx, "group-id", 95, 10, "")
+	require.NoError(t, err)
+	assert.Len(t, members, 10)
+	assert.Equal(t, "95", members[0].ID)
+	assert.Equal(t, 105, next)
+
+	// Searching filters pages as they are read
+	members, next, err = client.GetGroupMembersPage(ctx, "group-id", 0, 2, "USER-2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user-2", "user-20"}, []string{members[0].Username, members[1].Username})
+	assert.Equal(t, 21, next)
+
+	members, next, err = client.GetGroupMembersPage(ctx, "group-id", 240, 0, "user-24")
+	require.NoError(t, err)
+	assert.Len(t, members, 10)
+	assert.Equal(t, -1, next)
+}
+
 func TestGetUser(t *testing.T) {
 	mockResponse := `[{"id": "user-lizzie", "username": "lizzie-d"}, {"id": "user-liz", "username": "liz"}]`
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -92,9 +244,9 @@ func TestGetUser(t *testing.T) {
 	defer server.Close()
 
 	client := NewKeycloakClient(server.URL, "client-id", "client-secret", "test-realm")
-	client.Token = "mocked-token"
+	client.token.value = "mocked-token"
 
-	user, err := client.GetUser("liz")
+	user, err := client.GetUser(context.Background(), "liz")
 	assert.NoError(t, err)
 	assert.Equal(t, "user-liz", user.ID)
 	assert.Equal(t, "liz", user.Username)
@@ -111,9 +263,9 @@ func TestGetUserReturnsNotFoundForFuzzyMatch(t *testing.T) {
 	defer server.Close()
 
 	client := NewKeycloakClient(server.URL, "client-id", "client-secret", "test-realm")
-	client.Token = "mocked-token"
+	client.token.value = "mocked-token"
 
-	user, err := client.GetUser("liz")
+	user, err := client.GetUser(context.Background(), "liz")
 	assert.Nil(t, user)
 	assert.ErrorContains(t, err, "user 'liz' not found")
 }
@@ -127,9 +279,9 @@ func TestAddMemberToGroup(t *testing.T) {
 	defer server.Close()
 
 	client := NewKeycloakClient(server.URL, "client-id", "client-secret", "test-realm")
-	client.Token = "mocked-token"
+	client.token.value = "mocked-token"
 
-	err := client.AddMemberToGroup("user-id", "group-id")
+	err := client.AddMemberToGroup(context.Background(), "user-id", "group-id")
 	assert.NoError(t, err)
 }
 
@@ -142,9 +294,9 @@ func TestRemoveMemberFromGroup(t *testing.T) {
 	defer server.Close()
 
 	client := NewKeycloakClient(server.URL, "client-id", "client-secret", "test-realm")
-	client.Token = "mocked-token"
+	client.token.value = "mocked-token"
 
-	err := client.RemoveMemberFromGroup("user-id", "group-id")
+	err := client.RemoveMemberFromGroup(context.Background(), "user-id", "group-id")
 	assert.NoError(t, err)
 }
 
@@ -164,11 +316,63 @@ func TestExchangeToken(t *testing.T) {
 	defer server.Close()
 
 	client := NewKeycloakClient(server.URL, "client-id", "client-secret", "test-realm")
-	client.Token = "mocked-token"
+	client.token.value = "mocked-token"
 
-	resp, err := client.ExchangeToken("access-token", "openid test")
+	resp, err := client.ExchangeToken(context.Background(), "access-token", "openid test")
 	assert.NoError(t, err)
 	assert.Equal(t, "new_access", resp.Access)
 	assert.Equal(t, "new_refresh", resp.Refresh)
 	assert.Equal(t, 3600, resp.ExpiresIn)
 }
+
+func TestKeycloakOperation(t *testing.T) {
+	tests := map[string]string{
+		"https://kc/admin/realms/eodhp/groups?search=ws":        "GET /groups",
+		"https://kc/admin/realms/eodhp/groups/abc-123/members":  "GET /groups/{id}/members",
+		"https://kc/admin/realms/eodhp/users/u-1/groups/g-2":    "GET /users/{id}/groups/{id}",
+		"https://kc/realms/eodhp/protocol/openid-connect/token": "GET /protocol/openid-connect/token",
+	}
+	for rawURL, want := range tests {
+		assert.Equal(t, want, keycloakOperation(http.MethodGet, rawURL))
+	}
+}
+
+func TestKeycloakErrorResponsesCountedAsErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/realms/test-realm/protocol/openid-connect/token":
+			if r.FormValue("grant_type") == "client_credentials" {
+				_, _ = w.Write([]byte(`{"access_token": "admin-token"}`))
+				return
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error": "invalid_request"}`))
+		case "/admin/realms/test-realm/groups/missing-id":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	client := NewKeycloakClient(server.URL, "client-id", "client-secret", "test-realm")
+	errorsFor := func(operation string) float64 {
+		return testutil.ToFloat64(metrics.DependencyErrors.WithLabelValues(metrics.DependencyKeycloak, operation))
+	}
+
+	getGroup := errorsFor("GET /groups/{id}")
+	members := errorsFor("GET /groups/{id}/members")
+	exchange := errorsFor("POST /protocol/openid-connect/token")
+
+	_, _, err := client.makeRequest(context.Background(), http.MethodGet, server.URL+"/admin/realms/test-realm/groups/missing-id", "application/json", nil)
+	assert.Error(t, err)
+	_, _, err = client.makeRequest(context.Background(), http.MethodGet, server.URL+"/admin/realms/test-realm/groups/group-id/members", "application/json", nil)
+	assert.Error(t, err)
+	_, err = client.ExchangeToken(context.Background(), "user-token", "openid")
+	assert.Error(t, err)
+
+	// Client and server error responses are failed calls, not only transport errors
+	assert.Equal(t, getGroup+1, errorsFor("GET /groups/{id}"))
+	assert.Equal(t, members+1, errorsFor("GET /groups/{id}/members"))
+	assert.Equal(t, exchange+1, errorsFor("POST /protocol/openid-connect/token"))
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/EO-DataHub/eodhp-workspace-services/db"
 	"github.com/EO-DataHub/eodhp-workspace-services/internal/appconfig"
 	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authz"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/smithy-go"
@@ -54,6 +55,12 @@ type LinkedAccountService struct {
 	SecretsManager *secretsmanager.Client
 	K8sClient      kubernetes.Interface
 	KC             KeycloakClientInterface
+	// Authorizer decides what users may do. The default policy is used if it is nil.
+	Authorizer authz.Authorizer
+}
+
+func (svc *LinkedAccountService) authorizer() authz.Authorizer {
+	return authorizerOrDefault(svc.Authorizer, svc.DB, svc.KC)
 }
 
 // Payload represents the expected JSON structure
@@ -96,7 +103,7 @@ func (svc *LinkedAccountService) GetLinkedAccounts(w http.ResponseWriter, r *htt
 	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
 	if !ok {
 		logger.Warn().Msg("Unauthorized request: missing claims")
-		WriteResponse(w, http.StatusUnauthorized, nil)
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
 		return
 	}
 
@@ -104,15 +111,7 @@ func (svc *LinkedAccountService) GetLinkedAccounts(w http.ResponseWriter, r *htt
 	workspaceID := mux.Vars(r)["workspace-id"]
 
 	// Check if the user can access the workspace
-	authorized, err := isUserWorkspaceAuthorized(svc.DB, svc.KC, claims, workspaceID, false)
-	if err != nil {
-		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to authorize workspace")
-		WriteResponse(w, http.StatusInternalServerError, nil)
-		return
-	}
-
-	if !authorized {
-		WriteResponse(w, http.StatusForbidden, nil)
+	if !authorize(w, r, svc.authorizer(), claims, authz.ActionLinkedAccountsRead, authz.Resource{Workspace: workspaceID}) {
 		return
 	}
 
@@ -127,7 +126,7 @@ func (svc *LinkedAccountService) GetLinkedAccounts(w http.ResponseWriter, r *htt
 
 	if err != nil {
 		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to get linked accounts")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 	}
 
 	WriteResponse(w, http.StatusOK, providers)
@@ -142,7 +141,7 @@ func (svc *LinkedAccountService) DeleteLinkedAccountService(w http.ResponseWrite
 	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
 	if !ok {
 		logger.Warn().Msg("Unauthorized request: missing claims")
-		WriteResponse(w, http.StatusUnauthorized, nil)
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
 		return
 	}
 
@@ -151,25 +150,17 @@ func (svc *LinkedAccountService) DeleteLinkedAccountService(w http.ResponseWrite
 	provider := mux.Vars(r)["provider"]
 	namespace := "ws-" + workspaceID
 
-	// Check if the user is the account owner
-	authorized, err := isUserWorkspaceAuthorized(svc.DB, svc.KC, claims, workspaceID, true)
-	if err != nil {
-		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to authorize workspace")
-		WriteResponse(w, http.StatusInternalServerError, nil)
-		return
-	}
-
-	if !authorized {
-		WriteResponse(w, http.StatusForbidden, nil)
+	// Only workspace admins can manage linked accounts
+	if !authorize(w, r, svc.authorizer(), claims, authz.ActionLinkedAccountsManage, authz.Resource{Workspace: workspaceID}) {
 		return
 	}
 
 	// Delete the OTP secret from Kubernetes
 	k8sSecretName := "otp-" + provider
-	err = svc.deleteOTPSecret(k8sSecretName, namespace)
+	err := svc.deleteOTPSecret(k8sSecretName, namespace)
 	if err != nil {
 		logger.Error().Err(err).Str("workspace_id", workspaceID).Str("provider", provider).Msg("Failed to delete OTP secret")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
@@ -179,7 +170,7 @@ func (svc *LinkedAccountService) DeleteLinkedAccountService(w http.ResponseWrite
 	err = svc.deleteSecretKeyFromAWS(awsSecretName, provider)
 	if err != nil {
 		logger.Error().Err(err).Str("workspace_id", workspaceID).Str("provider", provider).Msg("Failed to delete encrypted key from AWS Secrets Manager")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
@@ -199,7 +190,7 @@ func (svc *LinkedAccountService) CreateLinkedAccountService(w http.ResponseWrite
 	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
 	if !ok {
 		logger.Warn().Msg("Unauthorized request: missing claims")
-		WriteResponse(w, http.StatusUnauthorized, nil)
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
 		return
 	}
 
@@ -207,16 +198,8 @@ func (svc *LinkedAccountService) CreateLinkedAccountService(w http.ResponseWrite
 	workspaceID := mux.Vars(r)["workspace-id"]
 	namespace := "ws-" + workspaceID
 
-	// Check if the user is the account owner
-	authorized, err := isUserWorkspaceAuthorized(svc.DB, svc.KC, claims, workspaceID, true)
-	if err != nil {
-		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to authorize workspace")
-		WriteResponse(w, http.StatusInternalServerError, nil)
-		return
-	}
-
-	if !authorized {
-		WriteResponse(w, http.StatusForbidden, "Access Denied: Must be account owner of the workspace")
+	// Only workspace admins can manage linked accounts
+	if !authorize(w, r, svc.authorizer(), claims, authz.ActionLinkedAccountsManage, authz.Resource{Workspace: workspaceID}) {
 		return
 	}
 
@@ -224,7 +207,7 @@ func (svc *LinkedAccountService) CreateLinkedAccountService(w http.ResponseWrite
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to read request body")
-		WriteResponse(w, http.StatusBadRequest, "Failed to read request body")
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Failed to read request body")
 		return
 	}
 	defer r.Body.Close()
@@ -233,20 +216,22 @@ func (svc *LinkedAccountService) CreateLinkedAccountService(w http.ResponseWrite
 	var payload Payload
 	if err := json.Unmarshal(body, &payload); err != nil {
 		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Invalid JSON payload")
-		WriteResponse(w, http.StatusBadRequest, "Invalid JSON payload")
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid JSON payload")
 		return
 	}
 
 	// Validate the key field
 	if payload.Key == "" {
 		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Field 'key' is required and cannot be empty")
-		WriteResponse(w, http.StatusBadRequest, "Field 'key' is required and cannot be empty")
+		WriteProblem(w, r, NewProblem(http.StatusBadRequest, CodeValidationFailed, "Field 'key' is required and cannot be empty").
+			WithFieldErrors(FieldError{Field: "key", Message: "is required and cannot be empty"}))
 		return
 	}
 
 	if payload.Name == "airbus" && reflect.DeepEqual(payload.Contracts, AirbusContractsData{}) {
 		logger.Error().Str("workspace_id", workspaceID).Msg("Field 'contracts' is required for an airbus key and cannot be empty")
-		WriteResponse(w, http.StatusBadRequest, "Field 'contracts' is required for an airbus key and cannot be empty")
+		WriteProblem(w, r, NewProblem(http.StatusBadRequest, CodeValidationFailed, "Field 'contracts' is required for an airbus key and cannot be empty").
+			WithFieldErrors(FieldError{Field: "contracts", Message: "is required for an airbus key and cannot be empty"}))
 		return
 	}
 
@@ -254,7 +239,7 @@ func (svc *LinkedAccountService) CreateLinkedAccountService(w http.ResponseWrite
 	otp, ciphertext, err := encryptWithOTP(payload.Key)
 	if err != nil {
 		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg(fmt.Sprintf("Encryption failed: %v", err))
-		WriteResponse(w, http.StatusInternalServerError, fmt.Sprintf("Encryption failed: %v", err))
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, fmt.Sprintf("Encryption failed: %v", err))
 		return
 	}
 
@@ -269,7 +254,7 @@ func (svc *LinkedAccountService) CreateLinkedAccountService(w http.ResponseWrite
 
 	if err != nil {
 		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg(fmt.Sprintf("Failed to store OTP in Kubernetes: %v", err))
-		WriteResponse(w, http.StatusInternalServerError, fmt.Sprintf("Failed to store OTP in Kubernetes: %v", err))
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, fmt.Sprintf("Failed to store OTP in Kubernetes: %v", err))
 		return
 	}
 	// Store the ciphertext in AWS Secrets Manager
@@ -277,7 +262,7 @@ func (svc *LinkedAccountService) CreateLinkedAccountService(w http.ResponseWrite
 	awsSecretName := fmt.Sprintf("ws-%s-%s", workspaceID, clusterPrefix) // We want to differentiate general secrets in AWS with workspace specific secrets
 	if err := svc.storeCiphertextInAWSSecrets(ciphertext, awsSecretName, payload.Name); err != nil {
 		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg(fmt.Sprintf("Failed to store encrypted key in AWS: %v", err))
-		WriteResponse(w, http.StatusInternalServerError, fmt.Sprintf("Failed to store encrypted key in AWS: %v", err))
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, fmt.Sprintf("Failed to store encrypted key in AWS: %v", err))
 		return
 	}
 	WriteResponse(w, http.StatusCreated, nil)
@@ -292,29 +277,21 @@ func (svc *LinkedAccountService) CreateOpenCosmosSessionService(w http.ResponseW
 	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
 	if !ok {
 		logger.Warn().Msg("Unauthorized request: missing claims")
-		WriteResponse(w, http.StatusUnauthorized, nil)
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
 		return
 	}
 
 	workspaceID := mux.Vars(r)["workspace-id"]
 	namespace := "ws-" + workspaceID
 
-	authorized, err := isUserWorkspaceAuthorized(svc.DB, svc.KC, claims, workspaceID, false)
-	if err != nil {
-		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to authorize workspace")
-		WriteResponse(w, http.StatusInternalServerError, nil)
-		return
-	}
-
-	if !authorized {
-		WriteResponse(w, http.StatusForbidden, "Access Denied: Must be a member of the workspace")
+	if !authorize(w, r, svc.authorizer(), claims, authz.ActionLinkedAccountsUse, authz.Resource{Workspace: workspaceID}) {
 		return
 	}
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to read request body")
-		WriteResponse(w, http.StatusBadRequest, "Failed to read request body")
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Failed to read request body")
 		return
 	}
 	defer r.Body.Close()
@@ -322,33 +299,37 @@ func (svc *LinkedAccountService) CreateOpenCosmosSessionService(w http.ResponseW
 	var payload OpenCosmosSessionPayload
 	if err := json.Unmarshal(body, &payload); err != nil {
 		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Invalid JSON payload")
-		WriteResponse(w, http.StatusBadRequest, "Invalid JSON payload")
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid JSON payload")
 		return
 	}
 
 	if payload.AccessToken == "" {
-		WriteResponse(w, http.StatusBadRequest, "Field 'accessToken' is required and cannot be empty")
+		WriteProblem(w, r, NewProblem(http.StatusBadRequest, CodeValidationFailed, "Field 'accessToken' is required and cannot be empty").
+			WithFieldErrors(FieldError{Field: "accessToken", Message: "is required and cannot be empty"}))
 		return
 	}
 
 	if payload.RefreshToken == "" {
-		WriteResponse(w, http.StatusBadRequest, "Field 'refreshToken' is required and cannot be empty")
+		WriteProblem(w, r, NewProblem(http.StatusBadRequest, CodeValidationFailed, "Field 'refreshToken' is required and cannot be empty").
+			WithFieldErrors(FieldError{Field: "refreshToken", Message: "is required and cannot be empty"}))
 		return
 	}
 
 	if payload.ExpiresAt <= 0 {
-		WriteResponse(w, http.StatusBadRequest, "Field 'expiresAt' is required and must be a positive timestamp")
+		WriteProblem(w, r, NewProblem(http.StatusBadRequest, CodeValidationFailed, "Field 'expiresAt' is required and must be a positive timestamp").
+			WithFieldErrors(FieldError{Field: "expiresAt", Message: "is required and must be a positive timestamp"}))
 		return
 	}
 
 	if payload.OrganizationID == nil || *payload.OrganizationID < 0 {
-		WriteResponse(w, http.StatusBadRequest, "Field 'organization_id' is required and must be a non-negative number")
+		WriteProblem(w, r, NewProblem(http.StatusBadRequest, CodeValidationFailed, "Field 'organization_id' is required and must be a non-negative number").
+			WithFieldErrors(FieldError{Field: "organization_id", Message: "is required and must be a non-negative number"}))
 		return
 	}
 
 	if err := svc.storeOpenCosmosSessionSecret(payload, openCosmosSecretName, namespace); err != nil {
 		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to store Open Cosmos session in Kubernetes")
-		WriteResponse(w, http.StatusInternalServerError, fmt.Sprintf("Failed to store Open Cosmos session in Kubernetes: %v", err))
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, fmt.Sprintf("Failed to store Open Cosmos session in Kubernetes: %v", err))
 		return
 	}
 
@@ -366,23 +347,15 @@ func (svc *LinkedAccountService) ValidateAirbusLinkedAccountService(w http.Respo
 	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
 	if !ok {
 		logger.Warn().Msg("Unauthorized request: missing claims")
-		WriteResponse(w, http.StatusUnauthorized, nil)
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
 		return
 	}
 
 	// Extract the workspace ID from the request URL path
 	workspaceID := mux.Vars(r)["workspace-id"]
 
-	// Check if the user is the account owner
-	authorized, err := isUserWorkspaceAuthorized(svc.DB, svc.KC, claims, workspaceID, true)
-	if err != nil {
-		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to authorize workspace")
-		WriteResponse(w, http.StatusInternalServerError, nil)
-		return
-	}
-
-	if !authorized {
-		WriteResponse(w, http.StatusForbidden, "Access Denied: Must be account owner of the workspace")
+	// Only workspace admins can manage linked accounts
+	if !authorize(w, r, svc.authorizer(), claims, authz.ActionLinkedAccountsManage, authz.Resource{Workspace: workspaceID}) {
 		return
 	}
 
@@ -390,7 +363,7 @@ func (svc *LinkedAccountService) ValidateAirbusLinkedAccountService(w http.Respo
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to read request body")
-		WriteResponse(w, http.StatusBadRequest, "Failed to read request body")
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Failed to read request body")
 		return
 	}
 	defer r.Body.Close()
@@ -399,14 +372,14 @@ func (svc *LinkedAccountService) ValidateAirbusLinkedAccountService(w http.Respo
 	var payload Payload
 	if err := json.Unmarshal(body, &payload); err != nil {
 		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Invalid JSON payload")
-		WriteResponse(w, http.StatusBadRequest, "Invalid JSON payload")
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid JSON payload")
 		return
 	}
 
 	// Validate the key field
 	if payload.Name != "airbus" {
 		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Only an Airbus key is allowed")
-		WriteResponse(w, http.StatusBadRequest, "Only an Airbus key is allowed")
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Only an Airbus key is allowed")
 		return
 	}
 
@@ -414,7 +387,7 @@ func (svc *LinkedAccountService) ValidateAirbusLinkedAccountService(w http.Respo
 	token, err := svc.getAirbusAccessToken(payload.Key)
 	if err != nil {
 		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to get Airbus token")
-		WriteResponse(w, http.StatusForbidden, "Access Denied")
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Access Denied")
 		return
 	}
 
@@ -424,7 +397,7 @@ func (svc *LinkedAccountService) ValidateAirbusLinkedAccountService(w http.Respo
 	if opticalErr != nil && sarErr != nil {
 		logger.Error().Str("workspace_id", workspaceID).
 			Msgf("Failed to get Airbus optical contracts and SAR whoami: optical=%v sar=%v", opticalErr, sarErr)
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
@@ -457,23 +430,15 @@ func (svc *LinkedAccountService) ValidatePlanetLinkedAccountService(w http.Respo
 	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
 	if !ok {
 		logger.Warn().Msg("Unauthorized request: missing claims")
-		WriteResponse(w, http.StatusUnauthorized, nil)
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
 		return
 	}
 
 	// Extract the workspace ID from the request URL path
 	workspaceID := mux.Vars(r)["workspace-id"]
 
-	// Check if the user is the account owner
-	authorized, err := isUserWorkspaceAuthorized(svc.DB, svc.KC, claims, workspaceID, true)
-	if err != nil {
-		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to authorize workspace")
-		WriteResponse(w, http.StatusInternalServerError, nil)
-		return
-	}
-
-	if !authorized {
-		WriteResponse(w, http.StatusForbidden, "Access Denied: Must be account owner of the workspace")
+	// Only workspace admins can manage linked accounts
+	if !authorize(w, r, svc.authorizer(), claims, authz.ActionLinkedAccountsManage, authz.Resource{Workspace: workspaceID}) {
 		return
 	}
 
@@ -481,7 +446,7 @@ func (svc *LinkedAccountService) ValidatePlanetLinkedAccountService(w http.Respo
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to read request body")
-		WriteResponse(w, http.StatusBadRequest, "Failed to read request body")
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Failed to read request body")
 		return
 	}
 	defer r.Body.Close()
@@ -490,14 +455,14 @@ func (svc *LinkedAccountService) ValidatePlanetLinkedAccountService(w http.Respo
 	var payload Payload
 	if err := json.Unmarshal(body, &payload); err != nil {
 		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Invalid JSON payload")
-		WriteResponse(w, http.StatusBadRequest, "Invalid JSON payload")
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid JSON payload")
 		return
 	}
 
 	// Validate the key field
 	if payload.Name != "planet" {
 		logger.Error().Str("workspace_id", workspaceID).Msg("Only a Planet key is allowed")
-		WriteResponse(w, http.StatusBadRequest, "Only a Planet key is allowed")
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Only a Planet key is allowed")
 		return
 	}
 
@@ -505,7 +470,7 @@ func (svc *LinkedAccountService) ValidatePlanetLinkedAccountService(w http.Respo
 	req, err := http.NewRequest("GET", svc.Config.Providers.Planet.ValidationURL, nil)
 	if err != nil {
 		logger.Error().Err(err).Msg("Failed to create request to Planet API")
-		WriteResponse(w, http.StatusInternalServerError, "Failed to contact Planet API")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to contact Planet API")
 		return
 	}
 	req.Header.Set("Authorization", "api-key "+payload.Key)
@@ -514,7 +479,7 @@ func (svc *LinkedAccountService) ValidatePlanetLinkedAccountService(w http.Respo
 	resp, err := client.Do(req)
 	if err != nil {
 		logger.Error().Err(err).Msg("Error making request to Planet API")
-		WriteResponse(w, http.StatusBadGateway, "Error contacting Planet API")
+		WriteError(w, r, http.StatusBadGateway, CodeUpstreamError, "Error contacting Planet API")
 		return
 	}
 	defer resp.Body.Close()
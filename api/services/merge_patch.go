@@ -0,0 +1,45 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// mergePatch applies a JSON Merge Patch (RFC 7396) document to the original JSON document.
+func mergePatch(original, patch []byte) ([]byte, error) {
+	var target interface{}
+	if err := json.Unmarshal(original, &target); err != nil {
+		return nil, fmt.Errorf("invalid original document: %w", err)
+	}
+
+	var p interface{}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %w", err)
+	}
+
+	return json.Marshal(mergePatchValue(target, p))
+}
+
+// mergePatchValue implements the MergePatch(Target, Patch) function from RFC 7396 section 2.
+func mergePatchValue(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		// A non-object patch replaces the target entirely
+		return patch
+	}
+
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = map[string]interface{}{}
+	}
+
+	for name, value := range patchObj {
+		if value == nil {
+			delete(targetObj, name)
+			continue
+		}
+		targetObj[name] = mergePatchValue(targetObj[name], value)
+	}
+
+	return targetObj
+}
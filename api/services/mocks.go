@@ -2,7 +2,7 @@ package services
 
 import (
 	"context"
-	"database/sql"
+	"time"
 
 	ws_manager "github.com/EO-DataHub/eodhp-workspace-manager/models"
 	ws_services "github.com/EO-DataHub/eodhp-workspace-services/models"
@@ -23,58 +23,69 @@ type MockKeycloakClient struct {
 	mock.Mock
 }
 
-type MockEventPublisher struct {
-	mock.Mock
-}
-
 func (m *MockAWSEmailClient) SendEmail(ctx context.Context, input *sesv2.SendEmailInput, opts ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
 	args := m.Called(ctx, input, opts)
 	return args.Get(0).(*sesv2.SendEmailOutput), args.Error(1)
 }
 
-func (m *MockWorkspaceDB) CreateAccount(account *ws_services.Account) (*ws_services.Account, error) {
+func (m *MockWorkspaceDB) CreateAccount(ctx context.Context, account *ws_services.Account) (*ws_services.Account, error) {
 	args := m.Called(account)
 	return args.Get(0).(*ws_services.Account), args.Error(1)
 }
 
-func (m *MockWorkspaceDB) GetAccounts(username string) ([]ws_services.Account, error) {
+func (m *MockWorkspaceDB) GetAccounts(ctx context.Context, username string) ([]ws_services.Account, error) {
 	args := m.Called(username)
 	return args.Get(0).([]ws_services.Account), args.Error(1)
 }
 
-func (m *MockWorkspaceDB) GetAccount(accountID uuid.UUID) (*ws_services.Account, error) {
+func (m *MockWorkspaceDB) GetAccount(ctx context.Context, accountID uuid.UUID) (*ws_services.Account, error) {
 	args := m.Called(accountID)
 	return args.Get(0).(*ws_services.Account), args.Error(1)
 }
 
-func (m *MockWorkspaceDB) UpdateAccount(accountID uuid.UUID, account ws_services.Account) (*ws_services.Account, error) {
-	args := m.Called(accountID, account)
+func (m *MockWorkspaceDB) UpdateAccount(ctx context.Context, accountID uuid.UUID, account ws_services.Account, version int) (*ws_services.Account, error) {
+	args := m.Called(accountID, account, version)
 	return args.Get(0).(*ws_services.Account), args.Error(1)
 }
 
-func (m *MockWorkspaceDB) DeleteAccount(accountID uuid.UUID) error {
-	args := m.Called(accountID)
-	return args.Error(0)
+func (m *MockWorkspaceDB) DeleteAccount(ctx context.Context, accountID uuid.UUID, version int, deletedBy string) (bool, error) {
+	args := m.Called(accountID, version, deletedBy)
+	return args.Bool(0), args.Error(1)
 }
 
-func (m *MockWorkspaceDB) IsUserAccountOwner(username, workspaceID string) (bool, error) {
+func (m *MockWorkspaceDB) CloseAccount(ctx context.Context, accountID uuid.UUID, closedBy string) ([]string, error) {
+	args := m.Called(accountID, closedBy)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockWorkspaceDB) FinishAccountClosure(ctx context.Context, workspaceName string) (bool, error) {
+	args := m.Called(workspaceName)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockWorkspaceDB) IsUserAccountOwner(ctx context.Context, username, workspaceID string) (bool, error) {
 	args := m.Called(username, workspaceID)
 	return args.Bool(0), args.Error(1)
 }
 
-func (m *MockWorkspaceDB) CreateAccountApprovalToken(accountID uuid.UUID) (string, error) {
-	args := m.Called(accountID)
-	return args.String(0), args.Error(1)
+func (m *MockWorkspaceDB) ListAccounts(ctx context.Context, opts ws_services.AccountListOptions) ([]ws_services.AdminAccount, error) {
+	args := m.Called(opts)
+	return args.Get(0).([]ws_services.AdminAccount), args.Error(1)
 }
 
-func (m *MockWorkspaceDB) ValidateApprovalToken(token string) (string, error) {
-	args := m.Called(token)
-	return args.String(0), args.Error(1)
+func (m *MockWorkspaceDB) SetAccountStatus(ctx context.Context, accountID uuid.UUID, from []string, to, changedBy, reason string) (*ws_services.AccountStatusChange, error) {
+	args := m.Called(accountID, from, to, changedBy, reason)
+	return args.Get(0).(*ws_services.AccountStatusChange), args.Error(1)
 }
 
-func (m *MockWorkspaceDB) UpdateAccountStatus(token, accountID, status string) error {
-	args := m.Called(token, accountID, status)
-	return args.Error(0)
+func (m *MockWorkspaceDB) ListAccountStatusChanges(ctx context.Context, accountID uuid.UUID) ([]ws_services.AccountStatusChange, error) {
+	args := m.Called(accountID)
+	return args.Get(0).([]ws_services.AccountStatusChange), args.Error(1)
+}
+
+func (m *MockWorkspaceDB) DecideAccount(ctx context.Context, accountID uuid.UUID, status, decidedBy, reason string) (*ws_services.AccountDecision, error) {
+	args := m.Called(accountID, status, decidedBy, reason)
+	return args.Get(0).(*ws_services.AccountDecision), args.Error(1)
 }
 
 func (m *MockWorkspaceDB) Close() error {
@@ -82,51 +93,186 @@ func (m *MockWorkspaceDB) Close() error {
 	return args.Error(0)
 }
 
-func (m *MockWorkspaceDB) CheckAccountIsVerified(accountID uuid.UUID) (bool, error) {
+func (m *MockWorkspaceDB) CheckAccountIsVerified(ctx context.Context, accountID uuid.UUID) (bool, string, error) {
 	args := m.Called(accountID)
-	return args.Bool(0), args.Error(1)
+	return args.Bool(0), args.String(1), args.Error(2)
 }
 
-func (m *MockWorkspaceDB) GetWorkspace(workspaceName string) (*ws_manager.WorkspaceSettings, error) {
+func (m *MockWorkspaceDB) GetWorkspace(ctx context.Context, workspaceName string) (*ws_manager.WorkspaceSettings, error) {
 	args := m.Called(workspaceName)
 	return args.Get(0).(*ws_manager.WorkspaceSettings), args.Error(1)
 }
 
-func (m *MockWorkspaceDB) GetUserWorkspaces(memberGroups []string) ([]ws_manager.WorkspaceSettings, error) {
+func (m *MockWorkspaceDB) GetWorkspaceAccountStatus(ctx context.Context, workspaceName string) (string, error) {
+	args := m.Called(workspaceName)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockWorkspaceDB) IsWorkspaceSuspended(ctx context.Context, workspaceName string) (bool, error) {
+	args := m.Called(workspaceName)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockWorkspaceDB) GetUserWorkspaces(ctx context.Context, memberGroups []string) ([]ws_manager.WorkspaceSettings, error) {
 	args := m.Called(memberGroups)
 	return args.Get(0).([]ws_manager.WorkspaceSettings), args.Error(1)
 }
 
-func (m *MockWorkspaceDB) GetOwnedWorkspaces(username string) ([]ws_manager.WorkspaceSettings, error) {
+func (m *MockWorkspaceDB) GetOwnedWorkspaces(ctx context.Context, username string) ([]ws_manager.WorkspaceSettings, error) {
 	args := m.Called(username)
 	return args.Get(0).([]ws_manager.WorkspaceSettings), args.Error(1)
 }
 
-func (m *MockWorkspaceDB) CheckWorkspaceExists(name string) (bool, error) {
+func (m *MockWorkspaceDB) GetAllWorkspaces(ctx context.Context) ([]string, error) {
+	args := m.Called()
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockWorkspaceDB) GetUnavailableWorkspaces(ctx context.Context) ([]ws_manager.WorkspaceSettings, error) {
+	args := m.Called()
+	return args.Get(0).([]ws_manager.WorkspaceSettings), args.Error(1)
+}
+
+func (m *MockWorkspaceDB) CheckWorkspaceExists(ctx context.Context, name string) (bool, error) {
 	args := m.Called(name)
 	return args.Bool(0), args.Error(1)
 }
 
-func (m *MockWorkspaceDB) UpdateWorkspaceStatus(status ws_manager.WorkspaceStatus) error {
+func (m *MockWorkspaceDB) CheckAvailableWorkspaceExists(ctx context.Context, name string) (bool, error) {
+	args := m.Called(name)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockWorkspaceDB) ListWorkspaces(ctx context.Context, opts ws_services.WorkspaceListOptions) ([]ws_services.AdminWorkspace, error) {
+	args := m.Called(opts)
+	return args.Get(0).([]ws_services.AdminWorkspace), args.Error(1)
+}
+
+func (m *MockWorkspaceDB) SuspendWorkspace(ctx context.Context, workspaceName, suspendedBy string) (bool, error) {
+	args := m.Called(workspaceName, suspendedBy)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockWorkspaceDB) ReactivateWorkspace(ctx context.Context, workspaceName string) (bool, error) {
+	args := m.Called(workspaceName)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockWorkspaceDB) GetWorkspaceRole(ctx context.Context, workspaceName, userID string) (string, error) {
+	args := m.Called(workspaceName, userID)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockWorkspaceDB) GetWorkspaceRoles(ctx context.Context, workspaceName string) (map[string]string, error) {
+	args := m.Called(workspaceName)
+	return args.Get(0).(map[string]string), args.Error(1)
+}
+
+func (m *MockWorkspaceDB) SetWorkspaceRole(ctx context.Context, workspaceName, userID, username, role, grantedBy string) error {
+	args := m.Called(workspaceName, userID, username, role, grantedBy)
+	return args.Error(0)
+}
+
+func (m *MockWorkspaceDB) DeleteWorkspaceRole(ctx context.Context, workspaceName, userID string) error {
+	args := m.Called(workspaceName, userID)
+	return args.Error(0)
+}
+
+func (m *MockWorkspaceDB) CreateWorkspaceInvitation(ctx context.Context, workspaceName, email, role, invitedBy string, expiry time.Duration) (*ws_services.WorkspaceInvitation, error) {
+	args := m.Called(workspaceName, email, role, invitedBy, expiry)
+	return args.Get(0).(*ws_services.WorkspaceInvitation), args.Error(1)
+}
+
+func (m *MockWorkspaceDB) GetWorkspaceInvitations(ctx context.Context, workspaceName string) ([]ws_services.WorkspaceInvitation, error) {
+	args := m.Called(workspaceName)
+	return args.Get(0).([]ws_services.WorkspaceInvitation), args.Error(1)
+}
+
+func (m *MockWorkspaceDB) GetWorkspaceInvitationByToken(ctx context.Context, token string) (*ws_services.WorkspaceInvitation, error) {
+	args := m.Called(token)
+	return args.Get(0).(*ws_services.WorkspaceInvitation), args.Error(1)
+}
+
+func (m *MockWorkspaceDB) DeleteWorkspaceInvitation(ctx context.Context, workspaceName string, invitationID uuid.UUID) (bool, error) {
+	args := m.Called(workspaceName, invitationID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockWorkspaceDB) UpdateWorkspaceStatus(ctx context.Context, status ws_manager.WorkspaceStatus) error {
 	args := m.Called(status)
 	return args.Error(0)
 }
 
-func (m *MockWorkspaceDB) DisableWorkspace(workspaceName string) error {
+func (m *MockWorkspaceDB) DisableWorkspace(ctx context.Context, workspaceName string) error {
 	args := m.Called(workspaceName)
 	return args.Error(0)
 }
 
-func (m *MockWorkspaceDB) CreateWorkspace(req *ws_manager.WorkspaceSettings) (*sql.Tx, error) {
+func (m *MockWorkspaceDB) CreateWorkspace(ctx context.Context, req *ws_manager.WorkspaceSettings) error {
+	args := m.Called(req)
+	return args.Error(0)
+}
+
+func (m *MockWorkspaceDB) UpdateWorkspace(ctx context.Context, req *ws_manager.WorkspaceSettings) error {
 	args := m.Called(req)
-	return args.Get(0).(*sql.Tx), args.Error(1)
+	return args.Error(0)
+}
+
+func (m *MockWorkspaceDB) ScheduleWorkspaceDeletion(ctx context.Context, workspaceName, requestedBy string, gracePeriod time.Duration) (time.Time, error) {
+	args := m.Called(workspaceName, requestedBy, gracePeriod)
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
+func (m *MockWorkspaceDB) CancelWorkspaceDeletion(ctx context.Context, workspaceName string) (bool, error) {
+	args := m.Called(workspaceName)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockWorkspaceDB) EnqueueExpiredWorkspaceDeletions(ctx context.Context, limit int) ([]string, error) {
+	args := m.Called(limit)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockWorkspaceDB) EnqueueWorkspaceEvent(ctx context.Context, event ws_manager.WorkspaceSettings) error {
+	args := m.Called(event)
+	return args.Error(0)
+}
+
+func (m *MockWorkspaceDB) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]ws_services.OutboxEvent, error) {
+	args := m.Called(limit, lease)
+	return args.Get(0).([]ws_services.OutboxEvent), args.Error(1)
 }
 
-func (m *MockWorkspaceDB) CommitTransaction(tx *sql.Tx) error {
-	args := m.Called(tx)
+func (m *MockWorkspaceDB) MarkOutboxEventSent(ctx context.Context, id int64) error {
+	args := m.Called(id)
 	return args.Error(0)
 }
 
+func (m *MockWorkspaceDB) MarkOutboxEventFailed(ctx context.Context, id int64, errMsg string, nextAttempt time.Time, permanent bool) error {
+	args := m.Called(id, errMsg, nextAttempt, permanent)
+	return args.Error(0)
+}
+
+func (m *MockWorkspaceDB) CreateWorkspaceSaga(ctx context.Context, saga *ws_services.WorkspaceCreationSaga) error {
+	args := m.Called(saga)
+	return args.Error(0)
+}
+
+func (m *MockWorkspaceDB) UpdateWorkspaceSaga(ctx context.Context, sagaID uuid.UUID, step, status, errMsg string) error {
+	args := m.Called(sagaID, step, status, errMsg)
+	return args.Error(0)
+}
+
+func (m *MockWorkspaceDB) GetUnfinishedWorkspaceSagas(ctx context.Context, olderThan time.Duration) ([]ws_services.WorkspaceCreationSaga, error) {
+	args := m.Called(olderThan)
+	return args.Get(0).([]ws_services.WorkspaceCreationSaga), args.Error(1)
+}
+
+func (m *MockWorkspaceDB) CheckNewerWorkspaceSagaExists(ctx context.Context, saga ws_services.WorkspaceCreationSaga) (bool, error) {
+	args := m.Called(saga.ID)
+	return args.Bool(0), args.Error(1)
+}
+
 // CreateUser mock
 func (m *MockKeycloakClient) CreateUser(username, email, password string) (string, error) {
 	args := m.Called(username, email, password)
@@ -140,15 +286,15 @@ func (m *MockKeycloakClient) DeleteUser(userID string) error {
 }
 
 // CreateGroup mock
-func (m *MockKeycloakClient) CreateGroup(groupName string) (int, error) {
+func (m *MockKeycloakClient) CreateGroup(ctx context.Context, groupName string) (int, error) {
 	args := m.Called(groupName)
 	return args.Get(0).(int), args.Error(1)
 }
 
 // DeleteGroup mock (This was missing)
-func (m *MockKeycloakClient) DeleteGroup(groupID string) (int, error) {
+func (m *MockKeycloakClient) DeleteGroup(ctx context.Context, groupID string) (int, error) {
 	args := m.Called(groupID)
-	return args.Get(0).(int), args.Error(0)
+	return args.Get(0).(int), args.Error(1)
 }
 
 // AddUserToGroup mock
@@ -163,57 +309,56 @@ func (m *MockKeycloakClient) RemoveUserFromGroup(userID, groupID string) error {
 	return args.Error(0)
 }
 
-func (m *MockKeycloakClient) GetToken() error {
+func (m *MockKeycloakClient) GetToken(ctx context.Context) error {
 	return nil // No-op for mock
 }
 
 // AddMemberToGroup mock (Add this method)
-func (m *MockKeycloakClient) AddMemberToGroup(userID, groupID string) error {
+func (m *MockKeycloakClient) AddMemberToGroup(ctx context.Context, userID, groupID string) error {
 	args := m.Called(userID, groupID)
 	return args.Error(0)
 }
 
-func (m *MockKeycloakClient) ExchangeToken(accessToken, scope string) (*TokenResponse, error) {
+func (m *MockKeycloakClient) ExchangeToken(ctx context.Context, accessToken, scope string) (*TokenResponse, error) {
 	args := m.Called(accessToken, scope)
 	return args.Get(0).(*TokenResponse), args.Error(1)
 }
 
-func (m *MockKeycloakClient) GetGroup(groupName string) (*ws_services.Group, error) {
+func (m *MockKeycloakClient) GetGroup(ctx context.Context, groupName string) (*ws_services.Group, error) {
 	args := m.Called(groupName)
 	return args.Get(0).(*ws_services.Group), args.Error(1)
 }
 
-func (m *MockKeycloakClient) GetGroupMembers(groupID string) ([]ws_services.User, error) {
+func (m *MockKeycloakClient) GetGroupMembers(ctx context.Context, groupID string) ([]ws_services.User, error) {
 	args := m.Called(groupID)
 	return args.Get(0).([]ws_services.User), args.Error(1)
 }
 
-func (m *MockKeycloakClient) GetGroupMember(groupID, userID string) (*ws_services.User, error) {
+func (m *MockKeycloakClient) GetGroupMembersPage(ctx context.Context, groupID string, first, limit int, search string) ([]ws_services.User, int, error) {
+	args := m.Called(groupID, first, limit, search)
+	return args.Get(0).([]ws_services.User), args.Int(1), args.Error(2)
+}
+
+func (m *MockKeycloakClient) GetGroupMember(ctx context.Context, groupID, userID string) (*ws_services.User, error) {
 	args := m.Called(groupID)
 	return args.Get(0).(*ws_services.User), args.Error(1)
 }
 
-func (m *MockKeycloakClient) GetUser(username string) (*ws_services.User, error) {
+func (m *MockKeycloakClient) GetGroups(ctx context.Context) ([]ws_services.Group, error) {
+	args := m.Called()
+	return args.Get(0).([]ws_services.Group), args.Error(1)
+}
+
+func (m *MockKeycloakClient) GetUser(ctx context.Context, username string) (*ws_services.User, error) {
 	args := m.Called(username)
 	return args.Get(0).(*ws_services.User), args.Error(1)
 }
 
-func (m *MockKeycloakClient) GetUserGroups(userID string) ([]string, error) {
+func (m *MockKeycloakClient) GetUserGroups(ctx context.Context, userID string) ([]string, error) {
 	args := m.Called(userID)
 	return args.Get(0).([]string), args.Error(1)
 }
-func (m *MockKeycloakClient) RemoveMemberFromGroup(userID, groupID string) error {
+func (m *MockKeycloakClient) RemoveMemberFromGroup(ctx context.Context, userID, groupID string) error {
 	args := m.Called(userID, groupID)
 	return args.Error(1)
 }
-
-// Mock the Publish method
-func (m *MockEventPublisher) Publish(event ws_manager.WorkspaceSettings) error {
-	args := m.Called(event)
-	return args.Error(0)
-}
-
-// Mock the Close method
-func (m *MockEventPublisher) Close() {
-	m.Called()
-}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/requestid"
+	"github.com/rs/zerolog/log"
+)
+
+// ProblemContentType is the media type of error responses.
+const ProblemContentType = "application/problem+json"
+
+// Machine-readable error codes. Clients should branch on these rather than on the detail text,
+// which is intended for people and may change.
+const (
+	CodeInvalidRequest       = "invalid_request"
+	CodeValidationFailed     = "validation_failed"
+	CodeUnauthorized         = "unauthorized"
+	CodeInvalidToken         = "invalid_token"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeConflict             = "conflict"
+	CodePreconditionFailed   = "precondition_failed"
+	CodePayloadTooLarge      = "payload_too_large"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeRateLimited          = "rate_limited"
+	CodeInternal             = "internal_error"
+	CodeUpstreamError        = "upstream_error"
+	CodeAccountNotFound      = "account_not_found"
+	CodeAccountNotApproved   = "account_not_approved"
+	CodeAccountHasWorkspaces = "account_has_workspaces"
+	CodeAccountInactive      = "account_inactive"
+	CodeWorkspaceSuspended   = "workspace_suspended"
+	CodeWorkspaceNotFound    = "workspace_not_found"
+	CodeWorkspaceExists      = "workspace_exists"
+	CodeWorkspaceDeleting    = "workspace_pending_deletion"
+	CodeWorkspaceNotDeleting = "workspace_not_pending_deletion"
+	CodeImmutableField       = "immutable_field"
+	CodeUserNotFound         = "user_not_found"
+	CodeInvitationNotFound   = "invitation_not_found"
+	CodeFileNotFound         = "file_not_found"
+	CodeFilesPartiallyFailed = "files_partially_failed"
+	CodeAccountOwnerRequired = "account_owner_required"
+	CodeWorkspaceScopedToken = "workspace_scoped_token"
+)
+
+// Problem is an RFC 7807 problem details error response.
+type Problem struct {
+	Type      string       `json:"type" example:"about:blank"`
+	Title     string       `json:"title" example:"Not Found"`
+	Status    int          `json:"status" example:"404"`
+	Code      string       `json:"code" example:"workspace_not_found"`
+	Detail    string       `json:"detail,omitempty" example:"Workspace does not exist."`
+	Instance  string       `json:"instance,omitempty" example:"/api/workspaces/my-workspace"`
+	RequestID string       `json:"request_id,omitempty" example:"0b9e7c4e-1d1f-4a43-9d44-2a1f5b0c9a7e"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes a problem with a single field of a request.
+type FieldError struct {
+	Field   string `json:"field" example:"name"`
+	Message string `json:"message" example:"is required"`
+}
+
+// NewProblem creates a problem with the given status, code and detail.
+func NewProblem(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+		Detail: detail,
+	}
+}
+
+// WithFieldErrors adds errors for individual request fields to p.
+func (p *Problem) WithFieldErrors(errs ...FieldError) *Problem {
+	p.Errors = append(p.Errors, errs...)
+	return p
+}
+
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+// WriteProblem writes p as the response to r.
+func WriteProblem(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if p.RequestID == "" {
+		p.RequestID = requestid.FromContext(r.Context())
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("Cache-Control", "max-age=0")
+	w.WriteHeader(p.Status)
+
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// WriteError writes a problem with the given status, code and detail as the response to r.
+func WriteError(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	WriteProblem(w, r, NewProblem(status, code, detail))
+}
+
+// WriteHTTPError writes err as the response to r. Errors from Keycloak keep their status,
+// anything else is logged and reported as an internal error without its details.
+func WriteHTTPError(w http.ResponseWriter, r *http.Request, err error) {
+	switch e := err.(type) {
+	case *Problem:
+		WriteProblem(w, r, e)
+	case *HTTPError:
+		WriteError(w, r, e.Status, codeForStatus(e.Status), e.Message)
+	default:
+		log.Error().Err(err).Str("request_id", requestid.FromContext(r.Context())).Msg("Internal error handling request")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+	}
+}
+
+// codeForStatus returns the generic code for a status when nothing more specific is known.
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusPreconditionFailed:
+		return CodePreconditionFailed
+	case http.StatusRequestEntityTooLarge:
+		return CodePayloadTooLarge
+	case http.StatusUnsupportedMediaType:
+		return CodeUnsupportedMediaType
+	case http.StatusUnprocessableEntity:
+		return CodeValidationFailed
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return CodeUpstreamError
+	}
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeInvalidRequest
+}
+
+// fieldErrors reports the same message for each of fields.
+func fieldErrors(fields []string, message string) []FieldError {
+	errs := make([]FieldError, 0, len(fields))
+	for _, field := range fields {
+		errs = append(errs, FieldError{Field: field, Message: message})
+	}
+	return errs
+}
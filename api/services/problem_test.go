@@ -0,0 +1,64 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/requestid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteProblem(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPut, "/api/workspaces/ws-1", nil)
+	r = r.WithContext(requestid.NewContext(r.Context(), "req-123"))
+	w := httptest.NewRecorder()
+
+	WriteProblem(w, r, NewProblem(http.StatusUnprocessableEntity, CodeImmutableField, "fields cannot be changed: name").
+		WithFieldErrors(fieldErrors([]string{"name"}, "cannot be changed")...))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+
+	var p Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, Problem{
+		Type:      "about:blank",
+		Title:     "Unprocessable Entity",
+		Status:    http.StatusUnprocessableEntity,
+		Code:      CodeImmutableField,
+		Detail:    "fields cannot be changed: name",
+		Instance:  "/api/workspaces/ws-1",
+		RequestID: "req-123",
+		Errors:    []FieldError{{Field: "name", Message: "cannot be changed"}},
+	}, p)
+}
+
+func TestWriteHTTPError(t *testing.T) {
+	tests := []struct {
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{&HTTPError{Status: http.StatusForbidden, Message: "denied"}, http.StatusForbidden, CodeForbidden},
+		{NewProblem(http.StatusUnauthorized, CodeInvalidToken, "invalid token"), http.StatusUnauthorized, CodeInvalidToken},
+		{errors.New("boom"), http.StatusInternalServerError, CodeInternal},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		WriteHTTPError(w, httptest.NewRequest(http.MethodGet, "/", nil), tt.err)
+
+		var p Problem
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+		assert.Equal(t, tt.wantStatus, w.Code)
+		assert.Equal(t, tt.wantStatus, p.Status)
+		assert.Equal(t, tt.wantCode, p.Code)
+
+		// Internal errors are logged, not returned to the client
+		assert.NotContains(t, w.Body.String(), "boom")
+	}
+}
@@ -0,0 +1,403 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	ws_manager "github.com/EO-DataHub/eodhp-workspace-manager/models"
+	"github.com/EO-DataHub/eodhp-workspace-services/db"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/tracing"
+	"github.com/rs/zerolog"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Kinds of change in a reconcile plan.
+const (
+	ReconcileActionCreate = "create"
+	ReconcileActionUpdate = "update"
+	ReconcileActionOrphan = "orphan"
+)
+
+// Resources compared by reconcile.
+const (
+	ReconcileResourceWorkspace = "workspace"
+	ReconcileResourceNamespace = "namespace"
+	ReconcileResourceGroup     = "keycloak-group"
+)
+
+// WorkspaceResource identifies the workspace custom resources managed by the workspace controller.
+var WorkspaceResource = schema.GroupVersionResource{Group: "core.telespazio-uk.io", Version: "v1alpha1", Resource: "workspaces"}
+
+// workspaceResourceNamespace is the namespace the workspace manager creates workspace resources in.
+const workspaceResourceNamespace = "workspaces"
+
+// The workspace controller sets WorkspaceNamespaceManagedByLabel on the namespaces it creates, or
+// owns them through their workspace resource. Other ws- namespaces are never deleted by reconcile.
+const (
+	WorkspaceNamespaceManagedByLabel = "app.kubernetes.io/managed-by"
+	WorkspaceNamespaceManagedBy      = "workspace-controller"
+)
+
+// ReconcileChange is a single difference between the database and the cluster or Keycloak.
+type ReconcileChange struct {
+	Action    string `json:"action"`
+	Resource  string `json:"resource"`
+	Name      string `json:"name"`
+	Workspace string `json:"workspace"`
+	Reason    string `json:"reason"`
+
+	settings *ws_manager.WorkspaceSettings
+}
+
+// ReconcilePlan lists the changes needed to bring the cluster and Keycloak in line with the database.
+type ReconcilePlan struct {
+	Changes []ReconcileChange `json:"changes"`
+}
+
+// ReconcileService compares the workspaces in the database with what exists in Kubernetes and Keycloak.
+type ReconcileService struct {
+	DB        db.WorkspaceDBInterface
+	KC        KeycloakClientInterface
+	K8sClient kubernetes.Interface
+	Dynamic   dynamic.Interface
+}
+
+// Plan builds the reconcile plan. If workspaces is not empty only those workspaces are considered.
+func (svc *ReconcileService) Plan(ctx context.Context, workspaces []string) (*ReconcilePlan, error) {
+	ctx, span := tracing.Start(ctx, "ReconcileService.Plan")
+	defer span.End()
+
+	only := make(map[string]bool, len(workspaces))
+	for _, name := range workspaces {
+		only[name] = true
+	}
+	included := func(name string) bool {
+		return len(only) == 0 || only[name]
+	}
+
+	desired, err := svc.desiredWorkspaces(ctx, included)
+	if err != nil {
+		return nil, err
+	}
+
+	resources, err := svc.workspaceResources(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces, err := svc.workspaceNamespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := svc.KC.GetGroups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keycloak groups: %w", err)
+	}
+	groupNames := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		groupNames[group.Name] = true
+	}
+
+	plan := &ReconcilePlan{}
+	add := func(change ReconcileChange) {
+		plan.Changes = append(plan.Changes, change)
+	}
+
+	for _, name := range sortedKeys(desired) {
+		ws := desired[name]
+		namespace := "ws-" + name
+
+		// Workspaces being torn down are expected to disappear from the cluster
+		if strings.EqualFold(ws.Status, WorkspaceStatusDeleting) {
+			continue
+		}
+
+		if resource, ok := resources[name]; !ok {
+			add(ReconcileChange{Action: ReconcileActionCreate, Resource: ReconcileResourceWorkspace, Name: name, Workspace: name,
+				Reason: "workspace resource missing", settings: ws})
+		} else if drift := workspaceDrift(ws, resource); drift != "" {
+			add(ReconcileChange{Action: ReconcileActionUpdate, Resource: ReconcileResourceWorkspace, Name: name, Workspace: name,
+				Reason: drift, settings: ws})
+		} else if _, ok := namespaces[namespace]; !ok {
+			add(ReconcileChange{Action: ReconcileActionUpdate, Resource: ReconcileResourceWorkspace, Name: name, Workspace: name,
+				Reason: fmt.Sprintf("namespace %s missing", namespace), settings: ws})
+		}
+
+		if !groupNames[name] {
+			add(ReconcileChange{Action: ReconcileActionCreate, Resource: ReconcileResourceGroup, Name: name, Workspace: name,
+				Reason: "keycloak group missing", settings: ws})
+		}
+	}
+
+	for _, name := range sortedKeys(resources) {
+		if _, ok := desired[name]; ok || !included(name) {
+			continue
+		}
+		add(ReconcileChange{Action: ReconcileActionOrphan, Resource: ReconcileResourceWorkspace, Name: name, Workspace: name,
+			Reason: "no active workspace in database"})
+	}
+
+	for _, namespace := range sortedKeys(namespaces) {
+		name := strings.TrimPrefix(namespace, "ws-")
+		if _, ok := desired[name]; ok || !included(name) {
+			continue
+		}
+		// Namespaces still owned by a workspace resource are removed along with it
+		if _, ok := resources[name]; ok {
+			continue
+		}
+		// Namespaces the workspace controller did not create are not ours to delete
+		if !controllerNamespace(namespaces[namespace]) {
+			continue
+		}
+		add(ReconcileChange{Action: ReconcileActionOrphan, Resource: ReconcileResourceNamespace, Name: namespace, Workspace: name,
+			Reason: "no active workspace in database"})
+	}
+
+	for _, name := range sortedKeys(groupNames) {
+		if _, ok := desired[name]; ok || !included(name) {
+			continue
+		}
+
+		// Only groups of workspaces that once existed are orphans, other groups are not ours to manage
+		known, err := svc.DB.CheckWorkspaceExists(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if !known {
+			continue
+		}
+		add(ReconcileChange{Action: ReconcileActionOrphan, Resource: ReconcileResourceGroup, Name: name, Workspace: name,
+			Reason: "workspace has been deleted"})
+	}
+
+	return plan, nil
+}
+
+// Apply carries out the changes in the plan whose action is in actions. Workspace resources are
+// changed by queueing events for the workspace manager, namespaces and groups are changed directly.
+// It returns the number of changes that failed.
+func (svc *ReconcileService) Apply(ctx context.Context, plan *ReconcilePlan, actions []string, logger *zerolog.Logger) int {
+	ctx, span := tracing.Start(ctx, "ReconcileService.Apply")
+	defer span.End()
+
+	selected := make(map[string]bool, len(actions))
+	for _, action := range actions {
+		selected[action] = true
+	}
+
+	failed := 0
+	for _, change := range plan.Changes {
+		if !selected[change.Action] {
+			continue
+		}
+
+		changeLogger := logger.With().Str("action", change.Action).Str("resource", change.Resource).Str("name", change.Name).Logger()
+		if err := svc.apply(ctx, change); err != nil {
+			changeLogger.Error().Err(err).Msg("Failed to apply reconcile change")
+			failed++
+			continue
+		}
+		changeLogger.Info().Msg("Applied reconcile change")
+	}
+
+	return failed
+}
+
+func (svc *ReconcileService) apply(ctx context.Context, change ReconcileChange) error {
+	switch change.Resource + "/" + change.Action {
+	case ReconcileResourceWorkspace + "/" + ReconcileActionCreate:
+		event := *change.settings
+		event.Status = WorkspaceStatusCreating
+		return svc.DB.EnqueueWorkspaceEvent(ctx, event)
+
+	case ReconcileResourceWorkspace + "/" + ReconcileActionUpdate:
+		event := *change.settings
+		event.Status = WorkspaceStatusUpdating
+		return svc.DB.EnqueueWorkspaceEvent(ctx, event)
+
+	case ReconcileResourceWorkspace + "/" + ReconcileActionOrphan:
+		var event ws_manager.WorkspaceSettings
+		event.Name = change.Name
+		event.Status = WorkspaceStatusDeleting
+		return svc.DB.EnqueueWorkspaceEvent(ctx, event)
+
+	case ReconcileResourceNamespace + "/" + ReconcileActionOrphan:
+		// Check the namespace again in case it was replaced since the plan was made
+		namespace, err := svc.K8sClient.CoreV1().Namespaces().Get(ctx, change.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if !controllerNamespace(namespace) {
+			return fmt.Errorf("namespace %s is not managed by the workspace controller", change.Name)
+		}
+		return svc.K8sClient.CoreV1().Namespaces().Delete(ctx, change.Name, metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &namespace.UID},
+		})
+
+	case ReconcileResourceGroup + "/" + ReconcileActionCreate:
+		if _, err := svc.KC.CreateGroup(ctx, change.Name); err != nil {
+			return err
+		}
+		// Restore the account owner's membership of the recreated group
+		owner, err := svc.KC.GetUser(ctx, change.settings.Owner)
+		if err != nil {
+			return fmt.Errorf("group created but failed to find owner %s: %w", change.settings.Owner, err)
+		}
+		group, err := svc.KC.GetGroup(ctx, change.Name)
+		if err != nil {
+			return err
+		}
+		return svc.KC.AddMemberToGroup(ctx, owner.ID, group.ID)
+
+	case ReconcileResourceGroup + "/" + ReconcileActionOrphan:
+		_, err := svc.KC.DeleteGroup(ctx, change.Name)
+		return err
+	}
+
+	return fmt.Errorf("unsupported change %s of %s", change.Action, change.Resource)
+}
+
+// desiredWorkspaces loads the full settings of every active workspace in the database.
+func (svc *ReconcileService) desiredWorkspaces(ctx context.Context, included func(string) bool) (map[string]*ws_manager.WorkspaceSettings, error) {
+	names, err := svc.DB.GetAllWorkspaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	workspaces := make(map[string]*ws_manager.WorkspaceSettings, len(names))
+	for _, name := range names {
+		if !included(name) {
+			continue
+		}
+		ws, err := svc.DB.GetWorkspace(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load workspace %s: %w", name, err)
+		}
+		workspaces[name] = ws
+	}
+
+	return workspaces, nil
+}
+
+// workspaceResources lists the workspace custom resources in the cluster by name.
+func (svc *ReconcileService) workspaceResources(ctx context.Context) (map[string]*unstructured.Unstructured, error) {
+	list, err := svc.Dynamic.Resource(WorkspaceResource).Namespace(workspaceResourceNamespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workspace resources: %w", err)
+	}
+
+	resources := make(map[string]*unstructured.Unstructured, len(list.Items))
+	for i := range list.Items {
+		resources[list.Items[i].GetName()] = &list.Items[i]
+	}
+	return resources, nil
+}
+
+// workspaceNamespaces lists the namespaces named for workspaces by name.
+func (svc *ReconcileService) workspaceNamespaces(ctx context.Context) (map[string]*corev1.Namespace, error) {
+	list, err := svc.K8sClient.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+
+	namespaces := make(map[string]*corev1.Namespace)
+	for i := range list.Items {
+		if strings.HasPrefix(list.Items[i].Name, "ws-") {
+			namespaces[list.Items[i].Name] = &list.Items[i]
+		}
+	}
+	return namespaces, nil
+}
+
+// controllerNamespace reports whether a namespace was created by the workspace controller, either
+// from its managed-by label or an owner reference to a workspace resource.
+func controllerNamespace(namespace *corev1.Namespace) bool {
+	if namespace.Labels[WorkspaceNamespaceManagedByLabel] == WorkspaceNamespaceManagedBy {
+		return true
+	}
+	for _, owner := range namespace.OwnerReferences {
+		gv, err := schema.ParseGroupVersion(owner.APIVersion)
+		if err == nil && gv.Group == WorkspaceResource.Group && owner.Kind == "Workspace" {
+			return true
+		}
+	}
+	return false
+}
+
+// workspaceDrift describes how the stores of a workspace resource differ from the database, or
+// returns an empty string if they match.
+func workspaceDrift(ws *ws_manager.WorkspaceSettings, resource *unstructured.Unstructured) string {
+	var wantObject, wantBlock []string
+	if ws.Stores != nil {
+		for _, store := range *ws.Stores {
+			for _, object := range store.Object {
+				wantObject = append(wantObject, object.Name)
+			}
+			for _, block := range store.Block {
+				wantBlock = append(wantBlock, block.Name)
+			}
+		}
+	}
+
+	var haveObject, haveBlock []string
+	buckets, _, _ := unstructured.NestedSlice(resource.Object, "spec", "aws", "s3", "buckets")
+	for _, bucket := range buckets {
+		if b, ok := bucket.(map[string]interface{}); ok {
+			path, _ := b["path"].(string)
+			haveObject = append(haveObject, strings.TrimSuffix(path, "/"))
+		}
+	}
+	accessPoints, _, _ := unstructured.NestedSlice(resource.Object, "spec", "aws", "efs", "accessPoints")
+	for _, accessPoint := range accessPoints {
+		if ap, ok := accessPoint.(map[string]interface{}); ok {
+			name, _ := ap["name"].(string)
+			haveBlock = append(haveBlock, name)
+		}
+	}
+
+	var drift []string
+	if !sameNames(wantObject, haveObject) {
+		drift = append(drift, fmt.Sprintf("object stores %v, resource has %v", sorted(wantObject), sorted(haveObject)))
+	}
+	if !sameNames(wantBlock, haveBlock) {
+		drift = append(drift, fmt.Sprintf("block stores %v, resource has %v", sorted(wantBlock), sorted(haveBlock)))
+	}
+	return strings.Join(drift, "; ")
+}
+
+func sameNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = sorted(a), sorted(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sorted(names []string) []string {
+	out := append([]string{}, names...)
+	sort.Strings(out)
+	return out
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	ws_manager "github.com/EO-DataHub/eodhp-workspace-manager/models"
+	"github.com/EO-DataHub/eodhp-workspace-services/models"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func workspaceResource(name string, objectPaths, accessPoints []string) *unstructured.Unstructured {
+	buckets := []interface{}{}
+	for _, path := range objectPaths {
+		buckets = append(buckets, map[string]interface{}{"path": path})
+	}
+	efs := []interface{}{}
+	for _, ap := range accessPoints {
+		efs = append(efs, map[string]interface{}{"name": ap})
+	}
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "core.telespazio-uk.io/v1alpha1",
+		"kind":       "Workspace",
+		"metadata":   map[string]interface{}{"name": name, "namespace": workspaceResourceNamespace},
+		"spec": map[string]interface{}{
+			"aws": map[string]interface{}{
+				"s3":  map[string]interface{}{"buckets": buckets},
+				"efs": map[string]interface{}{"accessPoints": efs},
+			},
+		},
+	}}
+}
+
+func workspaceSettings(name string, objectStores, blockStores []string) *ws_manager.WorkspaceSettings {
+	store := ws_manager.Stores{}
+	for _, object := range objectStores {
+		store.Object = append(store.Object, ws_manager.ObjectStore{Name: object})
+	}
+	for _, block := range blockStores {
+		store.Block = append(store.Block, ws_manager.BlockStore{Name: block})
+	}
+	return &ws_manager.WorkspaceSettings{Name: name, Owner: "owner", Status: "Ready", Stores: &[]ws_manager.Stores{store}}
+}
+
+func newReconcileService(mockDB *MockWorkspaceDB, mockKC *MockKeycloakClient, resources []runtime.Object, namespaces ...string) *ReconcileService {
+	var nsObjects []runtime.Object
+	for _, ns := range namespaces {
+		nsObjects = append(nsObjects, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   ns,
+			Labels: map[string]string{WorkspaceNamespaceManagedByLabel: WorkspaceNamespaceManagedBy},
+		}})
+	}
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{WorkspaceResource: "WorkspaceList"}, resources...)
+
+	return &ReconcileService{
+		DB:        mockDB,
+		KC:        mockKC,
+		K8sClient: fake.NewSimpleClientset(nsObjects...),
+		Dynamic:   dynamicClient,
+	}
+}
+
+func TestReconcilePlan(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	mockKC := new(MockKeycloakClient)
+
+	svc := newReconcileService(mockDB, mockKC, []runtime.Object{
+		workspaceResource("in-sync", []string{"in-sync/"}, []string{"in-sync"}),
+		workspaceResource("drifted", []string{"drifted/"}, nil),
+		workspaceResource("no-namespace", []string{"no-namespace/"}, nil),
+		workspaceResource("orphan", []string{"orphan/"}, nil),
+	}, "ws-in-sync", "ws-drifted", "ws-orphan", "ws-leftover", "default")
+
+	// Namespaces owned by a workspace resource are the controller's even without its label
+	_, err := svc.K8sClient.CoreV1().Namespaces().Create(context.Background(), &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name: "ws-owned",
+		OwnerReferences: []metav1.OwnerReference{{
+			APIVersion: "core.telespazio-uk.io/v1alpha1", Kind: "Workspace", Name: "owned", UID: "owned-uid",
+		}},
+	}}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	// Namespaces that only share the prefix are left alone
+	_, err = svc.K8sClient.CoreV1().Namespaces().Create(context.Background(),
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ws-unlabelled"}}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	mockDB.On("GetAllWorkspaces").Return([]string{"in-sync", "drifted", "missing", "no-namespace"}, nil)
+	mockDB.On("GetWorkspace", "in-sync").Return(workspaceSettings("in-sync", []string{"in-sync"}, []string{"in-sync"}), nil)
+	mockDB.On("GetWorkspace", "drifted").Return(workspaceSettings("drifted", []string{"drifted"}, []string{"drifted"}), nil)
+	mockDB.On("GetWorkspace", "missing").Return(workspaceSettings("missing", []string{"missing"}, nil), nil)
+	mockDB.On("GetWorkspace", "no-namespace").Return(workspaceSettings("no-namespace", []string{"no-namespace"}, nil), nil)
+	mockKC.On("GetGroups").Return([]models.Group{
+		{Name: "in-sync"}, {Name: "drifted"}, {Name: "no-namespace"}, {Name: "deleted"}, {Name: "hub-admins"},
+	}, nil)
+	mockDB.On("CheckWorkspaceExists", "deleted").Return(true, nil)
+	mockDB.On("CheckWorkspaceExists", "hub-admins").Return(false, nil)
+
+	plan, err := svc.Plan(context.Background(), nil)
+	require.NoError(t, err)
+
+	type change struct{ action, resource, name string }
+	var changes []change
+	for _, c := range plan.Changes {
+		changes = append(changes, change{c.Action, c.Resource, c.Name})
+	}
+
+	assert.Equal(t, []change{
+		{ReconcileActionUpdate, ReconcileResourceWorkspace, "drifted"},
+		{ReconcileActionCreate, ReconcileResourceWorkspace, "missing"},
+		{ReconcileActionCreate, ReconcileResourceGroup, "missing"},
+		{ReconcileActionUpdate, ReconcileResourceWorkspace, "no-namespace"},
+		{ReconcileActionOrphan, ReconcileResourceWorkspace, "orphan"},
+		{ReconcileActionOrphan, ReconcileResourceNamespace, "ws-leftover"},
+		{ReconcileActionOrphan, ReconcileResourceNamespace, "ws-owned"},
+		{ReconcileActionOrphan, ReconcileResourceGroup, "deleted"},
+	}, changes)
+	assert.Contains(t, plan.Changes[0].Reason, "block stores")
+}
+
+func TestReconcileApply(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	mockKC := new(MockKeycloakClient)
+	svc := newReconcileService(mockDB, mockKC, nil, "ws-leftover")
+
+	plan := &ReconcilePlan{Changes: []ReconcileChange{
+		{Action: ReconcileActionCreate, Resource: ReconcileResourceWorkspace, Name: "missing", settings: workspaceSettings("missing", []string{"missing"}, nil)},
+		{Action: ReconcileActionOrphan, Resource: ReconcileResourceNamespace, Name: "ws-leftover"},
+		{Action: ReconcileActionOrphan, Resource: ReconcileResourceGroup, Name: "deleted"},
+	}}
+
+	// The full workspace settings are queued rather than default store names
+	mockDB.On("EnqueueWorkspaceEvent", mock.MatchedBy(func(ws ws_manager.WorkspaceSettings) bool {
+		return ws.Name == "missing" && ws.Status == WorkspaceStatusCreating && (*ws.Stores)[0].Object[0].Name == "missing"
+	})).Return(nil).Once()
+
+	logger := zerolog.Nop()
+
+	// Only the selected kinds of change are applied
+	assert.Equal(t, 0, svc.Apply(context.Background(), plan, []string{ReconcileActionCreate}, &logger))
+	mockDB.AssertExpectations(t)
+	mockKC.AssertNotCalled(t, "DeleteGroup", mock.Anything)
+
+	mockKC.On("DeleteGroup", "deleted").Return(204, nil).Once()
+	assert.Equal(t, 0, svc.Apply(context.Background(), plan, []string{ReconcileActionOrphan}, &logger))
+
+	namespaces, err := svc.K8sClient.CoreV1().Namespaces().List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, namespaces.Items)
+	mockKC.AssertExpectations(t)
+}
+
+func TestReconcileApplyKeepsUnlabelledNamespaces(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	mockKC := new(MockKeycloakClient)
+	svc := newReconcileService(mockDB, mockKC, nil)
+
+	_, err := svc.K8sClient.CoreV1().Namespaces().Create(context.Background(),
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ws-unlabelled"}}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	mockDB.On("GetAllWorkspaces").Return([]string{}, nil)
+	mockKC.On("GetGroups").Return([]models.Group{}, nil)
+
+	// The namespace is not planned for deletion
+	plan, err := svc.Plan(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Empty(t, plan.Changes)
+
+	// Nor deleted if a stale plan names it
+	plan.Changes = []ReconcileChange{{Action: ReconcileActionOrphan, Resource: ReconcileResourceNamespace, Name: "ws-unlabelled"}}
+	logger := zerolog.Nop()
+	assert.Equal(t, 1, svc.Apply(context.Background(), plan, []string{ReconcileActionOrphan}, &logger))
+
+	_, err = svc.K8sClient.CoreV1().Namespaces().Get(context.Background(), "ws-unlabelled", metav1.GetOptions{})
+	assert.NoError(t, err)
+}
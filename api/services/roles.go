@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"slices"
+
+	"github.com/EO-DataHub/eodhp-workspace-services/db"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authz"
+)
+
+// WorkspaceRole is a member's level of access to a workspace, one of authz.WorkspaceRoles. Each
+// role includes the access of the roles below it:
+//   - viewer: list and download files, and list members and linked accounts
+//   - editor: also upload and delete files, use linked accounts and request credentials
+//   - admin: also manage members and linked accounts
+//   - owner: also update, delete and restore the workspace
+type WorkspaceRole string
+
+const (
+	WorkspaceRoleViewer WorkspaceRole = authz.RoleViewer
+	WorkspaceRoleEditor WorkspaceRole = authz.RoleEditor
+	WorkspaceRoleAdmin  WorkspaceRole = authz.RoleAdmin
+	WorkspaceRoleOwner  WorkspaceRole = authz.RoleOwner
+)
+
+// defaultWorkspaceRole is the role of members who have not been given one, which keeps the
+// access members had before roles were introduced.
+const defaultWorkspaceRole = WorkspaceRoleEditor
+
+// ParseWorkspaceRole returns the role named s, or false if there is no such role.
+func ParseWorkspaceRole(s string) (WorkspaceRole, bool) {
+	return WorkspaceRole(s), slices.Contains(authz.WorkspaceRoles, s)
+}
+
+// Includes reports whether r grants at least the access of other. The empty role, of users who
+// are not members, includes nothing.
+func (r WorkspaceRole) Includes(other WorkspaceRole) bool {
+	return authz.RoleIncludes(string(r), string(other))
+}
+
+// storedWorkspaceRole returns a role read from the database, or the default role if the member
+// has not been given one.
+func storedWorkspaceRole(role string) WorkspaceRole {
+	if parsed, ok := ParseWorkspaceRole(role); ok {
+		return parsed
+	}
+	return defaultWorkspaceRole
+}
+
+// workspaceRoleResolver looks up the roles of workspace members and the status of workspaces'
+// accounts. Membership of a workspace is held in Keycloak, the owner of the workspace's billing
+// account is always an owner and other members have the role stored for them or the default
+// role.
+type workspaceRoleResolver struct {
+	db db.WorkspaceDBInterface
+	kc KeycloakClientInterface
+}
+
+// WorkspaceRole returns the role of subject in workspace, or an empty string if they are not a
+// member.
+func (r workspaceRoleResolver) WorkspaceRole(ctx context.Context, subject authz.Subject, workspace string) (string, error) {
+	memberGroups, err := r.kc.GetUserGroups(ctx, subject.UserID)
+	if err != nil {
+		return "", err
+	}
+	if !isMemberGroupAuthorized(workspace, memberGroups) {
+		return "", nil
+	}
+
+	isAccountOwner, err := r.db.IsUserAccountOwner(ctx, subject.Username, workspace)
+	if err != nil {
+		return "", err
+	}
+	if isAccountOwner {
+		return string(WorkspaceRoleOwner), nil
+	}
+
+	role, err := r.db.GetWorkspaceRole(ctx, workspace, subject.UserID)
+	if err != nil {
+		return "", err
+	}
+
+	return string(storedWorkspaceRole(role)), nil
+}
+
+// WorkspaceAccountStatus returns the status of the billing account of workspace.
+func (r workspaceRoleResolver) WorkspaceAccountStatus(ctx context.Context, workspace string) (string, error) {
+	return r.db.GetWorkspaceAccountStatus(ctx, workspace)
+}
+
+// WorkspaceSuspended reports whether workspace has been suspended by an administrator.
+func (r workspaceRoleResolver) WorkspaceSuspended(ctx context.Context, workspace string) (bool, error) {
+	return r.db.IsWorkspaceSuspended(ctx, workspace)
+}
+
+// NewAuthorizer creates an authorizer for policy that looks up workspace roles and account
+// statuses with db and kc.
+func NewAuthorizer(policy *authz.Policy, db db.WorkspaceDBInterface, kc KeycloakClientInterface) *authz.PolicyAuthorizer {
+	resolver := workspaceRoleResolver{db: db, kc: kc}
+	return authz.NewPolicyAuthorizer(policy, resolver, resolver)
+}
+
+// authorizerOrDefault returns a, or an authorizer for the default policy if a is nil.
+func authorizerOrDefault(a authz.Authorizer, db db.WorkspaceDBInterface, kc KeycloakClientInterface) authz.Authorizer {
+	if a != nil {
+		return a
+	}
+	return NewAuthorizer(authz.DefaultPolicy(), db, kc)
+}
+
+// getWorkspaceRole returns the role of the user in a workspace, or an empty role if they are
+// not a member.
+func getWorkspaceRole(ctx context.Context, a authz.Authorizer, claims authn.Claims, workspace string) (WorkspaceRole, error) {
+	role, err := a.WorkspaceRole(ctx, authz.SubjectFromClaims(claims), workspace)
+	if err != nil {
+		return "", err
+	}
+	return WorkspaceRole(role), nil
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/EO-DataHub/eodhp-workspace-services/api/middleware"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authz"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkspaceRoleIncludes(t *testing.T) {
+	assert.True(t, WorkspaceRoleOwner.Includes(WorkspaceRoleAdmin))
+	assert.True(t, WorkspaceRoleEditor.Includes(WorkspaceRoleEditor))
+	assert.True(t, WorkspaceRoleEditor.Includes(WorkspaceRoleViewer))
+	assert.False(t, WorkspaceRoleViewer.Includes(WorkspaceRoleEditor))
+	assert.False(t, WorkspaceRoleAdmin.Includes(WorkspaceRoleOwner))
+	assert.False(t, WorkspaceRole("").Includes(WorkspaceRoleViewer))
+
+	_, ok := ParseWorkspaceRole("superuser")
+	assert.False(t, ok)
+	assert.Equal(t, defaultWorkspaceRole, storedWorkspaceRole(""))
+}
+
+func TestGetWorkspaceRole(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	mockKC := new(MockKeycloakClient)
+
+	member := authn.Claims{Username: "member"}
+	member.Subject = "user-1"
+	owner := authn.Claims{Username: "owner"}
+	owner.Subject = "user-2"
+	outsider := authn.Claims{Username: "outsider"}
+	outsider.Subject = "user-3"
+	admin := authn.Claims{Username: "admin"}
+	admin.RealmAccess.Roles = []string{"hub_admin"}
+
+	mockKC.On("GetUserGroups", "user-1").Return([]string{"ws-1"}, nil)
+	mockKC.On("GetUserGroups", "user-2").Return([]string{"ws-1"}, nil)
+	mockKC.On("GetUserGroups", "user-3").Return([]string{"ws-2"}, nil)
+	mockDB.On("IsUserAccountOwner", "member", "ws-1").Return(false, nil)
+	mockDB.On("IsUserAccountOwner", "owner", "ws-1").Return(true, nil)
+	mockDB.On("GetWorkspaceRole", "ws-1", "user-1").Return("viewer", nil)
+
+	tests := []struct {
+		name   string
+		claims authn.Claims
+		want   WorkspaceRole
+	}{
+		{name: "stored role", claims: member, want: WorkspaceRoleViewer},
+		{name: "account owner", claims: owner, want: WorkspaceRoleOwner},
+		{name: "not a member", claims: outsider, want: ""},
+		{name: "hub admin", claims: admin, want: WorkspaceRoleOwner},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			role, err := getWorkspaceRole(context.Background(), NewAuthorizer(authz.DefaultPolicy(), mockDB, mockKC), tc.claims, "ws-1")
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, role)
+		})
+	}
+}
+
+// staticAuthorizer makes the same decision for every request.
+type staticAuthorizer struct {
+	decision authz.Decision
+	err      error
+}
+
+func (a staticAuthorizer) Authorize(context.Context, authz.Subject, string, authz.Resource) (authz.Decision, error) {
+	return a.decision, a.err
+}
+
+func (a staticAuthorizer) WorkspaceRole(context.Context, authz.Subject, string) (string, error) {
+	return "", a.err
+}
+
+func TestAuthorize(t *testing.T) {
+	tests := []struct {
+		name       string
+		authorizer staticAuthorizer
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "allowed", authorizer: staticAuthorizer{decision: authz.Decision{Allowed: true, Reason: authz.ReasonRule}}, wantStatus: http.StatusOK},
+		{name: "denied", authorizer: staticAuthorizer{decision: authz.Decision{Reason: authz.ReasonDenied}}, wantStatus: http.StatusForbidden, wantCode: CodeForbidden},
+		{name: "scoped token", authorizer: staticAuthorizer{decision: authz.Decision{Reason: authz.ReasonScopedToken}}, wantStatus: http.StatusUnauthorized, wantCode: CodeWorkspaceScopedToken},
+		{name: "error", authorizer: staticAuthorizer{err: errors.New("keycloak unavailable")}, wantStatus: http.StatusInternalServerError, wantCode: CodeInternal},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/api/workspaces/ws-1", nil)
+
+			allowed := authorize(w, r, tc.authorizer, authn.Claims{Username: "alice"}, authz.ActionWorkspaceRead, authz.Resource{Workspace: "ws-1"})
+
+			assert.Equal(t, tc.wantStatus == http.StatusOK, allowed)
+			assert.Equal(t, tc.wantStatus, w.Code)
+			if tc.wantCode != "" {
+				var problem Problem
+				require.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+				assert.Equal(t, tc.wantCode, problem.Code)
+			}
+		})
+	}
+}
+
+func TestScopedTokensCannotManageAccounts(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	svc := BillingAccountService{DB: mockDB}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/accounts", nil)
+	r = r.WithContext(context.WithValue(r.Context(), middleware.ClaimsKey, authn.Claims{Username: "alice", Workspace: "ws-1"}))
+	w := httptest.NewRecorder()
+
+	svc.GetAccountsService(w, r)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	mockDB.AssertNotCalled(t, "GetAccounts", "alice")
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/tracing"
+	"github.com/EO-DataHub/eodhp-workspace-services/models"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+const (
+	SagaStatusRunning      = "Running"
+	SagaStatusCompleted    = "Completed"
+	SagaStatusCompensating = "Compensating"
+	SagaStatusCompensated  = "Compensated"
+	SagaStatusFailed       = "Failed"
+)
+
+// Steps of the workspace creation saga, in the order they run.
+const (
+	SagaStepGroupCreated    = "group_created"
+	SagaStepOwnerAdded      = "owner_added"
+	SagaStepWorkspaceStored = "workspace_stored"
+)
+
+// sagaStep is a single step of a saga. compensate undoes action and may be nil if the
+// step has nothing to undo.
+type sagaStep struct {
+	name       string
+	action     func() error
+	compensate func() error
+}
+
+// saga runs a sequence of steps, recording progress so that it can be recovered after a crash.
+type saga struct {
+	record func(step, status string, err error)
+	logger *zerolog.Logger
+}
+
+// run executes the steps in order. If a step fails, the completed steps are compensated in
+// reverse order and the error of the failed step is returned.
+func (s *saga) run(steps []sagaStep) error {
+	for i, step := range steps {
+		if err := step.action(); err != nil {
+			err = fmt.Errorf("step %s failed: %w", step.name, err)
+			lastStep := ""
+			if i > 0 {
+				lastStep = steps[i-1].name
+			}
+			s.compensate(steps[:i], lastStep, err)
+			return err
+		}
+
+		status := SagaStatusRunning
+		if i == len(steps)-1 {
+			status = SagaStatusCompleted
+		}
+		s.record(step.name, status, nil)
+	}
+
+	return nil
+}
+
+// compensate undoes the completed steps in reverse order and returns the final saga status.
+// lastStep is the last step recorded as complete.
+func (s *saga) compensate(completed []sagaStep, lastStep string, cause error) string {
+	s.record(lastStep, SagaStatusCompensating, cause)
+
+	var errs []error
+	for i := len(completed) - 1; i >= 0; i-- {
+		step := completed[i]
+		if step.compensate == nil {
+			continue
+		}
+		if err := step.compensate(); err != nil {
+			s.logger.Error().Err(err).Str("step", step.name).Msg("Failed to compensate saga step")
+			errs = append(errs, fmt.Errorf("compensating %s: %w", step.name, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		s.record(lastStep, SagaStatusFailed, errors.Join(append([]error{cause}, errs...)...))
+		return SagaStatusFailed
+	}
+
+	s.record(lastStep, SagaStatusCompensated, cause)
+	return SagaStatusCompensated
+}
+
+// newWorkspaceCreationSaga records a new workspace creation saga in the database.
+func (svc *WorkspaceService) newWorkspaceCreationSaga(ctx context.Context, record *models.WorkspaceCreationSaga, logger *zerolog.Logger) (*saga, error) {
+	record.Status = SagaStatusRunning
+	if err := svc.DB.CreateWorkspaceSaga(ctx, record); err != nil {
+		return nil, err
+	}
+
+	return svc.workspaceCreationSaga(ctx, record.ID, logger), nil
+}
+
+// workspaceCreationSaga returns a saga that records its progress against the saga with sagaID.
+func (svc *WorkspaceService) workspaceCreationSaga(ctx context.Context, sagaID uuid.UUID, logger *zerolog.Logger) *saga {
+	return &saga{
+		logger: logger,
+		record: func(step, status string, err error) {
+			errMsg := ""
+			if err != nil {
+				errMsg = err.Error()
+			}
+
+			// Progress is recorded on a best effort basis, recovery does not rely on it being up to date
+			if err := svc.DB.UpdateWorkspaceSaga(ctx, sagaID, step, status, errMsg); err != nil {
+				logger.Error().Err(err).Str("saga_id", sagaID.String()).Str("step", step).
+					Str("status", status).Msg("Failed to record workspace creation saga progress")
+			}
+		},
+	}
+}
+
+// RecoverWorkspaceCreationSaga finishes a saga left unfinished by a crashed process. If the
+// workspace record was stored the saga is rolled forward, since every other step runs before it
+// and its creation event was queued in the same transaction. Otherwise it is compensated.
+//
+// The group may have been created without the step being recorded, so it is deleted even then
+// unless a newer saga for the same name is unfinished, in which case the group may be its own.
+// Each compensation is safe to repeat.
+func (svc *WorkspaceService) RecoverWorkspaceCreationSaga(ctx context.Context, record models.WorkspaceCreationSaga, logger *zerolog.Logger) (string, error) {
+	ctx, span := tracing.Start(ctx, "WorkspaceService.RecoverWorkspaceCreationSaga")
+	defer span.End()
+
+	// A deleted workspace of the same name is not this saga's
+	stored, err := svc.DB.CheckAvailableWorkspaceExists(ctx, record.Workspace)
+	if err != nil {
+		return "", err
+	}
+
+	if stored {
+		if err := svc.DB.UpdateWorkspaceSaga(ctx, record.ID, SagaStepWorkspaceStored, SagaStatusCompleted, ""); err != nil {
+			return "", err
+		}
+		return SagaStatusCompleted, nil
+	}
+
+	// The group is created by the first step, so any recorded step shows it was this saga's
+	ownsGroup := record.Step != ""
+	if !ownsGroup {
+		newer, err := svc.DB.CheckNewerWorkspaceSagaExists(ctx, record)
+		if err != nil {
+			return "", err
+		}
+		ownsGroup = !newer
+	}
+
+	var steps []sagaStep
+	if ownsGroup {
+		steps = append(steps, sagaStep{
+			name: SagaStepGroupCreated,
+			compensate: func() error {
+				statusCode, err := svc.KC.DeleteGroup(ctx, record.Workspace)
+				if statusCode == http.StatusNotFound {
+					return nil
+				}
+				return err
+			},
+		})
+	}
+
+	cause := fmt.Errorf("recovered unfinished saga with last recorded step %q", record.Step)
+	return svc.workspaceCreationSaga(ctx, record.ID, logger).compensate(steps, record.Step, cause), nil
+}
@@ -1,15 +1,33 @@
 package services
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 
+	ws_manager "github.com/EO-DataHub/eodhp-workspace-manager/models"
 	"github.com/EO-DataHub/eodhp-workspace-services/api/middleware"
 	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authz"
+	"github.com/EO-DataHub/eodhp-workspace-services/models"
 	"github.com/gorilla/mux"
 	"github.com/rs/zerolog"
 )
 
-// GetUsersService retrieves all users associated with a workspace.
+// Page sizes for listing the users of a workspace.
+const (
+	defaultUsersPageSize = 100
+	maxUsersPageSize     = 1000
+)
+
+// GetUsersService retrieves the users associated with a workspace. Without a limit all users are
+// returned. With a limit, a page of users is returned and, if there are more, a Link header
+// gives the URL of the next page.
 func (svc *WorkspaceService) GetUsersService(w http.ResponseWriter, r *http.Request) {
 
 	logger := zerolog.Ctx(r.Context())
@@ -18,57 +36,90 @@ func (svc *WorkspaceService) GetUsersService(w http.ResponseWriter, r *http.Requ
 	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
 	if !ok {
 		logger.Warn().Msg("Unauthorized request: missing claims")
-		WriteResponse(w, http.StatusUnauthorized, nil)
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
 		return
 	}
 
 	// Parse the workspace ID from the URL path
 	workspaceID := mux.Vars(r)["workspace-id"]
 
-	// Check if the user can access the workspace
-	authorized, err := isUserWorkspaceAuthorized(svc.DB, svc.KC, claims, workspaceID, false)
-	if err != nil {
-		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to authorize workspace")
-		WriteResponse(w, http.StatusInternalServerError, nil)
-		return
+	// Parse the paging and search parameters
+	query := r.URL.Query()
+	search := query.Get("search")
+
+	limit := 0
+	if value := query.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxUsersPageSize {
+			WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest,
+				fmt.Sprintf("limit query parameter must be an integer between 1 and %d", maxUsersPageSize))
+			return
+		}
 	}
 
-	if !authorized {
-		WriteResponse(w, http.StatusForbidden, nil)
+	first := 0
+	if cursor := query.Get("cursor"); cursor != "" {
+		var err error
+		first, err = decodeCursor(cursor)
+		if err != nil {
+			WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "cursor query parameter is invalid")
+			return
+		}
+		if limit == 0 {
+			limit = defaultUsersPageSize
+		}
+	}
+
+	// Check if the user can access the workspace
+	if !authorize(w, r, svc.authorizer(), claims, authz.ActionMembersRead, authz.Resource{Workspace: workspaceID}) {
 		return
 	}
 
 	// Get information about the workspace
-	workspace, err := svc.DB.GetWorkspace(workspaceID)
+	workspace, err := svc.DB.GetWorkspace(r.Context(), workspaceID)
 
 	if err != nil {
 		logger.Error().Err(err).Msg("Database error retrieving workspace")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
 	// Find the group ID from keycloak
-	group, err := svc.KC.GetGroup(workspace.Name)
+	group, err := svc.KC.GetGroup(r.Context(), workspace.Name)
 
 	if err != nil {
 		logger.Error().Err(err).Str("name", workspace.Name).Msg("Failed to retrieve Keycloak group")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
 	// Get the members of the group
-	members, err := svc.KC.GetGroupMembers(group.ID)
+	members, next, err := svc.KC.GetGroupMembersPage(r.Context(), group.ID, first, limit, search)
 
 	if err != nil {
 		logger.Error().Err(err).Str("group_id", group.ID).Msg("Failed to retrieve group members")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	if limit > 0 && next >= 0 {
+		query.Set("limit", strconv.Itoa(limit))
+		query.Set("cursor", encodeCursor(next))
+		w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, query.Encode()))
+	}
+
+	// Add the role of each member in the workspace
+	if err := svc.setMemberRoles(r.Context(), workspace, members); err != nil {
+		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to retrieve workspace roles")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
 	WriteResponse(w, http.StatusOK, members)
 }
 
-// GetUsersService retrieves all users associated with a workspace.
+// GetUserService retrieves a single user of a workspace and their role.
 func (svc *WorkspaceService) GetUserService(w http.ResponseWriter, r *http.Request) {
 
 	logger := zerolog.Ctx(r.Context())
@@ -77,7 +128,7 @@ func (svc *WorkspaceService) GetUserService(w http.ResponseWriter, r *http.Reque
 	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
 	if !ok {
 		logger.Warn().Msg("Unauthorized request: missing claims")
-		WriteResponse(w, http.StatusUnauthorized, nil)
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
 		return
 	}
 
@@ -86,56 +137,58 @@ func (svc *WorkspaceService) GetUserService(w http.ResponseWriter, r *http.Reque
 	username := mux.Vars(r)["username"]
 
 	// Check if the user can access the workspace
-	authorized, err := isUserWorkspaceAuthorized(svc.DB, svc.KC, claims, workspaceID, false)
-	if err != nil {
-		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to authorize workspace")
-		WriteResponse(w, http.StatusInternalServerError, nil)
-		return
-	}
-
-	if !authorized {
-		WriteResponse(w, http.StatusForbidden, nil)
+	if !authorize(w, r, svc.authorizer(), claims, authz.ActionMembersRead, authz.Resource{Workspace: workspaceID}) {
 		return
 	}
 
 	// Get information about the workspace
-	workspace, err := svc.DB.GetWorkspace(workspaceID)
+	workspace, err := svc.DB.GetWorkspace(r.Context(), workspaceID)
 
 	if err != nil {
 		logger.Error().Err(err).Msg("Database error retrieving workspace")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
 	// Find the group ID from keycloak
-	group, err := svc.KC.GetGroup(workspace.Name)
+	group, err := svc.KC.GetGroup(r.Context(), workspace.Name)
 
 	if err != nil {
 		logger.Error().Err(err).Str("name", workspace.Name).Msg("Failed to retrieve Keycloak group")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
-	user, err := svc.KC.GetUser(username)
+	user, err := svc.KC.GetUser(r.Context(), username)
 	if err != nil {
 		logger.Warn().Err(err).Str("username", username).Msg("User ID not found")
-		WriteResponse(w, http.StatusNotFound, err.Error())
+		WriteError(w, r, http.StatusNotFound, CodeUserNotFound, err.Error())
 		return
 	}
 
 	// Get the members of the group
-	member, err := svc.KC.GetGroupMember(group.ID, user.ID)
+	member, err := svc.KC.GetGroupMember(r.Context(), group.ID, user.ID)
 
 	if err != nil {
 		logger.Error().Err(err).Str("group_id", group.ID).Str("user_id", user.ID).Msg("Failed to retrieve user membership")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	// Add the member's role in the workspace
+	members := []models.User{*member}
+	if err := svc.setMemberRoles(r.Context(), workspace, members); err != nil {
+		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to retrieve workspace roles")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
-	WriteResponse(w, http.StatusOK, member)
+	WriteResponse(w, http.StatusOK, members[0])
 }
 
-// AddUserService adds a user to a workspace.
+// AddUserService adds a user to a workspace, or changes the role of a member. Without a role in
+// the request body, a new member gets the default role and an existing member keeps theirs.
+// Admins cannot give a role above their own or change the role of a member above them.
 func (svc *WorkspaceService) AddUserService(w http.ResponseWriter, r *http.Request) {
 
 	logger := zerolog.Ctx(r.Context())
@@ -144,7 +197,7 @@ func (svc *WorkspaceService) AddUserService(w http.ResponseWriter, r *http.Reque
 	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
 	if !ok {
 		logger.Warn().Msg("Unauthorized request: missing claims")
-		WriteResponse(w, http.StatusUnauthorized, nil)
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
 		return
 	}
 
@@ -152,55 +205,133 @@ func (svc *WorkspaceService) AddUserService(w http.ResponseWriter, r *http.Reque
 	workspaceID := mux.Vars(r)["workspace-id"]
 	username := mux.Vars(r)["username"]
 
-	// Only account owners can remove users from a workspace
-	authorized, err := isUserWorkspaceAuthorized(svc.DB, svc.KC, claims, workspaceID, true)
+	// Decode the optional role from the request body
+	var payload models.WorkspaceUserRole
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+			logger.Warn().Err(err).Msg("Invalid request payload")
+			WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "")
+			return
+		}
+	}
+
+	role, ok := ParseWorkspaceRole(payload.Role)
+	if payload.Role != "" && !ok {
+		WriteProblem(w, r, NewProblem(http.StatusUnprocessableEntity, CodeValidationFailed, "Invalid workspace role.").
+			WithFieldErrors(FieldError{Field: "role", Message: "must be one of viewer, editor, admin or owner"}))
+		return
+	}
+
+	// Only workspace admins can add users or change their role
+	if !authorize(w, r, svc.authorizer(), claims, authz.ActionMembersManage, authz.Resource{Workspace: workspaceID}) {
+		return
+	}
+
+	// Members added without a role have the default role
+	if payload.Role == "" {
+		role = defaultWorkspaceRole
+	}
+
+	callerRole, err := getWorkspaceRole(r.Context(), svc.authorizer(), claims, workspaceID)
 	if err != nil {
-		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to authorize workspace")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to retrieve workspace role")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
-	if !authorized {
-		WriteResponse(w, http.StatusForbidden, nil)
+	if !callerRole.Includes(role) {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Cannot give a role above your own")
 		return
 	}
 
-	workspace, err := svc.DB.GetWorkspace(workspaceID)
+	workspace, err := svc.DB.GetWorkspace(r.Context(), workspaceID)
 
 	if err != nil {
 		logger.Error().Err(err).Msg("Database error retrieving workspace")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
 	// Find the group ID from keycloak
-	group, err := svc.KC.GetGroup(workspace.Name)
+	group, err := svc.KC.GetGroup(r.Context(), workspace.Name)
 
 	if err != nil {
 		logger.Error().Err(err).Str("name", workspace.Name).Msg("Failed to retrieve Keycloak group")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
-	user, err := svc.KC.GetUser(username)
+	user, err := svc.KC.GetUser(r.Context(), username)
 	if err != nil {
 		logger.Warn().Err(err).Str("username", username).Msg("User ID not found")
-		WriteResponse(w, http.StatusNotFound, err.Error())
+		WriteError(w, r, http.StatusNotFound, CodeUserNotFound, err.Error())
+		return
+	}
+
+	if payload.Role != "" {
+		// The account owner is always an owner of the workspace
+		isAccountOwner, err := svc.DB.IsUserAccountOwner(r.Context(), username, workspaceID)
+		if err != nil {
+			logger.Error().Err(err).Str("username", username).Str("workspace_id", workspaceID).Msg("Failed to check if user is account owner")
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+			return
+		}
+
+		if isAccountOwner {
+			WriteError(w, r, http.StatusConflict, CodeConflict, "The role of the account owner cannot be changed")
+			return
+		}
+	}
+
+	// Admins cannot change the role of members above them
+	current, err := svc.DB.GetWorkspaceRole(r.Context(), workspace.Name, user.ID)
+	if err != nil {
+		logger.Error().Err(err).Str("user_id", user.ID).Str("workspace_id", workspaceID).Msg("Failed to retrieve workspace role")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	if current != "" && !callerRole.Includes(storedWorkspaceRole(current)) {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Cannot change the role of a member above you")
+		return
+	}
+
+	// Record the member's role before adding them, so that they never have the default role
+	// instead. Without a role any stored one is removed, so that they have the default role.
+	err = svc.setMemberRole(r.Context(), workspace.Name, user.ID, username, payload.Role, claims.Username)
+	if err != nil {
+		logger.Error().Err(err).Str("user_id", user.ID).Str("workspace_id", workspaceID).Msg("Failed to set workspace role")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
 	// Add the user to the group in Keycloak
-	err = svc.KC.AddMemberToGroup(user.ID, group.ID)
+	err = svc.KC.AddMemberToGroup(r.Context(), user.ID, group.ID)
 	if err != nil {
 		logger.Error().Err(err).Str("user_id", user.ID).Str("group_id", group.ID).Msg("Failed to add user to group")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+
+		// Put back the role they had, so that it is not given to them if they are added later
+		if err := svc.setMemberRole(r.Context(), workspace.Name, user.ID, username, current, claims.Username); err != nil {
+			logger.Error().Err(err).Str("user_id", user.ID).Str("workspace_id", workspaceID).Msg("Failed to restore workspace role")
+		}
+
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
-	logger.Info().Str("username", username).Str("group", group.Name).Msg("User added to workspace group successfully")
+	logger.Info().Str("username", username).Str("group", group.Name).Str("role", string(role)).Msg("User added to workspace group successfully")
 	WriteResponse(w, http.StatusNoContent, nil)
 }
 
+// setMemberRole stores the role of a workspace member, or removes their stored role if role is
+// empty so that they have the default role.
+func (svc *WorkspaceService) setMemberRole(ctx context.Context, workspaceName, userID, username, role, grantedBy string) error {
+	if role == "" {
+		return svc.DB.DeleteWorkspaceRole(ctx, workspaceName, userID)
+	}
+	return svc.DB.SetWorkspaceRole(ctx, workspaceName, userID, username, role, grantedBy)
+}
+
 // RemoveUserService removes a user from a workspace.
 func (svc *WorkspaceService) RemoveUserService(w http.ResponseWriter, r *http.Request) {
 
@@ -210,7 +341,7 @@ func (svc *WorkspaceService) RemoveUserService(w http.ResponseWriter, r *http.Re
 	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
 	if !ok {
 		logger.Warn().Msg("Unauthorized request: missing claims")
-		WriteResponse(w, http.StatusUnauthorized, nil)
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
 		return
 	}
 
@@ -218,67 +349,131 @@ func (svc *WorkspaceService) RemoveUserService(w http.ResponseWriter, r *http.Re
 	workspaceID := mux.Vars(r)["workspace-id"]
 	username := mux.Vars(r)["username"]
 
-	// Only account owners can remove users from a workspace
-	authorized, err := isUserWorkspaceAuthorized(svc.DB, svc.KC, claims, workspaceID, true)
-	if err != nil {
-		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to authorize workspace")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+	// Only workspace admins can remove users from a workspace
+	if !authorize(w, r, svc.authorizer(), claims, authz.ActionMembersManage, authz.Resource{Workspace: workspaceID}) {
 		return
 	}
 
-	if !authorized {
-		WriteResponse(w, http.StatusForbidden, nil)
+	callerRole, err := getWorkspaceRole(r.Context(), svc.authorizer(), claims, workspaceID)
+	if err != nil {
+		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to retrieve workspace role")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
 	// Account owners cannot remove themselves from a group
-	isAccountOwner, err := svc.DB.IsUserAccountOwner(username, workspaceID)
+	isAccountOwner, err := svc.DB.IsUserAccountOwner(r.Context(), username, workspaceID)
 
 	if err != nil {
 		logger.Error().Err(err).Str("username", username).Str("workspace_id", workspaceID).Msg("Failed to check if user is account owner")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
 	if isAccountOwner {
 		logger.Warn().Str("username", username).Str("workspace_id", workspaceID).Msg("Account owners cannot remove themselves from a workspace")
-		WriteResponse(w, http.StatusForbidden, "Account owners cannot remove themselves from a workspace")
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Account owners cannot remove themselves from a workspace")
 		return
 	}
 
-	workspace, err := svc.DB.GetWorkspace(workspaceID)
+	workspace, err := svc.DB.GetWorkspace(r.Context(), workspaceID)
 
 	if err != nil {
 		logger.Error().Err(err).Msg("Database error retrieving workspace")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
 	// Find the group ID from keycloak
-	group, err := svc.KC.GetGroup(workspace.Name)
+	group, err := svc.KC.GetGroup(r.Context(), workspace.Name)
 
 	if err != nil {
 		logger.Error().Err(err).Str("name", workspace.Name).Msg("Failed to retrieve Keycloak group")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
-	user, err := svc.KC.GetUser(username)
+	user, err := svc.KC.GetUser(r.Context(), username)
 	if err != nil {
 		logger.Warn().Err(err).Str("username", username).Msg("User ID not found")
-		WriteResponse(w, http.StatusNotFound, err.Error())
+		WriteError(w, r, http.StatusNotFound, CodeUserNotFound, err.Error())
+		return
+	}
+
+	// Admins cannot remove members above them
+	current, err := svc.DB.GetWorkspaceRole(r.Context(), workspace.Name, user.ID)
+	if err != nil {
+		logger.Error().Err(err).Str("user_id", user.ID).Str("workspace_id", workspaceID).Msg("Failed to retrieve workspace role")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	if !callerRole.Includes(storedWorkspaceRole(current)) {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Cannot remove a member above you")
 		return
 	}
 
 	// Remove the user from the group in Keycloak
-	err = svc.KC.RemoveMemberFromGroup(user.ID, group.ID)
+	err = svc.KC.RemoveMemberFromGroup(r.Context(), user.ID, group.ID)
 
 	if err != nil {
 		logger.Error().Err(err).Str("user_id", user.ID).Str("group_id", group.ID).Msg("Failed to remove user from group")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	// Forget the member's role so that it is not kept if they are added again
+	err = svc.DB.DeleteWorkspaceRole(r.Context(), workspace.Name, user.ID)
+	if err != nil {
+		logger.Error().Err(err).Str("user_id", user.ID).Str("workspace_id", workspaceID).Msg("Failed to delete workspace role")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
 	logger.Info().Str("username", username).Str("group", group.Name).Msg("User removed from workspace group successfully")
 	WriteResponse(w, http.StatusNoContent, nil)
 }
+
+// setMemberRoles sets the role in workspace of each of members.
+func (svc *WorkspaceService) setMemberRoles(ctx context.Context, workspace *ws_manager.WorkspaceSettings, members []models.User) error {
+	roles, err := svc.DB.GetWorkspaceRoles(ctx, workspace.Name)
+	if err != nil {
+		return err
+	}
+
+	account, err := svc.DB.GetAccount(ctx, workspace.Account)
+	if err != nil {
+		return err
+	}
+
+	for i := range members {
+		role := storedWorkspaceRole(roles[members[i].ID])
+		if account != nil && members[i].Username == account.AccountOwner {
+			role = WorkspaceRoleOwner
+		}
+		members[i].Role = string(role)
+	}
+
+	return nil
+}
+
+// encodeCursor returns an opaque cursor for continuing a listing at offset.
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+// decodeCursor returns the offset encoded in a cursor.
+func decodeCursor(cursor string) (int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	offset, err := strconv.Atoi(string(decoded))
+	if err != nil {
+		return 0, err
+	}
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	return offset, nil
+}
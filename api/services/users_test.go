@@ -0,0 +1,247 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	ws_manager "github.com/EO-DataHub/eodhp-workspace-manager/models"
+	"github.com/EO-DataHub/eodhp-workspace-services/api/middleware"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
+	"github.com/EO-DataHub/eodhp-workspace-services/models"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newGetUsersRequest(query string) *http.Request {
+	claims := authn.Claims{Username: "admin"}
+	claims.RealmAccess.Roles = []string{"hub_admin"}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/workspaces/test-workspace/users?"+query, nil)
+	req = mux.SetURLVars(req, map[string]string{"workspace-id": "test-workspace"})
+	return req.WithContext(context.WithValue(req.Context(), middleware.ClaimsKey, claims))
+}
+
+func TestGetUsersService(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	mockKC := new(MockKeycloakClient)
+	svc := WorkspaceService{DB: mockDB, KC: mockKC}
+
+	accountID := uuid.New()
+	mockDB.On("GetWorkspace", "test-workspace").Return(&ws_manager.WorkspaceSettings{Name: "test-workspace", Account: accountID}, nil)
+	mockDB.On("GetWorkspaceRoles", "test-workspace").Return(map[string]string{"2": "viewer"}, nil)
+	mockDB.On("GetAccount", accountID).Return(&models.Account{ID: accountID, AccountOwner: "carol"}, nil)
+	mockKC.On("GetGroup", "test-workspace").Return(&models.Group{ID: "group-123"}, nil)
+
+	// Without a limit every member is returned
+	mockKC.On("GetGroupMembersPage", "group-123", 0, 0, "").
+		Return([]models.User{{ID: "1", Username: "alice"}, {ID: "2", Username: "bob"}}, -1, nil).Once()
+
+	w := httptest.NewRecorder()
+	svc.GetUsersService(w, newGetUsersRequest(""))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Link"))
+
+	var users []models.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &users))
+	require.Len(t, users, 2)
+
+	// Members without a stored role have the default role
+	assert.Equal(t, "editor", users[0].Role)
+	assert.Equal(t, "viewer", users[1].Role)
+
+	// A page links to the next one, keeping the search
+	mockKC.On("GetGroupMembersPage", "group-123", 0, 1, "ali").
+		Return([]models.User{{ID: "1", Username: "alice"}}, 7, nil).Once()
+
+	w = httptest.NewRecorder()
+	svc.GetUsersService(w, newGetUsersRequest("limit=1&search=ali"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	link := w.Header().Get("Link")
+	require.Regexp(t, `^<(.+)>; rel="next"$`, link)
+	next, err := url.Parse(link[1 : len(link)-len(`>; rel="next"`)])
+	require.NoError(t, err)
+	assert.Equal(t, "/api/workspaces/test-workspace/users", next.Path)
+	assert.Equal(t, "ali", next.Query().Get("search"))
+	assert.Equal(t, "1", next.Query().Get("limit"))
+
+	// Following the link continues from where the page ended
+	mockKC.On("GetGroupMembersPage", "group-123", 7, 1, "ali").
+		Return([]models.User{{ID: "9", Username: "alicia"}}, -1, nil).Once()
+
+	w = httptest.NewRecorder()
+	svc.GetUsersService(w, newGetUsersRequest(next.RawQuery))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Link"))
+
+	mockKC.AssertExpectations(t)
+}
+
+func TestGetUsersService_InvalidParameters(t *testing.T) {
+	svc := WorkspaceService{DB: new(MockWorkspaceDB), KC: new(MockKeycloakClient)}
+
+	for _, query := range []string{"limit=0", "limit=abc", "limit=5000", "cursor=not-a-cursor", "cursor=" + encodeCursor(-1)} {
+		w := httptest.NewRecorder()
+		svc.GetUsersService(w, newGetUsersRequest(query))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+// newMemberRequest returns a request from a workspace admin about bob.
+func newMemberRequest(method, body string) *http.Request {
+	claims := authn.Claims{Username: "alice"}
+	claims.Subject = "user-a"
+
+	req := httptest.NewRequest(method, "/api/workspaces/test-workspace/users/bob", strings.NewReader(body))
+	req = mux.SetURLVars(req, map[string]string{"workspace-id": "test-workspace", "username": "bob"})
+	return req.WithContext(context.WithValue(req.Context(), middleware.ClaimsKey, claims))
+}
+
+// newMemberMocks returns mocks in which alice is an admin of test-workspace and bob has
+// bobRole.
+func newMemberMocks(bobRole string) (*MockWorkspaceDB, *MockKeycloakClient) {
+	mockDB := new(MockWorkspaceDB)
+	mockKC := new(MockKeycloakClient)
+
+	mockKC.On("GetUserGroups", "user-a").Return([]string{"test-workspace"}, nil)
+	mockDB.On("IsUserAccountOwner", "alice", "test-workspace").Return(false, nil)
+	mockDB.On("GetWorkspaceRole", "test-workspace", "user-a").Return("admin", nil)
+	mockDB.On("IsWorkspaceSuspended", "test-workspace").Return(false, nil)
+
+	mockDB.On("GetWorkspace", "test-workspace").Return(&ws_manager.WorkspaceSettings{Name: "test-workspace"}, nil)
+	mockKC.On("GetGroup", "test-workspace").Return(&models.Group{ID: "group-123", Name: "test-workspace"}, nil)
+	mockKC.On("GetUser", "bob").Return(&models.User{ID: "user-b", Username: "bob"}, nil)
+	mockDB.On("IsUserAccountOwner", "bob", "test-workspace").Return(false, nil)
+	mockDB.On("GetWorkspaceRole", "test-workspace", "user-b").Return(bobRole, nil)
+
+	return mockDB, mockKC
+}
+
+func TestAddUserService_Role(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		bobRole string
+		status  int
+		setRole string
+	}{
+		{name: "without role", body: "", status: http.StatusNoContent},
+		{name: "without role, member above caller", body: "", bobRole: "owner", status: http.StatusForbidden},
+		{name: "new member", body: `{"role":"viewer"}`, status: http.StatusNoContent, setRole: "viewer"},
+		{name: "change role", body: `{"role":"admin"}`, bobRole: "editor", status: http.StatusNoContent, setRole: "admin"},
+		{name: "above caller", body: `{"role":"owner"}`, status: http.StatusForbidden},
+		{name: "member above caller", body: `{"role":"viewer"}`, bobRole: "owner", status: http.StatusForbidden},
+		{name: "unknown role", body: `{"role":"superuser"}`, status: http.StatusUnprocessableEntity},
+		{name: "invalid body", body: `{`, status: http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockDB, mockKC := newMemberMocks(tc.bobRole)
+			mockKC.On("AddMemberToGroup", "user-b", "group-123").Return(nil)
+			if tc.setRole != "" {
+				mockDB.On("SetWorkspaceRole", "test-workspace", "user-b", "bob", tc.setRole, "alice").Return(nil).Once()
+			}
+			if tc.body == "" && tc.status == http.StatusNoContent {
+				mockDB.On("DeleteWorkspaceRole", "test-workspace", "user-b").Return(nil).Once()
+			}
+
+			svc := WorkspaceService{DB: mockDB, KC: mockKC}
+			w := httptest.NewRecorder()
+			svc.AddUserService(w, newMemberRequest(http.MethodPut, tc.body))
+			assert.Equal(t, tc.status, w.Code)
+
+			if tc.setRole != "" {
+				mockDB.AssertExpectations(t)
+			} else {
+				mockDB.AssertNotCalled(t, "SetWorkspaceRole", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+			if tc.status != http.StatusNoContent {
+				mockKC.AssertNotCalled(t, "AddMemberToGroup", "user-b", "group-123")
+			}
+		})
+	}
+}
+
+func TestAddUserService_RoleError(t *testing.T) {
+	// Members are not added if their role cannot be recorded, so they never get the default role
+	mockDB, mockKC := newMemberMocks("")
+	mockDB.On("SetWorkspaceRole", "test-workspace", "user-b", "bob", "viewer", "alice").Return(errors.New("db down"))
+
+	svc := WorkspaceService{DB: mockDB, KC: mockKC}
+	w := httptest.NewRecorder()
+	svc.AddUserService(w, newMemberRequest(http.MethodPut, `{"role":"viewer"}`))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	mockKC.AssertNotCalled(t, "AddMemberToGroup", "user-b", "group-123")
+}
+
+func TestAddUserService_WithoutRoleResetsRole(t *testing.T) {
+	// A member added again without a role has the default role, not the one stored for them
+	mockDB, mockKC := newMemberMocks("viewer")
+	mockDB.On("DeleteWorkspaceRole", "test-workspace", "user-b").Return(nil).Once()
+	mockKC.On("AddMemberToGroup", "user-b", "group-123").Return(nil).Once()
+
+	svc := WorkspaceService{DB: mockDB, KC: mockKC}
+	w := httptest.NewRecorder()
+	svc.AddUserService(w, newMemberRequest(http.MethodPut, ""))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	mockDB.AssertCalled(t, "DeleteWorkspaceRole", "test-workspace", "user-b")
+	mockDB.AssertNotCalled(t, "SetWorkspaceRole", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAddUserService_GroupError(t *testing.T) {
+	// The role stored before the user could not be added is removed
+	mockDB, mockKC := newMemberMocks("")
+	mockDB.On("SetWorkspaceRole", "test-workspace", "user-b", "bob", "admin", "alice").Return(nil).Once()
+	mockKC.On("AddMemberToGroup", "user-b", "group-123").Return(errors.New("keycloak down")).Once()
+	mockDB.On("DeleteWorkspaceRole", "test-workspace", "user-b").Return(nil).Once()
+
+	svc := WorkspaceService{DB: mockDB, KC: mockKC}
+	w := httptest.NewRecorder()
+	svc.AddUserService(w, newMemberRequest(http.MethodPut, `{"role":"admin"}`))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	mockDB.AssertExpectations(t)
+
+	// and the role of an existing member is put back
+	mockDB, mockKC = newMemberMocks("viewer")
+	mockDB.On("SetWorkspaceRole", "test-workspace", "user-b", "bob", "admin", "alice").Return(nil).Once()
+	mockKC.On("AddMemberToGroup", "user-b", "group-123").Return(errors.New("keycloak down")).Once()
+	mockDB.On("SetWorkspaceRole", "test-workspace", "user-b", "bob", "viewer", "alice").Return(nil).Once()
+
+	svc = WorkspaceService{DB: mockDB, KC: mockKC}
+	w = httptest.NewRecorder()
+	svc.AddUserService(w, newMemberRequest(http.MethodPut, `{"role":"admin"}`))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	mockDB.AssertExpectations(t)
+}
+
+func TestRemoveUserService_Role(t *testing.T) {
+	// Admins can remove editors, and their role is forgotten
+	mockDB, mockKC := newMemberMocks("editor")
+	mockKC.On("RemoveMemberFromGroup", "user-b", "group-123").Return(nil, nil)
+	mockDB.On("DeleteWorkspaceRole", "test-workspace", "user-b").Return(nil).Once()
+
+	svc := WorkspaceService{DB: mockDB, KC: mockKC}
+	w := httptest.NewRecorder()
+	svc.RemoveUserService(w, newMemberRequest(http.MethodDelete, ""))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	mockDB.AssertExpectations(t)
+
+	// Admins cannot remove owners
+	mockDB, mockKC = newMemberMocks("owner")
+
+	svc = WorkspaceService{DB: mockDB, KC: mockKC}
+	w = httptest.NewRecorder()
+	svc.RemoveUserService(w, newMemberRequest(http.MethodDelete, ""))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	mockKC.AssertNotCalled(t, "RemoveMemberFromGroup", "user-b", "group-123")
+}
@@ -2,14 +2,16 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"regexp"
 
-	"github.com/EO-DataHub/eodhp-workspace-services/db"
 	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authz"
+	"github.com/rs/zerolog"
 )
 
 var dnsNameRegex = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
@@ -36,16 +38,6 @@ func WriteResponse(w http.ResponseWriter, statusCode int, response interface{},
 	}
 }
 
-// HasRole checks if a user has a specific role in the JWT claims.
-func HasRole(roles []string, role string) bool {
-	for _, userRole := range roles {
-		if userRole == role {
-			return true
-		}
-	}
-	return false
-}
-
 // Helper function to check if a member group is in the claims array
 func isMemberGroupAuthorized(workspaceGroup string, claimsGroups []string) bool {
 	for _, group := range claimsGroups {
@@ -61,53 +53,43 @@ func IsDNSCompatible(name string) bool {
 	return dnsNameRegex.MatchString(name)
 }
 
-// isUserWorkspaceAuthorized checks if a user is authorized to access information in a workspace
-func isUserWorkspaceAuthorized(db db.WorkspaceDBInterface, kc KeycloakClientInterface, claims authn.Claims, workspace string, mustBeAccountOwner bool) (bool, error) {
-
-	// hub_admin role is a superuser role
-	if HasRole(claims.RealmAccess.Roles, "hub_admin") {
-		return true, nil
+// authorize checks with a that the user may perform action on resource. It writes an error
+// response and returns false if they may not.
+func authorize(w http.ResponseWriter, r *http.Request, a authz.Authorizer, claims authn.Claims, action string, resource authz.Resource) bool {
+	if err := Authorize(r.Context(), a, claims, action, resource); err != nil {
+		WriteHTTPError(w, r, err)
+		return false
 	}
+	return true
+}
 
-	if claims.Username == "service-account-eodh-workspaces" {
-		return true, nil
-	}
+// Authorize checks with a that the user may perform action on resource, for handlers that do
+// not go through a service. It returns a *Problem to respond with if they may not.
+func Authorize(ctx context.Context, a authz.Authorizer, claims authn.Claims, action string, resource authz.Resource) error {
+	logger := zerolog.Ctx(ctx)
 
-	// Get the groups from keycloak associated with the user
-	memberGroups, err := kc.GetUserGroups(claims.Subject)
+	decision, err := a.Authorize(ctx, authz.SubjectFromClaims(claims), action, resource)
 	if err != nil {
-		return false, err
+		logger.Error().Err(err).Str("action", action).Str("workspace_id", resource.Workspace).Msg("Failed to authorize request")
+		return NewProblem(http.StatusInternalServerError, CodeInternal, "")
 	}
 
-	// Check if the user is an account owner
-	if mustBeAccountOwner {
-		if isMemberGroupAuthorized(workspace, memberGroups) {
-
-			// Do they own the workspace
-			isAccountOwner, err := db.IsUserAccountOwner(claims.Username, workspace)
-
-			// Check for errors
-			if err != nil {
-				return false, err
-			}
-
-			// Return true if the user is the account owner
-			if isAccountOwner {
-				return true, nil
-			}
-
-			// Return false if the user is not the account owner
-			return false, nil
-		}
-	}
-
-	// If the user is not an account owner, check if they are a member of the workspace
-	if isMemberGroupAuthorized(workspace, memberGroups) {
-		return true, nil
+	switch {
+	case decision.Allowed:
+		return nil
+	case decision.Reason == authz.ReasonScopedToken:
+		logger.Warn().Str("action", action).Str("workspace", claims.Workspace).Msg("Unauthorized request: workspace scoped token")
+		return NewProblem(http.StatusUnauthorized, CodeWorkspaceScopedToken, "workspace scoped tokens are not allowed for this request")
+	case decision.Reason == authz.ReasonAccountInactive:
+		logger.Warn().Str("action", action).Str("workspace_id", resource.Workspace).Msg("Access denied: account is not active")
+		return NewProblem(http.StatusForbidden, CodeAccountInactive, "the workspace's account is suspended or closed")
+	case decision.Reason == authz.ReasonWorkspaceSuspended:
+		logger.Warn().Str("action", action).Str("workspace_id", resource.Workspace).Msg("Access denied: workspace is suspended")
+		return NewProblem(http.StatusForbidden, CodeWorkspaceSuspended, "the workspace is suspended")
+	default:
+		logger.Warn().Str("action", action).Str("workspace_id", resource.Workspace).Str("user", claims.Username).Msg("Access denied")
+		return NewProblem(http.StatusForbidden, CodeForbidden, "")
 	}
-
-	// Return false if the user is not a member of the workspace or an account owner
-	return false, nil
 }
 
 func makeHTTPRequest(method, url string, headers map[string]string, body []byte) ([]byte, error) {
@@ -1,8 +1,17 @@
 package services
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
 
 	"net/http"
 
@@ -11,16 +20,65 @@ import (
 	"github.com/EO-DataHub/eodhp-workspace-services/db"
 	"github.com/EO-DataHub/eodhp-workspace-services/internal/appconfig"
 	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
-	"github.com/EO-DataHub/eodhp-workspace-services/internal/events"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authz"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/tracing"
+	"github.com/EO-DataHub/eodhp-workspace-services/models"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 )
 
+const (
+	WorkspaceStatusCreating = "creating"
+	WorkspaceStatusUpdating = "updating"
+	WorkspaceStatusDeleting = db.WorkspaceStatusDeleting
+
+	// WorkspaceStatusPendingDeletion is reported for workspaces within their deletion grace period
+	WorkspaceStatusPendingDeletion = "PendingDeletion"
+)
+
+const (
+	defaultDeletionSweepInterval = time.Minute
+	deletionSweepBatchSize       = 50
+)
+
+// fieldRule describes whether a field of a workspace or account may be changed by a client.
+type fieldRule int
+
+const (
+	// fieldMutable fields may be changed by the owner
+	fieldMutable fieldRule = iota
+	// fieldImmutable fields are fixed once the resource has been created
+	fieldImmutable
+	// fieldServerManaged fields are maintained by the service and ignored in requests
+	fieldServerManaged
+)
+
+// workspaceFieldRules lists every field of ws_manager.WorkspaceSettings a request may contain.
+// The name and stores are baked into the cluster resources of a workspace so cannot change. The
+// account a workspace is billed to may be moved to another approved account of the same owner.
+var workspaceFieldRules = map[string]fieldRule{
+	"id":           fieldImmutable,
+	"name":         fieldImmutable,
+	"account":      fieldMutable,
+	"owner":        fieldImmutable,
+	"stores":       fieldImmutable,
+	"status":       fieldServerManaged,
+	"last_updated": fieldServerManaged,
+}
+
 type WorkspaceService struct {
-	Config    *appconfig.Config
-	DB        db.WorkspaceDBInterface
-	Publisher events.Publisher
-	KC        KeycloakClientInterface
+	Config         *appconfig.Config
+	DB             db.WorkspaceDBInterface
+	KC             KeycloakClientInterface
+	AWSEmailClient EmailClient
+	// Authorizer decides what users may do. The default policy is used if it is nil.
+	Authorizer authz.Authorizer
+}
+
+func (svc *WorkspaceService) authorizer() authz.Authorizer {
+	return authorizerOrDefault(svc.Authorizer, svc.DB, svc.KC)
 }
 
 // GetWorkspacesService retrieves all workspaces accessible to the authenticated user's groups.
@@ -32,7 +90,7 @@ func (svc *WorkspaceService) GetWorkspacesService(w http.ResponseWriter, r *http
 	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
 	if !ok {
 		logger.Warn().Msg("Unauthorized request: missing claims")
-		WriteResponse(w, http.StatusUnauthorized, nil)
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
 		return
 	}
 
@@ -42,36 +100,43 @@ func (svc *WorkspaceService) GetWorkspacesService(w http.ResponseWriter, r *http
 	var err error
 	if workspacesOwned {
 		// Retrieve workspaces owned by the user
-		workspaces, err = svc.DB.GetOwnedWorkspaces(claims.Username)
+		workspaces, err = svc.DB.GetOwnedWorkspaces(r.Context(), claims.Username)
 		if err != nil {
 			logger.Error().Err(err).Msg("Database error retrieving workspaces")
-			WriteResponse(w, http.StatusInternalServerError, nil)
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 			return
 		}
 	} else {
 
 		// Retrieve groups the user is a member of
-		memberGroups, err := svc.KC.GetUserGroups(claims.Subject)
+		memberGroups, err := svc.KC.GetUserGroups(r.Context(), claims.Subject)
 		if err != nil {
 			logger.Error().Err(err).Str("user_id", claims.Subject).Msg("Failed to retrieve user groups")
-			WriteResponse(w, http.StatusInternalServerError, nil)
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		}
 
 		// Retrieve workspaces assigned to these groups
-		workspaces, err = svc.DB.GetUserWorkspaces(memberGroups)
+		workspaces, err = svc.DB.GetUserWorkspaces(r.Context(), memberGroups)
 		if err != nil {
 			logger.Error().Err(err).Msg("Database error retrieving workspaces")
-			WriteResponse(w, http.StatusInternalServerError, nil)
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 			return
 		}
 	}
 
 	var result []ws_manager.WorkspaceSettings
 
+	subject := authz.SubjectFromClaims(claims)
 	for _, ws := range workspaces {
 
-		// If workspace scoped claim and the workspace name does not match, skip it
-		if claims.Workspace != "" && ws.Name != claims.Workspace {
+		// Skip workspaces the user may not list, such as those a scoped token is not scoped to
+		decision, err := svc.authorizer().Authorize(r.Context(), subject, authz.ActionWorkspaceList, authz.Resource{Workspace: ws.Name})
+		if err != nil {
+			logger.Error().Err(err).Str("workspace_id", ws.Name).Msg("Failed to authorize workspace")
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+			return
+		}
+		if !decision.Allowed {
 			continue
 		}
 
@@ -80,7 +145,7 @@ func (svc *WorkspaceService) GetWorkspacesService(w http.ResponseWriter, r *http
 
 	// If workspace scoped claim and no matching workspaces, return unauthorized
 	if claims.Workspace != "" && len(result) == 0 {
-		WriteResponse(w, http.StatusUnauthorized, nil)
+		WriteError(w, r, http.StatusUnauthorized, CodeWorkspaceScopedToken, "")
 		return
 	}
 
@@ -102,7 +167,7 @@ func (svc *WorkspaceService) GetWorkspaceService(w http.ResponseWriter, r *http.
 	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
 	if !ok {
 		logger.Warn().Msg("Unauthorized request: missing claims")
-		WriteResponse(w, http.StatusUnauthorized, nil)
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
 		return
 	}
 
@@ -111,37 +176,20 @@ func (svc *WorkspaceService) GetWorkspaceService(w http.ResponseWriter, r *http.
 	logger.Info().Str("workspace_id", workspaceID).Msg("Retrieving workspace")
 
 	// Retrieve account associated with the user's username
-	workspace, err := svc.DB.GetWorkspace(workspaceID)
+	workspace, err := svc.DB.GetWorkspace(r.Context(), workspaceID)
 
-	if err != nil {
-		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Database error retrieving workspace")
-		WriteResponse(w, http.StatusNotFound, "Workspace does not exist.")
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn().Str("workspace_id", workspaceID).Msg("Workspace not found")
+		WriteError(w, r, http.StatusNotFound, CodeWorkspaceNotFound, "Workspace does not exist.")
 		return
-	}
-
-	// Get the groups from keycloak associated with the user
-	memberGroups, err := svc.KC.GetUserGroups(claims.Subject)
-	if err != nil {
-		logger.Error().Err(err).Str("user_id", claims.Subject).Msg("Failed to retrieve user groups")
-		WriteResponse(w, http.StatusInternalServerError, nil)
-	}
-
-	// Check if the account owner matches any of the claims member groups
-	if !isMemberGroupAuthorized(workspace.Name, memberGroups) {
-		logger.Warn().Str("workspace_id", workspaceID).Str("user", claims.Username).Msg("Access denied: user not in authorized groups")
-		WriteResponse(w, http.StatusForbidden, nil)
+	} else if err != nil {
+		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Database error retrieving workspace")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
-	// If using a workspace scoped token, only return the workspace the token is scoped to
-	if claims.Workspace != "" {
-		if claims.Workspace == workspace.Name {
-			WriteResponse(w, http.StatusOK, workspace)
-			return
-		}
-
-		// If the workspace is not found, return unauthorized
-		WriteResponse(w, http.StatusUnauthorized, nil)
+	// Only members can read a workspace, and scoped tokens only the workspace they are scoped to
+	if !authorize(w, r, svc.authorizer(), claims, authz.ActionWorkspaceRead, authz.Resource{Workspace: workspace.Name}) {
 		return
 	}
 
@@ -157,14 +205,11 @@ func (svc *WorkspaceService) CreateWorkspaceService(w http.ResponseWriter, r *ht
 	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
 	if !ok {
 		logger.Warn().Msg("Unauthorized request: missing claims")
-		WriteResponse(w, http.StatusUnauthorized, nil)
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
 		return
 	}
 
-	// Workspace Scoped tokens not authorized to create a workspace
-	if claims.Workspace != "" {
-		logger.Warn().Msg("Unauthorized request: workspace scoped token")
-		WriteResponse(w, http.StatusUnauthorized, nil)
+	if !authorize(w, r, svc.authorizer(), claims, authz.ActionWorkspaceCreate, authz.Resource{}) {
 		return
 	}
 
@@ -172,124 +217,384 @@ func (svc *WorkspaceService) CreateWorkspaceService(w http.ResponseWriter, r *ht
 	var wsSettings ws_manager.WorkspaceSettings
 	if err := json.NewDecoder(r.Body).Decode(&wsSettings); err != nil {
 		logger.Warn().Err(err).Msg("Invalid request payload")
-		WriteResponse(w, http.StatusBadRequest, nil)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "")
 		return
 	}
 
 	// Check that the account exists and the user is the account owner
-	account, err := svc.DB.CheckAccountIsVerified(wsSettings.Account)
+	verified, status, err := svc.DB.CheckAccountIsVerified(r.Context(), wsSettings.Account)
 	if err != nil {
 		logger.Error().Err(err).Msg("Database error checking account existence")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	// Suspended and closed accounts were approved once, so say why they cannot be used now
+	if status == AccountStatusSuspended || status == AccountStatusClosed || status == AccountStatusClosing {
+		logger.Warn().Str("account_id", wsSettings.Account.String()).Str("status", status).Msg("Unable to create a workspace - account is not active")
+		WriteError(w, r, http.StatusForbidden, CodeAccountInactive, fmt.Sprintf("Unable to create a workspace - account is %s", status))
 		return
 	}
 
 	// Return a not found response if the account does not exist
-	if !account {
+	if !verified {
 		logger.Warn().Str("account_id", wsSettings.Account.String()).Msg("Unable to create a workspace - account has not been approved")
-		WriteResponse(w, http.StatusForbidden, "Unable to create a workspace - account has not been approved")
+		WriteError(w, r, http.StatusForbidden, CodeAccountNotApproved, "Unable to create a workspace - account has not been approved")
 		return
 	}
 
 	// Check the name is DNS-compatible
 	if !IsDNSCompatible(wsSettings.Name) {
 		logger.Warn().Str("workspace_name", wsSettings.Name).Msg("Invalid workspace name. Not DNS compatible")
-		WriteResponse(w, http.StatusBadRequest, "invalid workspace name: must contain only a-z and -, not start with - and be less than 63 characters")
+		WriteError(w, r, http.StatusBadRequest, CodeValidationFailed, "invalid workspace name: must contain only a-z and -, not start with - and be less than 63 characters")
 		return
 	}
 
 	// Check that the workspace name does not already exist
-	workspaceExists, err := svc.DB.CheckWorkspaceExists(wsSettings.Name)
+	workspaceExists, err := svc.DB.CheckWorkspaceExists(r.Context(), wsSettings.Name)
 	if err != nil {
 		logger.Error().Err(err).Msg("Database error checking workspace existence")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
 	// Return a conflict response if the workspace name already exists
 	if workspaceExists {
 		logger.Warn().Str("workspace_name", wsSettings.Name).Msg("Workspace name already exists")
-		WriteResponse(w, http.StatusConflict, "workspace with name %s already exists", wsSettings.Name)
+		WriteError(w, r, http.StatusConflict, CodeWorkspaceExists, fmt.Sprintf("workspace with name %s already exists", wsSettings.Name))
 		return
 	}
 
-	// Create a group in Keycloak - the group name is the same as the workspace name
 	wsSettings.Owner = claims.Username
-	statusCode, err := svc.KC.CreateGroup(wsSettings.Name)
+	wsSettings.Status = WorkspaceStatusCreating
+
+	// Define default object and block stores
+	wsSettings.Stores = &[]ws_manager.Stores{
+		{
+			Object: []ws_manager.ObjectStore{
+				{Name: wsSettings.Name},
+			},
+			Block: []ws_manager.BlockStore{
+				{Name: wsSettings.Name},
+			},
+		},
+	}
 
+	// The saga must run to completion, or be compensated, even if the client goes away
+	ctx := context.WithoutCancel(r.Context())
+
+	// Record the creation so that it can be recovered if this process stops part way through
+	creation, err := svc.newWorkspaceCreationSaga(ctx, &models.WorkspaceCreationSaga{
+		ID:        uuid.New(),
+		Workspace: wsSettings.Name,
+		Account:   wsSettings.Account,
+		Owner:     claims.Username,
+		OwnerID:   claims.Subject,
+	}, logger)
 	if err != nil {
-		logger.Error().Err(err).Str("name", wsSettings.Name).Msg("Failed to create Keycloak group")
-		WriteResponse(w, statusCode, nil)
+		logger.Error().Err(err).Msg("Database error recording workspace creation")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
-	logger.Info().Str("name", wsSettings.Name).Msg("Group created successfully")
-
-	// Find the group ID just created from keycloak
-	group, err := svc.KC.GetGroup(wsSettings.Name)
+	// Keycloak refuses a group whose name is taken, for example by a workspace being created
+	groupExists := false
 
+	err = creation.run([]sagaStep{
+		{
+			// Create a group in Keycloak - the group name is the same as the workspace name
+			name: SagaStepGroupCreated,
+			action: func() error {
+				statusCode, err := svc.KC.CreateGroup(ctx, wsSettings.Name)
+				if err != nil {
+					groupExists = statusCode == http.StatusConflict
+					return err
+				}
+				logger.Info().Str("name", wsSettings.Name).Msg("Group created successfully")
+				return nil
+			},
+			compensate: func() error {
+				_, err := svc.KC.DeleteGroup(ctx, wsSettings.Name)
+				return err
+			},
+		},
+		{
+			// Add the account owner to the group just created
+			name: SagaStepOwnerAdded,
+			action: func() error {
+				group, err := svc.KC.GetGroup(ctx, wsSettings.Name)
+				if err != nil {
+					return err
+				}
+				if err := svc.KC.AddMemberToGroup(ctx, claims.Subject, group.ID); err != nil {
+					return err
+				}
+				logger.Info().Str("user_id", claims.Subject).Str("group_id", group.ID).Msg("User added to Keycloak group successfully")
+				return nil
+			},
+		},
+		{
+			// Store the workspace, its creation event is published by the outbox relay once committed
+			name: SagaStepWorkspaceStored,
+			action: func() error {
+				return svc.DB.CreateWorkspace(ctx, &wsSettings)
+			},
+		},
+	})
 	if err != nil {
-		logger.Error().Err(err).Str("name", wsSettings.Name).Msg("Failed to retrieve Keycloak group")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		logger.Error().Err(err).Str("workspace_name", wsSettings.Name).Msg("Failed to create workspace")
+		if groupExists {
+			WriteError(w, r, http.StatusConflict, CodeWorkspaceExists, fmt.Sprintf("workspace with name %s already exists", wsSettings.Name))
+			return
+		}
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
-	accountOwnerID := claims.Subject
-	err = svc.KC.AddMemberToGroup(accountOwnerID, group.ID)
-	if err != nil {
-		logger.Error().Err(err).Str("user_id", claims.Subject).Str("group_id", group.ID).Msg("Failed to add user to group")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+	logger.Info().Str("workspace_name", wsSettings.Name).Msg("Workspace created successfully")
+
+	// Send response
+	var location = fmt.Sprintf("%s/%s", r.URL.Path, wsSettings.ID)
+	WriteResponse(w, http.StatusCreated, wsSettings, location)
+
+}
+
+// UpdateWorkspaceService replaces the settings of a workspace with the request body.
+// Fields omitted from the body keep their current values.
+func (svc *WorkspaceService) UpdateWorkspaceService(w http.ResponseWriter, r *http.Request) {
+	svc.updateWorkspace(w, r, func(current map[string]interface{}, body []byte) (map[string]interface{}, error) {
+		var target map[string]interface{}
+		if err := json.Unmarshal(body, &target); err != nil {
+			return nil, err
+		}
+		if target == nil {
+			return nil, fmt.Errorf("request body must be a JSON object")
+		}
+
+		for field, value := range current {
+			if _, ok := target[field]; !ok {
+				target[field] = value
+			}
+		}
+		return target, nil
+	})
+}
+
+// PatchWorkspaceService applies a JSON Merge Patch (RFC 7396) to the settings of a workspace.
+func (svc *WorkspaceService) PatchWorkspaceService(w http.ResponseWriter, r *http.Request) {
+	svc.updateWorkspace(w, r, func(current map[string]interface{}, body []byte) (map[string]interface{}, error) {
+		original, err := json.Marshal(current)
+		if err != nil {
+			return nil, err
+		}
+
+		patched, err := mergePatch(original, body)
+		if err != nil {
+			return nil, err
+		}
+
+		var target map[string]interface{}
+		if err := json.Unmarshal(patched, &target); err != nil {
+			return nil, err
+		}
+		if target == nil {
+			return nil, fmt.Errorf("merge patch must be a JSON object")
+		}
+		return target, nil
+	})
+}
+
+// updateWorkspace validates the settings produced by buildTarget against the field rules, stores
+// them and publishes an update event so the workspace manager reconciles the workspace.
+func (svc *WorkspaceService) updateWorkspace(w http.ResponseWriter, r *http.Request,
+	buildTarget func(current map[string]interface{}, body []byte) (map[string]interface{}, error)) {
+
+	logger := zerolog.Ctx(r.Context())
+
+	// Extract the claims to get the users KC ID
+	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
+	if !ok {
+		logger.Warn().Msg("Unauthorized request: missing claims")
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
 		return
 	}
 
-	logger.Info().Str("user_id", claims.Subject).Str("group_id", group.ID).Msg("User added to Keycloak group successfully")
+	// Parse the workspace ID from the URL path
+	workspaceID := mux.Vars(r)["workspace-id"]
 
-	// Begin the workspace creation transaction
-	wsSettings.Status = "creating"
+	// Only workspace owners or a hub admin can change a workspace
+	if !authorize(w, r, svc.authorizer(), claims, authz.ActionWorkspaceUpdate, authz.Resource{Workspace: workspaceID}) {
+		return
+	}
 
-	// Define default object and block stores
-	wsSettings.Stores = &[]ws_manager.Stores{
-		{
-			Object: []ws_manager.ObjectStore{
-				{Name: wsSettings.Name},
-			},
-			Block: []ws_manager.BlockStore{
-				{Name: wsSettings.Name},
-			},
-		},
+	if !isJSONContentType(r.Header.Get("Content-Type"), r.Method == http.MethodPatch) {
+		WriteError(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "unsupported content type")
+		return
+	}
+
+	workspace, err := svc.DB.GetWorkspace(r.Context(), workspaceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn().Str("workspace_id", workspaceID).Msg("Workspace not found")
+		WriteError(w, r, http.StatusNotFound, CodeWorkspaceNotFound, "Workspace does not exist.")
+		return
+	} else if err != nil {
+		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Database error retrieving workspace")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	if workspace.Status == WorkspaceStatusPendingDeletion {
+		logger.Warn().Str("workspace_id", workspaceID).Msg("Workspace is pending deletion")
+		WriteError(w, r, http.StatusConflict, CodeWorkspaceDeleting, "Workspace is pending deletion. Restore it before making changes.")
+		return
 	}
-	tx, err := svc.DB.CreateWorkspace(&wsSettings)
+
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		logger.Error().Err(err).Msg("Database error creating workspace")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		logger.Warn().Err(err).Msg("Failed to read request body")
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "")
 		return
 	}
 
-	// Publish a message for workspace creation
-	err = svc.Publisher.Publish(wsSettings)
+	current, err := toJSONObject(workspace)
 	if err != nil {
-		logger.Error().Err(err).Msg("Failed to publish workspace creation event")
-		tx.Rollback()
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		logger.Error().Err(err).Msg("Failed to encode workspace")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
-	// Commit the transaction after successful publishing
-	if err := svc.DB.CommitTransaction(tx); err != nil {
-		logger.Error().Err(err).Msg("Failed to commit transaction")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+	target, err := buildTarget(current, body)
+	if err != nil {
+		logger.Warn().Err(err).Msg("Invalid request payload")
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("invalid request payload: %v", err))
 		return
 	}
 
-	logger.Info().Str("workspace_name", wsSettings.Name).Msg("Workspace created successfully")
+	unknown, immutable := checkFields(workspaceFieldRules, current, target)
+	if len(unknown) > 0 {
+		logger.Warn().Strs("fields", unknown).Msg("Unknown workspace fields in request")
+		WriteProblem(w, r, NewProblem(http.StatusBadRequest, CodeValidationFailed,
+			fmt.Sprintf("unknown fields: %s", strings.Join(unknown, ", "))).WithFieldErrors(fieldErrors(unknown, "is not a workspace field")...))
+		return
+	}
+	if len(immutable) > 0 {
+		logger.Warn().Strs("fields", immutable).Msg("Attempt to change immutable workspace fields")
+		WriteProblem(w, r, NewProblem(http.StatusUnprocessableEntity, CodeImmutableField,
+			fmt.Sprintf("fields cannot be changed: %s", strings.Join(immutable, ", "))).WithFieldErrors(fieldErrors(immutable, "cannot be changed")...))
+		return
+	}
 
-	// Send response
-	var location = fmt.Sprintf("%s/%s", r.URL.Path, wsSettings.ID)
-	WriteResponse(w, http.StatusCreated, wsSettings, location)
+	// Server managed fields keep their stored values
+	for field, rule := range workspaceFieldRules {
+		if rule == fieldServerManaged {
+			target[field] = current[field]
+		}
+	}
+
+	updated, err := fromJSONObject(target)
+	if err != nil {
+		logger.Warn().Err(err).Msg("Invalid request payload")
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("invalid request payload: %v", err))
+		return
+	}
+	updated.Status = WorkspaceStatusUpdating
+
+	// A workspace can only be moved to another approved account of its owner
+	if updated.Account != workspace.Account {
+		account, err := svc.DB.GetAccount(r.Context(), updated.Account)
+		if err != nil {
+			logger.Error().Err(err).Str("account_id", updated.Account.String()).Msg("Database error retrieving account")
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+			return
+		}
+
+		var message string
+		switch {
+		case account == nil || account.AccountOwner != workspace.Owner:
+			message = "must be an account owned by the workspace owner"
+		case account.Status != AccountStatusApproved:
+			message = "must be an approved account"
+		}
+		if message != "" {
+			logger.Warn().Str("account_id", updated.Account.String()).Msg("Invalid account for workspace")
+			WriteProblem(w, r, NewProblem(http.StatusUnprocessableEntity, CodeValidationFailed, "Invalid workspace.").
+				WithFieldErrors(FieldError{Field: "account", Message: message}))
+			return
+		}
+	}
 
+	// The update event is queued in the same transaction and published by the outbox relay
+	if err := svc.DB.UpdateWorkspace(r.Context(), updated); err != nil {
+		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Database error updating workspace")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	logger.Info().Str("workspace_name", updated.Name).Msg("Workspace updated successfully")
+	WriteResponse(w, http.StatusOK, updated)
+}
+
+// checkFields returns the fields in target that have no rule and the immutable fields whose
+// values differ from current.
+func checkFields(rules map[string]fieldRule, current, target map[string]interface{}) (unknown, immutable []string) {
+	for field, value := range target {
+		rule, ok := rules[field]
+		if !ok {
+			unknown = append(unknown, field)
+			continue
+		}
+		if rule == fieldImmutable && !reflect.DeepEqual(current[field], value) {
+			immutable = append(immutable, field)
+		}
+	}
+
+	// Removing an immutable field with a null merge patch is also a change
+	for field, rule := range rules {
+		if _, ok := target[field]; !ok && rule == fieldImmutable {
+			immutable = append(immutable, field)
+		}
+	}
+
+	sort.Strings(unknown)
+	sort.Strings(immutable)
+	return unknown, immutable
+}
+
+// toJSONObject converts workspace settings or an account into their generic JSON representation.
+func toJSONObject(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var obj map[string]interface{}
+	err = json.Unmarshal(b, &obj)
+	return obj, err
+}
+
+// fromJSONObject converts a generic JSON representation back into workspace settings.
+func fromJSONObject(obj map[string]interface{}) (*ws_manager.WorkspaceSettings, error) {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	var ws ws_manager.WorkspaceSettings
+	err = json.Unmarshal(b, &ws)
+	return &ws, err
+}
+
+// isJSONContentType reports whether contentType is JSON, or a JSON Merge Patch if allowed.
+func isJSONContentType(contentType string, allowMergePatch bool) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || (allowMergePatch && mediaType == "application/merge-patch+json")
 }
 
-// Deletes a workspace and its associated resources.
+// DeleteWorkspaceService schedules a workspace for deletion once the configured grace period has
+// passed. The deletion event is published by the sweeper, so the workspace can be restored until then.
 func (svc *WorkspaceService) DeleteWorkspaceService(w http.ResponseWriter, r *http.Request) {
 
 	logger := zerolog.Ctx(r.Context())
@@ -298,32 +603,136 @@ func (svc *WorkspaceService) DeleteWorkspaceService(w http.ResponseWriter, r *ht
 	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
 	if !ok {
 		logger.Warn().Msg("Unauthorized request: missing claims")
-		WriteResponse(w, http.StatusUnauthorized, nil)
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
 		return
 	}
 
-	// Workspace Scoped tokens not authorized to delete workspace
-	if claims.Workspace != "" {
-		logger.Warn().Msg("Unauthorized request: workspace scoped token")
-		WriteResponse(w, http.StatusUnauthorized, nil)
+	// Parse the workspace ID from the URL path
+	workspaceID := mux.Vars(r)["workspace-id"]
+
+	// Only workspace owners or a hub admin can delete a workspace
+	if !authorize(w, r, svc.authorizer(), claims, authz.ActionWorkspaceDelete, authz.Resource{Workspace: workspaceID}) {
+		return
+	}
+
+	scheduledAt, err := svc.DB.ScheduleWorkspaceDeletion(r.Context(), workspaceID, claims.Username, svc.deletionGracePeriod())
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn().Str("workspace_id", workspaceID).Msg("Workspace not found")
+		WriteError(w, r, http.StatusNotFound, CodeWorkspaceNotFound, "Workspace does not exist.")
+		return
+	} else if err != nil {
+		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to schedule workspace deletion")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+
+	// Read membership from Keycloak again now that the workspace is being deleted
+	invalidateGroupMembership(svc.KC, workspaceID)
+
+	logger.Info().Str("workspace_name", workspaceID).Time("scheduled_at", scheduledAt).Msg("Workspace deletion scheduled")
+
+	WriteResponse(w, http.StatusAccepted, models.WorkspaceDeletion{
+		Workspace:   workspaceID,
+		ScheduledAt: scheduledAt,
+	})
+
+}
+
+// RestoreWorkspaceService cancels the pending deletion of a workspace.
+func (svc *WorkspaceService) RestoreWorkspaceService(w http.ResponseWriter, r *http.Request) {
+
+	logger := zerolog.Ctx(r.Context())
+
+	// Extract the claims to get the users KC ID
+	claims, ok := r.Context().Value(middleware.ClaimsKey).(authn.Claims)
+	if !ok {
+		logger.Warn().Msg("Unauthorized request: missing claims")
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "missing claims")
 		return
 	}
 
 	// Parse the workspace ID from the URL path
 	workspaceID := mux.Vars(r)["workspace-id"]
 
-	var wsSettings ws_manager.WorkspaceSettings
-	wsSettings.Name = workspaceID
-	wsSettings.Status = "deleting"
+	// Only workspace owners or a hub admin can restore a workspace
+	if !authorize(w, r, svc.authorizer(), claims, authz.ActionWorkspaceRestore, authz.Resource{Workspace: workspaceID}) {
+		return
+	}
+
+	restored, err := svc.DB.CancelWorkspaceDeletion(r.Context(), workspaceID)
+	if err != nil {
+		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Failed to cancel workspace deletion")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
 
-	// Publish a message for workspace creation
-	err := svc.Publisher.Publish(wsSettings)
+	if !restored {
+		logger.Warn().Str("workspace_id", workspaceID).Msg("Workspace is not pending deletion")
+		WriteError(w, r, http.StatusConflict, CodeWorkspaceNotDeleting, "Workspace is not pending deletion.")
+		return
+	}
+
+	workspace, err := svc.DB.GetWorkspace(r.Context(), workspaceID)
 	if err != nil {
-		logger.Error().Err(err).Msg("Failed to publish workspace deletion event")
-		WriteResponse(w, http.StatusInternalServerError, nil)
+		logger.Error().Err(err).Str("workspace_id", workspaceID).Msg("Database error retrieving workspace")
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
 
-	WriteResponse(w, http.StatusNoContent, nil)
+	logger.Info().Str("workspace_name", workspaceID).Msg("Workspace deletion cancelled")
+	WriteResponse(w, http.StatusOK, workspace)
+}
+
+// SweepWorkspaceDeletions queues deletion events for workspaces whose grace period has passed.
+// Workspaces are claimed in batches so that several replicas can sweep concurrently.
+func (svc *WorkspaceService) SweepWorkspaceDeletions(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "WorkspaceService.SweepWorkspaceDeletions")
+	defer span.End()
+
+	for {
+		names, err := svc.DB.EnqueueExpiredWorkspaceDeletions(ctx, deletionSweepBatchSize)
+		if err != nil {
+			return err
+		}
+
+		if len(names) == 0 {
+			return nil
+		}
+
+		log.Info().Strs("workspaces", names).Msg("Queued workspace deletion events")
 
+		if len(names) < deletionSweepBatchSize {
+			return nil
+		}
+	}
+}
+
+// RunDeletionSweeper sweeps expired workspace deletions on every interval until ctx is cancelled.
+func (svc *WorkspaceService) RunDeletionSweeper(ctx context.Context) {
+	interval := defaultDeletionSweepInterval
+	if svc.Config != nil && svc.Config.Workspaces.DeletionSweepIntervalSeconds > 0 {
+		interval = time.Duration(svc.Config.Workspaces.DeletionSweepIntervalSeconds) * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := svc.SweepWorkspaceDeletions(ctx); err != nil {
+				log.Error().Err(err).Msg("Failed to sweep workspace deletions")
+			}
+		}
+	}
+}
+
+// deletionGracePeriod returns how long a deleted workspace can be restored for.
+func (svc *WorkspaceService) deletionGracePeriod() time.Duration {
+	if svc.Config == nil {
+		return 0
+	}
+	return time.Duration(svc.Config.Workspaces.DeletionGracePeriodHours) * time.Hour
 }
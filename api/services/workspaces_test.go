@@ -5,16 +5,21 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	ws_manager "github.com/EO-DataHub/eodhp-workspace-manager/models"
 	"github.com/EO-DataHub/eodhp-workspace-services/api/middleware"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/appconfig"
 	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
 	"github.com/EO-DataHub/eodhp-workspace-services/models"
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -22,16 +27,14 @@ import (
 // MockKeycloakClient is a mock implementation of KeycloakClientInterface
 
 func TestCreateWorkspaceService(t *testing.T) {
-	// Mock database, publisher, and Keycloak client
+	// Mock database and Keycloak client
 	mockDB := new(MockWorkspaceDB)
-	mockPublisher := new(MockEventPublisher)
 	mockKC := new(MockKeycloakClient)
 
 	// Initialize the service with the mock dependencies
 	svc := WorkspaceService{
-		DB:        mockDB,
-		Publisher: mockPublisher,
-		KC:        mockKC,
+		DB: mockDB,
+		KC: mockKC,
 	}
 
 	// Mock claims for authentication
@@ -50,14 +53,15 @@ func TestCreateWorkspaceService(t *testing.T) {
 
 	payloadBytes, _ := json.Marshal(workspacePayload)
 
-	mockDB.On("CheckAccountIsVerified", workspacePayload.Account).Return(true, nil).Once()
+	mockDB.On("CheckAccountIsVerified", workspacePayload.Account).Return(true, AccountStatusApproved, nil).Once()
 	mockDB.On("CheckWorkspaceExists", workspacePayload.Name).Return(false, nil).Once()
+	mockDB.On("CreateWorkspaceSaga", mock.Anything).Return(nil).Once()
+	mockDB.On("UpdateWorkspaceSaga", mock.Anything, mock.Anything, SagaStatusRunning, "").Return(nil).Times(2)
+	mockDB.On("UpdateWorkspaceSaga", mock.Anything, SagaStepWorkspaceStored, SagaStatusCompleted, "").Return(nil).Once()
 	mockKC.On("CreateGroup", workspacePayload.Name).Return(http.StatusCreated, nil).Once()
 	mockKC.On("GetGroup", workspacePayload.Name).Return(&models.Group{ID: "group-123"}, nil).Once()
 	mockKC.On("AddMemberToGroup", mockClaims.Subject, "group-123").Return(nil).Once()
-	mockDB.On("CreateWorkspace", mock.Anything).Return(&sql.Tx{}, nil).Once()
-	mockDB.On("CommitTransaction", mock.Anything).Return(nil).Once()
-	mockPublisher.On("Publish", mock.Anything).Return(nil).Once()
+	mockDB.On("CreateWorkspace", mock.Anything).Return(nil).Once()
 
 	// Create test request
 	req := httptest.NewRequest(http.MethodPost, "/api/workspaces", bytes.NewReader(payloadBytes))
@@ -77,7 +81,6 @@ func TestCreateWorkspaceService(t *testing.T) {
 	assert.Equal(t, http.StatusCreated, res.StatusCode, "Expected HTTP status 201 Created")
 
 	mockDB.AssertExpectations(t)
-	mockPublisher.AssertExpectations(t)
 	mockKC.AssertExpectations(t)
 
 	req = httptest.NewRequest(http.MethodPost, "/api/workspaces", bytes.NewReader(payloadBytes))
@@ -107,7 +110,7 @@ func TestCreateWorkspaceService(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, res.StatusCode, "Expected HTTP status 400 Bad Request for invalid JSON")
 
 	// Workspace name already exists
-	mockDB.On("CheckAccountIsVerified", workspacePayload.Account).Return(true, nil).Once()
+	mockDB.On("CheckAccountIsVerified", workspacePayload.Account).Return(true, AccountStatusApproved, nil).Once()
 	mockDB.On("CheckWorkspaceExists", workspacePayload.Name).Return(true, nil).Once()
 
 	req = httptest.NewRequest(http.MethodPost, "/api/workspaces", bytes.NewReader(payloadBytes))
@@ -125,7 +128,7 @@ func TestCreateWorkspaceService(t *testing.T) {
 	assert.Equal(t, http.StatusConflict, res.StatusCode, "Expected HTTP status 409 Conflict for existing workspace")
 
 	// Database error during account check
-	mockDB.On("CheckAccountIsVerified", workspacePayload.Account).Return(false, fmt.Errorf("database error")).Once()
+	mockDB.On("CheckAccountIsVerified", workspacePayload.Account).Return(false, "", fmt.Errorf("database error")).Once()
 
 	req = httptest.NewRequest(http.MethodPost, "/api/workspaces", bytes.NewReader(payloadBytes))
 	req.Header.Set("Content-Type", "application/json")
@@ -140,4 +143,532 @@ func TestCreateWorkspaceService(t *testing.T) {
 	defer res.Body.Close()
 
 	assert.Equal(t, http.StatusInternalServerError, res.StatusCode, "Expected HTTP status 500 Internal Server Error for database error")
+
+	// Suspended accounts cannot create workspaces
+	mockDB.On("CheckAccountIsVerified", workspacePayload.Account).Return(false, AccountStatusSuspended, nil).Once()
+
+	req = httptest.NewRequest(http.MethodPost, "/api/workspaces", bytes.NewReader(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+
+	ctx = context.WithValue(req.Context(), middleware.ClaimsKey, mockClaims)
+	req = req.WithContext(ctx)
+
+	w = httptest.NewRecorder()
+	svc.CreateWorkspaceService(w, req)
+
+	res = w.Result()
+	defer res.Body.Close()
+
+	assert.Equal(t, http.StatusForbidden, res.StatusCode, "Expected HTTP status 403 Forbidden for a suspended account")
+	var problem Problem
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&problem))
+	assert.Equal(t, CodeAccountInactive, problem.Code)
+}
+
+func newWorkspaceUpdateRequest(method, body, contentType string, claims authn.Claims) *http.Request {
+	req := httptest.NewRequest(method, "/api/workspaces/test-workspace", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", contentType)
+	req = mux.SetURLVars(req, map[string]string{"workspace-id": "test-workspace"})
+	return req.WithContext(context.WithValue(req.Context(), middleware.ClaimsKey, claims))
+}
+
+func TestUpdateWorkspaceService(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	mockKC := new(MockKeycloakClient)
+
+	svc := WorkspaceService{
+		DB: mockDB,
+		KC: mockKC,
+	}
+
+	mockClaims := authn.Claims{Username: "testuser"}
+	mockClaims.Subject = "user-123"
+
+	workspace := &ws_manager.WorkspaceSettings{
+		ID:      uuid.New(),
+		Name:    "test-workspace",
+		Account: uuid.New(),
+		Owner:   "testuser",
+		Status:  "Ready",
+	}
+
+	mockKC.On("GetUserGroups", "user-123").Return([]string{"test-workspace"}, nil)
+	mockDB.On("IsUserAccountOwner", "testuser", "test-workspace").Return(true, nil)
+	mockDB.On("GetWorkspace", "test-workspace").Return(workspace, nil)
+
+	// Server managed fields are ignored and omitted fields keep their values
+	mockDB.On("UpdateWorkspace", mock.MatchedBy(func(ws *ws_manager.WorkspaceSettings) bool {
+		return ws.ID == workspace.ID && ws.Name == workspace.Name && ws.Status == WorkspaceStatusUpdating
+	})).Return(nil).Once()
+
+	w := httptest.NewRecorder()
+	svc.UpdateWorkspaceService(w, newWorkspaceUpdateRequest(http.MethodPut,
+		`{"name": "test-workspace", "status": "Ready"}`, "application/json", mockClaims))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Changing an immutable field is rejected
+	w = httptest.NewRecorder()
+	svc.UpdateWorkspaceService(w, newWorkspaceUpdateRequest(http.MethodPut,
+		fmt.Sprintf(`{"name": "renamed", "id": "%s"}`, uuid.New()), "application/json", mockClaims))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "id, name")
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `"code":"immutable_field"`)
+
+	// Unknown fields are rejected
+	w = httptest.NewRecorder()
+	svc.UpdateWorkspaceService(w, newWorkspaceUpdateRequest(http.MethodPut,
+		`{"colour": "blue"}`, "application/json", mockClaims))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Workspace scoped tokens cannot update a workspace
+	w = httptest.NewRecorder()
+	svc.UpdateWorkspaceService(w, newWorkspaceUpdateRequest(http.MethodPut,
+		`{}`, "application/json", authn.Claims{Workspace: "test-workspace"}))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestUpdateWorkspaceService_MoveAccount(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+
+	svc := WorkspaceService{
+		DB: mockDB,
+	}
+
+	mockClaims := authn.Claims{Username: "admin"}
+	mockClaims.RealmAccess.Roles = []string{"hub_admin"}
+
+	workspace := &ws_manager.WorkspaceSettings{
+		ID:      uuid.New(),
+		Name:    "test-workspace",
+		Account: uuid.New(),
+		Owner:   "testuser",
+		Status:  "Ready",
+	}
+	mockDB.On("GetWorkspace", "test-workspace").Return(workspace, nil)
+
+	approved := uuid.New()
+	pending := uuid.New()
+	otherOwner := uuid.New()
+	mockDB.On("GetAccount", approved).Return(&models.Account{ID: approved, AccountOwner: "testuser", Status: AccountStatusApproved}, nil)
+	mockDB.On("GetAccount", pending).Return(&models.Account{ID: pending, AccountOwner: "testuser", Status: AccountStatusPending}, nil)
+	mockDB.On("GetAccount", otherOwner).Return(&models.Account{ID: otherOwner, AccountOwner: "someone-else", Status: AccountStatusApproved}, nil)
+
+	// The new account is saved with the workspace
+	mockDB.On("UpdateWorkspace", mock.MatchedBy(func(ws *ws_manager.WorkspaceSettings) bool {
+		return ws.ID == workspace.ID && ws.Account == approved
+	})).Return(nil).Once()
+
+	w := httptest.NewRecorder()
+	svc.PatchWorkspaceService(w, newWorkspaceUpdateRequest(http.MethodPatch,
+		fmt.Sprintf(`{"account": "%s"}`, approved), "application/merge-patch+json", mockClaims))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var updated ws_manager.WorkspaceSettings
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&updated))
+	assert.Equal(t, approved, updated.Account)
+
+	// Accounts that are not approved or belong to someone else are rejected
+	for _, accountID := range []uuid.UUID{pending, otherOwner} {
+		w = httptest.NewRecorder()
+		svc.PatchWorkspaceService(w, newWorkspaceUpdateRequest(http.MethodPatch,
+			fmt.Sprintf(`{"account": "%s"}`, accountID), "application/merge-patch+json", mockClaims))
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"account"`)
+	}
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestUpdateWorkspaceService_DatabaseError(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+
+	svc := WorkspaceService{
+		DB: mockDB,
+	}
+
+	mockClaims := authn.Claims{Username: "admin"}
+	mockClaims.RealmAccess.Roles = []string{"hub_admin"}
+
+	// Only a missing workspace is reported as not found
+	mockDB.On("GetWorkspace", "test-workspace").Return((*ws_manager.WorkspaceSettings)(nil), errors.New("connection refused")).Once()
+
+	w := httptest.NewRecorder()
+	svc.PatchWorkspaceService(w, newWorkspaceUpdateRequest(http.MethodPatch,
+		`{}`, "application/merge-patch+json", mockClaims))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	mockDB.On("GetWorkspace", "test-workspace").Return((*ws_manager.WorkspaceSettings)(nil), fmt.Errorf("workspace not found: %w", sql.ErrNoRows)).Once()
+
+	w = httptest.NewRecorder()
+	svc.PatchWorkspaceService(w, newWorkspaceUpdateRequest(http.MethodPatch,
+		`{}`, "application/merge-patch+json", mockClaims))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestUpdateWorkspaceService_NotAccountOwner(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	mockKC := new(MockKeycloakClient)
+
+	svc := WorkspaceService{
+		DB: mockDB,
+		KC: mockKC,
+	}
+
+	mockClaims := authn.Claims{Username: "member"}
+	mockClaims.Subject = "user-456"
+
+	mockKC.On("GetUserGroups", "user-456").Return([]string{"test-workspace"}, nil)
+	mockDB.On("IsUserAccountOwner", "member", "test-workspace").Return(false, nil)
+	mockDB.On("GetWorkspaceRole", "test-workspace", "user-456").Return("admin", nil)
+
+	w := httptest.NewRecorder()
+	svc.PatchWorkspaceService(w, newWorkspaceUpdateRequest(http.MethodPatch,
+		`{}`, "application/merge-patch+json", mockClaims))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	mockDB.AssertNotCalled(t, "UpdateWorkspace", mock.Anything)
+}
+
+func TestPatchWorkspaceService(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	mockKC := new(MockKeycloakClient)
+
+	svc := WorkspaceService{
+		DB: mockDB,
+		KC: mockKC,
+	}
+
+	mockClaims := authn.Claims{Username: "admin"}
+	mockClaims.RealmAccess.Roles = []string{"hub_admin"}
+
+	workspace := &ws_manager.WorkspaceSettings{
+		ID:      uuid.New(),
+		Name:    "test-workspace",
+		Account: uuid.New(),
+		Owner:   "testuser",
+		Status:  "Ready",
+		Stores: &[]ws_manager.Stores{{
+			Object: []ws_manager.ObjectStore{{Name: "test-workspace"}},
+			Block:  []ws_manager.BlockStore{{Name: "test-workspace"}},
+		}},
+	}
+
+	mockDB.On("GetWorkspace", "test-workspace").Return(workspace, nil)
+	mockDB.On("UpdateWorkspace", mock.Anything).Return(nil).Once()
+
+	w := httptest.NewRecorder()
+	svc.PatchWorkspaceService(w, newWorkspaceUpdateRequest(http.MethodPatch,
+		`{"last_updated": "2020-01-01T00:00:00Z"}`, "application/merge-patch+json", mockClaims))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Stores cannot be changed or removed
+	w = httptest.NewRecorder()
+	svc.PatchWorkspaceService(w, newWorkspaceUpdateRequest(http.MethodPatch,
+		`{"stores": null}`, "application/merge-patch+json", mockClaims))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	// Merge patches must be sent with a JSON content type
+	w = httptest.NewRecorder()
+	svc.PatchWorkspaceService(w, newWorkspaceUpdateRequest(http.MethodPatch,
+		`{}`, "text/plain", mockClaims))
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestMergePatch(t *testing.T) {
+	// Examples from RFC 7396 appendix A
+	tests := []struct {
+		original string
+		patch    string
+		expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		result, err := mergePatch([]byte(tt.original), []byte(tt.patch))
+		assert.NoError(t, err)
+		assert.JSONEq(t, tt.expected, string(result), "patch %s on %s", tt.patch, tt.original)
+	}
+}
+
+func TestDeleteWorkspaceService(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	mockKC := new(MockKeycloakClient)
+
+	svc := WorkspaceService{
+		Config: &appconfig.Config{Workspaces: appconfig.WorkspacesConfig{DeletionGracePeriodHours: 24}},
+		DB:     mockDB,
+		KC:     mockKC,
+	}
+
+	owner := authn.Claims{Username: "owner"}
+	owner.Subject = "owner-id"
+	member := authn.Claims{Username: "member"}
+	member.Subject = "member-id"
+
+	scheduledAt := time.Now().Add(24 * time.Hour)
+
+	mockKC.On("GetUserGroups", "owner-id").Return([]string{"test-workspace"}, nil)
+	mockKC.On("GetUserGroups", "member-id").Return([]string{"test-workspace"}, nil)
+	mockDB.On("IsUserAccountOwner", "owner", "test-workspace").Return(true, nil)
+	mockDB.On("IsUserAccountOwner", "member", "test-workspace").Return(false, nil)
+	mockDB.On("GetWorkspaceRole", "test-workspace", "member-id").Return("admin", nil)
+	mockDB.On("ScheduleWorkspaceDeletion", "test-workspace", "owner", 24*time.Hour).Return(scheduledAt, nil).Once()
+
+	// The account owner can schedule the deletion
+	w := httptest.NewRecorder()
+	svc.DeleteWorkspaceService(w, newWorkspaceUpdateRequest(http.MethodDelete, "", "", owner))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	var deletion models.WorkspaceDeletion
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&deletion))
+	assert.Equal(t, "test-workspace", deletion.Workspace)
+	assert.True(t, scheduledAt.Equal(deletion.ScheduledAt))
+
+	// Other workspace members cannot delete the workspace
+	w = httptest.NewRecorder()
+	svc.DeleteWorkspaceService(w, newWorkspaceUpdateRequest(http.MethodDelete, "", "", member))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Only a missing workspace is reported as not found
+	mockDB.On("ScheduleWorkspaceDeletion", "test-workspace", "owner", 24*time.Hour).
+		Return(time.Time{}, fmt.Errorf("workspace not found: %w", sql.ErrNoRows)).Once()
+	w = httptest.NewRecorder()
+	svc.DeleteWorkspaceService(w, newWorkspaceUpdateRequest(http.MethodDelete, "", "", owner))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	mockDB.On("ScheduleWorkspaceDeletion", "test-workspace", "owner", 24*time.Hour).
+		Return(time.Time{}, errors.New("connection refused")).Once()
+	w = httptest.NewRecorder()
+	svc.DeleteWorkspaceService(w, newWorkspaceUpdateRequest(http.MethodDelete, "", "", owner))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	// Deletion events are only queued by the sweeper
+	mockDB.AssertNotCalled(t, "EnqueueWorkspaceEvent", mock.Anything)
+	mockDB.AssertExpectations(t)
+}
+
+func TestRestoreWorkspaceService(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	mockKC := new(MockKeycloakClient)
+
+	svc := WorkspaceService{
+		DB: mockDB,
+		KC: mockKC,
+	}
+
+	owner := authn.Claims{Username: "owner"}
+	owner.Subject = "owner-id"
+
+	mockKC.On("GetUserGroups", "owner-id").Return([]string{"test-workspace"}, nil)
+	mockDB.On("IsUserAccountOwner", "owner", "test-workspace").Return(true, nil)
+	mockDB.On("CancelWorkspaceDeletion", "test-workspace").Return(true, nil).Once()
+	mockDB.On("GetWorkspace", "test-workspace").Return(&ws_manager.WorkspaceSettings{Name: "test-workspace", Status: "Ready"}, nil).Once()
+
+	w := httptest.NewRecorder()
+	svc.RestoreWorkspaceService(w, newWorkspaceUpdateRequest(http.MethodPost, "", "", owner))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Restoring a workspace that is not pending deletion is a conflict
+	mockDB.On("CancelWorkspaceDeletion", "test-workspace").Return(false, nil).Once()
+
+	w = httptest.NewRecorder()
+	svc.RestoreWorkspaceService(w, newWorkspaceUpdateRequest(http.MethodPost, "", "", owner))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestSweepWorkspaceDeletions(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+
+	svc := WorkspaceService{
+		DB: mockDB,
+	}
+
+	mockDB.On("EnqueueExpiredWorkspaceDeletions", deletionSweepBatchSize).Return([]string{"ws-one", "ws-two"}, nil).Once()
+
+	assert.NoError(t, svc.SweepWorkspaceDeletions(context.Background()))
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestCreateWorkspaceService_CompensatesFailedSteps(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	mockKC := new(MockKeycloakClient)
+
+	svc := WorkspaceService{
+		DB: mockDB,
+		KC: mockKC,
+	}
+
+	mockClaims := authn.Claims{Username: "testuser"}
+	mockClaims.Subject = "user-123"
+
+	workspacePayload := ws_manager.WorkspaceSettings{
+		Name:    "test-workspace",
+		Account: uuid.New(),
+	}
+	payloadBytes, _ := json.Marshal(workspacePayload)
+
+	mockDB.On("CheckAccountIsVerified", workspacePayload.Account).Return(true, AccountStatusApproved, nil).Once()
+	mockDB.On("CheckWorkspaceExists", workspacePayload.Name).Return(false, nil).Once()
+	mockDB.On("CreateWorkspaceSaga", mock.MatchedBy(func(saga *models.WorkspaceCreationSaga) bool {
+		return saga.Workspace == "test-workspace" && saga.OwnerID == "user-123" && saga.Status == SagaStatusRunning
+	})).Return(nil).Once()
+	mockKC.On("CreateGroup", workspacePayload.Name).Return(http.StatusCreated, nil).Once()
+	mockDB.On("UpdateWorkspaceSaga", mock.Anything, SagaStepGroupCreated, SagaStatusRunning, "").Return(nil).Once()
+
+	// Adding the owner fails, so the group must be deleted again
+	mockKC.On("GetGroup", workspacePayload.Name).Return(&models.Group{ID: "group-123"}, nil).Once()
+	mockKC.On("AddMemberToGroup", "user-123", "group-123").Return(fmt.Errorf("keycloak unavailable")).Once()
+	mockDB.On("UpdateWorkspaceSaga", mock.Anything, SagaStepGroupCreated, SagaStatusCompensating, mock.Anything).Return(nil).Once()
+	mockKC.On("DeleteGroup", workspacePayload.Name).Return(http.StatusNoContent, nil).Once()
+	mockDB.On("UpdateWorkspaceSaga", mock.Anything, SagaStepGroupCreated, SagaStatusCompensated, mock.Anything).Return(nil).Once()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/workspaces", bytes.NewReader(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req = req.WithContext(context.WithValue(req.Context(), middleware.ClaimsKey, mockClaims))
+
+	w := httptest.NewRecorder()
+	svc.CreateWorkspaceService(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	var problem Problem
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, CodeInternal, problem.Code)
+	mockDB.AssertExpectations(t)
+	mockKC.AssertExpectations(t)
+	mockDB.AssertNotCalled(t, "CreateWorkspace", mock.Anything)
+}
+
+func TestCreateWorkspaceService_GroupExists(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	mockKC := new(MockKeycloakClient)
+
+	svc := WorkspaceService{
+		DB: mockDB,
+		KC: mockKC,
+	}
+
+	mockClaims := authn.Claims{Username: "testuser"}
+	mockClaims.Subject = "user-123"
+
+	workspacePayload := ws_manager.WorkspaceSettings{
+		Name:    "test-workspace",
+		Account: uuid.New(),
+	}
+	payloadBytes, _ := json.Marshal(workspacePayload)
+
+	// Another creation of the same workspace has already made its group, which is left alone
+	mockDB.On("CheckAccountIsVerified", workspacePayload.Account).Return(true, AccountStatusApproved, nil).Once()
+	mockDB.On("CheckWorkspaceExists", workspacePayload.Name).Return(false, nil).Once()
+	mockDB.On("CreateWorkspaceSaga", mock.Anything).Return(nil).Once()
+	mockKC.On("CreateGroup", workspacePayload.Name).Return(http.StatusConflict, fmt.Errorf("group exists")).Once()
+	mockDB.On("UpdateWorkspaceSaga", mock.Anything, "", SagaStatusCompensating, mock.Anything).Return(nil).Once()
+	mockDB.On("UpdateWorkspaceSaga", mock.Anything, "", SagaStatusCompensated, mock.Anything).Return(nil).Once()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/workspaces", bytes.NewReader(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req = req.WithContext(context.WithValue(req.Context(), middleware.ClaimsKey, mockClaims))
+
+	w := httptest.NewRecorder()
+	svc.CreateWorkspaceService(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	var problem Problem
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, CodeWorkspaceExists, problem.Code)
+	mockDB.AssertExpectations(t)
+	mockKC.AssertNotCalled(t, "DeleteGroup", mock.Anything)
+	mockDB.AssertNotCalled(t, "CreateWorkspace", mock.Anything)
+}
+
+func TestRecoverWorkspaceCreationSaga(t *testing.T) {
+	mockDB := new(MockWorkspaceDB)
+	mockKC := new(MockKeycloakClient)
+
+	svc := WorkspaceService{
+		DB: mockDB,
+		KC: mockKC,
+	}
+	logger := zerolog.Nop()
+
+	// A saga whose workspace was stored is rolled forward
+	committed := models.WorkspaceCreationSaga{ID: uuid.New(), Workspace: "committed", Step: SagaStepOwnerAdded, Status: SagaStatusRunning}
+	mockDB.On("CheckAvailableWorkspaceExists", "committed").Return(true, nil).Once()
+	mockDB.On("UpdateWorkspaceSaga", committed.ID, SagaStepWorkspaceStored, SagaStatusCompleted, "").Return(nil).Once()
+
+	status, err := svc.RecoverWorkspaceCreationSaga(context.Background(), committed, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, SagaStatusCompleted, status)
+
+	// A saga whose workspace was never stored is cleaned up
+	crashed := models.WorkspaceCreationSaga{ID: uuid.New(), Workspace: "crashed", Step: SagaStepOwnerAdded, Status: SagaStatusRunning}
+	mockDB.On("CheckAvailableWorkspaceExists", "crashed").Return(false, nil).Once()
+	mockDB.On("UpdateWorkspaceSaga", crashed.ID, SagaStepOwnerAdded, SagaStatusCompensating, mock.Anything).Return(nil).Once()
+	mockKC.On("DeleteGroup", "crashed").Return(http.StatusNotFound, ErrGroupNotFound).Once()
+	mockDB.On("UpdateWorkspaceSaga", crashed.ID, SagaStepOwnerAdded, SagaStatusCompensated, mock.Anything).Return(nil).Once()
+
+	status, err = svc.RecoverWorkspaceCreationSaga(context.Background(), crashed, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, SagaStatusCompensated, status)
+
+	// The group is deleted even if its creation was not recorded
+	unrecorded := models.WorkspaceCreationSaga{ID: uuid.New(), Workspace: "unrecorded", Status: SagaStatusRunning}
+	mockDB.On("CheckAvailableWorkspaceExists", "unrecorded").Return(false, nil).Once()
+	mockDB.On("CheckNewerWorkspaceSagaExists", unrecorded.ID).Return(false, nil).Once()
+	mockDB.On("UpdateWorkspaceSaga", unrecorded.ID, "", SagaStatusCompensating, mock.Anything).Return(nil).Once()
+	mockKC.On("DeleteGroup", "unrecorded").Return(http.StatusNoContent, nil).Once()
+	mockDB.On("UpdateWorkspaceSaga", unrecorded.ID, "", SagaStatusCompensated, mock.Anything).Return(nil).Once()
+
+	status, err = svc.RecoverWorkspaceCreationSaga(context.Background(), unrecorded, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, SagaStatusCompensated, status)
+
+	mockDB.AssertExpectations(t)
+	mockKC.AssertExpectations(t)
+
+	// unless it may belong to a newer saga for the same name
+	superseded := models.WorkspaceCreationSaga{ID: uuid.New(), Workspace: "superseded", Status: SagaStatusRunning}
+	mockDB.On("CheckAvailableWorkspaceExists", "superseded").Return(false, nil).Once()
+	mockDB.On("CheckNewerWorkspaceSagaExists", superseded.ID).Return(true, nil).Once()
+	mockDB.On("UpdateWorkspaceSaga", superseded.ID, "", SagaStatusCompensating, mock.Anything).Return(nil).Once()
+	mockDB.On("UpdateWorkspaceSaga", superseded.ID, "", SagaStatusCompensated, mock.Anything).Return(nil).Once()
+
+	status, err = svc.RecoverWorkspaceCreationSaga(context.Background(), superseded, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, SagaStatusCompensated, status)
+	mockKC.AssertNotCalled(t, "DeleteGroup", "superseded")
+
+	// A deleted workspace of the same name does not complete the saga
+	replaced := models.WorkspaceCreationSaga{ID: uuid.New(), Workspace: "replaced", Step: SagaStepGroupCreated, Status: SagaStatusRunning}
+	mockDB.On("CheckAvailableWorkspaceExists", "replaced").Return(false, nil).Once()
+	mockDB.On("UpdateWorkspaceSaga", replaced.ID, SagaStepGroupCreated, SagaStatusCompensating, mock.Anything).Return(nil).Once()
+	mockKC.On("DeleteGroup", "replaced").Return(http.StatusNoContent, nil).Once()
+	mockDB.On("UpdateWorkspaceSaga", replaced.ID, SagaStepGroupCreated, SagaStatusCompensated, mock.Anything).Return(nil).Once()
+
+	status, err = svc.RecoverWorkspaceCreationSaga(context.Background(), replaced, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, SagaStatusCompensated, status)
+
+	mockDB.AssertExpectations(t)
+	mockKC.AssertExpectations(t)
 }
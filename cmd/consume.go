@@ -3,14 +3,23 @@ package cmd
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"time"
 
 	ws_manager "github.com/EO-DataHub/eodhp-workspace-manager/models"
 	"github.com/EO-DataHub/eodhp-workspace-services/internal/events"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/requestid"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/tracing"
+	"github.com/apache/pulsar-client-go/pulsar"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/gorilla/mux"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var consumeCmd = &cobra.Command{
@@ -20,6 +29,7 @@ var consumeCmd = &cobra.Command{
 
 		// Load the config, initialize the database and set up logging
 		commonSetUp()
+		defer flushTracing()
 
 		// Initialize event consumer
 		consumer, err := events.NewEventConsumer(appCfg.Pulsar.URL, appCfg.Pulsar.TopicConsumer, appCfg.Pulsar.Subscription)
@@ -28,126 +38,194 @@ var consumeCmd = &cobra.Command{
 		}
 		defer consumer.Close()
 
-		// Consume messages
-		for {
-			log.Info().Msg("Waiting for messages...")
-
-			msg, err := consumer.ReceiveMessage(context.Background())
-			if err != nil {
-				log.Error().Err(err).Msg("Error receiving message")
-				continue
+		// Stop receiving on SIGINT/SIGTERM, letting the message being processed finish
+		ctx, stop := signalContext()
+		defer stop()
+
+		// Serve the liveness and readiness probes
+		r := mux.NewRouter()
+		registerHealthRoutes(r, newHealthChecker(postgresCheck(), keycloakCheck(), pulsarCheck(consumer)), initializeTokenVerifier(appCfg.Keycloak), initializeAuthorizer(keycloakClient))
+		healthServer := newHTTPServer(fmt.Sprintf(":%d", healthPort), r, appCfg.Server)
+		go func() {
+			if err := healthServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.Error().Err(err).Msg("Health server failed")
 			}
+		}()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			consumeMessages(ctx, consumer)
+		}()
+
+		<-ctx.Done()
+		timeout := shutdownTimeout(appCfg.Server)
+		log.Info().Dur("timeout", timeout).Msg("Shutting down consumer")
+
+		select {
+		case <-done:
+			log.Info().Msg("Consumer stopped")
+		case <-time.After(timeout):
+			log.Warn().Msg("Shutdown window passed before the in-flight message was processed, it will be redelivered")
+		}
 
-			log.Info().Str("status", string(msg.Payload())).Msg("Received message")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := healthServer.Shutdown(shutdownCtx); err != nil {
+			log.Error().Err(err).Msg("Health server did not shut down cleanly")
+		}
+	},
+}
 
-			// Unmarshal the JSON message into WorkspaceStatus struct
-			var workspaceStatus ws_manager.WorkspaceStatus
-			err = json.Unmarshal([]byte(msg.Payload()), &workspaceStatus)
-			if err != nil {
-				log.Error().Err(err).Msg("Error unmarshaling JSON")
-				continue
-			}
+// consumeMessages receives and processes workspace status messages until ctx is cancelled.
+func consumeMessages(ctx context.Context, consumer *events.EventConsumer) {
+	for {
+		log.Info().Msg("Waiting for messages...")
 
-			if workspaceStatus.State == "Deleting" {
-				err := deleteWorkspace(workspaceStatus)
-				if err != nil {
-					log.Error().Err(err).Msg("Failed to delete workspace")
+		msg, err := consumer.ReceiveMessage(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("Error receiving message")
+			continue
+		}
 
-					// Nack the message if there is an error and attempt redelivery
-					consumer.Nack(msg)
-					continue
-				}
-				consumer.Ack(msg)
-			}
+		// Continue the trace and request ID of the sender, if it propagated them. Processing is not
+		// tied to ctx so that a message being handled at shutdown can finish.
+		msgCtx, span := tracing.Start(tracing.Extract(context.Background(), msg.Properties()),
+			"process "+msg.Topic(), trace.WithSpanKind(trace.SpanKindConsumer))
+		msgCtx = requestid.NewContext(msgCtx, msg.Properties()[requestid.Property])
+		handleStatusMessage(msgCtx, consumer, msg)
+		span.End()
+	}
+}
 
-			// Get the workspace from the database and check if the incoming status is newer
-			workspaceInDB, err := workspaceDB.GetWorkspace(workspaceStatus.Name)
+// handleStatusMessage applies a workspace status message to the database and acknowledges it.
+func handleStatusMessage(ctx context.Context, consumer *events.EventConsumer, msg pulsar.Message) {
+	log.Info().Str("status", string(msg.Payload())).Msg("Received message")
 
-			if err != nil {
-				log.Error().Err(err).Str("workspace_name", workspaceStatus.Name).Msg("Workspace not found")
+	// Unmarshal the JSON message into WorkspaceStatus struct
+	var workspaceStatus ws_manager.WorkspaceStatus
+	err := json.Unmarshal([]byte(msg.Payload()), &workspaceStatus)
+	if err != nil {
+		log.Error().Err(err).Msg("Error unmarshaling JSON")
+		return
+	}
 
-				// Acknowledge the message if the workspace is not found to discard it to prevent redelivery
-				consumer.Ack(msg)
-				continue
-			}
+	if workspaceStatus.State == "Deleting" {
+		err := deleteWorkspace(ctx, workspaceStatus)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to delete workspace")
 
-			// Update the workspace in the database if the incoming status is newer
-			if workspaceStatus.LastUpdated.After(workspaceInDB.LastUpdated) {
+			// Nack the message if there is an error and attempt redelivery
+			consumer.Nack(msg)
+			return
+		}
+		consumer.Ack(msg)
+	}
 
-				// If the namespace is empty, delete the workspace
-				if workspaceStatus.Namespace == "" {
+	// Get the workspace from the database and check if the incoming status is newer
+	workspaceInDB, err := workspaceDB.GetWorkspace(ctx, workspaceStatus.Name)
 
-					err := deleteWorkspace(workspaceStatus)
-					if err != nil {
-						log.Error().Err(err).Msg("Failed to delete workspace")
+	if err != nil {
+		log.Error().Err(err).Str("workspace_name", workspaceStatus.Name).Msg("Workspace not found")
 
-						// Nack the message if there is an error and attempt redelivery
-						consumer.Nack(msg)
-						continue
-					}
+		// Acknowledge the message if the workspace is not found to discard it to prevent redelivery
+		consumer.Ack(msg)
+		return
+	}
 
-				} else {
-					// Update the workspace status
-					err = workspaceDB.UpdateWorkspaceStatus(workspaceStatus)
-					if err != nil {
-						log.Error().Err(err).Msg("Failed to update workspace status")
+	// Update the workspace in the database if the incoming status is newer
+	if workspaceStatus.LastUpdated.After(workspaceInDB.LastUpdated) {
 
-						// Nack the message if there is an error and attempt redelivery
-						consumer.Nack(msg)
-						continue
-					}
-				}
+		// If the namespace is empty, delete the workspace
+		if workspaceStatus.Namespace == "" {
+
+			err := deleteWorkspace(ctx, workspaceStatus)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to delete workspace")
 
-				// Acknowledge the message if status is updated successfully
-				consumer.Ack(msg)
+				// Nack the message if there is an error and attempt redelivery
+				consumer.Nack(msg)
+				return
+			}
 
-			} else {
-				log.Warn().Msg("Incoming status is older")
+		} else {
+			// Update the workspace status
+			err = workspaceDB.UpdateWorkspaceStatus(ctx, workspaceStatus)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to update workspace status")
 
-				// Discard the message if incoming status is older
-				consumer.Ack(msg)
+				// Nack the message if there is an error and attempt redelivery
+				consumer.Nack(msg)
+				return
 			}
 		}
-	},
+
+		// Acknowledge the message if status is updated successfully
+		consumer.Ack(msg)
+
+	} else {
+		log.Warn().Msg("Incoming status is older")
+
+		// Discard the message if incoming status is older
+		consumer.Ack(msg)
+	}
 }
 
 // deleteWorkspace deletes a workspace by setting its status to 'Unavailable' in the database,
-// removing its Keycloak group, and deleting any lingering secrets in AWS Secrets Manager.
-func deleteWorkspace(wsStatus ws_manager.WorkspaceStatus) error {
+// removing its Keycloak group, and deleting any lingering secrets in AWS Secrets Manager. If its
+// account is closing and this was its last workspace, the account is deleted too.
+func deleteWorkspace(ctx context.Context, wsStatus ws_manager.WorkspaceStatus) error {
 
 	// Set the workspace as 'Unavailable' in the database
-	err := workspaceDB.DisableWorkspace(wsStatus.Name)
+	err := workspaceDB.DisableWorkspace(ctx, wsStatus.Name)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to delete workspace")
 		return err
 	}
 
 	// Get a token from keycloak so we can interact with it's API
-	err = keycloakClient.GetToken()
+	err = keycloakClient.GetToken(ctx)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to Authenticate with Keycloak")
 		return err
 	}
 
-	_, err = keycloakClient.DeleteGroup(wsStatus.Name)
-	if err != nil {
+	// Anything already removed by an earlier attempt is skipped, so that redelivered messages
+	// can finish the deletion
+	status, err := keycloakClient.DeleteGroup(ctx, wsStatus.Name)
+	if err != nil && status != http.StatusNotFound {
 		log.Error().Err(err).Msg("Failed to delete Keycloak group")
 		return err
 	}
 
 	// Remove any lingering secret from AWS Secrets Manager
-	_, err = secretsManagerClient.DeleteSecret(context.Background(), &secretsmanager.DeleteSecretInput{
+	_, err = secretsManagerClient.DeleteSecret(ctx, &secretsmanager.DeleteSecretInput{
 		SecretId:                   aws.String(fmt.Sprintf("ws-%s", wsStatus.Name)),
 		ForceDeleteWithoutRecovery: aws.Bool(true),
 	})
-	if err != nil {
+	var notFound *types.ResourceNotFoundException
+	if err != nil && !errors.As(err, &notFound) {
 		log.Error().Err(err).Msg("Failed to delete AWS Secret manager secret")
 		return err
 	}
 
+	// A closing account is deleted with its last workspace
+	closed, err := workspaceDB.FinishAccountClosure(ctx, wsStatus.Name)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to delete closed account")
+		return err
+	}
+	if closed {
+		log.Info().Str("workspace_name", wsStatus.Name).Msg("Deleted closed account of last workspace")
+	}
+
 	return nil
 }
 
 func init() {
 	rootCmd.AddCommand(consumeCmd)
+	consumeCmd.Flags().IntVar(&healthPort, "health-port", 8081, "port to serve the health and metrics endpoints on")
 }
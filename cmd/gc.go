@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/EO-DataHub/eodhp-workspace-services/api/services"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var (
+	gcDelete bool
+	gcMinAge time.Duration
+	gcReport string
+)
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Report and optionally delete Keycloak groups and secrets left behind by deleted workspaces",
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// Load the config, initialize the database, keycloak, AWS Secrets Manager and set up logging
+		commonSetUp()
+		defer flushTracing()
+
+		// Get a token from keycloak so we can interact with it's API
+		if err := keycloakClient.GetToken(context.Background()); err != nil {
+			log.Fatal().Err(err).Msg("Failed to Authenticate with Keycloak")
+		}
+
+		k8sClient, err := initializeK8sClient()
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to initialize Kubernetes client")
+		}
+
+		gcService := &services.GarbageCollectService{
+			DB:             workspaceDB,
+			KC:             keycloakClient,
+			SecretsManager: secretsManagerClient,
+			K8sClient:      k8sClient,
+			ClusterPrefix:  os.Getenv("CLUSTER_PREFIX"),
+		}
+
+		logger := log.Logger
+		report, err := gcService.Collect(context.Background(), gcMinAge, gcDelete, &logger)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to collect orphaned resources")
+		}
+
+		out := os.Stdout
+		if gcReport != "-" {
+			out, err = os.Create(gcReport)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Failed to create report file")
+			}
+			defer out.Close()
+		}
+
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			log.Fatal().Err(err).Msg("Failed to write report")
+		}
+
+		log.Info().Int("orphaned", len(report.Resources)).Bool("delete", gcDelete).Msg("Garbage collection completed")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(gcCmd)
+	gcCmd.Flags().BoolVar(&gcDelete, "delete", false, "delete the orphaned resources instead of only reporting them")
+	gcCmd.Flags().DurationVar(&gcMinAge, "min-age", 24*time.Hour, "only collect resources last modified longer ago than this")
+	gcCmd.Flags().StringVar(&gcReport, "report", "-", "file to write the JSON report to, - for stdout")
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/EO-DataHub/eodhp-workspace-services/api/handlers"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authz"
+	awsclient "github.com/EO-DataHub/eodhp-workspace-services/internal/aws"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/health"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/metrics"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gorilla/mux"
+)
+
+// newHealthChecker creates a checker for the given dependency checks using the configured timeout and cache TTL.
+func newHealthChecker(checks ...health.Check) *health.Checker {
+	return health.NewChecker(
+		time.Duration(appCfg.Health.CheckTimeoutSeconds)*time.Second,
+		time.Duration(appCfg.Health.CacheTTLSeconds)*time.Second,
+		checks...,
+	)
+}
+
+// registerHealthRoutes adds the liveness, readiness and metrics endpoints to r. They sit outside
+// the API middleware so that probes and scrapers do not need a token.
+func registerHealthRoutes(r *mux.Router, checker *health.Checker, verifier authn.TokenVerifier, authorizer authz.Authorizer) {
+	r.HandleFunc("/healthz", handlers.Healthz()).Methods(http.MethodGet)
+	r.HandleFunc("/readyz", handlers.Readyz(checker, verifier, authorizer)).Methods(http.MethodGet)
+	r.Handle("/metrics", metrics.Handler()).Methods(http.MethodGet)
+}
+
+func postgresCheck() health.Check {
+	return health.Check{Name: "postgres", Run: workspaceDB.DB.PingContext}
+}
+
+func keycloakCheck() health.Check {
+	return health.Check{Name: "keycloak", Run: keycloakClient.CheckTokenEndpoint}
+}
+
+func pulsarCheck(pinger interface{ Ping(context.Context) error }) health.Check {
+	return health.Check{Name: "pulsar", Run: pinger.Ping}
+}
+
+// s3Check checks that the workspaces bucket can be reached. The service's own credentials may
+// not be allowed to access the bucket, so any response other than a server error counts.
+func s3Check() health.Check {
+	client := awsclient.NewS3ClientWithEndpoint(awsCfg, appCfg.AWS.S3.Endpoint, appCfg.AWS.S3.ForcePathStyle)
+
+	return health.Check{Name: "s3", Run: func(ctx context.Context) error {
+		_, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(appCfg.AWS.S3.Bucket)})
+
+		var respErr *awshttp.ResponseError
+		if errors.As(err, &respErr) && respErr.HTTPStatusCode() < http.StatusInternalServerError {
+			return nil
+		}
+		return err
+	}}
+}
+
+// blockStoreCheck checks that the block store nginx responds. Requests without a path are not
+// expected to succeed, so any response other than a server error counts.
+func blockStoreCheck() health.Check {
+	return health.Check{Name: "block-store", Run: func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, appCfg.Files.BlockBaseURL, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("block store returned status %d", resp.StatusCode)
+		}
+		return nil
+	}}
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/EO-DataHub/eodhp-workspace-services/api/services"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/appconfig"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authz"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var (
+	policyPath     string
+	policyRequests string
+)
+
+var policyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Work with the authorization policy",
+}
+
+var policyTestCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Evaluate sample requests against the authorization policy",
+	Run: func(cmd *cobra.Command, args []string) {
+
+		setLogging(logLevel)
+
+		// Use the policy given on the command line, otherwise the one the config points to
+		path := policyPath
+		if path == "" {
+			cfg, err := appconfig.LoadConfig(configPath)
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to load config")
+			}
+			path = cfg.AuthorizationPolicy
+		}
+
+		policy, err := authz.LoadPolicy(path)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to load authorization policy")
+		}
+
+		data, err := os.ReadFile(policyRequests)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to read sample requests")
+		}
+		cases, err := authz.ParseCases(data)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid sample requests")
+		}
+
+		results, err := authz.EvaluateCases(context.Background(), policy, cases)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to evaluate sample requests")
+		}
+
+		if failed := printPolicyResults(results); failed > 0 {
+			log.Fatal().Int("failed", failed).Msg("Some requests did not get the expected decision")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(policyCmd)
+	policyCmd.AddCommand(policyTestCmd)
+	policyTestCmd.Flags().StringVar(&policyPath, "policy", "", "policy file to test (defaults to the one in the config, or the built-in policy)")
+	policyTestCmd.Flags().StringVar(&policyRequests, "requests", "config/policy-tests.yaml", "file of sample requests and their expected decisions")
+}
+
+// initializeAuthorizer creates the authorizer for the configured policy, looking up workspace
+// roles with kc.
+func initializeAuthorizer(kc services.KeycloakClientInterface) authz.Authorizer {
+	policy, err := authz.LoadPolicy(appCfg.AuthorizationPolicy)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load authorization policy")
+	}
+	return services.NewAuthorizer(policy, workspaceDB, kc)
+}
+
+// printPolicyResults writes the decision for each sample request to stdout as a table and
+// returns the number that did not get the expected decision.
+func printPolicyResults(results []authz.CaseResult) int {
+	failed := 0
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESULT\tDECISION\tACTION\tSUBJECT\tRESOURCE\tREASON\tNAME")
+	for _, result := range results {
+		outcome := "PASS"
+		if !result.Passed {
+			outcome = "FAIL"
+			failed++
+		}
+
+		decision := "deny"
+		if result.Decision.Allowed {
+			decision = "allow"
+		}
+
+		reason := result.Decision.Reason
+		if result.Decision.Rule != "" {
+			reason = fmt.Sprintf("%s (%s)", reason, result.Decision.Rule)
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", outcome, decision, result.Case.Action,
+			describeSubject(result.Case), describeResource(result.Case.Resource), reason, result.Case.Name)
+	}
+	tw.Flush()
+
+	return failed
+}
+
+// describeSubject summarises the user of a sample request.
+func describeSubject(c authz.Case) string {
+	parts := []string{c.Subject.Username}
+	if len(c.Subject.RealmRoles) > 0 {
+		parts = append(parts, "roles="+strings.Join(c.Subject.RealmRoles, ","))
+	}
+	if c.WorkspaceRole != "" {
+		parts = append(parts, "role="+c.WorkspaceRole)
+	}
+	if c.Subject.Workspace != "" {
+		parts = append(parts, "scoped="+c.Subject.Workspace)
+	}
+	if c.AccountStatus != "" {
+		parts = append(parts, "account="+c.AccountStatus)
+	}
+	if c.WorkspaceSuspended {
+		parts = append(parts, "suspended")
+	}
+	return strings.Join(parts, " ")
+}
+
+// describeResource summarises the resource of a sample request.
+func describeResource(resource authz.Resource) string {
+	var parts []string
+	if resource.Workspace != "" {
+		parts = append(parts, "workspace="+resource.Workspace)
+	}
+	if resource.Owner != "" {
+		parts = append(parts, "owner="+resource.Owner)
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/EO-DataHub/eodhp-workspace-services/api/middleware"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/appconfig"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authz"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/ratelimit"
+	"github.com/rs/zerolog/log"
+)
+
+// Route groups that rate limits can be configured for.
+const (
+	rateLimitGroupS3Tokens   = "s3Tokens"
+	rateLimitGroupSessions   = "sessions"
+	rateLimitGroupFiles      = "files"
+	rateLimitGroupDataLoader = "dataLoader"
+)
+
+var rateLimitGroups = []string{rateLimitGroupS3Tokens, rateLimitGroupSessions, rateLimitGroupFiles, rateLimitGroupDataLoader}
+
+// rateLimiter applies the limits configured for each route group.
+type rateLimiter struct {
+	store      ratelimit.Store
+	groups     map[string]appconfig.RateLimitGroupConfig
+	authorizer authz.Authorizer
+}
+
+// newRateLimiter creates a rate limiter using the configured store. Buckets are kept in memory
+// unless the store is "postgres", which shares them between replicas. Workspace limits only
+// count requests from users authorizer finds have a role in the workspace.
+func newRateLimiter(cfg appconfig.RateLimitConfig, authorizer authz.Authorizer) *rateLimiter {
+	var store ratelimit.Store
+	switch strings.ToLower(cfg.Store) {
+	case "", "memory":
+		store = ratelimit.NewMemoryStore()
+	case "postgres":
+		store = workspaceDB.RateLimitStore()
+	default:
+		log.Fatal().Str("store", cfg.Store).Msg("Unsupported rate limit store")
+	}
+
+	for group := range cfg.Groups {
+		if !slices.Contains(rateLimitGroups, group) {
+			log.Warn().Str("group", group).Strs("groups", rateLimitGroups).Msg("Ignoring rate limits for unknown route group")
+		}
+	}
+
+	return &rateLimiter{store: store, groups: cfg.Groups, authorizer: authorizer}
+}
+
+// limit wraps h in the limits of group. Routes in groups without configured limits are not limited.
+func (l *rateLimiter) limit(group string, h http.Handler) http.Handler {
+	cfg, ok := l.groups[group]
+	if !ok {
+		return h
+	}
+
+	return middleware.RateLimit(l.store, group,
+		ratelimit.PerMinute(cfg.User.RequestsPerMinute, cfg.User.Burst),
+		ratelimit.PerMinute(cfg.Workspace.RequestsPerMinute, cfg.Workspace.Burst),
+		l.authorizer,
+	)(h)
+}
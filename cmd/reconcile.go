@@ -1,67 +1,160 @@
 package cmd
 
 import (
-	ws_manager "github.com/EO-DataHub/eodhp-workspace-manager/models"
-	"github.com/EO-DataHub/eodhp-workspace-services/internal/events"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/EO-DataHub/eodhp-workspace-services/api/services"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	reconcileDryRun     bool
+	reconcileApply      []string
+	reconcileWorkspaces []string
+	reconcileYes        bool
 )
 
+var reconcileActions = []string{services.ReconcileActionCreate, services.ReconcileActionUpdate, services.ReconcileActionOrphan}
+
 var reconcileCmd = &cobra.Command{
 	Use:   "reconcile",
-	Short: "If the workspace exists in the database but not in Kubernetes, create it",
+	Short: "Compare workspaces in the database with Kubernetes and Keycloak, and optionally fix the differences",
 	Run: func(cmd *cobra.Command, args []string) {
 
-		// Load the config, initialize the database and set up logging
+		if reconcileDryRun && len(reconcileApply) > 0 {
+			log.Fatal().Msg("--dry-run and --apply cannot be used together")
+		}
+		actions, err := parseReconcileActions(reconcileApply)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid --apply value")
+		}
+
+		// Load the config, initialize the database, keycloak and set up logging
 		commonSetUp()
+		defer flushTracing()
+
+		// Get a token from keycloak so we can interact with it's API
+		if err := keycloakClient.GetToken(context.Background()); err != nil {
+			log.Fatal().Err(err).Msg("Failed to Authenticate with Keycloak")
+		}
 
-		// Initialize event publisher
-		publisher, err := events.NewEventPublisher(appCfg.Pulsar.URL, appCfg.Pulsar.TopicProducer)
+		k8sConfig, err := initializeK8sConfig()
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to load Kubernetes config")
+		}
+		k8sClient, err := kubernetes.NewForConfig(k8sConfig)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to create Kubernetes client")
+		}
+		dynamicClient, err := dynamic.NewForConfig(k8sConfig)
 		if err != nil {
-			log.Fatal().Err(err).Msg("Failed to initialize event publisher")
+			log.Fatal().Err(err).Msg("Failed to create Kubernetes dynamic client")
 		}
-		defer publisher.Close()
 
-		// Get all the workspaces from the database
-		workspaces, err := workspaceDB.GetAllWorkspaces()
+		reconcileService := &services.ReconcileService{
+			DB:        workspaceDB,
+			KC:        keycloakClient,
+			K8sClient: k8sClient,
+			Dynamic:   dynamicClient,
+		}
+
+		ctx := context.Background()
+		plan, err := reconcileService.Plan(ctx, reconcileWorkspaces)
 		if err != nil {
-			log.Fatal().Err(err).Msg("Error fetching workspace names")
+			log.Fatal().Err(err).Msg("Failed to build reconcile plan")
 		}
 
-		log.Info().Msg("Starting reconciliation process...")
-
-		// Iterate through each workspace and send its settings
-		for _, workspaceName := range workspaces {
-			log.Info().Msgf("Publishing workspace settings for: %s", workspaceName)
-
-			// Construct minimal workspace settings
-			wsSettings := ws_manager.WorkspaceSettings{
-				Name:   workspaceName,
-				Status: "creating",
-				Stores: &[]ws_manager.Stores{
-					{
-						Object: []ws_manager.ObjectStore{
-							{Name: workspaceName + "-object-store"},
-						},
-						Block: []ws_manager.BlockStore{
-							{Name: "block-store"},
-						},
-					},
-				},
-			}
+		printReconcilePlan(plan)
 
-			err = publisher.Publish(wsSettings)
-			if err != nil {
-				log.Error().Err(err).Msgf("Failed to publish workspace settings for: %s", workspaceName)
-			} else {
-				log.Info().Msgf("Successfully published workspace settings for: %s", workspaceName)
-			}
+		if len(actions) == 0 {
+			log.Info().Msg("Dry run, no changes applied. Use --apply to act on the plan")
+			return
 		}
 
-		log.Info().Msg("Workspace publishing process completed.")
+		// Changes are only made once the operator has seen the plan and agreed to it
+		if !reconcileYes && !confirmReconcile(plan, actions, os.Stdin) {
+			log.Info().Msg("Reconcile plan not confirmed, no changes applied")
+			return
+		}
+
+		logger := log.Logger
+		if failed := reconcileService.Apply(ctx, plan, actions, &logger); failed > 0 {
+			log.Fatal().Int("failed", failed).Msg("Some reconcile changes could not be applied")
+		}
+		log.Info().Strs("actions", actions).Msg("Reconcile plan applied")
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(reconcileCmd)
+	reconcileCmd.Flags().BoolVar(&reconcileDryRun, "dry-run", false, "only print the plan (the default when --apply is not set)")
+	reconcileCmd.Flags().StringSliceVar(&reconcileApply, "apply", nil, "apply the planned changes of these kinds: create, update, orphan or all")
+	reconcileCmd.Flags().StringSliceVar(&reconcileWorkspaces, "workspace", nil, "only reconcile these workspaces")
+	reconcileCmd.Flags().BoolVar(&reconcileYes, "yes", false, "apply the changes without asking for confirmation")
+}
+
+// confirmReconcile asks whether to apply the selected changes of the plan, reading the answer from
+// in. Anything but yes, including no answer at all, declines.
+func confirmReconcile(plan *services.ReconcilePlan, actions []string, in io.Reader) bool {
+	selected := 0
+	for _, change := range plan.Changes {
+		for _, action := range actions {
+			if change.Action == action {
+				selected++
+			}
+		}
+	}
+	if selected == 0 {
+		return false
+	}
+
+	fmt.Printf("Apply %d %v changes? [y/N]: ", selected, actions)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// parseReconcileActions validates the kinds of change passed to --apply.
+func parseReconcileActions(values []string) ([]string, error) {
+	var actions []string
+	for _, value := range values {
+		if value == "all" {
+			return reconcileActions, nil
+		}
+		valid := false
+		for _, action := range reconcileActions {
+			if value == action {
+				valid = true
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("unknown change kind %q, expected one of %v or all", value, reconcileActions)
+		}
+		actions = append(actions, value)
+	}
+	return actions, nil
+}
+
+// printReconcilePlan writes the plan to stdout as a table.
+func printReconcilePlan(plan *services.ReconcilePlan) {
+	if len(plan.Changes) == 0 {
+		fmt.Println("Nothing to reconcile")
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACTION\tRESOURCE\tNAME\tREASON")
+	for _, change := range plan.Changes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", change.Action, change.Resource, change.Name, change.Reason)
+	}
+	tw.Flush()
 }
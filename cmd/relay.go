@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/appconfig"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/events"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var relayCmd = &cobra.Command{
+	Use:   "relay",
+	Short: "Publish workspace events from the database outbox to Pulsar",
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// Load the config, initialize the database and set up logging
+		commonSetUp()
+		defer flushTracing()
+
+		// Initialize event publisher
+		publisher, err := events.NewEventPublisher(appCfg.Pulsar.URL, appCfg.Pulsar.TopicProducer)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to initialize event publisher")
+		}
+		defer publisher.Close()
+
+		ctx, stop := signalContext()
+		defer stop()
+
+		log.Info().Msg("Starting outbox relay...")
+		initializeOutboxRelay(appCfg.Pulsar, publisher).Run(ctx)
+		log.Info().Msg("Outbox relay stopped")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(relayCmd)
+}
+
+// initializeOutboxRelay creates a relay that publishes events from the workspace database outbox.
+func initializeOutboxRelay(pulsarCfg appconfig.PulsarConfig, publisher events.Publisher) *events.Relay {
+	return events.NewRelay(workspaceDB, publisher, events.RelayConfig{
+		PollInterval: time.Duration(pulsarCfg.OutboxPollIntervalSeconds) * time.Second,
+		BatchSize:    pulsarCfg.OutboxBatchSize,
+		MaxBackoff:   time.Duration(pulsarCfg.OutboxMaxBackoffSeconds) * time.Second,
+	})
+}
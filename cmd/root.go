@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -9,7 +10,9 @@ import (
 	"github.com/EO-DataHub/eodhp-workspace-services/api/services"
 	"github.com/EO-DataHub/eodhp-workspace-services/db"
 	"github.com/EO-DataHub/eodhp-workspace-services/internal/appconfig"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
 	awsclient "github.com/EO-DataHub/eodhp-workspace-services/internal/aws"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/tracing"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/rs/zerolog"
@@ -21,12 +24,15 @@ var (
 	logLevel             string
 	host                 string
 	port                 int
+	healthPort           int
+	withRelay            bool
 	configPath           string
 	appCfg               *appconfig.Config
 	workspaceDB          *db.WorkspaceDB
 	keycloakClient       *services.KeycloakClient
 	secretsManagerClient *secretsmanager.Client
 	awsCfg               aws.Config
+	shutdownTracing      func(context.Context) error
 )
 
 var rootCmd = &cobra.Command{
@@ -59,6 +65,12 @@ func commonSetUp() {
 		log.Fatal().Err(err).Msg("failed to load config")
 	}
 
+	// Set up tracing before any clients are created so that their calls are traced
+	shutdownTracing, err = tracing.Init(context.Background(), appCfg.Tracing)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize tracing")
+	}
+
 	// Initialize WorkspaceDB
 	err = initializeDatabase()
 	if err != nil {
@@ -106,6 +118,47 @@ func initializeKeycloakClient(kcCfg appconfig.KeycloakConfig) *services.Keycloak
 	return keycloakClient
 }
 
+// Defaults for the cache of each user's Keycloak groups.
+const (
+	defaultGroupCacheTTL  = 30 * time.Second
+	defaultGroupCacheSize = 10000
+)
+
+// newGroupCachingKeycloakClient wraps the Keycloak client in a cache of each user's groups,
+// unless the cache is disabled with a negative TTL.
+func newGroupCachingKeycloakClient(kcCfg appconfig.KeycloakConfig) services.KeycloakClientInterface {
+	if kcCfg.GroupCacheTTLSeconds < 0 {
+		return keycloakClient
+	}
+
+	ttl := defaultGroupCacheTTL
+	if kcCfg.GroupCacheTTLSeconds > 0 {
+		ttl = time.Duration(kcCfg.GroupCacheTTLSeconds) * time.Second
+	}
+	size := defaultGroupCacheSize
+	if kcCfg.GroupCacheSize > 0 {
+		size = kcCfg.GroupCacheSize
+	}
+
+	return services.NewGroupCachingKeycloakClient(keycloakClient, ttl, size)
+}
+
+// initializeTokenVerifier creates a verifier for bearer tokens signed by the Keycloak realm.
+func initializeTokenVerifier(kcCfg appconfig.KeycloakConfig) *authn.JWKSVerifier {
+	issuer := kcCfg.Issuer
+	if issuer == "" {
+		issuer = authn.KeycloakIssuer(kcCfg.URL, kcCfg.Realm)
+	}
+
+	return authn.NewJWKSVerifier(authn.VerifierConfig{
+		JWKSURL:   authn.KeycloakJWKSURL(kcCfg.URL, kcCfg.Realm),
+		Issuer:    issuer,
+		Audience:  kcCfg.Audience,
+		ClockSkew: time.Duration(kcCfg.ClockSkewSeconds) * time.Second,
+		CacheTTL:  time.Duration(kcCfg.JWKSCacheTTLSeconds) * time.Second,
+	})
+}
+
 func setLogging(level string) {
 	zerolog.TimestampFunc = func() time.Time {
 		return time.Now().UTC()
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/EO-DataHub/eodhp-workspace-services/api/services"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var (
+	sagaOlderThan time.Duration
+	sagaDryRun    bool
+)
+
+var sagaCmd = &cobra.Command{
+	Use:   "saga",
+	Short: "Manage workspace creation sagas",
+}
+
+var sagaRecoverCmd = &cobra.Command{
+	Use:   "recover",
+	Short: "Resume or clean up workspace creations left unfinished by a crashed process",
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// Load the config, initialize the database, keycloak and set up logging
+		commonSetUp()
+		defer flushTracing()
+
+		sagas, err := workspaceDB.GetUnfinishedWorkspaceSagas(context.Background(), sagaOlderThan)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to retrieve unfinished workspace creation sagas")
+		}
+
+		if len(sagas) == 0 {
+			log.Info().Msg("No unfinished workspace creation sagas")
+			return
+		}
+
+		if sagaDryRun {
+			for _, saga := range sagas {
+				log.Info().Str("saga_id", saga.ID.String()).Str("workspace_name", saga.Workspace).
+					Str("step", saga.Step).Str("status", saga.Status).Time("updated_at", saga.UpdatedAt).
+					Msg("Unfinished workspace creation saga")
+			}
+			return
+		}
+
+		// Get a token from keycloak so we can interact with it's API
+		if err := keycloakClient.GetToken(context.Background()); err != nil {
+			log.Fatal().Err(err).Msg("Failed to Authenticate with Keycloak")
+		}
+
+		workspaceService := &services.WorkspaceService{
+			Config: appCfg,
+			DB:     workspaceDB,
+			KC:     keycloakClient,
+		}
+
+		for _, saga := range sagas {
+			logger := log.With().Str("saga_id", saga.ID.String()).Str("workspace_name", saga.Workspace).Logger()
+
+			status, err := workspaceService.RecoverWorkspaceCreationSaga(context.Background(), saga, &logger)
+			if err != nil {
+				logger.Error().Err(err).Msg("Failed to recover workspace creation saga")
+				continue
+			}
+
+			logger.Info().Str("previous_step", saga.Step).Str("status", status).Msg("Recovered workspace creation saga")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sagaCmd)
+	sagaCmd.AddCommand(sagaRecoverCmd)
+	sagaRecoverCmd.Flags().DurationVar(&sagaOlderThan, "older-than", 10*time.Minute, "only recover sagas that have not progressed for this long")
+	sagaRecoverCmd.Flags().BoolVar(&sagaDryRun, "dry-run", false, "list unfinished sagas without recovering them")
+}
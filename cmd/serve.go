@@ -1,10 +1,13 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"path"
+	"sync"
 
 	"github.com/EO-DataHub/eodhp-workspace-services/api/handlers"
 	"github.com/EO-DataHub/eodhp-workspace-services/api/middleware"
@@ -12,6 +15,7 @@ import (
 	docs "github.com/EO-DataHub/eodhp-workspace-services/docs"
 	awsclient "github.com/EO-DataHub/eodhp-workspace-services/internal/aws"
 	"github.com/EO-DataHub/eodhp-workspace-services/internal/events"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/health"
 	"github.com/gorilla/mux"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
@@ -35,13 +39,34 @@ var serveCmd = &cobra.Command{
 
 		// Load the config, initialize the database, keycloak, AWS Secrets Manager and set up logging
 		commonSetUp()
+		defer flushTracing()
 
-		// Initialize event publisher
-		publisher, err := events.NewEventPublisher(appCfg.Pulsar.URL, appCfg.Pulsar.TopicProducer)
-		if err != nil {
-			log.Fatal().Err(err).Msg("Failed to initialize event publisher")
+		// Stop background work and drain requests on SIGINT/SIGTERM
+		ctx, stop := signalContext()
+		defer stop()
+
+		// Background workers are waited for before the clients they use are closed
+		var workers sync.WaitGroup
+		defer workers.Wait()
+
+		// Dependencies checked by the readiness endpoint
+		checks := []health.Check{postgresCheck(), keycloakCheck(), s3Check()}
+		if appCfg.Files.BlockBaseURL != "" {
+			checks = append(checks, blockStoreCheck())
+		}
+
+		// Publish queued workspace events, unless a separate relay process does so
+		if withRelay {
+			publisher, err := events.NewEventPublisher(appCfg.Pulsar.URL, appCfg.Pulsar.TopicProducer)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Failed to initialize event publisher")
+			}
+			checks = append(checks, pulsarCheck(publisher))
+
+			// Closes the publisher only once the relay has finished the event it is publishing
+			waitForRelay := initializeOutboxRelay(appCfg.Pulsar, publisher).Start(ctx)
+			defer waitForRelay()
 		}
-		defer publisher.Close()
 
 		// Initialize Kubernetes client (optional in local dev)
 		k8sClient, err := initializeK8sClient()
@@ -51,11 +76,14 @@ var serveCmd = &cobra.Command{
 
 		// Shared clients/services
 		sts_client := awsclient.NewSTSClient(awsCfg)
+		kc := newGroupCachingKeycloakClient(appCfg.Keycloak)
+		authorizer := initializeAuthorizer(kc)
 		fileService := &services.FileService{
-			Config: appCfg,
-			DB:     workspaceDB,
-			KC:     keycloakClient,
-			STS:    sts_client,
+			Config:     appCfg,
+			DB:         workspaceDB,
+			KC:         kc,
+			STS:        sts_client,
+			Authorizer: authorizer,
 		}
 
 		// Create routes
@@ -71,18 +99,33 @@ var serveCmd = &cobra.Command{
 			httpSwagger.DomID("swagger-ui"),
 		)).Methods(http.MethodGet)
 
+		// Trace and record the latency of every route, including those of subrouters
+		r.Use(middleware.Tracing)
+		r.Use(middleware.Metrics)
+
+		// Liveness and readiness probes, and metrics
+		verifier := initializeTokenVerifier(appCfg.Keycloak)
+		registerHealthRoutes(r, newHealthChecker(checks...), verifier, authorizer)
+
 		// Register the API routes
 		api := r.PathPrefix(appCfg.BasePath).Subrouter()
 
 		// Apply the middleware to the API routes
+		jwtMiddleware := middleware.JWTMiddleware(verifier)
 		api.Use(middleware.WithLogger)
-		api.Use(middleware.JWTMiddleware)
+		api.Use(jwtMiddleware)
+
+		// Per-user and per-workspace limits for route groups that are expensive to serve
+		limiter := newRateLimiter(appCfg.RateLimits, authorizer)
+
+		sesClient := awsclient.NewSESClient(awsCfg)
 
 		workspaceService := &services.WorkspaceService{
-			Config:    appCfg,
-			DB:        workspaceDB,
-			Publisher: publisher,
-			KC:        keycloakClient,
+			Config:         appCfg,
+			DB:             workspaceDB,
+			KC:             kc,
+			AWSEmailClient: sesClient,
+			Authorizer:     authorizer,
 		}
 
 		// Workspace routes
@@ -92,6 +135,14 @@ var serveCmd = &cobra.Command{
 		api.HandleFunc("/workspaces/{workspace-id}", handlers.UpdateWorkspace(workspaceService)).Methods(http.MethodPut)
 		api.HandleFunc("/workspaces/{workspace-id}", handlers.PatchWorkspace(workspaceService)).Methods(http.MethodPatch)
 		api.HandleFunc("/workspaces/{workspace-id}", handlers.DeleteWorkspace(workspaceService)).Methods(http.MethodDelete)
+		api.HandleFunc("/workspaces/{workspace-id}/restore", handlers.RestoreWorkspace(workspaceService)).Methods(http.MethodPost)
+
+		// Queue deletion events for workspaces whose grace period has passed
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			workspaceService.RunDeletionSweeper(ctx)
+		}()
 
 		// Workspace management routes
 		api.HandleFunc("/workspaces/{workspace-id}/users", handlers.GetUsers(workspaceService)).Methods(http.MethodGet)
@@ -99,43 +150,67 @@ var serveCmd = &cobra.Command{
 		api.HandleFunc("/workspaces/{workspace-id}/users/{username}", handlers.GetUser(workspaceService)).Methods(http.MethodGet)
 		api.HandleFunc("/workspaces/{workspace-id}/users/{username}", handlers.RemoveUser(workspaceService)).Methods(http.MethodDelete)
 
+		// Workspace invitation routes
+		api.HandleFunc("/workspaces/{workspace-id}/invitations", handlers.CreateInvitation(workspaceService)).Methods(http.MethodPost)
+		api.HandleFunc("/workspaces/{workspace-id}/invitations", handlers.GetInvitations(workspaceService)).Methods(http.MethodGet)
+		api.HandleFunc("/workspaces/{workspace-id}/invitations/{invitation-id}", handlers.RevokeInvitation(workspaceService)).Methods(http.MethodDelete)
+
+		// The link in the invitation email opens a page that accepts or declines with a POST
+		invitationRouter := api.PathPrefix("/invitations").Subrouter()
+		invitationRouter.HandleFunc("/{token}", handlers.InvitationPage(workspaceService)).Methods(http.MethodGet)
+		invitationRouter.HandleFunc("/{token}/accept", handlers.AcceptInvitation(workspaceService)).Methods(http.MethodPost)
+		invitationRouter.HandleFunc("/{token}/decline", handlers.DeclineInvitation(workspaceService)).Methods(http.MethodPost)
+
 		// Account routes
 		billingAccountService := &services.BillingAccountService{
 			Config:         appCfg,
 			DB:             workspaceDB,
-			AWSEmailClient: awsclient.NewSESClient(awsCfg),
-			KC:             keycloakClient,
+			AWSEmailClient: sesClient,
+			KC:             kc,
+			Authorizer:     authorizer,
 		}
 		accountRouter := api.PathPrefix("/accounts").Subrouter()
-		accountRouter.Use(middleware.DenyWorkspaceScopedTokens)
-
 		accountRouter.HandleFunc("", handlers.CreateAccount(billingAccountService)).Methods(http.MethodPost)
 		accountRouter.HandleFunc("", handlers.GetAccounts(billingAccountService)).Methods(http.MethodGet)
 		accountRouter.HandleFunc("/{account-id}", handlers.GetAccount(billingAccountService)).Methods(http.MethodGet)
 		accountRouter.HandleFunc("/{account-id}", handlers.DeleteAccount(billingAccountService)).Methods(http.MethodDelete)
 		accountRouter.HandleFunc("/{account-id}", handlers.UpdateAccount(billingAccountService)).Methods(http.MethodPut)
 
-		accountAdminRouter := accountRouter.PathPrefix("/admin").Subrouter()
-		accountAdminRouter.Use(middleware.WithLogger)
-		accountAdminRouter.Use(middleware.JWTMiddleware)
-		accountAdminRouter.HandleFunc("/approve/{token}", handlers.AccountStatusHandler(billingAccountService, services.AccountStatusApproved)).Methods(http.MethodGet)
-		accountAdminRouter.HandleFunc("/deny/{token}", handlers.AccountStatusHandler(billingAccountService, services.AccountStatusDenied)).Methods(http.MethodGet)
+		// Hub admin routes
+		adminService := &services.AdminService{
+			Config:         appCfg,
+			DB:             workspaceDB,
+			KC:             kc,
+			AWSEmailClient: sesClient,
+			Authorizer:     authorizer,
+		}
+		adminRouter := api.PathPrefix("/admin").Subrouter()
+		adminRouter.HandleFunc("/accounts", handlers.AdminListAccounts(adminService)).Methods(http.MethodGet)
+		adminRouter.HandleFunc("/accounts/pending", handlers.AdminListPendingAccounts(adminService)).Methods(http.MethodGet)
+		adminRouter.HandleFunc("/accounts/{account-id}/decision", handlers.DecideAccount(billingAccountService)).Methods(http.MethodPost)
+		adminRouter.HandleFunc("/accounts/{account-id}/suspend", handlers.AdminSuspendAccount(adminService)).Methods(http.MethodPost)
+		adminRouter.HandleFunc("/accounts/{account-id}/close", handlers.AdminCloseAccount(adminService)).Methods(http.MethodPost)
+		adminRouter.HandleFunc("/accounts/{account-id}/reactivate", handlers.AdminReactivateAccount(adminService)).Methods(http.MethodPost)
+		adminRouter.HandleFunc("/accounts/{account-id}/status-changes", handlers.AdminListAccountStatusChanges(adminService)).Methods(http.MethodGet)
+		adminRouter.HandleFunc("/workspaces", handlers.AdminListWorkspaces(adminService)).Methods(http.MethodGet)
+		adminRouter.HandleFunc("/workspaces/{workspace-id}/suspend", handlers.AdminSuspendWorkspace(adminService)).Methods(http.MethodPost)
+		adminRouter.HandleFunc("/workspaces/{workspace-id}/reactivate", handlers.AdminReactivateWorkspace(adminService)).Methods(http.MethodPost)
 
 		// Workspace scoped session routes
-		api.HandleFunc("/workspaces/{workspace-id}/{user-id}/sessions", handlers.CreateWorkspaceSession(keycloakClient)).Methods(http.MethodPost)
+		api.Handle("/workspaces/{workspace-id}/{user-id}/sessions", limiter.limit(rateLimitGroupSessions, handlers.CreateWorkspaceSession(keycloakClient, authorizer))).Methods(http.MethodPost)
 
 		// S3 token routes
-		api.HandleFunc("/workspaces/{workspace-id}/{user-id}/s3-tokens", handlers.RequestS3CredentialsHandler(appCfg.AWS.S3.RoleArn, sts_client, *keycloakClient)).Methods(http.MethodPost)
+		api.Handle("/workspaces/{workspace-id}/{user-id}/s3-tokens", limiter.limit(rateLimitGroupS3Tokens, handlers.RequestS3CredentialsHandler(appCfg.AWS.S3.RoleArn, sts_client, *keycloakClient, authorizer))).Methods(http.MethodPost)
 
 		// File management routes
-		api.HandleFunc("/workspaces/{workspace-id}/files", handlers.GetWorkspaceFiles(fileService)).Methods(http.MethodGet)
-		api.HandleFunc("/workspaces/{workspace-id}/files/object", handlers.UploadWorkspaceObjectFiles(fileService)).Methods(http.MethodPost)
-		api.HandleFunc("/workspaces/{workspace-id}/files/block", handlers.UploadWorkspaceBlockFiles(fileService)).Methods(http.MethodPost)
-		api.HandleFunc("/workspaces/{workspace-id}/files/object", handlers.DeleteWorkspaceObjectFile(fileService)).Methods(http.MethodDelete)
-		api.HandleFunc("/workspaces/{workspace-id}/files/block", handlers.DeleteWorkspaceBlockFile(fileService)).Methods(http.MethodDelete)
-		api.HandleFunc("/workspaces/{workspace-id}/files/object/upload-url", handlers.GetWorkspaceObjectFileUploadURL(fileService)).Methods(http.MethodGet)
-		api.HandleFunc("/workspaces/{workspace-id}/files/object/metadata", handlers.GetWorkspaceObjectFileMetadata(fileService)).Methods(http.MethodGet)
-		api.HandleFunc("/workspaces/{workspace-id}/files/block/metadata", handlers.GetWorkspaceBlockFileMetadata(fileService)).Methods(http.MethodGet)
+		api.Handle("/workspaces/{workspace-id}/files", limiter.limit(rateLimitGroupFiles, handlers.GetWorkspaceFiles(fileService))).Methods(http.MethodGet)
+		api.Handle("/workspaces/{workspace-id}/files/object", limiter.limit(rateLimitGroupFiles, handlers.UploadWorkspaceObjectFiles(fileService))).Methods(http.MethodPost)
+		api.Handle("/workspaces/{workspace-id}/files/block", limiter.limit(rateLimitGroupFiles, handlers.UploadWorkspaceBlockFiles(fileService))).Methods(http.MethodPost)
+		api.Handle("/workspaces/{workspace-id}/files/object", limiter.limit(rateLimitGroupFiles, handlers.DeleteWorkspaceObjectFile(fileService))).Methods(http.MethodDelete)
+		api.Handle("/workspaces/{workspace-id}/files/block", limiter.limit(rateLimitGroupFiles, handlers.DeleteWorkspaceBlockFile(fileService))).Methods(http.MethodDelete)
+		api.Handle("/workspaces/{workspace-id}/files/object/upload-url", limiter.limit(rateLimitGroupFiles, handlers.GetWorkspaceObjectFileUploadURL(fileService))).Methods(http.MethodGet)
+		api.Handle("/workspaces/{workspace-id}/files/object/metadata", limiter.limit(rateLimitGroupFiles, handlers.GetWorkspaceObjectFileMetadata(fileService))).Methods(http.MethodGet)
+		api.Handle("/workspaces/{workspace-id}/files/block/metadata", limiter.limit(rateLimitGroupFiles, handlers.GetWorkspaceBlockFileMetadata(fileService))).Methods(http.MethodGet)
 
 		// Linked account routes (disabled when K8s client is unavailable, e.g., local dev without kubeconfig)
 		if k8sClient != nil {
@@ -144,7 +219,8 @@ var serveCmd = &cobra.Command{
 				DB:             workspaceDB,
 				SecretsManager: secretsManagerClient,
 				K8sClient:      k8sClient,
-				KC:             keycloakClient,
+				KC:             kc,
+				Authorizer:     authorizer,
 			}
 			api.HandleFunc("/workspaces/{workspace-id}/linked-accounts", handlers.CreateLinkedAccount(linkedAccountService)).Methods(http.MethodPost)
 			api.HandleFunc("/workspaces/{workspace-id}/linked-accounts", handlers.GetLinkedAccounts(linkedAccountService)).Methods(http.MethodGet)
@@ -157,17 +233,37 @@ var serveCmd = &cobra.Command{
 		}
 
 		// Data Loader routes
-		api.HandleFunc("/workspaces/{workspace-id}/data-loader", handlers.AddFileDataLoader(appCfg, sts_client, *keycloakClient)).Methods(http.MethodPost)
-		api.HandleFunc("/workspaces/{workspace-id}/data-loader", handlers.DeleteFileDataLoader(appCfg, sts_client, *keycloakClient)).Methods(http.MethodDelete)
+		api.Handle("/workspaces/{workspace-id}/data-loader", limiter.limit(rateLimitGroupDataLoader, handlers.AddFileDataLoader(appCfg, sts_client, *keycloakClient, authorizer))).Methods(http.MethodPost)
+		api.Handle("/workspaces/{workspace-id}/data-loader", limiter.limit(rateLimitGroupDataLoader, handlers.DeleteFileDataLoader(appCfg, sts_client, *keycloakClient, authorizer))).Methods(http.MethodDelete)
 
+		server := newHTTPServer(fmt.Sprintf("%s:%d", host, port), r, appCfg.Server)
+
+		serveErr := make(chan error, 1)
+		go func() {
+			serveErr <- server.ListenAndServe()
+		}()
 		log.Info().Msg(fmt.Sprintf("Server started at %s:%d", host, port))
 
-		if err := http.ListenAndServe(fmt.Sprintf("%s:%d", host, port),
-			r); err != nil {
+		select {
+		case err := <-serveErr:
+			if !errors.Is(err, http.ErrServerClosed) {
+				log.Error().Err(err).Msg("could not start server")
+			}
+			stop()
+			return
+		case <-ctx.Done():
+		}
+
+		// Stop accepting connections and wait for in-flight requests within the shutdown window
+		timeout := shutdownTimeout(appCfg.Server)
+		log.Info().Dur("timeout", timeout).Msg("Shutting down server")
 
-			log.Error().Err(err).Msg("could not start server")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Error().Err(err).Msg("Server did not shut down cleanly")
 		}
-		log.Info().Msg(fmt.Sprintf("Server running on http://%s:%d", host, port))
+		log.Info().Msg("Server stopped")
 	},
 }
 
@@ -175,10 +271,27 @@ func init() {
 	rootCmd.AddCommand(serveCmd)
 	serveCmd.Flags().StringVar(&host, "host", "0.0.0.0", "host to run the server on")
 	serveCmd.Flags().IntVar(&port, "port", 8080, "port to run the server on")
+	serveCmd.Flags().BoolVar(&withRelay, "with-relay", true, "publish queued workspace events from the API server")
 
 }
 
 func initializeK8sClient() (kubernetes.Interface, error) {
+	config, err := initializeK8sConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// Create Kubernetes client
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %v", err)
+	}
+
+	return clientset, nil
+}
+
+// initializeK8sConfig loads the in-cluster config when running in a pod, or the local kubeconfig otherwise.
+func initializeK8sConfig() (*rest.Config, error) {
 	var config *rest.Config
 	var err error
 
@@ -197,11 +310,5 @@ func initializeK8sClient() (kubernetes.Interface, error) {
 		}
 	}
 
-	// Create Kubernetes client
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Kubernetes client: %v", err)
-	}
-
-	return clientset, nil
+	return config, nil
 }
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/appconfig"
+	"github.com/rs/zerolog/log"
+)
+
+// Defaults used when a server timeout is not configured. Reads and writes are allowed plenty of
+// time as they carry file uploads and downloads.
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultReadTimeout       = 5 * time.Minute
+	defaultWriteTimeout      = 5 * time.Minute
+	defaultIdleTimeout       = 2 * time.Minute
+	defaultShutdownTimeout   = 30 * time.Second
+	tracingFlushTimeout      = 5 * time.Second
+)
+
+// signalContext returns a context that is cancelled when the process receives SIGINT or SIGTERM.
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// newHTTPServer creates an HTTP server for handler with the configured timeouts.
+func newHTTPServer(addr string, handler http.Handler, cfg appconfig.ServerConfig) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: secondsOrDefault(cfg.ReadHeaderTimeoutSeconds, defaultReadHeaderTimeout),
+		ReadTimeout:       secondsOrDefault(cfg.ReadTimeoutSeconds, defaultReadTimeout),
+		WriteTimeout:      secondsOrDefault(cfg.WriteTimeoutSeconds, defaultWriteTimeout),
+		IdleTimeout:       secondsOrDefault(cfg.IdleTimeoutSeconds, defaultIdleTimeout),
+	}
+}
+
+// shutdownTimeout returns how long in-flight work is given to finish once a shutdown signal is received.
+func shutdownTimeout(cfg appconfig.ServerConfig) time.Duration {
+	return secondsOrDefault(cfg.ShutdownTimeoutSeconds, defaultShutdownTimeout)
+}
+
+func secondsOrDefault(seconds int, def time.Duration) time.Duration {
+	if seconds <= 0 {
+		return def
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// flushTracing exports any spans still buffered before the process exits.
+func flushTracing() {
+	if shutdownTracing == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), tracingFlushTimeout)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to flush traces")
+	}
+}
@@ -1,21 +1,24 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
 
 	ws_manager "github.com/EO-DataHub/eodhp-workspace-manager/models"
-	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
 	ws_services "github.com/EO-DataHub/eodhp-workspace-services/models"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 )
 
 // GetAccounts retrieves all accounts owned by the specified account owner.
-func (db *WorkspaceDB) GetAccounts(accountOwner string) ([]ws_services.Account, error) {
-	query := `SELECT id, created_at, name, account_owner, billing_address, organization_name, account_opening_reason, status FROM accounts WHERE account_owner = $1`
-	rows, err := db.DB.Query(query, accountOwner)
+func (db *WorkspaceDB) GetAccounts(ctx context.Context, accountOwner string) ([]ws_services.Account, error) {
+	ctx, span := startSpan(ctx, "GetAccounts")
+	defer span.End()
+
+	query := `SELECT id, created_at, name, account_owner, billing_address, organization_name, account_opening_reason, status FROM accounts WHERE account_owner = $1 AND deleted_at IS NULL`
+	rows, err := db.DB.QueryContext(ctx, query, accountOwner)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving accounts: %w", err)
 	}
@@ -36,7 +39,7 @@ func (db *WorkspaceDB) GetAccounts(accountOwner string) ([]ws_services.Account,
 		}
 
 		// Retrieve associated workspaces for the account
-		workspaces, err := db.getAccountWorkspaces(ac.ID)
+		workspaces, err := db.getAccountWorkspaces(ctx, ac.ID)
 		if err != nil {
 			return nil, fmt.Errorf("error retrieving workspaces for account: %w", err)
 		}
@@ -47,9 +50,12 @@ func (db *WorkspaceDB) GetAccounts(accountOwner string) ([]ws_services.Account,
 }
 
 // GetAccount retrieves a single account.
-func (db *WorkspaceDB) GetAccount(accountID uuid.UUID) (*ws_services.Account, error) {
-	query := `SELECT id, created_at, name, account_owner, billing_address, organization_name, account_opening_reason FROM accounts WHERE id = $1`
-	row := db.DB.QueryRow(query, accountID)
+func (db *WorkspaceDB) GetAccount(ctx context.Context, accountID uuid.UUID) (*ws_services.Account, error) {
+	ctx, span := startSpan(ctx, "GetAccount")
+	defer span.End()
+
+	query := `SELECT id, created_at, name, account_owner, billing_address, organization_name, account_opening_reason, status, version FROM accounts WHERE id = $1 AND deleted_at IS NULL`
+	row := db.DB.QueryRowContext(ctx, query, accountID)
 
 	var ac ws_services.Account
 	if err := row.Scan(
@@ -59,7 +65,9 @@ func (db *WorkspaceDB) GetAccount(accountID uuid.UUID) (*ws_services.Account, er
 		&ac.AccountOwner,
 		&ac.BillingAddress,
 		&ac.OrganizationName,
-		&ac.AccountOpeningReason); err != nil {
+		&ac.AccountOpeningReason,
+		&ac.Status,
+		&ac.Version); err != nil {
 		if err == sql.ErrNoRows {
 			// Account does not exist, return nil account and nil error
 			return nil, nil
@@ -68,7 +76,7 @@ func (db *WorkspaceDB) GetAccount(accountID uuid.UUID) (*ws_services.Account, er
 		return nil, fmt.Errorf("error scanning accounts: %w", err)
 	}
 
-	workspaces, err := db.getAccountWorkspaces(ac.ID)
+	workspaces, err := db.getAccountWorkspaces(ctx, ac.ID)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving workspaces for account: %w", err)
 	}
@@ -79,9 +87,11 @@ func (db *WorkspaceDB) GetAccount(accountID uuid.UUID) (*ws_services.Account, er
 }
 
 // CreateAccount creates a new account in the database.
-func (w *WorkspaceDB) CreateAccount(req *ws_services.Account) (*ws_services.Account, error) {
+func (w *WorkspaceDB) CreateAccount(ctx context.Context, req *ws_services.Account) (*ws_services.Account, error) {
+	ctx, span := startSpan(ctx, "CreateAccount")
+	defer span.End()
 
-	tx, err := w.DB.Begin()
+	tx, err := w.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error starting transaction: %w", err)
 	}
@@ -90,7 +100,7 @@ func (w *WorkspaceDB) CreateAccount(req *ws_services.Account) (*ws_services.Acco
 	created_at := time.Now().UTC()
 
 	// Insert new account details
-	err = w.execQuery(tx, `
+	err = w.execQuery(ctx, tx, `
 		INSERT INTO accounts (id, created_at, name, account_owner, billing_address, organization_name, account_opening_reason)
 		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
 		accountID, created_at, req.Name, req.AccountOwner, req.BillingAddress, req.OrganizationName, req.AccountOpeningReason)
@@ -110,33 +120,30 @@ func (w *WorkspaceDB) CreateAccount(req *ws_services.Account) (*ws_services.Acco
 		BillingAddress:       req.BillingAddress,
 		OrganizationName:     req.OrganizationName,
 		AccountOpeningReason: req.AccountOpeningReason,
+		Version:              1,
 	}
 
 	return &account, nil
 }
 
-// UpdateAccount updates an existing account's details.
-func (w *WorkspaceDB) UpdateAccount(accountID uuid.UUID, account ws_services.Account) (*ws_services.Account, error) {
-	// Start a transaction
-	tx, err := w.DB.Begin()
-	if err != nil {
-		return nil, fmt.Errorf("error starting transaction: %w", err)
+// UpdateAccount updates the details of an account that the owner may change, if it is still at
+// version. It returns the account with its new version, or nil if it has been changed since.
+func (w *WorkspaceDB) UpdateAccount(ctx context.Context, accountID uuid.UUID, account ws_services.Account, version int) (*ws_services.Account, error) {
+	ctx, span := startSpan(ctx, "UpdateAccount")
+	defer span.End()
+
+	// The owner and status are changed through their own requests
+	err := w.DB.QueryRowContext(ctx, `
+		UPDATE accounts
+		SET name = $1, billing_address = $2, organization_name = $3, account_opening_reason = $4, version = version + 1
+		WHERE id = $5 AND version = $6
+		RETURNING version`,
+		account.Name, account.BillingAddress, account.OrganizationName, account.AccountOpeningReason, accountID, version).Scan(&account.Version)
+	if err == sql.ErrNoRows {
+		return nil, nil
 	}
-
-	// Update account fields in the database
-	err = w.execQuery(tx, `
-		UPDATE accounts 
-		SET name = $1, account_owner = $2, billing_address = $3, organization_name = $4, account_opening_reason = $5 WHERE id = $6`,
-		account.Name, account.AccountOwner, account.BillingAddress, account.OrganizationName, account.AccountOpeningReason, accountID)
 	if err != nil {
-		tx.Rollback()
-		log.Error().Err(err).Msg("error updating account owner")
-		return nil, fmt.Errorf("error updating account owner: %w", err)
-	}
-
-	// Commit transaction after update
-	if err := w.CommitTransaction(tx); err != nil {
-		return nil, fmt.Errorf("error committing transaction: %w", err)
+		return nil, fmt.Errorf("error updating account: %w", err)
 	}
 
 	// Construct and return the updated account object
@@ -146,167 +153,255 @@ func (w *WorkspaceDB) UpdateAccount(accountID uuid.UUID, account ws_services.Acc
 	return &account, nil
 }
 
-// DeleteAccount deletes an account from the database by its ID.
-func (w *WorkspaceDB) DeleteAccount(accountID uuid.UUID) error {
-	tx, err := w.DB.Begin()
+// AccountStatusDeleted is the status of deleted accounts. Their rows are kept, with the time
+// they were deleted, so that their deleted workspaces and the history of their decisions and
+// status changes are kept too.
+const AccountStatusDeleted = "Deleted"
+
+// AccountStatusClosing is the status of accounts whose workspaces are being deleted before the
+// account itself is.
+const AccountStatusClosing = "Closing"
+
+// DeleteAccount deletes an account by its ID if it still has version, and records who deleted
+// it. It returns false if the account has been changed or deleted since.
+func (w *WorkspaceDB) DeleteAccount(ctx context.Context, accountID uuid.UUID, version int, deletedBy string) (bool, error) {
+	ctx, span := startSpan(ctx, "DeleteAccount")
+	defer span.End()
+
+	tx, err := w.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("error starting transaction: %w", err)
+		return false, fmt.Errorf("error starting transaction: %w", err)
 	}
 
-	// Rollback transaction if an error occurs
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		}
-	}()
-
-	// Execute delete query for the specified account ID
-	err = w.execQuery(tx, `DELETE FROM accounts WHERE id = $1`, accountID)
+	var locked bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT true FROM accounts WHERE id = $1 AND version = $2 AND deleted_at IS NULL FOR UPDATE`,
+		accountID, version).Scan(&locked)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return false, nil
+	}
 	if err != nil {
-		return fmt.Errorf("error executing delete query: %w", err)
+		tx.Rollback()
+		return false, fmt.Errorf("error locking account: %w", err)
+	}
+
+	deleted, err := w.markAccountDeleted(ctx, tx, accountID, nil, deletedBy)
+	if err != nil || !deleted {
+		tx.Rollback()
+		return false, err
 	}
 
-	// Commit transaction after successful deletion
 	if err := w.CommitTransaction(tx); err != nil {
-		return fmt.Errorf("error committing transaction: %w", err)
+		return false, fmt.Errorf("error committing transaction: %w", err)
 	}
 
-	return nil
+	return true, nil
 }
 
-// getAccountWorkspaces retrieves all workspaces associated with a specific account ID.
-func (db *WorkspaceDB) getAccountWorkspaces(accountID uuid.UUID) ([]ws_manager.WorkspaceSettings, error) {
-
-	workspaces, err := db.getWorkspacesByAccount(accountID)
-	if err != nil {
-		return nil, err
+// markAccountDeleted gives an account with one of the from statuses, or any status if from is
+// empty, the deleted status within tx and records when and by whom it was deleted. It returns
+// false if the account was not deleted.
+func (w *WorkspaceDB) markAccountDeleted(ctx context.Context, tx *sql.Tx, accountID uuid.UUID, from []string, deletedBy string) (bool, error) {
+	change, err := w.changeAccountStatus(ctx, tx, accountID, from, AccountStatusDeleted, deletedBy, "account deleted")
+	if err != nil || change == nil {
+		return false, err
 	}
 
-	// Retrieve associated stores for each workspace
-	workspaces, err = db.getWorkspaceStores(workspaces)
-
-	if err != nil {
-		return nil, err
+	if _, err := tx.ExecContext(ctx, `UPDATE accounts SET deleted_at = NOW() WHERE id = $1`, accountID); err != nil {
+		return false, fmt.Errorf("error deleting account: %w", err)
 	}
 
-	return workspaces, nil
+	return true, nil
 }
 
-// CheckAccountIsVerified checks if an account is verified and approved to use.
-func (db *WorkspaceDB) CheckAccountIsVerified(accountID uuid.UUID) (bool, error) {
-	query := `SELECT EXISTS(SELECT 1 FROM accounts WHERE id = $1 and status = 'Approved')`
-	var exists bool
-	err := db.DB.QueryRow(query, accountID).Scan(&exists)
+// CloseAccount marks an account as closing and queues a deletion event for each of its
+// workspaces that is not already being deleted, in the same transaction. The account is removed
+// by FinishAccountClosure once every workspace has gone. It returns the names of the workspaces
+// queued for deletion.
+func (w *WorkspaceDB) CloseAccount(ctx context.Context, accountID uuid.UUID, closedBy string) ([]string, error) {
+	ctx, span := startSpan(ctx, "CloseAccount")
+	defer span.End()
+
+	tx, err := w.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return false, fmt.Errorf("error checking account existence: %w", err)
+		return nil, fmt.Errorf("error starting transaction: %w", err)
 	}
-	return exists, nil
-}
-
-func (db *WorkspaceDB) IsUserAccountOwner(username, workspaceID string) (bool, error) {
 
-	// Get information about the workspace
-	workspace, err := db.GetWorkspace(workspaceID)
+	// An account that is already closing is left as it is, and its workspaces queued again
+	if _, err := w.changeAccountStatus(ctx, tx, accountID, nil, AccountStatusClosing, closedBy, "account deleted"); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error closing account: %w", err)
+	}
 
-	// Check for errors
+	rows, err := tx.QueryContext(ctx, `
+		UPDATE workspaces
+		SET status = $1, deletion_scheduled_at = NULL, last_updated = CURRENT_TIMESTAMP
+		WHERE account = $2 AND status NOT IN ('Unavailable', $1)
+		RETURNING name`, WorkspaceStatusDeleting, accountID)
 	if err != nil {
-		return false, fmt.Errorf("database error retrieving workspace: %w", err)
+		tx.Rollback()
+		return nil, fmt.Errorf("error deleting account workspaces: %w", err)
 	}
 
-	// Get account information
-	account, err := db.GetAccount(workspace.Account)
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return nil, fmt.Errorf("error scanning workspace name: %w", err)
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error reading account workspaces: %w", err)
+	}
 
-	// Check for errors
-	if err != nil {
-		return false, fmt.Errorf("database error retrieving account: %w", err)
+	for _, name := range names {
+		var wsSettings ws_manager.WorkspaceSettings
+		wsSettings.Name = name
+		wsSettings.Status = WorkspaceStatusDeleting
+		if err := w.insertOutboxEvent(ctx, tx, wsSettings); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
 	}
 
-	// Check if the user is the account owner
-	if username == account.AccountOwner {
-		return true, nil
+	if err := w.CommitTransaction(tx); err != nil {
+		return nil, err
 	}
 
-	// Return false if the user is not the account owner
-	return false, nil
+	return names, nil
 }
 
-// CreateAccountApproval stores an approval request in the database
-func (w *WorkspaceDB) CreateAccountApprovalToken(accountID uuid.UUID) (string, error) {
+// FinishAccountClosure deletes the closing account of a deleted workspace once none of the
+// account's workspaces remain. It returns true if the account was deleted.
+func (w *WorkspaceDB) FinishAccountClosure(ctx context.Context, workspaceName string) (bool, error) {
+	ctx, span := startSpan(ctx, "FinishAccountClosure")
+	defer span.End()
 
-	tx, err := w.DB.Begin()
+	tx, err := w.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return "", fmt.Errorf("error starting transaction: %w", err)
+		return false, fmt.Errorf("error starting transaction: %w", err)
 	}
 
-	token, err := authn.GenerateToken()
+	// The account is locked so that it is only deleted once, by whichever of its last
+	// workspaces is deleted last
+	var accountID uuid.UUID
+	err = tx.QueryRowContext(ctx, `
+		SELECT a.id FROM accounts a
+		WHERE a.status = $2
+			AND a.id = (SELECT account FROM workspaces WHERE name = $1)
+			AND NOT EXISTS (SELECT 1 FROM workspaces ws WHERE ws.account = a.id AND ws.status != 'Unavailable')
+		FOR UPDATE`,
+		workspaceName, AccountStatusClosing).Scan(&accountID)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return false, nil
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to generate token: %w", err)
+		tx.Rollback()
+		return false, fmt.Errorf("error finding closed account: %w", err)
 	}
 
-	// Token valid for 30 days
-	expiry := time.Now().Add(30 * 24 * time.Hour)
-
-	err = w.execQuery(tx, `
-		INSERT INTO account_approvals (id, account_id, approval_token, token_expires_at, created_at)
-		VALUES ($1, $2, $3, $4, $5)`,
-		uuid.New(), accountID, token, expiry, time.Now().UTC())
-	if err != nil {
-		return "", err
+	deleted, err := w.markAccountDeleted(ctx, tx, accountID, []string{AccountStatusClosing}, "workspace-services")
+	if err != nil || !deleted {
+		tx.Rollback()
+		return false, err
 	}
 
-	// Commit transaction after insertion
 	if err := w.CommitTransaction(tx); err != nil {
-		return "", fmt.Errorf("error committing transaction: %w", err)
+		return false, err
 	}
 
-	return token, nil
+	return true, nil
 }
 
-// ValidateApprovalToken checks if the token is valid and retrieves the account ID
-func (w *WorkspaceDB) ValidateApprovalToken(token string) (string, error) {
-	var accountID string
-	var expiresAt time.Time
+// getAccountWorkspaces retrieves all workspaces associated with a specific account ID.
+func (db *WorkspaceDB) getAccountWorkspaces(ctx context.Context, accountID uuid.UUID) ([]ws_manager.WorkspaceSettings, error) {
 
-	query := `SELECT account_id, token_expires_at FROM account_approvals WHERE approval_token = $1`
-	err := w.DB.QueryRow(query, token).Scan(&accountID, &expiresAt)
+	workspaces, err := db.getWorkspacesByAccount(ctx, accountID)
 	if err != nil {
-		return "", fmt.Errorf("invalid or expired token")
+		return nil, err
 	}
 
-	// Check if the token has expired
-	if time.Now().After(expiresAt) {
-		return "", fmt.Errorf("token has expired")
+	// Retrieve associated stores for each workspace
+	workspaces, err = db.getWorkspaceStores(ctx, workspaces)
+
+	if err != nil {
+		return nil, err
 	}
 
-	return accountID, nil
+	return workspaces, nil
 }
 
-// UpdateAccountStatus changes the status of an account and removes the token from being used again
-func (w *WorkspaceDB) UpdateAccountStatus(token, accountID, status string) error {
+// CheckAccountIsVerified reports whether an account is approved to use, and returns its status.
+// The status is empty if the account does not exist.
+func (db *WorkspaceDB) CheckAccountIsVerified(ctx context.Context, accountID uuid.UUID) (bool, string, error) {
+	ctx, span := startSpan(ctx, "CheckAccountIsVerified")
+	defer span.End()
+
+	query := `SELECT status FROM accounts WHERE id = $1 AND deleted_at IS NULL`
+	var status string
+	err := db.DB.QueryRowContext(ctx, query, accountID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", fmt.Errorf("error checking account existence: %w", err)
+	}
+	return status == "Approved", status, nil
+}
 
-	tx, err := w.DB.Begin()
+// GetWorkspaceAccountStatus returns the status of the account a workspace belongs to, or an
+// empty string if the workspace does not exist.
+func (db *WorkspaceDB) GetWorkspaceAccountStatus(ctx context.Context, workspaceName string) (string, error) {
+	ctx, span := startSpan(ctx, "GetWorkspaceAccountStatus")
+	defer span.End()
+
+	query := `
+		SELECT a.status FROM workspaces ws
+		INNER JOIN accounts a ON a.id = ws.account
+		WHERE ws.name = $1`
+	var status string
+	err := db.DB.QueryRowContext(ctx, query, workspaceName).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
 	if err != nil {
-		return fmt.Errorf("error starting transaction: %w", err)
+		return "", fmt.Errorf("error retrieving workspace account status: %w", err)
 	}
+	return status, nil
+}
+
+func (db *WorkspaceDB) IsUserAccountOwner(ctx context.Context, username, workspaceID string) (bool, error) {
+	ctx, span := startSpan(ctx, "IsUserAccountOwner")
+	defer span.End()
+
+	// Get information about the workspace
+	workspace, err := db.GetWorkspace(ctx, workspaceID)
 
-	// Change the status
-	err = w.execQuery(tx, `UPDATE accounts SET status = $1 WHERE id = $2`, status, accountID)
+	// Check for errors
 	if err != nil {
-		tx.Rollback()
-		log.Error().Err(err).Msg("error updating account owner")
-		return fmt.Errorf("error updating account owner: %w", err)
+		return false, fmt.Errorf("database error retrieving workspace: %w", err)
 	}
 
-	// Remove the approval token to make it one time use
-	err = w.execQuery(tx, `DELETE FROM account_approvals WHERE approval_token = $1`, token)
+	// Get account information
+	account, err := db.GetAccount(ctx, workspace.Account)
+
+	// Check for errors
 	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("error executing delete query: %w", err)
+		return false, fmt.Errorf("database error retrieving account: %w", err)
 	}
 
-	if err := w.CommitTransaction(tx); err != nil {
-		return fmt.Errorf("error committing transaction: %w", err)
+	// Check if the user is the account owner
+	if username == account.AccountOwner {
+		return true, nil
 	}
 
-	return nil
+	// Return false if the user is not the account owner
+	return false, nil
 }
@@ -0,0 +1,385 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	ws_services "github.com/EO-DataHub/eodhp-workspace-services/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// AccountSortColumns maps the fields accounts can be sorted by to their columns.
+var AccountSortColumns = map[string]string{
+	"created_at":   "a.created_at",
+	"name":         "a.name",
+	"owner":        "a.account_owner",
+	"organization": "a.organization_name",
+	"status":       "a.status",
+}
+
+// WorkspaceSortColumns maps the fields workspaces can be sorted by to their columns.
+var WorkspaceSortColumns = map[string]string{
+	"created_at":   "ws.created_at",
+	"name":         "ws.name",
+	"status":       workspaceStatusColumn,
+	"last_updated": "ws.last_updated",
+}
+
+// workspaceStatusColumn is the status reported for a workspace. A scheduled deletion or a
+// suspension takes precedence over the status reported by the workspace manager.
+const workspaceStatusColumn = `CASE
+		WHEN ws.deletion_scheduled_at IS NOT NULL THEN 'PendingDeletion'
+		WHEN ws.suspended_at IS NOT NULL AND ws.status != 'Unavailable' THEN 'Suspended'
+		ELSE ws.status END`
+
+// ListAccounts returns a page of all accounts, with the number of workspaces of each.
+func (w *WorkspaceDB) ListAccounts(ctx context.Context, opts ws_services.AccountListOptions) ([]ws_services.AdminAccount, error) {
+	ctx, span := startSpan(ctx, "ListAccounts")
+	defer span.End()
+
+	// Deleted accounts are only kept for the history of their workspaces and status changes
+	conditions := []string{"a.deleted_at IS NULL"}
+	var args []interface{}
+	if opts.Status != "" {
+		args = append(args, opts.Status)
+		conditions = append(conditions, fmt.Sprintf("a.status = $%d", len(args)))
+	}
+	if opts.Owner != "" {
+		args = append(args, opts.Owner)
+		conditions = append(conditions, fmt.Sprintf("a.account_owner = $%d", len(args)))
+	}
+	if opts.Organization != "" {
+		args = append(args, "%"+escapeLike(opts.Organization)+"%")
+		conditions = append(conditions, fmt.Sprintf("a.organization_name ILIKE $%d", len(args)))
+	}
+
+	query := `
+		SELECT a.id, a.created_at, a.name, a.account_owner, a.organization_name, a.billing_address,
+			a.account_opening_reason, a.status,
+			(SELECT COUNT(*) FROM workspaces ws WHERE ws.account = a.id AND ws.status != 'Unavailable')
+		FROM accounts a` +
+		whereClause(conditions) +
+		orderClause(AccountSortColumns, opts.Sort, "created_at", opts.Descending, "a.id") +
+		pageClause(&args, opts.Offset, opts.Limit)
+
+	rows, err := w.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing accounts: %w", err)
+	}
+	defer rows.Close()
+
+	var accounts []ws_services.AdminAccount
+	for rows.Next() {
+		var ac ws_services.AdminAccount
+		if err := rows.Scan(&ac.ID, &ac.CreatedAt, &ac.Name, &ac.AccountOwner, &ac.OrganizationName,
+			&ac.BillingAddress, &ac.AccountOpeningReason, &ac.Status, &ac.WorkspaceCount); err != nil {
+			return nil, fmt.Errorf("error scanning account: %w", err)
+		}
+		accounts = append(accounts, ac)
+	}
+
+	return accounts, rows.Err()
+}
+
+// ListWorkspaces returns a page of the workspaces of every account. Deleted workspaces are only
+// returned when filtering by the Unavailable status.
+func (w *WorkspaceDB) ListWorkspaces(ctx context.Context, opts ws_services.WorkspaceListOptions) ([]ws_services.AdminWorkspace, error) {
+	ctx, span := startSpan(ctx, "ListWorkspaces")
+	defer span.End()
+
+	var conditions []string
+	var args []interface{}
+	if opts.Status != "" {
+		args = append(args, opts.Status)
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", workspaceStatusColumn, len(args)))
+	} else {
+		conditions = append(conditions, "ws.status != 'Unavailable'")
+	}
+	if opts.Account != nil {
+		args = append(args, *opts.Account)
+		conditions = append(conditions, fmt.Sprintf("ws.account = $%d", len(args)))
+	}
+	if opts.CreatedBefore != nil {
+		args = append(args, *opts.CreatedBefore)
+		conditions = append(conditions, fmt.Sprintf("ws.created_at < $%d", len(args)))
+	}
+	if opts.CreatedAfter != nil {
+		args = append(args, *opts.CreatedAfter)
+		conditions = append(conditions, fmt.Sprintf("ws.created_at > $%d", len(args)))
+	}
+
+	query := `
+		SELECT ws.id, ws.name, ws.account, a.name, a.account_owner, ` + workspaceStatusColumn + `,
+			ws.created_at, ws.last_updated, ws.suspended_at, ws.suspended_by
+		FROM workspaces ws
+		INNER JOIN accounts a ON a.id = ws.account` +
+		whereClause(conditions) +
+		orderClause(WorkspaceSortColumns, opts.Sort, "created_at", opts.Descending, "ws.id") +
+		pageClause(&args, opts.Offset, opts.Limit)
+
+	rows, err := w.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing workspaces: %w", err)
+	}
+	defer rows.Close()
+
+	var workspaces []ws_services.AdminWorkspace
+	for rows.Next() {
+		var ws ws_services.AdminWorkspace
+		if err := rows.Scan(&ws.ID, &ws.Name, &ws.Account, &ws.AccountName, &ws.Owner, &ws.Status,
+			&ws.CreatedAt, &ws.LastUpdated, &ws.SuspendedAt, &ws.SuspendedBy); err != nil {
+			return nil, fmt.Errorf("error scanning workspace: %w", err)
+		}
+		workspaces = append(workspaces, ws)
+	}
+
+	return workspaces, rows.Err()
+}
+
+// SetAccountStatus changes the status of an account with one of the from statuses to another,
+// and records who changed it and why. It returns nil if the account does not have one of the
+// from statuses.
+func (w *WorkspaceDB) SetAccountStatus(ctx context.Context, accountID uuid.UUID, from []string, to, changedBy, reason string) (*ws_services.AccountStatusChange, error) {
+	ctx, span := startSpan(ctx, "SetAccountStatus")
+	defer span.End()
+
+	tx, err := w.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	change, err := w.changeAccountStatus(ctx, tx, accountID, from, to, changedBy, reason)
+	if err != nil || change == nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := w.CommitTransaction(tx); err != nil {
+		return nil, err
+	}
+
+	return change, nil
+}
+
+// ListAccountStatusChanges returns the status changes of an account, oldest first.
+func (w *WorkspaceDB) ListAccountStatusChanges(ctx context.Context, accountID uuid.UUID) ([]ws_services.AccountStatusChange, error) {
+	ctx, span := startSpan(ctx, "ListAccountStatusChanges")
+	defer span.End()
+
+	rows, err := w.DB.QueryContext(ctx, `
+		SELECT id, account_id, from_status, to_status, changed_by, reason, changed_at
+		FROM account_status_changes
+		WHERE account_id = $1
+		ORDER BY changed_at, id`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing account status changes: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []ws_services.AccountStatusChange
+	for rows.Next() {
+		var change ws_services.AccountStatusChange
+		if err := rows.Scan(&change.ID, &change.AccountID, &change.FromStatus, &change.ToStatus,
+			&change.ChangedBy, &change.Reason, &change.ChangedAt); err != nil {
+			return nil, fmt.Errorf("error scanning account status change: %w", err)
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, rows.Err()
+}
+
+// changeAccountStatus gives an account status to within tx, bumping its version, and records the
+// change. Only an account with one of the from statuses is changed, or one with any other status
+// if from is empty. It returns nil if the account was not changed.
+func (w *WorkspaceDB) changeAccountStatus(ctx context.Context, tx *sql.Tx, accountID uuid.UUID, from []string, to, changedBy, reason string) (*ws_services.AccountStatusChange, error) {
+	// The row is locked before it is read so that the status it is changed from is the one
+	// recorded, even if two changes are made at once
+	args := []interface{}{to, accountID}
+	condition := ""
+	if len(from) > 0 {
+		args = append(args, pq.Array(from))
+		condition = " AND old.status = ANY($3)"
+	}
+
+	change := ws_services.AccountStatusChange{
+		ID:        uuid.New(),
+		AccountID: accountID,
+		ToStatus:  to,
+		ChangedBy: changedBy,
+		Reason:    reason,
+	}
+	err := tx.QueryRowContext(ctx, `
+		UPDATE accounts a SET status = $1, version = a.version + 1
+		FROM (SELECT id, status FROM accounts WHERE id = $2 FOR UPDATE) old
+		WHERE a.id = old.id AND old.status != $1`+condition+`
+		RETURNING old.status`, args...).Scan(&change.FromStatus)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error updating account status: %w", err)
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO account_status_changes (id, account_id, from_status, to_status, changed_by, reason)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING changed_at`,
+		change.ID, change.AccountID, change.FromStatus, change.ToStatus, change.ChangedBy, change.Reason).Scan(&change.ChangedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error recording account status change: %w", err)
+	}
+
+	return &change, nil
+}
+
+// DecideAccount approves or denies a pending account, giving it status, and records who decided
+// and why. It returns nil if the account is not pending.
+func (w *WorkspaceDB) DecideAccount(ctx context.Context, accountID uuid.UUID, status, decidedBy, reason string) (*ws_services.AccountDecision, error) {
+	ctx, span := startSpan(ctx, "DecideAccount")
+	defer span.End()
+
+	tx, err := w.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	// Only pending accounts can be decided, so two admins deciding at once cannot both succeed
+	change, err := w.changeAccountStatus(ctx, tx, accountID, []string{"Pending"}, status, decidedBy, reason)
+	if err != nil || change == nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	decision := ws_services.AccountDecision{
+		ID:        uuid.New(),
+		AccountID: accountID,
+		Status:    status,
+		DecidedBy: decidedBy,
+		Reason:    reason,
+	}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO account_decisions (id, account_id, status, decided_by, reason)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING decided_at`,
+		decision.ID, decision.AccountID, decision.Status, decision.DecidedBy, decision.Reason).Scan(&decision.DecidedAt)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error recording account decision: %w", err)
+	}
+
+	if err := w.CommitTransaction(tx); err != nil {
+		return nil, err
+	}
+
+	return &decision, nil
+}
+
+// SuspendWorkspace records that a workspace has been suspended. It returns false if the
+// workspace is already suspended or has been deleted.
+func (w *WorkspaceDB) SuspendWorkspace(ctx context.Context, workspaceName, suspendedBy string) (bool, error) {
+	ctx, span := startSpan(ctx, "SuspendWorkspace")
+	defer span.End()
+
+	result, err := w.DB.ExecContext(ctx, `
+		UPDATE workspaces SET suspended_at = NOW(), suspended_by = $1
+		WHERE name = $2 AND suspended_at IS NULL AND status != 'Unavailable'`,
+		suspendedBy, workspaceName)
+	if err != nil {
+		return false, fmt.Errorf("error suspending workspace: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking workspace suspension: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// IsWorkspaceSuspended reports whether a workspace has been suspended. Workspaces that do not
+// exist are not suspended.
+func (w *WorkspaceDB) IsWorkspaceSuspended(ctx context.Context, workspaceName string) (bool, error) {
+	ctx, span := startSpan(ctx, "IsWorkspaceSuspended")
+	defer span.End()
+
+	var suspended bool
+	err := w.DB.QueryRowContext(ctx, `
+		SELECT suspended_at IS NOT NULL FROM workspaces WHERE name = $1`,
+		workspaceName).Scan(&suspended)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error checking workspace suspension: %w", err)
+	}
+
+	return suspended, nil
+}
+
+// ReactivateWorkspace lifts the suspension of a workspace. It returns false if the workspace
+// was not suspended.
+func (w *WorkspaceDB) ReactivateWorkspace(ctx context.Context, workspaceName string) (bool, error) {
+	ctx, span := startSpan(ctx, "ReactivateWorkspace")
+	defer span.End()
+
+	result, err := w.DB.ExecContext(ctx, `
+		UPDATE workspaces SET suspended_at = NULL, suspended_by = NULL
+		WHERE name = $1 AND suspended_at IS NOT NULL AND status != 'Unavailable'`,
+		workspaceName)
+	if err != nil {
+		return false, fmt.Errorf("error reactivating workspace: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking workspace reactivation: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// whereClause joins conditions into a WHERE clause, or returns an empty string if there are
+// none.
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return "\n\t\tWHERE " + strings.Join(conditions, " AND ")
+}
+
+// orderClause orders by the column of sort, or of defaultSort if sort is not one of columns.
+// Ties are broken by tiebreak so that pages do not overlap.
+func orderClause(columns map[string]string, sort, defaultSort string, descending bool, tiebreak string) string {
+	column, ok := columns[sort]
+	if !ok {
+		column = columns[defaultSort]
+	}
+
+	direction := "ASC"
+	if descending {
+		direction = "DESC"
+	}
+	return fmt.Sprintf("\n\t\tORDER BY %s %s, %s %s", column, direction, tiebreak, direction)
+}
+
+// pageClause adds the offset and limit to args and returns the clause using them. A limit of
+// zero returns every row after the offset.
+func pageClause(args *[]interface{}, offset, limit int) string {
+	clause := ""
+	if limit > 0 {
+		*args = append(*args, limit)
+		clause += fmt.Sprintf("\n\t\tLIMIT $%d", len(*args))
+	}
+	*args = append(*args, offset)
+	clause += fmt.Sprintf(" OFFSET $%d", len(*args))
+	return clause
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -10,10 +10,13 @@ import (
 
 	ws_manager "github.com/EO-DataHub/eodhp-workspace-manager/models"
 	"github.com/EO-DataHub/eodhp-workspace-services/internal/appconfig"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/tracing"
 	ws_services "github.com/EO-DataHub/eodhp-workspace-services/models"
 	"github.com/google/uuid"
 	"github.com/pressly/goose/v3"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 //go:embed migrations/*.sql
@@ -22,24 +25,54 @@ var embedMigrations embed.FS
 // WorkspaceDBInterface defines the database operations.
 type WorkspaceDBInterface interface {
 	Close() error
-	GetAccounts(accountOwner string) ([]ws_services.Account, error)
-	GetAccount(accountID uuid.UUID) (*ws_services.Account, error)
-	CreateAccount(req *ws_services.Account) (*ws_services.Account, error)
-	UpdateAccount(accountID uuid.UUID, account ws_services.Account) (*ws_services.Account, error)
-	DeleteAccount(accountID uuid.UUID) error
-	CheckAccountIsVerified(accountID uuid.UUID) (bool, error)
-	IsUserAccountOwner(username, workspaceID string) (bool, error)
-	CreateAccountApprovalToken(accountID uuid.UUID) (string, error)
-	ValidateApprovalToken(token string) (string, error)
-	UpdateAccountStatus(token, accountID, status string) error
-	GetWorkspace(workspace_name string) (*ws_manager.WorkspaceSettings, error)
-	GetUserWorkspaces(memberGroups []string) ([]ws_manager.WorkspaceSettings, error)
-	GetOwnedWorkspaces(username string) ([]ws_manager.WorkspaceSettings, error)
-	CheckWorkspaceExists(name string) (bool, error)
-	UpdateWorkspaceStatus(status ws_manager.WorkspaceStatus) error
-	DisableWorkspace(workspaceName string) error
-	CreateWorkspace(req *ws_manager.WorkspaceSettings) (*sql.Tx, error)
-	CommitTransaction(tx *sql.Tx) error
+	GetAccounts(ctx context.Context, accountOwner string) ([]ws_services.Account, error)
+	GetAccount(ctx context.Context, accountID uuid.UUID) (*ws_services.Account, error)
+	CreateAccount(ctx context.Context, req *ws_services.Account) (*ws_services.Account, error)
+	UpdateAccount(ctx context.Context, accountID uuid.UUID, account ws_services.Account, version int) (*ws_services.Account, error)
+	DeleteAccount(ctx context.Context, accountID uuid.UUID, version int, deletedBy string) (bool, error)
+	CloseAccount(ctx context.Context, accountID uuid.UUID, closedBy string) ([]string, error)
+	FinishAccountClosure(ctx context.Context, workspaceName string) (bool, error)
+	CheckAccountIsVerified(ctx context.Context, accountID uuid.UUID) (bool, string, error)
+	IsUserAccountOwner(ctx context.Context, username, workspaceID string) (bool, error)
+	ListAccounts(ctx context.Context, opts ws_services.AccountListOptions) ([]ws_services.AdminAccount, error)
+	SetAccountStatus(ctx context.Context, accountID uuid.UUID, from []string, to, changedBy, reason string) (*ws_services.AccountStatusChange, error)
+	ListAccountStatusChanges(ctx context.Context, accountID uuid.UUID) ([]ws_services.AccountStatusChange, error)
+	DecideAccount(ctx context.Context, accountID uuid.UUID, status, decidedBy, reason string) (*ws_services.AccountDecision, error)
+	GetWorkspace(ctx context.Context, workspace_name string) (*ws_manager.WorkspaceSettings, error)
+	GetWorkspaceAccountStatus(ctx context.Context, workspaceName string) (string, error)
+	GetUserWorkspaces(ctx context.Context, memberGroups []string) ([]ws_manager.WorkspaceSettings, error)
+	GetOwnedWorkspaces(ctx context.Context, username string) ([]ws_manager.WorkspaceSettings, error)
+	GetAllWorkspaces(ctx context.Context) ([]string, error)
+	GetUnavailableWorkspaces(ctx context.Context) ([]ws_manager.WorkspaceSettings, error)
+	CheckWorkspaceExists(ctx context.Context, name string) (bool, error)
+	CheckAvailableWorkspaceExists(ctx context.Context, name string) (bool, error)
+	ListWorkspaces(ctx context.Context, opts ws_services.WorkspaceListOptions) ([]ws_services.AdminWorkspace, error)
+	SuspendWorkspace(ctx context.Context, workspaceName, suspendedBy string) (bool, error)
+	ReactivateWorkspace(ctx context.Context, workspaceName string) (bool, error)
+	IsWorkspaceSuspended(ctx context.Context, workspaceName string) (bool, error)
+	GetWorkspaceRole(ctx context.Context, workspaceName, userID string) (string, error)
+	GetWorkspaceRoles(ctx context.Context, workspaceName string) (map[string]string, error)
+	SetWorkspaceRole(ctx context.Context, workspaceName, userID, username, role, grantedBy string) error
+	DeleteWorkspaceRole(ctx context.Context, workspaceName, userID string) error
+	CreateWorkspaceInvitation(ctx context.Context, workspaceName, email, role, invitedBy string, expiry time.Duration) (*ws_services.WorkspaceInvitation, error)
+	GetWorkspaceInvitations(ctx context.Context, workspaceName string) ([]ws_services.WorkspaceInvitation, error)
+	GetWorkspaceInvitationByToken(ctx context.Context, token string) (*ws_services.WorkspaceInvitation, error)
+	DeleteWorkspaceInvitation(ctx context.Context, workspaceName string, invitationID uuid.UUID) (bool, error)
+	UpdateWorkspaceStatus(ctx context.Context, status ws_manager.WorkspaceStatus) error
+	DisableWorkspace(ctx context.Context, workspaceName string) error
+	CreateWorkspace(ctx context.Context, req *ws_manager.WorkspaceSettings) error
+	UpdateWorkspace(ctx context.Context, req *ws_manager.WorkspaceSettings) error
+	ScheduleWorkspaceDeletion(ctx context.Context, workspaceName, requestedBy string, gracePeriod time.Duration) (time.Time, error)
+	CancelWorkspaceDeletion(ctx context.Context, workspaceName string) (bool, error)
+	EnqueueExpiredWorkspaceDeletions(ctx context.Context, limit int) ([]string, error)
+	EnqueueWorkspaceEvent(ctx context.Context, event ws_manager.WorkspaceSettings) error
+	ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]ws_services.OutboxEvent, error)
+	MarkOutboxEventSent(ctx context.Context, id int64) error
+	MarkOutboxEventFailed(ctx context.Context, id int64, errMsg string, nextAttempt time.Time, permanent bool) error
+	CreateWorkspaceSaga(ctx context.Context, saga *ws_services.WorkspaceCreationSaga) error
+	UpdateWorkspaceSaga(ctx context.Context, sagaID uuid.UUID, step, status, errMsg string) error
+	GetUnfinishedWorkspaceSagas(ctx context.Context, olderThan time.Duration) ([]ws_services.WorkspaceCreationSaga, error)
+	CheckNewerWorkspaceSagaExists(ctx context.Context, saga ws_services.WorkspaceCreationSaga) (bool, error)
 }
 
 // WorkspaceDB wraps database, events, and logging functionalities.
@@ -108,13 +141,13 @@ func (w *WorkspaceDB) Migrate() error {
 }
 
 // execQuery executes a SQL query within a transaction.
-func (w *WorkspaceDB) execQuery(tx *sql.Tx, query string, args ...interface{}) error {
+func (w *WorkspaceDB) execQuery(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) error {
 
 	if w.DB == nil {
 		return fmt.Errorf("database connection is not established")
 	}
 
-	_, err := tx.Exec(query, args...)
+	_, err := tx.ExecContext(ctx, query, args...)
 	if err != nil {
 		return err
 	}
@@ -128,3 +161,12 @@ func (w *WorkspaceDB) CommitTransaction(tx *sql.Tx) error {
 	}
 	return nil
 }
+
+// startSpan starts a span for a database operation.
+func startSpan(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "db."+operation, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation.name", operation),
+		))
+}
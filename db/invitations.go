@@ -0,0 +1,129 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
+	ws_services "github.com/EO-DataHub/eodhp-workspace-services/models"
+	"github.com/google/uuid"
+)
+
+// CreateWorkspaceInvitation invites the owner of email to join a workspace with role until the
+// invitation expires. Inviting an email address that already has a pending invitation to the
+// workspace replaces it, so that the new token is the only one that can be used.
+func (w *WorkspaceDB) CreateWorkspaceInvitation(ctx context.Context, workspaceName, email, role, invitedBy string, expiry time.Duration) (*ws_services.WorkspaceInvitation, error) {
+	ctx, span := startSpan(ctx, "CreateWorkspaceInvitation")
+	defer span.End()
+
+	token, err := authn.GenerateToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	invitation := ws_services.WorkspaceInvitation{
+		Workspace: workspaceName,
+		Email:     email,
+		Role:      role,
+		InvitedBy: invitedBy,
+		ExpiresAt: time.Now().Add(expiry).UTC(),
+		Token:     token,
+	}
+
+	err = w.DB.QueryRowContext(ctx, `
+		INSERT INTO workspace_invitations (id, workspace_id, email, role, invited_by, invitation_token, token_expires_at)
+		SELECT $1, id, $3, $4, $5, $6, $7 FROM workspaces WHERE name = $2
+		ON CONFLICT (workspace_id, email) DO UPDATE
+		SET role = EXCLUDED.role, invited_by = EXCLUDED.invited_by, invitation_token = EXCLUDED.invitation_token,
+			token_expires_at = EXCLUDED.token_expires_at, created_at = NOW()
+		RETURNING id, created_at`,
+		uuid.New(), workspaceName, email, role, invitedBy, token, invitation.ExpiresAt).
+		Scan(&invitation.ID, &invitation.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("workspace not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating workspace invitation: %w", err)
+	}
+
+	return &invitation, nil
+}
+
+// GetWorkspaceInvitations returns the invitations to a workspace that have not expired.
+func (w *WorkspaceDB) GetWorkspaceInvitations(ctx context.Context, workspaceName string) ([]ws_services.WorkspaceInvitation, error) {
+	ctx, span := startSpan(ctx, "GetWorkspaceInvitations")
+	defer span.End()
+
+	rows, err := w.DB.QueryContext(ctx, `
+		SELECT i.id, ws.name, i.email, i.role, i.invited_by, i.created_at, i.token_expires_at
+		FROM workspace_invitations i
+		JOIN workspaces ws ON ws.id = i.workspace_id
+		WHERE ws.name = $1 AND i.token_expires_at > NOW()
+		ORDER BY i.created_at`,
+		workspaceName)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving workspace invitations: %w", err)
+	}
+	defer rows.Close()
+
+	var invitations []ws_services.WorkspaceInvitation
+	for rows.Next() {
+		var invitation ws_services.WorkspaceInvitation
+		if err := rows.Scan(&invitation.ID, &invitation.Workspace, &invitation.Email, &invitation.Role,
+			&invitation.InvitedBy, &invitation.CreatedAt, &invitation.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("error scanning workspace invitation: %w", err)
+		}
+		invitations = append(invitations, invitation)
+	}
+
+	return invitations, rows.Err()
+}
+
+// GetWorkspaceInvitationByToken returns the invitation with token, or nil if there is none.
+// Expired invitations are returned so that the caller can tell the invitee.
+func (w *WorkspaceDB) GetWorkspaceInvitationByToken(ctx context.Context, token string) (*ws_services.WorkspaceInvitation, error) {
+	ctx, span := startSpan(ctx, "GetWorkspaceInvitationByToken")
+	defer span.End()
+
+	invitation := ws_services.WorkspaceInvitation{Token: token}
+	err := w.DB.QueryRowContext(ctx, `
+		SELECT i.id, ws.name, i.email, i.role, i.invited_by, i.created_at, i.token_expires_at
+		FROM workspace_invitations i
+		JOIN workspaces ws ON ws.id = i.workspace_id
+		WHERE i.invitation_token = $1`,
+		token).Scan(&invitation.ID, &invitation.Workspace, &invitation.Email, &invitation.Role,
+		&invitation.InvitedBy, &invitation.CreatedAt, &invitation.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving workspace invitation: %w", err)
+	}
+
+	return &invitation, nil
+}
+
+// DeleteWorkspaceInvitation removes an invitation to a workspace once it has been accepted,
+// declined or revoked. It reports whether the invitation existed.
+func (w *WorkspaceDB) DeleteWorkspaceInvitation(ctx context.Context, workspaceName string, invitationID uuid.UUID) (bool, error) {
+	ctx, span := startSpan(ctx, "DeleteWorkspaceInvitation")
+	defer span.End()
+
+	result, err := w.DB.ExecContext(ctx, `
+		DELETE FROM workspace_invitations i
+		USING workspaces ws
+		WHERE ws.id = i.workspace_id AND ws.name = $1 AND i.id = $2`,
+		workspaceName, invitationID)
+	if err != nil {
+		return false, fmt.Errorf("error deleting workspace invitation: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking deleted workspace invitation: %w", err)
+	}
+
+	return rows > 0, nil
+}
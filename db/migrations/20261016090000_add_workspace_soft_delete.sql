@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workspaces ADD COLUMN deletion_scheduled_at TIMESTAMPTZ NULL;
+ALTER TABLE workspaces ADD COLUMN deletion_requested_by TEXT NULL;
+CREATE INDEX IF NOT EXISTS idx_workspaces_deletion_scheduled_at ON workspaces (deletion_scheduled_at) WHERE deletion_scheduled_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_workspaces_deletion_scheduled_at;
+ALTER TABLE workspaces DROP COLUMN IF EXISTS deletion_requested_by;
+ALTER TABLE workspaces DROP COLUMN IF EXISTS deletion_scheduled_at;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS workspace_creation_sagas (
+				id UUID PRIMARY KEY,
+				workspace_name VARCHAR(255) NOT NULL,
+				account UUID NOT NULL,
+				owner TEXT NOT NULL,
+				owner_id TEXT NOT NULL,
+				step VARCHAR(50) NOT NULL DEFAULT '',
+				status VARCHAR(50) NOT NULL,
+				error TEXT NULL,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_workspace_creation_sagas_status ON workspace_creation_sagas (status, updated_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS workspace_creation_sagas;
+-- +goose StatementEnd
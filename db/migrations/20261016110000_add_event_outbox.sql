@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS event_outbox (
+				id BIGSERIAL PRIMARY KEY,
+				aggregate VARCHAR(255) NOT NULL,
+				payload JSONB NOT NULL,
+				status VARCHAR(50) NOT NULL DEFAULT 'Pending',
+				attempts INT NOT NULL DEFAULT 0,
+				last_error TEXT NULL,
+				next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				locked_until TIMESTAMPTZ NULL,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				sent_at TIMESTAMPTZ NULL
+);
+CREATE INDEX IF NOT EXISTS idx_event_outbox_pending ON event_outbox (next_attempt_at, id) WHERE status = 'Pending';
+CREATE INDEX IF NOT EXISTS idx_event_outbox_aggregate ON event_outbox (aggregate, id) WHERE status = 'Pending';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS event_outbox;
+-- +goose StatementEnd
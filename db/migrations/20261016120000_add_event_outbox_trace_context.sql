@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE event_outbox ADD COLUMN IF NOT EXISTS trace_context JSONB NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE event_outbox DROP COLUMN IF EXISTS trace_context;
+-- +goose StatementEnd
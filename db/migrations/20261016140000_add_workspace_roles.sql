@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS workspace_roles (
+				workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+				user_id VARCHAR(255) NOT NULL,
+				username VARCHAR(255) NOT NULL,
+				role VARCHAR(50) NOT NULL,
+				granted_by VARCHAR(255) NOT NULL,
+				updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				PRIMARY KEY (workspace_id, user_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS workspace_roles;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS workspace_invitations (
+				id UUID PRIMARY KEY,
+				workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+				email VARCHAR(255) NOT NULL,
+				role VARCHAR(50) NOT NULL,
+				invited_by VARCHAR(255) NOT NULL,
+				invitation_token VARCHAR(255) UNIQUE NOT NULL,
+				token_expires_at TIMESTAMPTZ NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				UNIQUE (workspace_id, email)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS workspace_invitations;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workspaces ADD COLUMN suspended_at TIMESTAMPTZ NULL;
+ALTER TABLE workspaces ADD COLUMN suspended_by TEXT NULL;
+ALTER TABLE workspaces ADD COLUMN created_at TIMESTAMPTZ NULL;
+UPDATE workspaces SET created_at = last_updated;
+ALTER TABLE workspaces ALTER COLUMN created_at SET DEFAULT NOW();
+ALTER TABLE workspaces ALTER COLUMN created_at SET NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_accounts_status ON accounts (status);
+CREATE INDEX IF NOT EXISTS idx_workspaces_account ON workspaces (account);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_workspaces_account;
+DROP INDEX IF EXISTS idx_accounts_status;
+ALTER TABLE workspaces DROP COLUMN IF EXISTS created_at;
+ALTER TABLE workspaces DROP COLUMN IF EXISTS suspended_by;
+ALTER TABLE workspaces DROP COLUMN IF EXISTS suspended_at;
+-- +goose StatementEnd
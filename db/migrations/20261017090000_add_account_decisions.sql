@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS account_decisions (
+				id UUID PRIMARY KEY,
+				account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+				status VARCHAR(50) NOT NULL,
+				decided_by VARCHAR(255) NOT NULL,
+				reason TEXT NOT NULL DEFAULT '',
+				decided_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_account_decisions_account ON account_decisions (account_id);
+
+-- Accounts are approved through the admin API rather than emailed links
+DROP TABLE IF EXISTS account_approvals;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS account_approvals (
+				id UUID PRIMARY KEY,
+				account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+				approval_token VARCHAR(255) UNIQUE NOT NULL,
+				token_expires_at TIMESTAMPTZ NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+DROP TABLE IF EXISTS account_decisions;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Incremented by every update so that clients can detect concurrent changes
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE accounts DROP COLUMN IF EXISTS version;
+-- +goose StatementEnd
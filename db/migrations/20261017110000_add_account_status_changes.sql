@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Status changes are kept after the account is deleted, so the account is not a foreign key
+CREATE TABLE IF NOT EXISTS account_status_changes (
+				id UUID PRIMARY KEY,
+				account_id UUID NOT NULL,
+				from_status VARCHAR(50) NOT NULL,
+				to_status VARCHAR(50) NOT NULL,
+				changed_by VARCHAR(255) NOT NULL,
+				reason TEXT NOT NULL DEFAULT '',
+				changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_account_status_changes_account ON account_status_changes (account_id, changed_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS account_status_changes;
+-- +goose StatementEnd
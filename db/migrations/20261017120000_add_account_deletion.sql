@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Deleted accounts are kept so that their deleted workspaces and decisions are not removed with them
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM accounts WHERE deleted_at IS NOT NULL;
+ALTER TABLE accounts DROP COLUMN IF EXISTS deleted_at;
+-- +goose StatementEnd
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	ws_manager "github.com/EO-DataHub/eodhp-workspace-manager/models"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/requestid"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/tracing"
+	ws_services "github.com/EO-DataHub/eodhp-workspace-services/models"
+)
+
+// insertOutboxEvent adds a workspace event to the outbox within the transaction of the change it describes.
+func (w *WorkspaceDB) insertOutboxEvent(ctx context.Context, tx *sql.Tx, event ws_manager.WorkspaceSettings) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error serializing event: %w", err)
+	}
+
+	// Keep the trace and ID of the request so that publishing the event can be correlated with it
+	carrier := tracing.Inject(ctx)
+	if id := requestid.FromContext(ctx); id != "" {
+		carrier[requestid.Property] = id
+	}
+	traceContext, err := json.Marshal(carrier)
+	if err != nil {
+		return fmt.Errorf("error serializing trace context: %w", err)
+	}
+
+	err = w.execQuery(ctx, tx, `
+		INSERT INTO event_outbox (aggregate, payload, trace_context)
+		VALUES ($1, $2, $3)`,
+		event.Name, payload, traceContext)
+	if err != nil {
+		return fmt.Errorf("error inserting into event_outbox: %w", err)
+	}
+
+	return nil
+}
+
+// EnqueueWorkspaceEvent adds a workspace event to the outbox for changes that are not stored in the database.
+func (w *WorkspaceDB) EnqueueWorkspaceEvent(ctx context.Context, event ws_manager.WorkspaceSettings) error {
+	ctx, span := startSpan(ctx, "EnqueueWorkspaceEvent")
+	defer span.End()
+
+	tx, err := w.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	if err := w.insertOutboxEvent(ctx, tx, event); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return w.CommitTransaction(tx)
+}
+
+// ClaimOutboxEvents leases up to limit pending events that are due to be published. Events are
+// returned in the order they were written and an event is not claimed while an earlier event for
+// the same workspace is still pending, so each workspace's events are published in order.
+// Leased events are not claimed again until the lease expires.
+func (w *WorkspaceDB) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]ws_services.OutboxEvent, error) {
+	ctx, span := startSpan(ctx, "ClaimOutboxEvents")
+	defer span.End()
+
+	rows, err := w.DB.QueryContext(ctx, `
+		UPDATE event_outbox
+		SET locked_until = NOW() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT e.id FROM event_outbox e
+			WHERE e.status = 'Pending'
+			  AND e.next_attempt_at <= NOW()
+			  AND (e.locked_until IS NULL OR e.locked_until < NOW())
+			  AND NOT EXISTS (
+				SELECT 1 FROM event_outbox earlier
+				WHERE earlier.aggregate = e.aggregate AND earlier.status = 'Pending' AND earlier.id < e.id
+			  )
+			ORDER BY e.id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, aggregate, payload, COALESCE(trace_context, '{}'), attempts, created_at`,
+		limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("error claiming outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []ws_services.OutboxEvent
+	for rows.Next() {
+		var event ws_services.OutboxEvent
+		var traceContext []byte
+		if err := rows.Scan(&event.ID, &event.Aggregate, &event.Payload, &traceContext, &event.Attempts, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning outbox event: %w", err)
+		}
+		if err := json.Unmarshal(traceContext, &event.TraceContext); err != nil {
+			return nil, fmt.Errorf("error decoding outbox event trace context: %w", err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading outbox events: %w", err)
+	}
+
+	// RETURNING does not preserve the order of the subquery
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
+
+// MarkOutboxEventSent records that an event has been published.
+func (w *WorkspaceDB) MarkOutboxEventSent(ctx context.Context, id int64) error {
+	ctx, span := startSpan(ctx, "MarkOutboxEventSent")
+	defer span.End()
+
+	_, err := w.DB.ExecContext(ctx, `
+		UPDATE event_outbox
+		SET status = 'Sent', sent_at = NOW(), locked_until = NULL, attempts = attempts + 1, last_error = NULL
+		WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("error marking outbox event as sent: %w", err)
+	}
+	return nil
+}
+
+// MarkOutboxEventFailed records a failed publish attempt. The event is retried at nextAttempt,
+// unless permanent is set, in which case it is never retried.
+func (w *WorkspaceDB) MarkOutboxEventFailed(ctx context.Context, id int64, errMsg string, nextAttempt time.Time, permanent bool) error {
+	ctx, span := startSpan(ctx, "MarkOutboxEventFailed")
+	defer span.End()
+
+	status := "Pending"
+	if permanent {
+		status = "Failed"
+	}
+
+	_, err := w.DB.ExecContext(ctx, `
+		UPDATE event_outbox
+		SET status = $1, attempts = attempts + 1, last_error = $2, next_attempt_at = $3, locked_until = NULL
+		WHERE id = $4`,
+		status, errMsg, nextAttempt, id)
+	if err != nil {
+		return fmt.Errorf("error marking outbox event as failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/ratelimit"
+	"github.com/rs/zerolog/log"
+)
+
+// rateLimitPruneInterval is how often buckets that have refilled are deleted.
+const rateLimitPruneInterval = time.Minute
+
+// RateLimitStore returns a rate limit store that keeps buckets in Postgres, so that limits are
+// enforced across all replicas.
+func (w *WorkspaceDB) RateLimitStore() ratelimit.Store {
+	return &rateLimitStore{db: w}
+}
+
+type rateLimitStore struct {
+	db *WorkspaceDB
+
+	mu     sync.Mutex
+	pruned time.Time
+}
+
+// Take takes a token from the bucket of every key if each of them has one. The buckets' rows are
+// locked for the transaction so that concurrent requests from any replica are counted.
+func (s *rateLimitStore) Take(ctx context.Context, keys ...ratelimit.Key) (ratelimit.Result, error) {
+	var limited []ratelimit.Key
+	for _, key := range keys {
+		if !key.Limit.Unlimited() {
+			limited = append(limited, key)
+		}
+	}
+	if len(limited) == 0 {
+		return ratelimit.Result{Allowed: true}, nil
+	}
+
+	// Rows are always locked in the same order so that concurrent requests cannot deadlock
+	sort.Slice(limited, func(i, j int) bool { return limited[i].Name < limited[j].Name })
+
+	ctx, span := startSpan(ctx, "TakeRateLimitToken")
+	defer span.End()
+
+	tx, err := s.db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return ratelimit.Result{}, fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	updated := make([]ratelimit.Bucket, len(limited))
+	for i, key := range limited {
+		// New keys start with a full bucket. The no-op update locks existing rows and returns them.
+		var bucket ratelimit.Bucket
+		var now time.Time
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO rate_limit_buckets (key, tokens, updated_at, full_at)
+			VALUES ($1, $2, NOW(), NOW())
+			ON CONFLICT (key) DO UPDATE SET key = EXCLUDED.key
+			RETURNING tokens, updated_at, NOW()`,
+			key.Name, key.Limit.Burst).Scan(&bucket.Tokens, &bucket.Updated, &now)
+		if err != nil {
+			tx.Rollback()
+			return ratelimit.Result{}, fmt.Errorf("error reading rate limit bucket: %w", err)
+		}
+
+		bucket, result := bucket.Take(now, key.Limit)
+		if !result.Allowed {
+			// No tokens are taken from the other buckets
+			tx.Rollback()
+			result.Key = key.Name
+			return result, nil
+		}
+		updated[i] = bucket
+	}
+
+	for i, key := range limited {
+		err = s.db.execQuery(ctx, tx, `
+			UPDATE rate_limit_buckets SET tokens = $2, updated_at = $3, full_at = $4
+			WHERE key = $1`,
+			key.Name, updated[i].Tokens, updated[i].Updated, updated[i].FullAt(key.Limit))
+		if err != nil {
+			tx.Rollback()
+			return ratelimit.Result{}, fmt.Errorf("error updating rate limit bucket: %w", err)
+		}
+	}
+
+	if err := s.db.CommitTransaction(tx); err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	s.prune(ctx)
+
+	return ratelimit.Result{Allowed: true}, nil
+}
+
+// prune deletes buckets that have refilled, at most once per interval on each replica.
+func (s *rateLimitStore) prune(ctx context.Context) {
+	s.mu.Lock()
+	if time.Since(s.pruned) < rateLimitPruneInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.pruned = time.Now()
+	s.mu.Unlock()
+
+	if _, err := s.db.DB.ExecContext(ctx, `DELETE FROM rate_limit_buckets WHERE full_at <= NOW()`); err != nil {
+		log.Warn().Err(err).Msg("Failed to prune rate limit buckets")
+	}
+}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// GetWorkspaceRole returns the role given to a user in a workspace, or an empty string if they
+// have not been given one.
+func (w *WorkspaceDB) GetWorkspaceRole(ctx context.Context, workspaceName, userID string) (string, error) {
+	ctx, span := startSpan(ctx, "GetWorkspaceRole")
+	defer span.End()
+
+	var role string
+	err := w.DB.QueryRowContext(ctx, `
+		SELECT r.role FROM workspace_roles r
+		JOIN workspaces ws ON ws.id = r.workspace_id
+		WHERE ws.name = $1 AND r.user_id = $2`,
+		workspaceName, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error retrieving workspace role: %w", err)
+	}
+
+	return role, nil
+}
+
+// GetWorkspaceRoles returns the roles given to users in a workspace, keyed by user ID.
+func (w *WorkspaceDB) GetWorkspaceRoles(ctx context.Context, workspaceName string) (map[string]string, error) {
+	ctx, span := startSpan(ctx, "GetWorkspaceRoles")
+	defer span.End()
+
+	rows, err := w.DB.QueryContext(ctx, `
+		SELECT r.user_id, r.role FROM workspace_roles r
+		JOIN workspaces ws ON ws.id = r.workspace_id
+		WHERE ws.name = $1`,
+		workspaceName)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving workspace roles: %w", err)
+	}
+	defer rows.Close()
+
+	roles := make(map[string]string)
+	for rows.Next() {
+		var userID, role string
+		if err := rows.Scan(&userID, &role); err != nil {
+			return nil, fmt.Errorf("error scanning workspace role: %w", err)
+		}
+		roles[userID] = role
+	}
+
+	return roles, rows.Err()
+}
+
+// SetWorkspaceRole gives a user a role in a workspace, replacing any role they had.
+func (w *WorkspaceDB) SetWorkspaceRole(ctx context.Context, workspaceName, userID, username, role, grantedBy string) error {
+	ctx, span := startSpan(ctx, "SetWorkspaceRole")
+	defer span.End()
+
+	result, err := w.DB.ExecContext(ctx, `
+		INSERT INTO workspace_roles (workspace_id, user_id, username, role, granted_by)
+		SELECT id, $2, $3, $4, $5 FROM workspaces WHERE name = $1
+		ON CONFLICT (workspace_id, user_id) DO UPDATE
+		SET username = EXCLUDED.username, role = EXCLUDED.role,
+			granted_by = EXCLUDED.granted_by, updated_at = NOW()`,
+		workspaceName, userID, username, role, grantedBy)
+	if err != nil {
+		return fmt.Errorf("error setting workspace role: %w", err)
+	}
+
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return fmt.Errorf("workspace not found")
+	}
+
+	return nil
+}
+
+// DeleteWorkspaceRole removes the role given to a user in a workspace.
+func (w *WorkspaceDB) DeleteWorkspaceRole(ctx context.Context, workspaceName, userID string) error {
+	ctx, span := startSpan(ctx, "DeleteWorkspaceRole")
+	defer span.End()
+
+	_, err := w.DB.ExecContext(ctx, `
+		DELETE FROM workspace_roles r
+		USING workspaces ws
+		WHERE ws.id = r.workspace_id AND ws.name = $1 AND r.user_id = $2`,
+		workspaceName, userID)
+	if err != nil {
+		return fmt.Errorf("error deleting workspace role: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	ws_services "github.com/EO-DataHub/eodhp-workspace-services/models"
+	"github.com/google/uuid"
+)
+
+// CreateWorkspaceSaga records the start of a workspace creation saga.
+func (w *WorkspaceDB) CreateWorkspaceSaga(ctx context.Context, saga *ws_services.WorkspaceCreationSaga) error {
+	ctx, span := startSpan(ctx, "CreateWorkspaceSaga")
+	defer span.End()
+
+	_, err := w.DB.ExecContext(ctx, `
+		INSERT INTO workspace_creation_sagas (id, workspace_name, account, owner, owner_id, step, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		saga.ID, saga.Workspace, saga.Account, saga.Owner, saga.OwnerID, saga.Step, saga.Status)
+	if err != nil {
+		return fmt.Errorf("error inserting workspace creation saga: %w", err)
+	}
+	return nil
+}
+
+// UpdateWorkspaceSaga records the last completed step and status of a workspace creation saga.
+func (w *WorkspaceDB) UpdateWorkspaceSaga(ctx context.Context, sagaID uuid.UUID, step, status, errMsg string) error {
+	ctx, span := startSpan(ctx, "UpdateWorkspaceSaga")
+	defer span.End()
+
+	_, err := w.DB.ExecContext(ctx, `
+		UPDATE workspace_creation_sagas
+		SET step = $1, status = $2, error = NULLIF($3, ''), updated_at = NOW()
+		WHERE id = $4`,
+		step, status, errMsg, sagaID)
+	if err != nil {
+		return fmt.Errorf("error updating workspace creation saga: %w", err)
+	}
+	return nil
+}
+
+// GetUnfinishedWorkspaceSagas retrieves sagas that are still running, compensating or failed to
+// compensate and have not been updated for at least olderThan.
+func (w *WorkspaceDB) GetUnfinishedWorkspaceSagas(ctx context.Context, olderThan time.Duration) ([]ws_services.WorkspaceCreationSaga, error) {
+	ctx, span := startSpan(ctx, "GetUnfinishedWorkspaceSagas")
+	defer span.End()
+
+	rows, err := w.DB.QueryContext(ctx, `
+		SELECT id, workspace_name, account, owner, owner_id, step, status, COALESCE(error, ''), created_at, updated_at
+		FROM workspace_creation_sagas
+		WHERE status IN ('Running', 'Compensating', 'Failed')
+		  AND updated_at < NOW() - make_interval(secs => $1)
+		ORDER BY created_at`,
+		olderThan.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving workspace creation sagas: %w", err)
+	}
+	defer rows.Close()
+
+	var sagas []ws_services.WorkspaceCreationSaga
+	for rows.Next() {
+		var saga ws_services.WorkspaceCreationSaga
+		if err := rows.Scan(&saga.ID, &saga.Workspace, &saga.Account, &saga.Owner, &saga.OwnerID,
+			&saga.Step, &saga.Status, &saga.Error, &saga.CreatedAt, &saga.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning workspace creation saga: %w", err)
+		}
+		sagas = append(sagas, saga)
+	}
+
+	return sagas, rows.Err()
+}
+
+// CheckNewerWorkspaceSagaExists checks if an unfinished saga for the same workspace name was
+// started after saga.
+func (w *WorkspaceDB) CheckNewerWorkspaceSagaExists(ctx context.Context, saga ws_services.WorkspaceCreationSaga) (bool, error) {
+	ctx, span := startSpan(ctx, "CheckNewerWorkspaceSagaExists")
+	defer span.End()
+
+	var exists bool
+	err := w.DB.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM workspace_creation_sagas
+			WHERE workspace_name = $1 AND id != $2 AND created_at > $3
+			  AND status IN ('Running', 'Compensating', 'Failed'))`,
+		saga.Workspace, saga.ID, saga.CreatedAt).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("error checking for newer workspace creation sagas: %w", err)
+	}
+	return exists, nil
+}
@@ -1,9 +1,11 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	ws_manager "github.com/EO-DataHub/eodhp-workspace-manager/models"
 	"github.com/google/uuid"
@@ -11,8 +13,13 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// WorkspaceStatusDeleting is stored and published for workspaces whose deletion event has been queued.
+const WorkspaceStatusDeleting = "deleting"
+
 // getWorkspace retrieves a workspace by name.
-func (db *WorkspaceDB) GetWorkspace(workspace_name string) (*ws_manager.WorkspaceSettings, error) {
+func (db *WorkspaceDB) GetWorkspace(ctx context.Context, workspace_name string) (*ws_manager.WorkspaceSettings, error) {
+	ctx, span := startSpan(ctx, "GetWorkspace")
+	defer span.End()
 
 	// Check that the workspace exists
 	query := `
@@ -21,7 +28,7 @@ func (db *WorkspaceDB) GetWorkspace(workspace_name string) (*ws_manager.Workspac
 		workspaces.name, 
 		workspaces.account, 
 		accounts.account_owner as owner, 
-		workspaces.status, 
+		CASE WHEN workspaces.deletion_scheduled_at IS NOT NULL THEN 'PendingDeletion' WHEN workspaces.suspended_at IS NOT NULL THEN 'Suspended' ELSE workspaces.status END AS status, 
 		workspaces.last_updated
 	FROM 
 		workspaces
@@ -30,7 +37,7 @@ func (db *WorkspaceDB) GetWorkspace(workspace_name string) (*ws_manager.Workspac
 	WHERE 
 		workspaces.name = $1 AND workspaces.status != 'Unavailable'
 	`
-	rows, err := db.DB.Query(query, workspace_name)
+	rows, err := db.DB.QueryContext(ctx, query, workspace_name)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving workspace: %w", err)
 	}
@@ -41,13 +48,15 @@ func (db *WorkspaceDB) GetWorkspace(workspace_name string) (*ws_manager.Workspac
 		if err := rows.Scan(&ws.ID, &ws.Name, &ws.Account, &ws.Owner, &ws.Status, &ws.LastUpdated); err != nil {
 			return nil, fmt.Errorf("error scanning workspace: %w", err)
 		}
+	} else if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error retrieving workspace: %w", err)
 	} else {
-		return nil, fmt.Errorf("workspace not found")
+		return nil, fmt.Errorf("workspace not found: %w", sql.ErrNoRows)
 	}
 
 	// Attach the stores to this workspace
 	workspaces := []ws_manager.WorkspaceSettings{ws}
-	workspacesWithStores, err := db.getWorkspaceStores(workspaces)
+	workspacesWithStores, err := db.getWorkspaceStores(ctx, workspaces)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving workspace stores: %w", err)
 	}
@@ -56,15 +65,17 @@ func (db *WorkspaceDB) GetWorkspace(workspace_name string) (*ws_manager.Workspac
 }
 
 // GetUserWorkspaces retrieves workspaces accessible to the specified member groups.
-func (db *WorkspaceDB) GetUserWorkspaces(memberGroups []string) ([]ws_manager.WorkspaceSettings, error) {
+func (db *WorkspaceDB) GetUserWorkspaces(ctx context.Context, memberGroups []string) ([]ws_manager.WorkspaceSettings, error) {
+	ctx, span := startSpan(ctx, "GetUserWorkspaces")
+	defer span.End()
 
 	// Get the workspaces the user is a member of
-	workspaces, err := db.getWorkspacesByGroup(memberGroups)
+	workspaces, err := db.getWorkspacesByGroup(ctx, memberGroups)
 	if err != nil {
 		return nil, err
 	}
 
-	workspaces, err = db.getWorkspaceStores(workspaces)
+	workspaces, err = db.getWorkspaceStores(ctx, workspaces)
 
 	if err != nil {
 		return nil, err
@@ -74,15 +85,17 @@ func (db *WorkspaceDB) GetUserWorkspaces(memberGroups []string) ([]ws_manager.Wo
 }
 
 // GetOwnedWorkspaces retrieves workspaces owned by the specified username.
-func (db *WorkspaceDB) GetOwnedWorkspaces(username string) ([]ws_manager.WorkspaceSettings, error) {
+func (db *WorkspaceDB) GetOwnedWorkspaces(ctx context.Context, username string) ([]ws_manager.WorkspaceSettings, error) {
+	ctx, span := startSpan(ctx, "GetOwnedWorkspaces")
+	defer span.End()
 
 	// Get the workspaces the user owns
-	workspaces, err := db.getWorkspacesByOwnership(username)
+	workspaces, err := db.getWorkspacesByOwnership(ctx, username)
 	if err != nil {
 		return nil, err
 	}
 
-	workspaces, err = db.getWorkspaceStores(workspaces)
+	workspaces, err = db.getWorkspaceStores(ctx, workspaces)
 
 	if err != nil {
 		return nil, err
@@ -92,12 +105,15 @@ func (db *WorkspaceDB) GetOwnedWorkspaces(username string) ([]ws_manager.Workspa
 }
 
 // GetAllWorkspaces retrieves all workspaces.
-func (db *WorkspaceDB) GetAllWorkspaces() ([]string, error) {
+func (db *WorkspaceDB) GetAllWorkspaces(ctx context.Context) ([]string, error) {
+	ctx, span := startSpan(ctx, "GetAllWorkspaces")
+	defer span.End()
+
 	// Query to select all workspaces without filtering by member group
 	query := `SELECT name FROM workspaces WHERE status != 'Unavailable'`
 
 	// Execute the query
-	rows, err := db.DB.Query(query)
+	rows, err := db.DB.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving workspaces: %w", err)
 	}
@@ -117,23 +133,54 @@ func (db *WorkspaceDB) GetAllWorkspaces() ([]string, error) {
 	return workspaceNames, nil
 }
 
-// CreateWorkspace starts a transaction to insert a new workspace record.
-func (w *WorkspaceDB) CreateWorkspace(req *ws_manager.WorkspaceSettings) (*sql.Tx, error) {
-	tx, err := w.DB.Begin()
+// GetUnavailableWorkspaces retrieves the name and deletion time of every deleted workspace.
+func (db *WorkspaceDB) GetUnavailableWorkspaces(ctx context.Context) ([]ws_manager.WorkspaceSettings, error) {
+	ctx, span := startSpan(ctx, "GetUnavailableWorkspaces")
+	defer span.End()
+
+	rows, err := db.DB.QueryContext(ctx, `SELECT name, last_updated FROM workspaces WHERE status = 'Unavailable'`)
 	if err != nil {
-		return nil, fmt.Errorf("error starting transaction: %w", err)
+		return nil, fmt.Errorf("error retrieving deleted workspaces: %w", err)
+	}
+	defer rows.Close()
+
+	var workspaces []ws_manager.WorkspaceSettings
+	for rows.Next() {
+		var ws ws_manager.WorkspaceSettings
+		if err := rows.Scan(&ws.Name, &ws.LastUpdated); err != nil {
+			return nil, fmt.Errorf("error scanning deleted workspace: %w", err)
+		}
+		workspaces = append(workspaces, ws)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading deleted workspaces: %w", err)
+	}
+
+	return workspaces, nil
+}
+
+// CreateWorkspace inserts a new workspace record and queues its creation event in a single transaction.
+func (w *WorkspaceDB) CreateWorkspace(ctx context.Context, req *ws_manager.WorkspaceSettings) error {
+	ctx, span := startSpan(ctx, "CreateWorkspace")
+	defer span.End()
+
+	tx, err := w.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
 	}
 
 	// Generate a new workspace ID
 	workspaceID := uuid.New()
 
-	err = w.execQuery(tx, `
+	err = w.execQuery(ctx, tx, `
 		INSERT INTO workspaces (id, name, account, status, last_updated)
 		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)`,
 		workspaceID, req.Name, req.Account, req.Status)
 	if err != nil {
-		return nil, fmt.Errorf("error inserting workspace: %w", err)
+		tx.Rollback()
+		return fmt.Errorf("error inserting workspace: %w", err)
 	}
+	req.ID = workspaceID
 
 	// Insert into workspace_stores and then into object_stores/block_stores
 	if req.Stores != nil {
@@ -144,23 +191,23 @@ func (w *WorkspaceDB) CreateWorkspace(req *ws_manager.WorkspaceSettings) (*sql.T
 				storeID := uuid.New()
 
 				// Insert into `workspace_stores`
-				err = w.execQuery(tx, `
+				err = w.execQuery(ctx, tx, `
                     INSERT INTO workspace_stores (id, workspace_id, store_type, name)
                     VALUES ($1, $2, $3, $4)`,
 					storeID, workspaceID, "object", object.Name)
 				if err != nil {
 					tx.Rollback()
-					return nil, fmt.Errorf("error inserting into workspace_stores (object): %w", err)
+					return fmt.Errorf("error inserting into workspace_stores (object): %w", err)
 				}
 
 				// Insert into `object_stores` using the generated store ID
-				err = w.execQuery(tx, `
+				err = w.execQuery(ctx, tx, `
                     INSERT INTO object_stores (store_id, path, env_var, access_point_arn)
                     VALUES ($1, $2, $3, $4)`,
 					storeID, object.Prefix, object.EnvVar, object.AccessPointArn)
 				if err != nil {
 					tx.Rollback()
-					return nil, fmt.Errorf("error inserting into object_stores: %w", err)
+					return fmt.Errorf("error inserting into object_stores: %w", err)
 				}
 			}
 
@@ -169,40 +216,191 @@ func (w *WorkspaceDB) CreateWorkspace(req *ws_manager.WorkspaceSettings) (*sql.T
 				storeID := uuid.New()
 
 				// Insert into `workspace_stores`
-				err = w.execQuery(tx, `
+				err = w.execQuery(ctx, tx, `
                     INSERT INTO workspace_stores (id, workspace_id, store_type, name)
                     VALUES ($1, $2, $3, $4)`,
 					storeID, workspaceID, "block", block.Name)
 				if err != nil {
 					tx.Rollback()
-					return nil, fmt.Errorf("error inserting into workspace_stores (block): %w", err)
+					return fmt.Errorf("error inserting into workspace_stores (block): %w", err)
 				}
 
 				// Insert into `block_stores` using the generated store ID
-				err = w.execQuery(tx, `
+				err = w.execQuery(ctx, tx, `
                     INSERT INTO block_stores (store_id, access_point_id, mount_point)
                     VALUES ($1, $2, $3)`,
 					storeID, block.AccessPointID, block.MountPoint)
 				if err != nil {
 					tx.Rollback()
-					return nil, fmt.Errorf("error inserting into block_stores: %w", err)
+					return fmt.Errorf("error inserting into block_stores: %w", err)
 				}
 			}
 		}
 	}
 
-	return tx, nil
+	if err := w.insertOutboxEvent(ctx, tx, *req); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return w.CommitTransaction(tx)
+}
+
+// UpdateWorkspace updates the mutable settings of a workspace record and queues its update event
+// in a single transaction.
+func (w *WorkspaceDB) UpdateWorkspace(ctx context.Context, req *ws_manager.WorkspaceSettings) error {
+	ctx, span := startSpan(ctx, "UpdateWorkspace")
+	defer span.End()
+
+	tx, err := w.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE workspaces
+		SET status = $1, account = $2, last_updated = CURRENT_TIMESTAMP
+		WHERE id = $3 AND status != 'Unavailable' AND deletion_scheduled_at IS NULL`,
+		req.Status, req.Account, req.ID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error updating workspace: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error checking updated workspace: %w", err)
+	}
+	if rowsAffected == 0 {
+		tx.Rollback()
+		return fmt.Errorf("workspace not found")
+	}
+
+	if err := w.insertOutboxEvent(ctx, tx, *req); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return w.CommitTransaction(tx)
+}
+
+// ScheduleWorkspaceDeletion marks a workspace for deletion once the grace period has passed and
+// returns the time it will be deleted. Scheduling an already pending workspace keeps its original time.
+func (w *WorkspaceDB) ScheduleWorkspaceDeletion(ctx context.Context, workspaceName, requestedBy string, gracePeriod time.Duration) (time.Time, error) {
+	ctx, span := startSpan(ctx, "ScheduleWorkspaceDeletion")
+	defer span.End()
+
+	var scheduledAt time.Time
+	err := w.DB.QueryRowContext(ctx, `
+		UPDATE workspaces
+		SET deletion_scheduled_at = COALESCE(deletion_scheduled_at, NOW() + make_interval(secs => $1)),
+			deletion_requested_by = COALESCE(deletion_requested_by, $2)
+		WHERE name = $3 AND status != 'Unavailable'
+		RETURNING deletion_scheduled_at`,
+		gracePeriod.Seconds(), requestedBy, workspaceName).Scan(&scheduledAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, fmt.Errorf("workspace not found: %w", err)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error scheduling workspace deletion: %w", err)
+	}
+
+	return scheduledAt, nil
+}
+
+// CancelWorkspaceDeletion clears a pending deletion. It returns false if no deletion was pending.
+func (w *WorkspaceDB) CancelWorkspaceDeletion(ctx context.Context, workspaceName string) (bool, error) {
+	ctx, span := startSpan(ctx, "CancelWorkspaceDeletion")
+	defer span.End()
+
+	result, err := w.DB.ExecContext(ctx, `
+		UPDATE workspaces
+		SET deletion_scheduled_at = NULL, deletion_requested_by = NULL
+		WHERE name = $1 AND status != 'Unavailable' AND deletion_scheduled_at IS NOT NULL`,
+		workspaceName)
+	if err != nil {
+		return false, fmt.Errorf("error cancelling workspace deletion: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking cancelled workspace deletion: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// EnqueueExpiredWorkspaceDeletions moves up to limit workspaces whose grace period has passed into
+// the deleting state and queues their deletion events in the same transaction. Rows locked by a
+// concurrent sweeper are skipped.
+func (w *WorkspaceDB) EnqueueExpiredWorkspaceDeletions(ctx context.Context, limit int) ([]string, error) {
+	ctx, span := startSpan(ctx, "EnqueueExpiredWorkspaceDeletions")
+	defer span.End()
+
+	tx, err := w.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		UPDATE workspaces
+		SET status = $1, deletion_scheduled_at = NULL, last_updated = CURRENT_TIMESTAMP
+		WHERE id IN (
+			SELECT id FROM workspaces
+			WHERE deletion_scheduled_at <= NOW() AND status != 'Unavailable'
+			ORDER BY deletion_scheduled_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING name`, WorkspaceStatusDeleting, limit)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error claiming expired workspace deletions: %w", err)
+	}
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return nil, fmt.Errorf("error scanning workspace name: %w", err)
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error reading expired workspace deletions: %w", err)
+	}
+
+	for _, name := range names {
+		var wsSettings ws_manager.WorkspaceSettings
+		wsSettings.Name = name
+		wsSettings.Status = WorkspaceStatusDeleting
+		if err := w.insertOutboxEvent(ctx, tx, wsSettings); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := w.CommitTransaction(tx); err != nil {
+		return nil, err
+	}
+
+	return names, nil
 }
 
 // getWorkspaceStores retrieves block and object stores associated with each workspace.
-func (db *WorkspaceDB) getWorkspaceStores(workspaces []ws_manager.WorkspaceSettings) ([]ws_manager.WorkspaceSettings, error) {
+func (db *WorkspaceDB) getWorkspaceStores(ctx context.Context, workspaces []ws_manager.WorkspaceSettings) ([]ws_manager.WorkspaceSettings, error) {
 
-	blockStores, err := db.getBlockStores(workspaces)
+	blockStores, err := db.getBlockStores(ctx, workspaces)
 	if err != nil {
 		return nil, err
 	}
 
-	objectStores, err := db.getObjectStores(workspaces)
+	objectStores, err := db.getObjectStores(ctx, workspaces)
 
 	if err != nil {
 		return nil, err
@@ -224,7 +422,7 @@ func (db *WorkspaceDB) getWorkspaceStores(workspaces []ws_manager.WorkspaceSetti
 }
 
 // getWorkspacesByGroup retrieves workspaces for the provided keycloak groups.
-func (db *WorkspaceDB) getWorkspacesByGroup(memberGroups []string) ([]ws_manager.WorkspaceSettings, error) {
+func (db *WorkspaceDB) getWorkspacesByGroup(ctx context.Context, memberGroups []string) ([]ws_manager.WorkspaceSettings, error) {
 
 	query := `
 	SELECT 
@@ -232,7 +430,7 @@ func (db *WorkspaceDB) getWorkspacesByGroup(memberGroups []string) ([]ws_manager
 		workspaces.name, 
 		workspaces.account, 
 		accounts.account_owner as owner, 
-		workspaces.status, 
+		CASE WHEN workspaces.deletion_scheduled_at IS NOT NULL THEN 'PendingDeletion' WHEN workspaces.suspended_at IS NOT NULL THEN 'Suspended' ELSE workspaces.status END AS status, 
 		workspaces.last_updated
 	FROM 
 		workspaces
@@ -242,7 +440,7 @@ func (db *WorkspaceDB) getWorkspacesByGroup(memberGroups []string) ([]ws_manager
 		workspaces.name = ANY($1) AND workspaces.status != 'Unavailable'
 	`
 
-	rows, err := db.DB.Query(query, pq.Array(memberGroups))
+	rows, err := db.DB.QueryContext(ctx, query, pq.Array(memberGroups))
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving workspaces: %w", err)
 	}
@@ -260,7 +458,7 @@ func (db *WorkspaceDB) getWorkspacesByGroup(memberGroups []string) ([]ws_manager
 }
 
 // getWorkspacesByAccount retrieves workspaces linked to a specific account ID.
-func (db *WorkspaceDB) getWorkspacesByAccount(accountID uuid.UUID) ([]ws_manager.WorkspaceSettings, error) {
+func (db *WorkspaceDB) getWorkspacesByAccount(ctx context.Context, accountID uuid.UUID) ([]ws_manager.WorkspaceSettings, error) {
 
 	query := `
 	SELECT 
@@ -268,7 +466,7 @@ func (db *WorkspaceDB) getWorkspacesByAccount(accountID uuid.UUID) ([]ws_manager
 		workspaces.name, 
 		workspaces.account, 
 		accounts.account_owner as owner, 
-		workspaces.status, 
+		CASE WHEN workspaces.deletion_scheduled_at IS NOT NULL THEN 'PendingDeletion' WHEN workspaces.suspended_at IS NOT NULL THEN 'Suspended' ELSE workspaces.status END AS status, 
 		workspaces.last_updated
 	FROM 
 		workspaces
@@ -278,7 +476,7 @@ func (db *WorkspaceDB) getWorkspacesByAccount(accountID uuid.UUID) ([]ws_manager
 		workspaces.account = $1 AND workspaces.status != 'Unavailable'
 	`
 
-	rows, err := db.DB.Query(query, accountID)
+	rows, err := db.DB.QueryContext(ctx, query, accountID)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving workspaces: %w", err)
 	}
@@ -296,7 +494,7 @@ func (db *WorkspaceDB) getWorkspacesByAccount(accountID uuid.UUID) ([]ws_manager
 }
 
 // getWorkspacesByOwnership retrieves workspaces owned by the specified username.
-func (db *WorkspaceDB) getWorkspacesByOwnership(username string) ([]ws_manager.WorkspaceSettings, error) {
+func (db *WorkspaceDB) getWorkspacesByOwnership(ctx context.Context, username string) ([]ws_manager.WorkspaceSettings, error) {
 
 	query := `
 	SELECT 
@@ -304,7 +502,7 @@ func (db *WorkspaceDB) getWorkspacesByOwnership(username string) ([]ws_manager.W
 		workspaces.name, 
 		workspaces.account, 
 		accounts.account_owner as owner, 
-		workspaces.status, 
+		CASE WHEN workspaces.deletion_scheduled_at IS NOT NULL THEN 'PendingDeletion' WHEN workspaces.suspended_at IS NOT NULL THEN 'Suspended' ELSE workspaces.status END AS status, 
 		workspaces.last_updated
 	FROM 
 		workspaces
@@ -314,7 +512,7 @@ func (db *WorkspaceDB) getWorkspacesByOwnership(username string) ([]ws_manager.W
 		accounts.account_owner = $1 AND workspaces.status != 'Unavailable'
 	`
 
-	rows, err := db.DB.Query(query, username)
+	rows, err := db.DB.QueryContext(ctx, query, username)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving workspaces: %w", err)
 	}
@@ -332,14 +530,14 @@ func (db *WorkspaceDB) getWorkspacesByOwnership(username string) ([]ws_manager.W
 }
 
 // getBlockStores fetches block stores associated with the specified workspaces.
-func (db *WorkspaceDB) getBlockStores(workspaces []ws_manager.WorkspaceSettings) (map[uuid.UUID][]ws_manager.BlockStore, error) {
+func (db *WorkspaceDB) getBlockStores(ctx context.Context, workspaces []ws_manager.WorkspaceSettings) (map[uuid.UUID][]ws_manager.BlockStore, error) {
 	workspaceIDs := extractWorkspaceIDs(workspaces)
 	query := `
 		SELECT ws.workspace_id, ws.name, bs.store_id, bs.access_point_id, bs.mount_point
 		FROM workspace_stores ws
 		INNER JOIN block_stores bs ON bs.store_id = ws.id
 		WHERE ws.workspace_id = ANY($1)`
-	rows, err := db.DB.Query(query, pq.Array(workspaceIDs))
+	rows, err := db.DB.QueryContext(ctx, query, pq.Array(workspaceIDs))
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving block stores: %w", err)
 	}
@@ -358,14 +556,14 @@ func (db *WorkspaceDB) getBlockStores(workspaces []ws_manager.WorkspaceSettings)
 }
 
 // getObjectStores fetches object stores associated with the specified workspaces.
-func (db *WorkspaceDB) getObjectStores(workspaces []ws_manager.WorkspaceSettings) (map[uuid.UUID][]ws_manager.ObjectStore, error) {
+func (db *WorkspaceDB) getObjectStores(ctx context.Context, workspaces []ws_manager.WorkspaceSettings) (map[uuid.UUID][]ws_manager.ObjectStore, error) {
 	workspaceIDs := extractWorkspaceIDs(workspaces)
 	query := `
 	   SELECT ws.id, ws.name, wss.name, os.* from workspaces ws
        INNER join workspace_stores wss on wss.workspace_id = ws.id
        INNER join object_stores os on os.store_id = wss.id
        WHERE ws.id = ANY($1)`
-	rows, err := db.DB.Query(query, pq.Array(workspaceIDs))
+	rows, err := db.DB.QueryContext(ctx, query, pq.Array(workspaceIDs))
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving object stores: %w", err)
 	}
@@ -402,10 +600,28 @@ func (db *WorkspaceDB) getObjectStores(workspaces []ws_manager.WorkspaceSettings
 }
 
 // CheckWorkspaceExists checks if a workspace with the specified name already exists.
-func (db *WorkspaceDB) CheckWorkspaceExists(name string) (bool, error) {
+func (db *WorkspaceDB) CheckWorkspaceExists(ctx context.Context, name string) (bool, error) {
+	ctx, span := startSpan(ctx, "CheckWorkspaceExists")
+	defer span.End()
+
 	query := `SELECT EXISTS(SELECT 1 FROM workspaces WHERE name = $1)`
 	var exists bool
-	err := db.DB.QueryRow(query, name).Scan(&exists)
+	err := db.DB.QueryRowContext(ctx, query, name).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("error checking workspace existence: %w", err)
+	}
+	return exists, nil
+}
+
+// CheckAvailableWorkspaceExists checks if a workspace with the specified name exists and has not
+// been deleted.
+func (db *WorkspaceDB) CheckAvailableWorkspaceExists(ctx context.Context, name string) (bool, error) {
+	ctx, span := startSpan(ctx, "CheckAvailableWorkspaceExists")
+	defer span.End()
+
+	query := `SELECT EXISTS(SELECT 1 FROM workspaces WHERE name = $1 AND status != 'Unavailable')`
+	var exists bool
+	err := db.DB.QueryRowContext(ctx, query, name).Scan(&exists)
 	if err != nil {
 		return false, fmt.Errorf("error checking workspace existence: %w", err)
 	}
@@ -421,16 +637,18 @@ func extractWorkspaceIDs(workspaces []ws_manager.WorkspaceSettings) []uuid.UUID
 	return ids
 }
 
-func (w *WorkspaceDB) UpdateWorkspaceStatus(status ws_manager.WorkspaceStatus) error {
+func (w *WorkspaceDB) UpdateWorkspaceStatus(ctx context.Context, status ws_manager.WorkspaceStatus) error {
+	ctx, span := startSpan(ctx, "UpdateWorkspaceStatus")
+	defer span.End()
 
-	tx, err := w.DB.Begin()
+	tx, err := w.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("error starting transaction: %w", err)
 	}
 
 	// Get the workspace ID from the workspaces table
 	var workspaceID uuid.UUID
-	err = tx.QueryRow(`SELECT id FROM workspaces WHERE name = $1`, status.Name).Scan(&workspaceID)
+	err = tx.QueryRowContext(ctx, `SELECT id FROM workspaces WHERE name = $1`, status.Name).Scan(&workspaceID)
 	if err != nil {
 		tx.Rollback()
 		return fmt.Errorf("error retrieving workspace ID: %w", err)
@@ -450,7 +668,7 @@ func (w *WorkspaceDB) UpdateWorkspaceStatus(status ws_manager.WorkspaceStatus) e
 			continue
 		}
 
-		err = w.execQuery(tx, `
+		err = w.execQuery(ctx, tx, `
 			UPDATE block_stores
 			SET access_point_id = $1, mount_point = $2
 			FROM workspace_stores
@@ -471,7 +689,7 @@ func (w *WorkspaceDB) UpdateWorkspaceStatus(status ws_manager.WorkspaceStatus) e
 		// The store name is assumed to be the first segment before the "/".
 		storeName := strings.Split(bucket.Path, "/")[0]
 
-		err = w.execQuery(tx, `
+		err = w.execQuery(ctx, tx, `
 			UPDATE object_stores
 			SET path = $1, env_var = $2, access_point_arn = $3
 			FROM workspace_stores
@@ -487,7 +705,7 @@ func (w *WorkspaceDB) UpdateWorkspaceStatus(status ws_manager.WorkspaceStatus) e
 	}
 
 	// Update the workspaces table
-	err = w.execQuery(tx, `
+	err = w.execQuery(ctx, tx, `
         UPDATE workspaces
         SET role_name = $1, role_arn = $2, status = $3, last_updated = CURRENT_TIMESTAMP
         WHERE id = $4`,
@@ -507,43 +725,46 @@ func (w *WorkspaceDB) UpdateWorkspaceStatus(status ws_manager.WorkspaceStatus) e
 	return nil
 }
 
-func (w *WorkspaceDB) DisableWorkspace(workspaceName string) error {
-	tx, err := w.DB.Begin()
+func (w *WorkspaceDB) DisableWorkspace(ctx context.Context, workspaceName string) error {
+	ctx, span := startSpan(ctx, "DisableWorkspace")
+	defer span.End()
+
+	tx, err := w.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("error starting transaction: %w", err)
 	}
 
 	// Get workspace ID from name
 	var workspaceID string
-	err = tx.QueryRow(`SELECT id FROM workspaces WHERE name = $1`, workspaceName).Scan(&workspaceID)
+	err = tx.QueryRowContext(ctx, `SELECT id FROM workspaces WHERE name = $1`, workspaceName).Scan(&workspaceID)
 	if err != nil {
 		tx.Rollback()
 		return fmt.Errorf("workspace not found: %w", err)
 	}
 
 	// Delete from dependent tables in reverse dependency order
-	_, err = tx.Exec(`DELETE FROM object_stores WHERE store_id IN 
+	_, err = tx.ExecContext(ctx, `DELETE FROM object_stores WHERE store_id IN 
 		(SELECT id FROM workspace_stores WHERE workspace_id = $1)`, workspaceID)
 	if err != nil {
 		tx.Rollback()
 		return fmt.Errorf("error deleting from object_stores: %w", err)
 	}
 
-	_, err = tx.Exec(`DELETE FROM block_stores WHERE store_id IN 
+	_, err = tx.ExecContext(ctx, `DELETE FROM block_stores WHERE store_id IN 
 		(SELECT id FROM workspace_stores WHERE workspace_id = $1)`, workspaceID)
 	if err != nil {
 		tx.Rollback()
 		return fmt.Errorf("error deleting from block_stores: %w", err)
 	}
 
-	_, err = tx.Exec(`DELETE FROM workspace_stores WHERE workspace_id = $1`, workspaceID)
+	_, err = tx.ExecContext(ctx, `DELETE FROM workspace_stores WHERE workspace_id = $1`, workspaceID)
 	if err != nil {
 		tx.Rollback()
 		return fmt.Errorf("error deleting from workspace_stores: %w", err)
 	}
 
 	// Set workspace status to 'Unavailable'
-	_, err = tx.Exec(`UPDATE workspaces SET status = 'Unavailable', role_name = NULL, role_arn = NULL, last_updated = CURRENT_TIMESTAMP WHERE id = $1`, workspaceID)
+	_, err = tx.ExecContext(ctx, `UPDATE workspaces SET status = 'Unavailable', role_name = NULL, role_arn = NULL, last_updated = CURRENT_TIMESTAMP WHERE id = $1`, workspaceID)
 	if err != nil {
 		tx.Rollback()
 		return fmt.Errorf("error updating workspace status: %w", err)
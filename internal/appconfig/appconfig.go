@@ -13,16 +13,67 @@ import (
 
 // Config holds all configuration details
 type Config struct {
-	Host      string          `yaml:"host"`
-	BasePath  string          `yaml:"basePath"`
-	DocsPath  string          `yaml:"docsPath"`
-	Accounts  AccountsConfig  `yaml:"accounts"`
-	Database  DatabaseConfig  `yaml:"database"`
-	Pulsar    PulsarConfig    `yaml:"pulsar"`
-	Keycloak  KeycloakConfig  `yaml:"keycloak"`
-	AWS       AWSConfig       `yaml:"aws"`
-	Files     FilesConfig     `yaml:"files"`
-	Providers ProvidersConfig `yaml:"providers"`
+	Host     string `yaml:"host"`
+	BasePath string `yaml:"basePath"`
+	DocsPath string `yaml:"docsPath"`
+	// AuthorizationPolicy is the path of the policy file deciding what users may do. The
+	// built-in default policy is used if it is empty.
+	AuthorizationPolicy string           `yaml:"authorizationPolicy"`
+	Server              ServerConfig     `yaml:"server"`
+	Health              HealthConfig     `yaml:"health"`
+	Tracing             TracingConfig    `yaml:"tracing"`
+	RateLimits          RateLimitConfig  `yaml:"rateLimits"`
+	Accounts            AccountsConfig   `yaml:"accounts"`
+	Database            DatabaseConfig   `yaml:"database"`
+	Pulsar              PulsarConfig     `yaml:"pulsar"`
+	Keycloak            KeycloakConfig   `yaml:"keycloak"`
+	AWS                 AWSConfig        `yaml:"aws"`
+	Files               FilesConfig      `yaml:"files"`
+	Workspaces          WorkspacesConfig `yaml:"workspaces"`
+	Providers           ProvidersConfig  `yaml:"providers"`
+}
+
+// ServerConfig defines the HTTP server timeouts and the shutdown window
+type ServerConfig struct {
+	ReadHeaderTimeoutSeconds int `yaml:"readHeaderTimeoutSeconds"`
+	ReadTimeoutSeconds       int `yaml:"readTimeoutSeconds"`
+	WriteTimeoutSeconds      int `yaml:"writeTimeoutSeconds"`
+	IdleTimeoutSeconds       int `yaml:"idleTimeoutSeconds"`
+	ShutdownTimeoutSeconds   int `yaml:"shutdownTimeoutSeconds"`
+}
+
+// HealthConfig defines the readiness check timeout and how long results are cached
+type HealthConfig struct {
+	CheckTimeoutSeconds int `yaml:"checkTimeoutSeconds"`
+	CacheTTLSeconds     int `yaml:"cacheTTLSeconds"`
+}
+
+// TracingConfig defines where trace spans are exported
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter"`
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	FilePath    string  `yaml:"filePath"`
+	ServiceName string  `yaml:"serviceName"`
+	SampleRatio float64 `yaml:"sampleRatio"`
+}
+
+// RateLimitConfig defines where token buckets are kept and the limits of each route group
+type RateLimitConfig struct {
+	Store  string                          `yaml:"store"`
+	Groups map[string]RateLimitGroupConfig `yaml:"groups"`
+}
+
+// RateLimitGroupConfig defines the limits applied to each user and to each workspace within a route group
+type RateLimitGroupConfig struct {
+	User      RateLimitRule `yaml:"user"`
+	Workspace RateLimitRule `yaml:"workspace"`
+}
+
+// RateLimitRule defines a token bucket. A zero rate disables the limit.
+type RateLimitRule struct {
+	RequestsPerMinute int `yaml:"requestsPerMinute"`
+	Burst             int `yaml:"burst"`
 }
 
 // AccountsConfig defines the email chain for account approval requests
@@ -43,13 +94,26 @@ type PulsarConfig struct {
 	TopicProducer string `yaml:"topicProducer"`
 	TopicConsumer string `yaml:"topicConsumer"`
 	Subscription  string `yaml:"subscription"`
+
+	// Outbox relay settings
+	OutboxPollIntervalSeconds int `yaml:"outboxPollIntervalSeconds"`
+	OutboxBatchSize           int `yaml:"outboxBatchSize"`
+	OutboxMaxBackoffSeconds   int `yaml:"outboxMaxBackoffSeconds"`
 }
 
 // KeycloakConfig defines authentication configuration
 type KeycloakConfig struct {
-	ClientId string `yaml:"clientId"`
-	URL      string `yaml:"url"`
-	Realm    string `yaml:"realm"`
+	ClientId            string `yaml:"clientId"`
+	URL                 string `yaml:"url"`
+	Realm               string `yaml:"realm"`
+	Issuer              string `yaml:"issuer"`
+	Audience            string `yaml:"audience"`
+	ClockSkewSeconds    int    `yaml:"clockSkewSeconds"`
+	JWKSCacheTTLSeconds int    `yaml:"jwksCacheTtlSeconds"`
+
+	// Cache of each user's group membership
+	GroupCacheTTLSeconds int `yaml:"groupCacheTtlSeconds"`
+	GroupCacheSize       int `yaml:"groupCacheSize"`
 }
 
 type S3Config struct {
@@ -76,6 +140,13 @@ type FilesConfig struct {
 	BlockTimeoutSeconds int    `yaml:"blockTimeoutSeconds"`
 }
 
+// WorkspacesConfig defines the workspace lifecycle settings
+type WorkspacesConfig struct {
+	DeletionGracePeriodHours     int `yaml:"deletionGracePeriodHours"`
+	DeletionSweepIntervalSeconds int `yaml:"deletionSweepIntervalSeconds"`
+	InvitationExpiryHours        int `yaml:"invitationExpiryHours"`
+}
+
 type AirbusProviderConfig struct {
 	AcessTokenURL       string `yaml:"access_token_url"`
 	OpticalContractsURL string `yaml:"optical_contracts_url"`
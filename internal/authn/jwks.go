@@ -0,0 +1,284 @@
+package authn
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrUnknownKey = errors.New("signing key not found in jwks")
+
+const (
+	defaultJWKSCacheTTL       = 15 * time.Minute
+	defaultJWKSRefreshBackoff = 10 * time.Second
+	defaultJWKSFetchTimeout   = 10 * time.Second
+)
+
+// signingMethods are the asymmetric algorithms Keycloak may sign access tokens with.
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// TokenVerifier verifies a bearer token and returns its claims.
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (Claims, error)
+}
+
+// VerifierConfig configures a JWKSVerifier.
+type VerifierConfig struct {
+	JWKSURL        string        // URL of the JSON Web Key Set
+	Issuer         string        // Expected iss claim
+	Audience       string        // Expected aud claim, not checked if empty
+	ClockSkew      time.Duration // Leeway applied to exp, nbf and iat
+	CacheTTL       time.Duration // How long fetched keys are trusted before refetching
+	RefreshBackoff time.Duration // Minimum time between refetches triggered by unknown key IDs
+	HTTPClient     *http.Client
+}
+
+// JWKSVerifier verifies JWT signatures against keys published at a JWKS endpoint.
+// Keys are cached and refetched when they expire or a token references an unknown key ID,
+// which allows the issuer to rotate keys without restarting the service.
+type JWKSVerifier struct {
+	cfg    VerifierConfig
+	parser *jwt.Parser
+
+	mu          sync.RWMutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+
+	refreshMu sync.Mutex
+}
+
+// KeycloakJWKSURL returns the certificate endpoint for a Keycloak realm.
+func KeycloakJWKSURL(baseURL, realm string) string {
+	return fmt.Sprintf("%s/realms/%s/protocol/openid-connect/certs", strings.TrimSuffix(baseURL, "/"), realm)
+}
+
+// KeycloakIssuer returns the issuer Keycloak uses for tokens minted by a realm.
+func KeycloakIssuer(baseURL, realm string) string {
+	return fmt.Sprintf("%s/realms/%s", strings.TrimSuffix(baseURL, "/"), realm)
+}
+
+// NewJWKSVerifier creates a verifier for tokens signed by keys published at cfg.JWKSURL.
+func NewJWKSVerifier(cfg VerifierConfig) *JWKSVerifier {
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = defaultJWKSCacheTTL
+	}
+	if cfg.RefreshBackoff <= 0 {
+		cfg.RefreshBackoff = defaultJWKSRefreshBackoff
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: defaultJWKSFetchTimeout}
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(cfg.ClockSkew),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+
+	return &JWKSVerifier{
+		cfg:    cfg,
+		parser: jwt.NewParser(opts...),
+		keys:   make(map[string]crypto.PublicKey),
+	}
+}
+
+// Verify checks the token signature, issuer, audience and validity window and returns its claims.
+func (v *JWKSVerifier) Verify(ctx context.Context, tokenStr string) (Claims, error) {
+	claims := Claims{}
+
+	t, err := v.parser.ParseWithClaims(tokenStr, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.key(ctx, kid)
+	})
+	if err != nil {
+		return claims, fmt.Errorf("%w: %w", ErrInvalidJWT, err)
+	}
+	if !t.Valid {
+		return claims, ErrInvalidJWT
+	}
+
+	return claims, nil
+}
+
+// key returns the public key for kid, refreshing the key set if the cache is stale or the kid is unknown.
+func (v *JWKSVerifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.RLock()
+	k, ok := v.keys[kid]
+	fresh := time.Since(v.fetchedAt) < v.cfg.CacheTTL
+	v.mu.RUnlock()
+
+	if ok && fresh {
+		return k, nil
+	}
+
+	if err := v.refresh(ctx, !fresh); err != nil {
+		// Keep serving cached keys if the endpoint is temporarily unavailable
+		if ok {
+			return k, nil
+		}
+		return nil, err
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if k, ok := v.keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("%w: kid %q", ErrUnknownKey, kid)
+}
+
+// refresh fetches the key set. Refetches are limited to one per RefreshBackoff, whether the
+// cache has expired or a token references an unknown key ID, so tokens with bogus key IDs cannot
+// be used to hammer the identity provider, even while it is failing and the cache stays expired.
+func (v *JWKSVerifier) refresh(ctx context.Context, expired bool) error {
+	v.refreshMu.Lock()
+	defer v.refreshMu.Unlock()
+
+	v.mu.RLock()
+	lastAttempt := v.lastAttempt
+	stale := time.Since(v.fetchedAt) >= v.cfg.CacheTTL
+	v.mu.RUnlock()
+
+	// Another caller refreshed the keys while we were waiting
+	if expired && !stale {
+		return nil
+	}
+	if time.Since(lastAttempt) < v.cfg.RefreshBackoff {
+		return nil
+	}
+
+	v.mu.Lock()
+	v.lastAttempt = time.Now()
+	v.mu.Unlock()
+
+	keys, err := v.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.fetchedAt = time.Now()
+	v.mu.Unlock()
+
+	return nil
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// fetch downloads and parses the key set, skipping keys that are not used for signatures.
+func (v *JWKSVerifier) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.cfg.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := v.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch jwks: unexpected status %d", resp.StatusCode)
+	}
+
+	var set jsonWebKeySet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to decode jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,286 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/authn"
+)
+
+// Actions that can be authorized. Each handler checks one of these before doing anything on
+// behalf of the user.
+const (
+	ActionWorkspaceList          = "workspace.list"
+	ActionWorkspaceRead          = "workspace.read"
+	ActionWorkspaceCreate        = "workspace.create"
+	ActionWorkspaceUpdate        = "workspace.update"
+	ActionWorkspaceDelete        = "workspace.delete"
+	ActionWorkspaceRestore       = "workspace.restore"
+	ActionMembersRead            = "workspace.members.read"
+	ActionMembersManage          = "workspace.members.manage"
+	ActionInvitationsManage      = "workspace.invitations.manage"
+	ActionInvitationRespond      = "invitation.respond"
+	ActionFilesRead              = "files.read"
+	ActionFilesWrite             = "files.write"
+	ActionWorkspaceCredentials   = "workspace.credentials"
+	ActionLinkedAccountsRead     = "linked_accounts.read"
+	ActionLinkedAccountsUse      = "linked_accounts.use"
+	ActionLinkedAccountsManage   = "linked_accounts.manage"
+	ActionAccountList            = "account.list"
+	ActionAccountCreate          = "account.create"
+	ActionAccountCreateForOthers = "account.create_for_others"
+	ActionAccountRead            = "account.read"
+	ActionAccountUpdate          = "account.update"
+	ActionAccountDelete          = "account.delete"
+	ActionAccountApprove         = "account.approve"
+	ActionHealthDetails          = "health.details"
+	ActionAdminRead              = "admin.read"
+	ActionAdminManage            = "admin.manage"
+)
+
+// Actions lists every action a policy can grant.
+var Actions = []string{
+	ActionWorkspaceList, ActionWorkspaceRead, ActionWorkspaceCreate, ActionWorkspaceUpdate,
+	ActionWorkspaceDelete, ActionWorkspaceRestore, ActionMembersRead, ActionMembersManage,
+	ActionInvitationsManage, ActionInvitationRespond, ActionFilesRead, ActionFilesWrite,
+	ActionWorkspaceCredentials,
+	ActionLinkedAccountsRead, ActionLinkedAccountsUse, ActionLinkedAccountsManage,
+	ActionAccountList, ActionAccountCreate, ActionAccountCreateForOthers, ActionAccountRead,
+	ActionAccountUpdate, ActionAccountDelete, ActionAccountApprove, ActionHealthDetails,
+	ActionAdminRead, ActionAdminManage,
+}
+
+// Workspace roles.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+	RoleOwner  = "owner"
+)
+
+// WorkspaceRoles lists the workspace roles from least to most access. Each role includes the
+// access of the roles before it. The roles are not part of the policy because the service gives
+// them meaning: account owners are owners and members who have not been given a role are
+// editors.
+var WorkspaceRoles = []string{RoleViewer, RoleEditor, RoleAdmin, RoleOwner}
+
+// RoleIncludes reports whether role grants at least the access of required. The empty role, of
+// users who are not members, includes nothing.
+func RoleIncludes(role, required string) bool {
+	rank := slices.Index(WorkspaceRoles, role)
+	return rank >= 0 && rank >= slices.Index(WorkspaceRoles, required)
+}
+
+// Reasons for a decision.
+const (
+	// ReasonSuperuser allows a superuser to perform any action.
+	ReasonSuperuser = "superuser"
+	// ReasonRule allows an action because a rule of the policy grants it.
+	ReasonRule = "rule"
+	// ReasonScopedToken denies an action because the token is scoped to a workspace, either a
+	// different one or because the action is not allowed with scoped tokens.
+	ReasonScopedToken = "scoped_token"
+	// ReasonDenied denies an action because no rule grants it.
+	ReasonDenied = "denied"
+	// ReasonAccountInactive denies an action that the policy refuses on the workspaces of
+	// accounts that are suspended or closed.
+	ReasonAccountInactive = "account_inactive"
+	// ReasonWorkspaceSuspended denies an action that the policy refuses on suspended
+	// workspaces.
+	ReasonWorkspaceSuspended = "workspace_suspended"
+)
+
+// Subject is the user making a request.
+type Subject struct {
+	UserID     string   `yaml:"userId"`
+	Username   string   `yaml:"username"`
+	RealmRoles []string `yaml:"realmRoles"`
+	// Workspace is the workspace the token is scoped to, if any.
+	Workspace string `yaml:"workspace"`
+}
+
+// SubjectFromClaims returns the subject of the token the claims were taken from.
+func SubjectFromClaims(claims authn.Claims) Subject {
+	return Subject{
+		UserID:     claims.Subject,
+		Username:   claims.Username,
+		RealmRoles: claims.RealmAccess.Roles,
+		Workspace:  claims.Workspace,
+	}
+}
+
+// Resource is what an action is performed on. Fields that do not apply are left empty.
+type Resource struct {
+	// Workspace is the name of the workspace the resource belongs to.
+	Workspace string `yaml:"workspace"`
+	// Owner is the username of the owner of the resource, such as a billing account.
+	Owner string `yaml:"owner"`
+}
+
+// Decision is the outcome of authorizing an action.
+type Decision struct {
+	Allowed bool
+	Reason  string
+	// Rule names the rule that allowed the action, if any.
+	Rule string
+}
+
+// Authorizer decides whether subjects may perform actions on resources.
+type Authorizer interface {
+	Authorize(ctx context.Context, subject Subject, action string, resource Resource) (Decision, error)
+	// WorkspaceRole returns the role subject has in workspace, or an empty string if they have
+	// none. Superusers have the highest role in every workspace.
+	WorkspaceRole(ctx context.Context, subject Subject, workspace string) (string, error)
+}
+
+// RoleResolver looks up the role a subject has been given in a workspace. It returns an empty
+// string if they are not a member.
+type RoleResolver interface {
+	WorkspaceRole(ctx context.Context, subject Subject, workspace string) (string, error)
+}
+
+// AccountResolver looks up the status of the billing account a workspace belongs to, returning
+// an empty string if the workspace does not exist, and whether the workspace is suspended.
+type AccountResolver interface {
+	WorkspaceAccountStatus(ctx context.Context, workspace string) (string, error)
+	WorkspaceSuspended(ctx context.Context, workspace string) (bool, error)
+}
+
+// PolicyAuthorizer authorizes actions with the rules of a policy.
+type PolicyAuthorizer struct {
+	policy   *Policy
+	roles    RoleResolver
+	accounts AccountResolver
+}
+
+var _ Authorizer = (*PolicyAuthorizer)(nil)
+
+// NewPolicyAuthorizer creates an authorizer for policy that looks up workspace roles with roles
+// and the status of workspaces and their accounts with accounts. Statuses are not checked if
+// accounts is nil.
+func NewPolicyAuthorizer(policy *Policy, roles RoleResolver, accounts AccountResolver) *PolicyAuthorizer {
+	return &PolicyAuthorizer{policy: policy, roles: roles, accounts: accounts}
+}
+
+// Authorize decides whether subject may perform action on resource. Tokens scoped to a
+// workspace can only be used on that workspace, and only for actions whose rules allow scoped
+// tokens. Otherwise the action is allowed for superusers and for subjects meeting every
+// condition of one of the action's rules, unless the policy refuses it because the workspace's
+// account is inactive or the workspace is suspended.
+func (a *PolicyAuthorizer) Authorize(ctx context.Context, subject Subject, action string, resource Resource) (Decision, error) {
+	decision, err := a.decide(ctx, subject, action, resource)
+	if err != nil || !decision.Allowed {
+		return decision, err
+	}
+
+	// Only allowed actions are checked, so that the account's status is not revealed to users
+	// who could not perform the action anyway
+	if a.accounts != nil && resource.Workspace != "" && slices.Contains(a.policy.InactiveAccounts.Actions, action) {
+		status, err := a.accounts.WorkspaceAccountStatus(ctx, resource.Workspace)
+		if err != nil {
+			return Decision{}, fmt.Errorf("failed to look up account status: %w", err)
+		}
+		if slices.Contains(a.policy.InactiveAccounts.Statuses, status) {
+			return Decision{Reason: ReasonAccountInactive}, nil
+		}
+	}
+
+	if a.accounts != nil && resource.Workspace != "" && slices.Contains(a.policy.SuspendedWorkspaces.Actions, action) {
+		suspended, err := a.accounts.WorkspaceSuspended(ctx, resource.Workspace)
+		if err != nil {
+			return Decision{}, fmt.Errorf("failed to look up workspace suspension: %w", err)
+		}
+		if suspended {
+			return Decision{Reason: ReasonWorkspaceSuspended}, nil
+		}
+	}
+
+	return decision, nil
+}
+
+// decide applies the rules of the policy to an action.
+func (a *PolicyAuthorizer) decide(ctx context.Context, subject Subject, action string, resource Resource) (Decision, error) {
+	scoped := subject.Workspace != ""
+	if scoped && resource.Workspace != "" && resource.Workspace != subject.Workspace {
+		return Decision{Reason: ReasonScopedToken}, nil
+	}
+
+	// The role is only looked up once, and only if a rule needs it
+	var role *string
+	workspaceRole := func() (string, error) {
+		if role == nil {
+			r, err := a.roles.WorkspaceRole(ctx, subject, resource.Workspace)
+			if err != nil {
+				return "", err
+			}
+			role = &r
+		}
+		return *role, nil
+	}
+
+	deniedScoped := false
+	for _, rule := range a.policy.Rules {
+		if !slices.Contains(rule.Actions, action) {
+			continue
+		}
+
+		if scoped && !rule.ScopedTokens {
+			deniedScoped = true
+			continue
+		}
+
+		if a.policy.isSuperuser(subject) {
+			return Decision{Allowed: true, Reason: ReasonSuperuser}, nil
+		}
+
+		ok, err := a.matches(rule, subject, resource, workspaceRole)
+		if err != nil {
+			return Decision{}, err
+		}
+		if ok {
+			return Decision{Allowed: true, Reason: ReasonRule, Rule: rule.Name}, nil
+		}
+	}
+
+	if deniedScoped {
+		return Decision{Reason: ReasonScopedToken}, nil
+	}
+	return Decision{Reason: ReasonDenied}, nil
+}
+
+// WorkspaceRole returns the role subject has in workspace.
+func (a *PolicyAuthorizer) WorkspaceRole(ctx context.Context, subject Subject, workspace string) (string, error) {
+	if a.policy.isSuperuser(subject) {
+		return RoleOwner, nil
+	}
+	return a.roles.WorkspaceRole(ctx, subject, workspace)
+}
+
+// matches reports whether subject meets every condition of rule.
+func (a *PolicyAuthorizer) matches(rule Rule, subject Subject, resource Resource, workspaceRole func() (string, error)) (bool, error) {
+	if len(rule.RealmRoles) > 0 && !slices.ContainsFunc(rule.RealmRoles, func(role string) bool {
+		return slices.Contains(subject.RealmRoles, role)
+	}) {
+		return false, nil
+	}
+
+	if rule.ResourceOwner && (resource.Owner == "" || resource.Owner != subject.Username) {
+		return false, nil
+	}
+
+	if rule.WorkspaceRole != "" {
+		if resource.Workspace == "" {
+			return false, nil
+		}
+		role, err := workspaceRole()
+		if err != nil {
+			return false, fmt.Errorf("failed to look up workspace role: %w", err)
+		}
+		if !RoleIncludes(role, rule.WorkspaceRole) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
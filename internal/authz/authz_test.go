@@ -0,0 +1,178 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type roleLookups struct {
+	role  string
+	err   error
+	calls int
+}
+
+func (r *roleLookups) WorkspaceRole(context.Context, Subject, string) (string, error) {
+	r.calls++
+	return r.role, r.err
+}
+
+type accountLookups struct {
+	status    string
+	suspended bool
+	calls     int
+}
+
+func (a *accountLookups) WorkspaceAccountStatus(context.Context, string) (string, error) {
+	a.calls++
+	return a.status, nil
+}
+
+func (a *accountLookups) WorkspaceSuspended(context.Context, string) (bool, error) {
+	return a.suspended, nil
+}
+
+func TestDefaultPolicyCases(t *testing.T) {
+	data, err := os.ReadFile("../../config/policy-tests.yaml")
+	require.NoError(t, err)
+
+	cases, err := ParseCases(data)
+	require.NoError(t, err)
+
+	results, err := EvaluateCases(context.Background(), DefaultPolicy(), cases)
+	require.NoError(t, err)
+
+	for _, result := range results {
+		assert.True(t, result.Passed, "%s: got %+v", result.Case.Name, result.Decision)
+	}
+}
+
+func TestPolicyAuthorizer(t *testing.T) {
+	ctx := context.Background()
+	roles := &roleLookups{role: "editor"}
+	authorizer := NewPolicyAuthorizer(DefaultPolicy(), roles, &accountLookups{status: "Approved"})
+
+	alice := Subject{UserID: "user-a", Username: "alice"}
+	workspace := Resource{Workspace: "ws-1"}
+
+	decision, err := authorizer.Authorize(ctx, alice, ActionFilesWrite, workspace)
+	require.NoError(t, err)
+	assert.Equal(t, Decision{Allowed: true, Reason: ReasonRule, Rule: "editors can change files and use linked accounts"}, decision)
+
+	// The role is looked up once however many rules need it
+	roles.calls = 0
+	decision, err = authorizer.Authorize(ctx, alice, ActionWorkspaceUpdate, workspace)
+	require.NoError(t, err)
+	assert.Equal(t, ReasonDenied, decision.Reason)
+	assert.Equal(t, 1, roles.calls)
+
+	// Scoped tokens are denied for actions that do not allow them
+	scoped := alice
+	scoped.Workspace = "ws-1"
+	decision, err = authorizer.Authorize(ctx, scoped, ActionWorkspaceUpdate, workspace)
+	require.NoError(t, err)
+	assert.Equal(t, Decision{Reason: ReasonScopedToken}, decision)
+
+	// Superusers are never looked up and have the highest role
+	roles.calls = 0
+	admin := Subject{Username: "admin", RealmRoles: []string{"hub_admin"}}
+	decision, err = authorizer.Authorize(ctx, admin, ActionWorkspaceDelete, workspace)
+	require.NoError(t, err)
+	assert.Equal(t, ReasonSuperuser, decision.Reason)
+
+	role, err := authorizer.WorkspaceRole(ctx, admin, "ws-1")
+	require.NoError(t, err)
+	assert.Equal(t, "owner", role)
+	assert.Zero(t, roles.calls)
+
+	// Failed lookups are returned rather than denying
+	roles.err = errors.New("keycloak unavailable")
+	_, err = authorizer.Authorize(ctx, alice, ActionFilesRead, workspace)
+	assert.Error(t, err)
+}
+
+func TestPolicyAuthorizerInactiveAccounts(t *testing.T) {
+	ctx := context.Background()
+	accounts := &accountLookups{status: "Suspended"}
+	authorizer := NewPolicyAuthorizer(DefaultPolicy(), &roleLookups{role: "owner"}, accounts)
+
+	alice := Subject{UserID: "user-a", Username: "alice"}
+	workspace := Resource{Workspace: "ws-1"}
+
+	// Nothing new can be written to the workspace, even by superusers
+	decision, err := authorizer.Authorize(ctx, alice, ActionFilesWrite, workspace)
+	require.NoError(t, err)
+	assert.Equal(t, Decision{Reason: ReasonAccountInactive}, decision)
+
+	admin := Subject{Username: "admin", RealmRoles: []string{"hub_admin"}}
+	decision, err = authorizer.Authorize(ctx, admin, ActionWorkspaceCredentials, workspace)
+	require.NoError(t, err)
+	assert.Equal(t, ReasonAccountInactive, decision.Reason)
+
+	// but its data can still be read, without looking up the account
+	accounts.calls = 0
+	decision, err = authorizer.Authorize(ctx, alice, ActionFilesRead, workspace)
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed)
+	assert.Zero(t, accounts.calls)
+
+	// Users who could not perform the action anyway are not told about the account
+	decision, err = authorizer.Authorize(ctx, Subject{Username: "mallory"}, ActionFilesWrite, Resource{})
+	require.NoError(t, err)
+	assert.Equal(t, ReasonDenied, decision.Reason)
+	assert.Zero(t, accounts.calls)
+}
+
+func TestPolicyAuthorizerSuspendedWorkspaces(t *testing.T) {
+	ctx := context.Background()
+	accounts := &accountLookups{status: "Approved", suspended: true}
+	authorizer := NewPolicyAuthorizer(DefaultPolicy(), &roleLookups{role: "owner"}, accounts)
+
+	alice := Subject{UserID: "user-a", Username: "alice"}
+	workspace := Resource{Workspace: "ws-1"}
+
+	// Files cannot be read and members cannot be managed, even by superusers
+	for _, action := range []string{ActionFilesRead, ActionWorkspaceCredentials, ActionMembersManage} {
+		decision, err := authorizer.Authorize(ctx, alice, action, workspace)
+		require.NoError(t, err)
+		assert.Equal(t, Decision{Reason: ReasonWorkspaceSuspended}, decision, action)
+	}
+
+	admin := Subject{Username: "admin", RealmRoles: []string{"hub_admin"}}
+	decision, err := authorizer.Authorize(ctx, admin, ActionFilesWrite, workspace)
+	require.NoError(t, err)
+	assert.Equal(t, ReasonWorkspaceSuspended, decision.Reason)
+
+	// but the workspace can still be seen
+	decision, err = authorizer.Authorize(ctx, alice, ActionWorkspaceRead, workspace)
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed)
+
+	// and access is restored when it is reactivated
+	accounts.suspended = false
+	decision, err = authorizer.Authorize(ctx, alice, ActionFilesRead, workspace)
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed)
+}
+
+func TestParsePolicyRejectsMistakes(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":                      "rules:\n  - actions: [files.read]\n    workspaceRol: viewer\n",
+		"unknown action":                     "rules:\n  - actions: [files.reed]\n",
+		"unknown role":                       "rules:\n  - actions: [files.read]\n    workspaceRole: superuser\n",
+		"no actions":                         "rules:\n  - name: empty\n",
+		"unknown inactive account action":    "inactiveAccounts:\n  actions: [files.wrte]\n",
+		"unknown suspended workspace action": "suspendedWorkspaces:\n  actions: [files.raed]\n",
+	}
+
+	for name, policy := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParsePolicy([]byte(policy))
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Case is a sample request to evaluate against a policy, with the decision it should get.
+type Case struct {
+	Name    string  `yaml:"name"`
+	Subject Subject `yaml:"subject"`
+	// WorkspaceRole is the role the subject has in the resource's workspace.
+	WorkspaceRole string `yaml:"workspaceRole"`
+	// AccountStatus is the status of the account of the resource's workspace.
+	AccountStatus string `yaml:"accountStatus"`
+	// WorkspaceSuspended is whether the resource's workspace is suspended.
+	WorkspaceSuspended bool     `yaml:"workspaceSuspended"`
+	Action             string   `yaml:"action"`
+	Resource           Resource `yaml:"resource"`
+	// Expect is "allow" or "deny", or empty to only report the decision.
+	Expect string `yaml:"expect"`
+}
+
+// CaseResult is the decision made for a case.
+type CaseResult struct {
+	Case     Case
+	Decision Decision
+	// Passed is false if the decision is not the expected one.
+	Passed bool
+}
+
+// ParseCases parses a YAML list of cases.
+func ParseCases(data []byte) ([]Case, error) {
+	var cases []Case
+	if err := yaml.UnmarshalStrict(data, &cases); err != nil {
+		return nil, fmt.Errorf("failed to parse cases: %w", err)
+	}
+
+	for i, c := range cases {
+		if c.Expect != "" && c.Expect != "allow" && c.Expect != "deny" {
+			return nil, fmt.Errorf("case %d expects %q, not allow or deny", i+1, c.Expect)
+		}
+	}
+
+	return cases, nil
+}
+
+// EvaluateCases decides each case with policy, taking the subject's workspace role and the
+// status of the workspace and its account from the case.
+func EvaluateCases(ctx context.Context, policy *Policy, cases []Case) ([]CaseResult, error) {
+	results := make([]CaseResult, 0, len(cases))
+	for _, c := range cases {
+		authorizer := NewPolicyAuthorizer(policy, staticRole(c.WorkspaceRole), staticWorkspace{accountStatus: c.AccountStatus, suspended: c.WorkspaceSuspended})
+
+		decision, err := authorizer.Authorize(ctx, c.Subject, c.Action, c.Resource)
+		if err != nil {
+			return nil, err
+		}
+
+		passed := c.Expect == "" || (c.Expect == "allow") == decision.Allowed
+		results = append(results, CaseResult{Case: c, Decision: decision, Passed: passed})
+	}
+	return results, nil
+}
+
+// staticRole gives every subject the same role in every workspace.
+type staticRole string
+
+func (r staticRole) WorkspaceRole(context.Context, Subject, string) (string, error) {
+	return string(r), nil
+}
+
+// staticWorkspace gives every workspace and its account the same status.
+type staticWorkspace struct {
+	accountStatus string
+	suspended     bool
+}
+
+func (s staticWorkspace) WorkspaceAccountStatus(context.Context, string) (string, error) {
+	return s.accountStatus, nil
+}
+
+func (s staticWorkspace) WorkspaceSuspended(context.Context, string) (bool, error) {
+	return s.suspended, nil
+}
@@ -0,0 +1,129 @@
+package authz
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+//go:embed policy.yaml
+var defaultPolicy []byte
+
+// Policy is a declarative set of rules granting actions.
+type Policy struct {
+	// Superusers may perform every action and have the highest role in every workspace.
+	Superusers struct {
+		RealmRoles []string `yaml:"realmRoles"`
+		Usernames  []string `yaml:"usernames"`
+	} `yaml:"superusers"`
+	Rules []Rule `yaml:"rules"`
+	// InactiveAccounts refuses actions on the workspaces of accounts with any of these statuses,
+	// even to superusers.
+	InactiveAccounts struct {
+		Statuses []string `yaml:"statuses"`
+		Actions  []string `yaml:"actions"`
+	} `yaml:"inactiveAccounts"`
+	// SuspendedWorkspaces refuses actions on workspaces suspended by an administrator, even to
+	// superusers.
+	SuspendedWorkspaces struct {
+		Actions []string `yaml:"actions"`
+	} `yaml:"suspendedWorkspaces"`
+}
+
+// Rule grants actions to subjects meeting all of its conditions. A rule without conditions
+// grants the actions to every authenticated user.
+type Rule struct {
+	Name    string   `yaml:"name"`
+	Actions []string `yaml:"actions"`
+	// RealmRoles requires the subject to have at least one of these realm roles.
+	RealmRoles []string `yaml:"realmRoles"`
+	// WorkspaceRole requires the subject to have at least this role, one of WorkspaceRoles, in
+	// the resource's workspace.
+	WorkspaceRole string `yaml:"workspaceRole"`
+	// ResourceOwner requires the subject to own the resource.
+	ResourceOwner bool `yaml:"resourceOwner"`
+	// ScopedTokens allows the actions with tokens scoped to the resource's workspace.
+	ScopedTokens bool `yaml:"scopedTokens"`
+}
+
+// ParsePolicy parses and validates a YAML policy. Unknown fields, actions and workspace roles
+// are errors, so that a mistake in the policy does not silently change who has access.
+func ParsePolicy(data []byte) (*Policy, error) {
+	var policy Policy
+	if err := yaml.UnmarshalStrict(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %w", err)
+	}
+
+	for i, rule := range policy.Rules {
+		if rule.Name == "" {
+			policy.Rules[i].Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if len(rule.Actions) == 0 {
+			return nil, fmt.Errorf("%s has no actions", policy.Rules[i].Name)
+		}
+		for _, action := range rule.Actions {
+			if !slices.Contains(Actions, action) {
+				return nil, fmt.Errorf("%s has unknown action %q", policy.Rules[i].Name, action)
+			}
+		}
+		if rule.WorkspaceRole != "" && !slices.Contains(WorkspaceRoles, rule.WorkspaceRole) {
+			return nil, fmt.Errorf("%s has unknown workspace role %q", policy.Rules[i].Name, rule.WorkspaceRole)
+		}
+	}
+
+	for _, action := range policy.InactiveAccounts.Actions {
+		if !slices.Contains(Actions, action) {
+			return nil, fmt.Errorf("inactiveAccounts has unknown action %q", action)
+		}
+	}
+
+	for _, action := range policy.SuspendedWorkspaces.Actions {
+		if !slices.Contains(Actions, action) {
+			return nil, fmt.Errorf("suspendedWorkspaces has unknown action %q", action)
+		}
+	}
+
+	return &policy, nil
+}
+
+// LoadPolicy reads a policy from path, or returns the default policy if path is empty.
+func LoadPolicy(path string) (*Policy, error) {
+	if path == "" {
+		return DefaultPolicy(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %w", err)
+	}
+	return ParsePolicy(data)
+}
+
+var (
+	defaultPolicyOnce   sync.Once
+	defaultPolicyParsed *Policy
+)
+
+// DefaultPolicy returns the policy used when none is configured.
+func DefaultPolicy() *Policy {
+	defaultPolicyOnce.Do(func() {
+		policy, err := ParsePolicy(defaultPolicy)
+		if err != nil {
+			panic(fmt.Sprintf("invalid default policy: %v", err))
+		}
+		defaultPolicyParsed = policy
+	})
+	return defaultPolicyParsed
+}
+
+// isSuperuser reports whether subject may perform every action.
+func (p *Policy) isSuperuser(subject Subject) bool {
+	return slices.Contains(p.Superusers.Usernames, subject.Username) ||
+		slices.ContainsFunc(p.Superusers.RealmRoles, func(role string) bool {
+			return slices.Contains(subject.RealmRoles, role)
+		})
+}
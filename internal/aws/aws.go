@@ -4,12 +4,17 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/metrics"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/requestid"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/tracing"
+
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/aws/aws-sdk-go-v2/service/sesv2"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/middleware"
 )
 
 // LoadAWSConfig initializes and returns an AWS SDK configuration.
@@ -23,31 +28,46 @@ func LoadAWSConfig(region string) (aws.Config, error) {
 
 // NewSecretsManagerClient initializes the AWS Secrets Manager client.
 func NewSecretsManagerClient(cfg aws.Config) *secretsmanager.Client {
-	return secretsmanager.NewFromConfig(cfg)
+	return secretsmanager.NewFromConfig(cfg, func(o *secretsmanager.Options) {
+		o.APIOptions = instrument(o.APIOptions)
+	})
 }
 
 // NewSESClient initializes the AWS SES client.
 func NewSESClient(cfg aws.Config) *sesv2.Client {
-	return sesv2.NewFromConfig(cfg)
+	return sesv2.NewFromConfig(cfg, func(o *sesv2.Options) {
+		o.APIOptions = instrument(o.APIOptions)
+	})
 }
 
 // NewSTSClient initializes the AWS STS client.
 func NewSTSClient(cfg aws.Config) *sts.Client {
-	return sts.NewFromConfig(cfg)
+	return sts.NewFromConfig(cfg, func(o *sts.Options) {
+		o.APIOptions = instrument(o.APIOptions)
+	})
 }
 
 // Initialize S3 Client
 func NewS3Client(cfg aws.Config) *s3.Client {
-	return s3.NewFromConfig(cfg)
+	return s3.NewFromConfig(cfg, instrumentS3)
 }
 
 // Initialize S3 Client with optional endpoint override.
 func NewS3ClientWithEndpoint(cfg aws.Config, endpoint string, forcePathStyle bool) *s3.Client {
 	if endpoint == "" {
-		return s3.NewFromConfig(cfg)
+		return s3.NewFromConfig(cfg, instrumentS3)
 	}
-	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+	return s3.NewFromConfig(cfg, instrumentS3, func(o *s3.Options) {
 		o.BaseEndpoint = aws.String(endpoint)
 		o.UsePathStyle = forcePathStyle
 	})
 }
+
+func instrumentS3(o *s3.Options) {
+	o.APIOptions = instrument(o.APIOptions)
+}
+
+// instrument adds the metrics, tracing and request ID middleware to an AWS client's API options.
+func instrument(apiOptions []func(*middleware.Stack) error) []func(*middleware.Stack) error {
+	return append(apiOptions, metrics.AWSMiddleware, tracing.AWSMiddleware, requestid.AWSMiddleware)
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/metrics"
 	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/rs/zerolog/log"
 )
 
 type EventConsumer struct {
 	client   pulsar.Client
 	consumer pulsar.Consumer
+	topic    string
 }
 
 // NewEventConsumer initializes the Pulsar client and consumer.
@@ -33,7 +36,7 @@ func NewEventConsumer(pulsarURL, topic, subscription string) (*EventConsumer, er
 		return nil, fmt.Errorf("could not create Pulsar consumer: %w", err)
 	}
 
-	return &EventConsumer{client: client, consumer: consumer}, nil
+	return &EventConsumer{client: client, consumer: consumer, topic: topic}, nil
 }
 
 // ReceiveMessage retrieves a message from Pulsar.
@@ -47,12 +50,42 @@ func (c *EventConsumer) ReceiveMessage(ctx context.Context) (pulsar.Message, err
 
 // Ack acknowledges a message.
 func (c *EventConsumer) Ack(msg pulsar.Message) {
-	c.consumer.Ack(msg)
+	err := c.consumer.Ack(msg)
+	metrics.CountPulsarMessage("ack", err)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to acknowledge message")
+	}
 }
 
 // Nack negatively acknowledges a message.
 func (c *EventConsumer) Nack(msg pulsar.Message) {
 	c.consumer.Nack(msg)
+	metrics.CountPulsarMessage("nack", nil)
+}
+
+// Ping checks that the Pulsar broker can be reached by looking up the consumer's topic.
+func (c *EventConsumer) Ping(ctx context.Context) error {
+	return lookupTopic(ctx, c.client, c.topic)
+}
+
+// lookupTopic asks the broker for the partitions of topic. The client call does not take a
+// context, so it is abandoned if ctx is done first.
+func lookupTopic(ctx context.Context, client pulsar.Client, topic string) error {
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := client.TopicPartitions(topic)
+		errCh <- err
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return fmt.Errorf("failed to look up topic %s: %w", topic, err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // Close cleans up the Pulsar consumer and client.
@@ -4,27 +4,30 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-
 	"time"
 
 	ws_manager "github.com/EO-DataHub/eodhp-workspace-manager/models"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/metrics"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/requestid"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/tracing"
 	"github.com/apache/pulsar-client-go/pulsar"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type EventPublisher struct {
 	client   pulsar.Client
 	producer pulsar.Producer
+	topic    string
 }
 
 // Publisher defines the interface for an event publisher
 type Publisher interface {
-	Publish(event ws_manager.WorkspaceSettings) error
+	Publish(ctx context.Context, event ws_manager.WorkspaceSettings) error
 	Close()
 }
 
-const maxRetries = 3 // Hardcoded and slightly random for now - can be made configurable
-
 // Initializes the Pulsar client and producer
 func NewEventPublisher(pulsarURL, topic string) (*EventPublisher, error) {
 	client, err := pulsar.NewClient(pulsar.ClientOptions{
@@ -46,34 +49,49 @@ func NewEventPublisher(pulsarURL, topic string) (*EventPublisher, error) {
 	return &EventPublisher{
 		client:   client,
 		producer: producer,
+		topic:    topic,
 	}, nil
 }
 
-// Tries to publish an event, retrying if necessary
-func (p *EventPublisher) Publish(event ws_manager.WorkspaceSettings) error {
+// Publish sends an event to Pulsar. Failed events are retried by the outbox relay. The trace
+// context and request ID of ctx are sent in the message properties so that consumers can continue
+// the trace and correlate their logs.
+func (p *EventPublisher) Publish(ctx context.Context, event ws_manager.WorkspaceSettings) (err error) {
+	ctx, span := tracing.Start(ctx, "publish "+p.topic, trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "pulsar"),
+			attribute.String("messaging.destination.name", p.topic),
+			attribute.String("workspace", event.Name),
+		))
+	defer func() { tracing.End(span, err) }()
+
 	message, err := json.Marshal(event)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to serialize event")
-		return err
+		return fmt.Errorf("failed to serialize event: %w", err)
 	}
 
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		_, err := p.producer.Send(context.Background(), &pulsar.ProducerMessage{
-			Payload: message,
-		})
-		if err == nil {
-			return err
-		}
-		log.Error().Int("attempt", attempt).Err(err).Msg("Failed to send event to Pulsar")
+	start := time.Now()
+	properties := tracing.Inject(ctx)
+	if id := requestid.FromContext(ctx); id != "" {
+		properties[requestid.Property] = id
+	}
 
-		// Reconnect or retry logic, wait before retrying
-		if attempt < maxRetries {
-			time.Sleep(2 * time.Second) // Simple backoff, adjust as needed
-		}
+	_, err = p.producer.Send(ctx, &pulsar.ProducerMessage{
+		Payload:    message,
+		Properties: properties,
+	})
+	metrics.ObserveDependency(metrics.DependencyPulsar, "publish", start, err)
+	metrics.CountPulsarMessage("publish", err)
+	if err != nil {
+		return fmt.Errorf("failed to send event to Pulsar: %w", err)
 	}
-	log.Error().Int("maxRetries", maxRetries).Msg("Giving up after maxRetries attempts")
-	return fmt.Errorf("failed to publish event after %d attempts: %w", maxRetries, err)
 
+	return nil
+}
+
+// Ping checks that the Pulsar broker can be reached by looking up the producer's topic.
+func (p *EventPublisher) Ping(ctx context.Context) error {
+	return lookupTopic(ctx, p.client, p.topic)
 }
 
 // Close the Pulsar client, producer, and stop the goroutine
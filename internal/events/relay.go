@@ -0,0 +1,172 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	ws_manager "github.com/EO-DataHub/eodhp-workspace-manager/models"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/requestid"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/tracing"
+	ws_services "github.com/EO-DataHub/eodhp-workspace-services/models"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultRelayPollInterval = 2 * time.Second
+	defaultRelayBatchSize    = 50
+	defaultRelayMaxBackoff   = 5 * time.Minute
+	relayInitialBackoff      = time.Second
+)
+
+// OutboxStore is the storage used by the relay to read and update outbox events.
+type OutboxStore interface {
+	ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]ws_services.OutboxEvent, error)
+	MarkOutboxEventSent(ctx context.Context, id int64) error
+	MarkOutboxEventFailed(ctx context.Context, id int64, errMsg string, nextAttempt time.Time, permanent bool) error
+}
+
+// RelayConfig configures a Relay.
+type RelayConfig struct {
+	PollInterval time.Duration // How often the outbox is polled for pending events
+	BatchSize    int           // Maximum number of events claimed per poll
+	MaxBackoff   time.Duration // Upper bound on the delay between attempts to publish an event
+}
+
+// Relay publishes events written to the outbox, retrying failed events with exponential backoff.
+type Relay struct {
+	store     OutboxStore
+	publisher Publisher
+	cfg       RelayConfig
+}
+
+// NewRelay creates a relay that publishes events from store with publisher.
+func NewRelay(store OutboxStore, publisher Publisher, cfg RelayConfig) *Relay {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultRelayPollInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultRelayBatchSize
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaultRelayMaxBackoff
+	}
+
+	return &Relay{store: store, publisher: publisher, cfg: cfg}
+}
+
+// Run relays events on every poll interval until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.RelayPending(ctx); err != nil {
+			log.Error().Err(err).Msg("Failed to relay outbox events")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Start runs the relay in the background until ctx is cancelled. The returned function waits for
+// the relay to stop and then closes the publisher, so an event being published when ctx is
+// cancelled is published, and recorded, before the producer is closed.
+func (r *Relay) Start(ctx context.Context) (wait func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.Run(ctx)
+	}()
+
+	return func() {
+		<-done
+		r.publisher.Close()
+	}
+}
+
+// RelayPending publishes the pending events that are due, in batches, and returns how many were sent.
+// An event that fails to publish is retried later; later events for the same workspace wait for it.
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	sent := 0
+	for {
+		// Lease claimed events for long enough to publish the whole batch
+		events, err := r.store.ClaimOutboxEvents(ctx, r.cfg.BatchSize, r.lease())
+		if err != nil {
+			return sent, err
+		}
+
+		for _, event := range events {
+			// Once ctx is cancelled the remaining events are left for their leases to expire
+			if ctx.Err() != nil {
+				return sent, nil
+			}
+			// An event already being published is finished, so its outcome is recorded
+			if r.relay(context.WithoutCancel(ctx), event) {
+				sent++
+			}
+		}
+
+		if len(events) < r.cfg.BatchSize {
+			return sent, nil
+		}
+	}
+}
+
+// relay publishes a single event and records the outcome. It returns true if the event was sent.
+// The event is published in the trace, and with the ID, of the request that queued it.
+func (r *Relay) relay(ctx context.Context, event ws_services.OutboxEvent) bool {
+	logger := log.With().Int64("event_id", event.ID).Str("workspace_name", event.Aggregate).Logger()
+	ctx = tracing.Extract(ctx, event.TraceContext)
+	ctx = requestid.NewContext(ctx, event.TraceContext[requestid.Property])
+
+	var wsSettings ws_manager.WorkspaceSettings
+	if err := json.Unmarshal(event.Payload, &wsSettings); err != nil {
+		// Retrying will never succeed, so the event is parked for investigation
+		logger.Error().Err(err).Msg("Discarding undecodable outbox event")
+		if err := r.store.MarkOutboxEventFailed(ctx, event.ID, fmt.Sprintf("invalid payload: %v", err), time.Now(), true); err != nil {
+			logger.Error().Err(err).Msg("Failed to mark outbox event as failed")
+		}
+		return false
+	}
+
+	if err := r.publisher.Publish(ctx, wsSettings); err != nil {
+		nextAttempt := time.Now().Add(r.backoff(event.Attempts))
+		logger.Warn().Err(err).Int("attempts", event.Attempts+1).Time("next_attempt", nextAttempt).
+			Msg("Failed to publish outbox event")
+		if err := r.store.MarkOutboxEventFailed(ctx, event.ID, err.Error(), nextAttempt, false); err != nil {
+			logger.Error().Err(err).Msg("Failed to record outbox event failure")
+		}
+		return false
+	}
+
+	// If this fails the event is published again once its lease expires, which consumers tolerate
+	if err := r.store.MarkOutboxEventSent(ctx, event.ID); err != nil {
+		logger.Error().Err(err).Msg("Failed to mark outbox event as sent")
+		return false
+	}
+
+	logger.Debug().Msg("Published outbox event")
+	return true
+}
+
+// backoff returns the delay before the next attempt after attempts previous failures.
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := relayInitialBackoff
+	for i := 0; i < attempts; i++ {
+		delay *= 2
+		if delay >= r.cfg.MaxBackoff {
+			return r.cfg.MaxBackoff
+		}
+	}
+	return delay
+}
+
+func (r *Relay) lease() time.Duration {
+	return r.cfg.PollInterval + time.Minute
+}
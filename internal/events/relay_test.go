@@ -0,0 +1,169 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	ws_manager "github.com/EO-DataHub/eodhp-workspace-manager/models"
+	"github.com/EO-DataHub/eodhp-workspace-services/internal/requestid"
+	ws_services "github.com/EO-DataHub/eodhp-workspace-services/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type mockOutboxStore struct {
+	mock.Mock
+}
+
+func (m *mockOutboxStore) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]ws_services.OutboxEvent, error) {
+	args := m.Called(limit, lease)
+	return args.Get(0).([]ws_services.OutboxEvent), args.Error(1)
+}
+
+func (m *mockOutboxStore) MarkOutboxEventSent(ctx context.Context, id int64) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *mockOutboxStore) MarkOutboxEventFailed(ctx context.Context, id int64, errMsg string, nextAttempt time.Time, permanent bool) error {
+	args := m.Called(id, errMsg, nextAttempt, permanent)
+	return args.Error(0)
+}
+
+type mockPublisher struct {
+	mock.Mock
+	traces     []string
+	requestIDs []string
+}
+
+func (m *mockPublisher) Publish(ctx context.Context, event ws_manager.WorkspaceSettings) error {
+	m.traces = append(m.traces, trace.SpanContextFromContext(ctx).TraceID().String())
+	m.requestIDs = append(m.requestIDs, requestid.FromContext(ctx))
+	args := m.Called(event)
+	return args.Error(0)
+}
+
+func (m *mockPublisher) Close() {}
+
+func TestRelayPending(t *testing.T) {
+	store := new(mockOutboxStore)
+	publisher := new(mockPublisher)
+	relay := NewRelay(store, publisher, RelayConfig{BatchSize: 10, MaxBackoff: time.Minute})
+
+	store.On("ClaimOutboxEvents", 10, mock.Anything).Return([]ws_services.OutboxEvent{
+		{ID: 1, Aggregate: "ws-one", Payload: []byte(`{"name":"ws-one","status":"creating"}`),
+			TraceContext: map[string]string{
+				"traceparent":      "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+				requestid.Property: "req-123",
+			}},
+		{ID: 2, Aggregate: "ws-two", Payload: []byte(`{"name":"ws-two","status":"creating"}`), Attempts: 2},
+		{ID: 3, Aggregate: "ws-three", Payload: []byte(`not json`)},
+	}, nil).Once()
+
+	publisher.On("Publish", ws_manager.WorkspaceSettings{Name: "ws-one", Status: "creating"}).Return(nil).Once()
+	store.On("MarkOutboxEventSent", int64(1)).Return(nil).Once()
+
+	// A failed publish is retried after a backoff that grows with the number of attempts
+	before := time.Now()
+	publisher.On("Publish", ws_manager.WorkspaceSettings{Name: "ws-two", Status: "creating"}).Return(errors.New("pulsar unavailable")).Once()
+	store.On("MarkOutboxEventFailed", int64(2), "pulsar unavailable", mock.MatchedBy(func(next time.Time) bool {
+		return !next.Before(before.Add(4 * time.Second))
+	}), false).Return(nil).Once()
+
+	// Undecodable events are never retried
+	store.On("MarkOutboxEventFailed", int64(3), mock.Anything, mock.Anything, true).Return(nil).Once()
+
+	sent, err := relay.RelayPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+
+	// Events are published in the trace, and with the ID, of the request that queued them
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", publisher.traces[0])
+	assert.Equal(t, "req-123", publisher.requestIDs[0])
+
+	store.AssertExpectations(t)
+	publisher.AssertExpectations(t)
+}
+
+// blockingPublisher holds each publish until it is released, and records the order of publishes and closes.
+type blockingPublisher struct {
+	started chan struct{}
+	release chan struct{}
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (p *blockingPublisher) Publish(ctx context.Context, event ws_manager.WorkspaceSettings) error {
+	p.started <- struct{}{}
+	<-p.release
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	p.calls = append(p.calls, "publish "+event.Name)
+	return nil
+}
+
+func (p *blockingPublisher) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, "close")
+}
+
+func TestRelayStopDuringPublish(t *testing.T) {
+	store := new(mockOutboxStore)
+	publisher := &blockingPublisher{started: make(chan struct{}, 1), release: make(chan struct{})}
+	relay := NewRelay(store, publisher, RelayConfig{BatchSize: 10, PollInterval: time.Hour})
+
+	store.On("ClaimOutboxEvents", 10, mock.Anything).Return([]ws_services.OutboxEvent{
+		{ID: 1, Aggregate: "ws-one", Payload: []byte(`{"name":"ws-one","status":"creating"}`)},
+		{ID: 2, Aggregate: "ws-two", Payload: []byte(`{"name":"ws-two","status":"creating"}`)},
+	}, nil).Once()
+	store.On("MarkOutboxEventSent", int64(1)).Return(nil).Once()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wait := relay.Start(ctx)
+
+	// Stop the relay while the first event is being published
+	<-publisher.started
+	cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		t.Fatal("relay stopped while an event was being published")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(publisher.release)
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("relay did not stop")
+	}
+
+	// The event in flight is published and recorded before the publisher is closed, and the
+	// rest of the batch is left for the next run
+	assert.Equal(t, []string{"publish ws-one", "close"}, publisher.calls)
+	store.AssertExpectations(t)
+}
+
+func TestRelayBackoff(t *testing.T) {
+	relay := NewRelay(nil, nil, RelayConfig{MaxBackoff: 10 * time.Second})
+
+	assert.Equal(t, time.Second, relay.backoff(0))
+	assert.Equal(t, 4*time.Second, relay.backoff(2))
+	assert.Equal(t, 10*time.Second, relay.backoff(10))
+}
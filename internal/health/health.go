@@ -0,0 +1,134 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+
+	defaultCheckTimeout = 3 * time.Second
+	defaultCacheTTL     = 10 * time.Second
+)
+
+// Check is a single dependency check. Run must return once ctx is done.
+type Check struct {
+	Name    string
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
+// CheckResult is the outcome of a single check.
+type CheckResult struct {
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// Report is the combined outcome of all checks.
+type Report struct {
+	Status    string                 `json:"status"`
+	Checks    map[string]CheckResult `json:"checks"`
+	CheckedAt time.Time              `json:"checked_at"`
+}
+
+// Ready reports whether every check passed.
+func (r Report) Ready() bool {
+	return r.Status == StatusOK
+}
+
+// Checker runs a set of checks and caches the report, so that frequent probes do not put load
+// on the dependencies.
+type Checker struct {
+	checks   []Check
+	timeout  time.Duration
+	cacheTTL time.Duration
+
+	mu     sync.Mutex
+	report *Report
+}
+
+// NewChecker creates a checker. Checks without a timeout use timeout, and reports are reused for cacheTTL.
+func NewChecker(timeout, cacheTTL time.Duration, checks ...Check) *Checker {
+	if timeout <= 0 {
+		timeout = defaultCheckTimeout
+	}
+	if cacheTTL <= 0 {
+		cacheTTL = defaultCacheTTL
+	}
+	return &Checker{checks: checks, timeout: timeout, cacheTTL: cacheTTL}
+}
+
+// Report returns the cached report, running the checks again if it has expired. Concurrent
+// callers wait for a single run rather than starting their own.
+func (c *Checker) Report(ctx context.Context) Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.report != nil && time.Since(c.report.CheckedAt) < c.cacheTTL {
+		return *c.report
+	}
+
+	report := c.run(ctx)
+	c.report = &report
+	return report
+}
+
+func (c *Checker) run(ctx context.Context) Report {
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(c.checks)), CheckedAt: time.Now().UTC()}
+
+	results := make([]CheckResult, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.runCheck(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	for i, check := range c.checks {
+		report.Checks[check.Name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusUnavailable
+		}
+	}
+	return report
+}
+
+func (c *Checker) runCheck(ctx context.Context, check Check) CheckResult {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = c.timeout
+	}
+
+	// The probe's own context is not used, so that an impatient caller does not cache a failure
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- check.Run(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+
+	result := CheckResult{Status: StatusOK, DurationMs: time.Since(start).Milliseconds(), CheckedAt: start.UTC()}
+	if err != nil {
+		result.Status = StatusUnavailable
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,47 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckerReport(t *testing.T) {
+	var runs atomic.Int32
+
+	checker := NewChecker(50*time.Millisecond, time.Minute,
+		Check{Name: "ok", Run: func(ctx context.Context) error {
+			runs.Add(1)
+			return nil
+		}},
+		Check{Name: "failing", Run: func(ctx context.Context) error {
+			return errors.New("connection refused")
+		}},
+		Check{Name: "slow", Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+	)
+
+	report := checker.Report(context.Background())
+	assert.False(t, report.Ready())
+	assert.Equal(t, StatusOK, report.Checks["ok"].Status)
+	assert.Equal(t, "connection refused", report.Checks["failing"].Error)
+	assert.Equal(t, StatusUnavailable, report.Checks["slow"].Status)
+
+	// The report is cached until the TTL passes
+	checker.Report(context.Background())
+	assert.Equal(t, int32(1), runs.Load())
+}
+
+func TestCheckerReportReady(t *testing.T) {
+	checker := NewChecker(time.Second, time.Nanosecond, Check{Name: "ok", Run: func(ctx context.Context) error { return nil }})
+
+	report := checker.Report(context.Background())
+	assert.True(t, report.Ready())
+	assert.Equal(t, StatusOK, report.Status)
+}
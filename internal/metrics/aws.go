@@ -0,0 +1,25 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// AWSMiddleware records the latency and errors of AWS API calls, labelled by service and
+// operation. It is added to the deserialize step, which presigned requests never reach, so each
+// attempt sent to AWS is recorded and presigning is not.
+func AWSMiddleware(stack *middleware.Stack) error {
+	return stack.Deserialize.Add(middleware.DeserializeMiddlewareFunc("WorkspaceServicesMetrics",
+		func(ctx context.Context, in middleware.DeserializeInput, next middleware.DeserializeHandler) (
+			middleware.DeserializeOutput, middleware.Metadata, error) {
+
+			start := time.Now()
+			out, metadata, err := next.HandleDeserialize(ctx, in)
+			ObserveDependency(strings.ToLower(awsmiddleware.GetServiceID(ctx)), awsmiddleware.GetOperationName(ctx), start, err)
+			return out, metadata, err
+		}), middleware.Before)
+}
@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "workspace_services"
+
+// Dependencies whose calls are recorded.
+const (
+	DependencyKeycloak   = "keycloak"
+	DependencyBlockStore = "block-store"
+	DependencyPulsar     = "pulsar"
+)
+
+// Results of a recorded call.
+const (
+	ResultSuccess = "success"
+	ResultError   = "error"
+)
+
+// Caches whose lookups are recorded.
+const (
+	CacheUserGroups = "keycloak_user_groups"
+)
+
+var (
+	// HTTPRequestDuration records API request latency by route template, method and status code.
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by route template, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	// DependencyRequestDuration records the latency of calls to Keycloak, AWS, the block store and Pulsar.
+	DependencyRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "dependency_request_duration_seconds",
+		Help:      "Latency of calls to external dependencies by dependency, operation and result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"dependency", "operation", "result"})
+
+	// DependencyErrors counts failed calls to external dependencies.
+	DependencyErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dependency_errors_total",
+		Help:      "Failed calls to external dependencies by dependency and operation.",
+	}, []string{"dependency", "operation"})
+
+	// PulsarMessages counts messages published, acknowledged and negatively acknowledged.
+	PulsarMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pulsar_messages_total",
+		Help:      "Pulsar messages by operation (publish, ack, nack) and result.",
+	}, []string{"operation", "result"})
+
+	// RateLimited counts requests rejected by a rate limit, by route group and by whether the
+	// user's or the workspace's limit was exceeded.
+	RateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Requests rejected by a rate limit by route group and scope (user, workspace).",
+	}, []string{"group", "scope"})
+
+	// CacheLookups counts cache hits and misses.
+	CacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Cache lookups by cache and result (hit, miss).",
+	}, []string{"cache", "result"})
+)
+
+// ObserveDependency records the latency of a call to dependency that started at start, counting
+// it as an error if err is set.
+func ObserveDependency(dependency, operation string, start time.Time, err error) {
+	result := ResultSuccess
+	if err != nil {
+		result = ResultError
+		DependencyErrors.WithLabelValues(dependency, operation).Inc()
+	}
+	DependencyRequestDuration.WithLabelValues(dependency, operation, result).Observe(time.Since(start).Seconds())
+}
+
+// CountPulsarMessage records a Pulsar publish, ack or nack.
+func CountPulsarMessage(operation string, err error) {
+	result := ResultSuccess
+	if err != nil {
+		result = ResultError
+	}
+	PulsarMessages.WithLabelValues(operation, result).Inc()
+}
+
+// CountCacheLookup records a hit or miss of cache.
+func CountCacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	CacheLookups.WithLabelValues(cache, result).Inc()
+}
+
+// Handler serves the registered metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pruneInterval is how often buckets that have refilled are removed.
+const pruneInterval = time.Minute
+
+// MemoryStore holds buckets in the memory of a single replica.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]memoryBucket
+	pruned  time.Time
+	now     func() time.Time
+}
+
+type memoryBucket struct {
+	Bucket
+	fullAt time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]memoryBucket), now: time.Now}
+}
+
+// Take takes a token from the bucket of every key if each of them has one.
+func (s *MemoryStore) Take(_ context.Context, keys ...Key) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.prune(now)
+
+	updated := make([]Bucket, len(keys))
+	for i, key := range keys {
+		if key.Limit.Unlimited() {
+			continue
+		}
+
+		current, ok := s.buckets[key.Name]
+		if !ok {
+			current.Bucket = NewBucket(now, key.Limit)
+		}
+
+		bucket, result := current.Take(now, key.Limit)
+		if !result.Allowed {
+			result.Key = key.Name
+			return result, nil
+		}
+		updated[i] = bucket
+	}
+
+	for i, key := range keys {
+		if !key.Limit.Unlimited() {
+			s.buckets[key.Name] = memoryBucket{Bucket: updated[i], fullAt: updated[i].FullAt(key.Limit)}
+		}
+	}
+
+	return Result{Allowed: true}, nil
+}
+
+// prune removes buckets that have refilled, so that the store does not grow with every user
+// and workspace seen. The lock must be held.
+func (s *MemoryStore) prune(now time.Time) {
+	if now.Sub(s.pruned) < pruneInterval {
+		return
+	}
+	s.pruned = now
+
+	for key, bucket := range s.buckets {
+		if !bucket.fullAt.After(now) {
+			delete(s.buckets, key)
+		}
+	}
+}
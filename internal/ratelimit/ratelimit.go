@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit is a token bucket refilled at Rate tokens per second up to Burst tokens. Each request
+// takes one token. A zero Rate means no limit.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute returns a limit of requests per minute allowing bursts of burst requests. The
+// burst defaults to the number of requests per minute.
+func PerMinute(requests, burst int) Limit {
+	if requests <= 0 {
+		return Limit{}
+	}
+	if burst <= 0 {
+		burst = requests
+	}
+	return Limit{Rate: float64(requests) / 60, Burst: burst}
+}
+
+// Unlimited reports whether l does not restrict requests.
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0
+}
+
+// Key is a bucket that a request takes a token from.
+type Key struct {
+	Name  string
+	Limit Limit
+}
+
+// Result is the outcome of taking a token.
+type Result struct {
+	Allowed bool
+	// RetryAfter is how long until a token is available when the request is not allowed.
+	RetryAfter time.Duration
+	// Key is the name of the key that refused the request.
+	Key string
+}
+
+// Store holds the buckets of each key. Stores shared between replicas enforce the limit across
+// all of them.
+type Store interface {
+	// Take takes a token from the bucket of every key if each of them has one. Otherwise no
+	// token is taken, so a request refused by one limit does not count against the others.
+	Take(ctx context.Context, keys ...Key) (Result, error)
+}
+
+// Bucket is the state of a key's token bucket.
+type Bucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// NewBucket returns a full bucket for limit.
+func NewBucket(now time.Time, limit Limit) Bucket {
+	return Bucket{Tokens: float64(limit.Burst), Updated: now}
+}
+
+// Take refills b for the time since it was last updated and takes a token if one is available.
+// It returns the updated bucket and whether the request is allowed.
+func (b Bucket) Take(now time.Time, limit Limit) (Bucket, Result) {
+	if elapsed := now.Sub(b.Updated).Seconds(); elapsed > 0 {
+		b.Tokens = math.Min(float64(limit.Burst), b.Tokens+elapsed*limit.Rate)
+	}
+	b.Updated = now
+
+	if b.Tokens >= 1 {
+		b.Tokens--
+		return b, Result{Allowed: true}
+	}
+
+	wait := time.Duration((1 - b.Tokens) / limit.Rate * float64(time.Second))
+	return b, Result{RetryAfter: wait}
+}
+
+// FullAt returns when b will have refilled to the burst size of limit. A bucket that has not
+// been used since then can be forgotten, as a new bucket would be full.
+func (b Bucket) FullAt(limit Limit) time.Time {
+	missing := float64(limit.Burst) - b.Tokens
+	if missing <= 0 {
+		return b.Updated
+	}
+	return b.Updated.Add(time.Duration(missing / limit.Rate * float64(time.Second)))
+}
@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBucketTake(t *testing.T) {
+	limit := PerMinute(60, 2)
+	now := time.Now()
+	bucket := NewBucket(now, limit)
+
+	bucket, result := bucket.Take(now, limit)
+	assert.True(t, result.Allowed)
+	bucket, result = bucket.Take(now, limit)
+	assert.True(t, result.Allowed)
+
+	// The burst is used up and a token is refilled every second
+	bucket, result = bucket.Take(now.Add(250*time.Millisecond), limit)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 750*time.Millisecond, result.RetryAfter)
+
+	bucket, result = bucket.Take(now.Add(time.Second), limit)
+	assert.True(t, result.Allowed)
+
+	// Refilling stops at the burst size
+	assert.Equal(t, now.Add(3*time.Second), bucket.FullAt(limit))
+	bucket, _ = bucket.Take(now.Add(time.Hour), limit)
+	assert.InDelta(t, 1, bucket.Tokens, 1e-9)
+}
+
+func TestPerMinute(t *testing.T) {
+	assert.True(t, PerMinute(0, 10).Unlimited())
+	assert.Equal(t, Limit{Rate: 2, Burst: 120}, PerMinute(120, 0))
+	assert.Equal(t, Limit{Rate: 0.5, Burst: 5}, PerMinute(30, 5))
+}
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+	limit := PerMinute(60, 1)
+
+	result, err := store.Take(ctx, Key{Name: "user:alice", Limit: limit})
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	result, err = store.Take(ctx, Key{Name: "user:alice", Limit: limit})
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+	assert.Equal(t, "user:alice", result.Key)
+
+	// Keys have separate buckets
+	result, err = store.Take(ctx, Key{Name: "user:bob", Limit: limit})
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	// Unlimited keys are not stored
+	result, err = store.Take(ctx, Key{Name: "user:carol", Limit: Limit{}})
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Len(t, store.buckets, 2)
+
+	// Buckets that have refilled are pruned
+	now = now.Add(2 * pruneInterval)
+	result, err = store.Take(ctx, Key{Name: "user:bob", Limit: limit})
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Len(t, store.buckets, 1)
+}
+
+func TestMemoryStoreTakesFromAllKeysOrNone(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	user := Key{Name: "user:alice", Limit: PerMinute(60, 2)}
+	workspace := Key{Name: "workspace:ws-1", Limit: PerMinute(60, 1)}
+
+	result, err := store.Take(ctx, user, workspace)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	// The workspace refuses, so the user's token is not taken
+	result, err = store.Take(ctx, user, workspace)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, "workspace:ws-1", result.Key)
+
+	result, err = store.Take(ctx, user)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+}
@@ -0,0 +1,23 @@
+package requestid
+
+import (
+	"context"
+
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// AWSMiddleware forwards the request ID to AWS. The header is added in the deserialize step,
+// after the request has been signed, so it is never part of a signature and presigned URLs do
+// not require clients to send it.
+func AWSMiddleware(stack *middleware.Stack) error {
+	return stack.Deserialize.Add(middleware.DeserializeMiddlewareFunc("WorkspaceServicesRequestID",
+		func(ctx context.Context, in middleware.DeserializeInput, next middleware.DeserializeHandler) (
+			middleware.DeserializeOutput, middleware.Metadata, error) {
+
+			if req, ok := in.Request.(*smithyhttp.Request); ok {
+				InjectHTTP(ctx, req.Header)
+			}
+			return next.HandleDeserialize(ctx, in)
+		}), middleware.Before)
+}
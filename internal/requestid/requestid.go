@@ -0,0 +1,51 @@
+package requestid
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"github.com/google/uuid"
+)
+
+// Header carries the request ID on HTTP requests and responses.
+const Header = "X-Request-ID"
+
+// Property carries the request ID on Pulsar messages.
+const Property = "request_id"
+
+type contextKey struct{}
+
+// validID limits IDs accepted from callers to a length and alphabet that is safe to log and forward.
+var validID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// New generates a request ID.
+func New() string {
+	return uuid.NewString()
+}
+
+// Valid reports whether id can be accepted from a caller.
+func Valid(id string) bool {
+	return validID.MatchString(id)
+}
+
+// NewContext returns ctx carrying id. An empty id leaves ctx unchanged.
+func NewContext(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID carried by ctx, or an empty string.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// InjectHTTP adds the request ID carried by ctx to the headers of an outgoing request.
+func InjectHTTP(ctx context.Context, header http.Header) {
+	if id := FromContext(ctx); id != "" {
+		header.Set(Header, id)
+	}
+}
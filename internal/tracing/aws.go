@@ -0,0 +1,30 @@
+package tracing
+
+import (
+	"context"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AWSMiddleware starts a client span around each AWS API call, covering any retries. It is added
+// to the initialize step so that the span is in the context of every later step.
+func AWSMiddleware(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("WorkspaceServicesTracing",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (
+			out middleware.InitializeOutput, metadata middleware.Metadata, err error) {
+
+			service, operation := awsmiddleware.GetServiceID(ctx), awsmiddleware.GetOperationName(ctx)
+			ctx, span := Start(ctx, service+"."+operation, trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					attribute.String("rpc.system", "aws-api"),
+					attribute.String("rpc.service", service),
+					attribute.String("rpc.method", operation),
+				))
+			defer func() { End(span, err) }()
+
+			return next.HandleInitialize(ctx, in)
+		}), middleware.Before)
+}
@@ -18,4 +18,6 @@ type Account struct {
 	AccountOpeningReason *string                        `json:"accountOpeningReason"`
 	Status               string                         `json:"status"`
 	Workspaces           []ws_manager.WorkspaceSettings `json:"workspaces"`
+	// Version is incremented by every update and returned to clients as the ETag of the account.
+	Version int `json:"-"`
 }
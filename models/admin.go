@@ -0,0 +1,99 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AdminAccount is an account as listed for hub admins.
+type AdminAccount struct {
+	ID               uuid.UUID `json:"id"`
+	CreatedAt        time.Time `json:"createdAt"`
+	Name             string    `json:"name"`
+	AccountOwner     string    `json:"accountOwner"`
+	OrganizationName *string   `json:"organizationName"`
+	BillingAddress   string    `json:"billingAddress"`
+	// AccountOpeningReason is why the owner asked for the account, for deciding whether to approve it.
+	AccountOpeningReason *string `json:"accountOpeningReason"`
+	Status               string  `json:"status"`
+	// WorkspaceCount is the number of workspaces of the account that have not been deleted.
+	WorkspaceCount int `json:"workspaceCount"`
+}
+
+// AccountDecisionRequest is a hub admin's decision on a pending account.
+type AccountDecisionRequest struct {
+	// Decision is either "approve" or "deny".
+	Decision string `json:"decision"`
+	// Reason is shown to the account owner if the account is denied.
+	Reason string `json:"reason"`
+}
+
+// AccountDecision records who approved or denied an account, and why.
+type AccountDecision struct {
+	ID        uuid.UUID `json:"id"`
+	AccountID uuid.UUID `json:"accountId"`
+	// Status is the status the account was given, Approved or Denied.
+	Status    string    `json:"status"`
+	DecidedBy string    `json:"decidedBy"`
+	Reason    string    `json:"reason"`
+	DecidedAt time.Time `json:"decidedAt"`
+}
+
+// AccountStatusChangeRequest gives the reason a hub admin is changing the status of an account.
+type AccountStatusChangeRequest struct {
+	// Reason is shown to the account owner.
+	Reason string `json:"reason"`
+}
+
+// AccountStatusChange records a change to the status of an account, who made it and why.
+type AccountStatusChange struct {
+	ID         uuid.UUID `json:"id"`
+	AccountID  uuid.UUID `json:"accountId"`
+	FromStatus string    `json:"fromStatus"`
+	ToStatus   string    `json:"toStatus"`
+	ChangedBy  string    `json:"changedBy"`
+	Reason     string    `json:"reason"`
+	ChangedAt  time.Time `json:"changedAt"`
+}
+
+// AdminWorkspace is a workspace as listed for hub admins.
+type AdminWorkspace struct {
+	ID          uuid.UUID  `json:"id"`
+	Name        string     `json:"name"`
+	Account     uuid.UUID  `json:"account"`
+	AccountName string     `json:"account_name"`
+	Owner       string     `json:"owner"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUpdated time.Time  `json:"last_updated"`
+	SuspendedAt *time.Time `json:"suspended_at,omitempty"`
+	SuspendedBy *string    `json:"suspended_by,omitempty"`
+	// MemberCount is the number of members of the workspace's group, if it could be counted.
+	MemberCount *int `json:"member_count,omitempty"`
+}
+
+// AccountListOptions filters, orders and pages the accounts listed for hub admins. Empty
+// filters match every account.
+type AccountListOptions struct {
+	Status       string
+	Owner        string
+	Organization string
+	Sort         string
+	Descending   bool
+	Offset       int
+	Limit        int
+}
+
+// WorkspaceListOptions filters, orders and pages the workspaces listed for hub admins. Empty
+// filters match every workspace that has not been deleted.
+type WorkspaceListOptions struct {
+	Status        string
+	Account       *uuid.UUID
+	CreatedBefore *time.Time
+	CreatedAfter  *time.Time
+	Sort          string
+	Descending    bool
+	Offset        int
+	Limit         int
+}
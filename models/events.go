@@ -0,0 +1,16 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OutboxEvent is an event stored in the outbox table waiting to be published.
+type OutboxEvent struct {
+	ID           int64             `json:"id"`
+	Aggregate    string            `json:"aggregate"` // Name of the workspace the event belongs to
+	Payload      json.RawMessage   `json:"payload"`
+	TraceContext map[string]string `json:"trace_context"` // Trace context and ID of the request that queued the event
+	Attempts     int               `json:"attempts"`
+	CreatedAt    time.Time         `json:"created_at"`
+}
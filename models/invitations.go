@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WorkspaceInvitation is a pending invitation for the owner of an email address to join a
+// workspace.
+type WorkspaceInvitation struct {
+	ID        uuid.UUID `json:"id"`
+	Workspace string    `json:"workspace"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	InvitedBy string    `json:"invited_by"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// Token is only sent to the invitee.
+	Token string `json:"-"`
+}
+
+// WorkspaceInvitationRequest is a request to invite someone to a workspace.
+type WorkspaceInvitationRequest struct {
+	Email string `json:"email" example:"user@example.com"`
+	Role  string `json:"role,omitempty" example:"editor"`
+}
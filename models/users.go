@@ -7,6 +7,15 @@ type User struct {
 	FirstName string `json:"firstName"`
 	LastName  string `json:"lastName"`
 	Email     string `json:"email"`
+	// EmailVerified is whether the user has shown that they own their email address.
+	EmailVerified bool `json:"emailVerified,omitempty"`
+	// Role is the user's role in a workspace, when listed as a workspace member.
+	Role string `json:"role,omitempty"`
+}
+
+// WorkspaceUserRole is the role to give a user when adding them to a workspace.
+type WorkspaceUserRole struct {
+	Role string `json:"role" example:"editor"`
 }
 
 // Group represents a group in the system.
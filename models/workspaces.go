@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WorkspaceDeletion describes a workspace that has been scheduled for deletion
+type WorkspaceDeletion struct {
+	Workspace   string    `json:"workspace"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+}
+
+// WorkspaceCreationSaga records the progress of a workspace creation so that it can be
+// resumed or cleaned up if the process creating it stops part way through.
+type WorkspaceCreationSaga struct {
+	ID        uuid.UUID `json:"id"`
+	Workspace string    `json:"workspace"`
+	Account   uuid.UUID `json:"account"`
+	Owner     string    `json:"owner"`
+	OwnerID   string    `json:"owner_id"`
+	Step      string    `json:"step"`   // Last step that completed
+	Status    string    `json:"status"` // Running, Completed, Compensating, Compensated or Failed
+	Error     string    `json:"error"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}